@@ -1,31 +1,298 @@
 package main
 
 import (
+	"dicomviewer/dicom"
+	"dicomviewer/dimse"
 	"dicomviewer/http"
 	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
 )
 
+const defaultIndexPath = "/tmp/dicom-index/index.db"
+
+// storagePathEnv the environment variable specifying the directory DICOM
+// files are stored in, when not specified by flag
+const storagePathEnv = "DICOMVIEWER_STORAGE_PATH"
+
+// storage backends DICOM files may be stored in
+const (
+	storageLocal = "local"
+	storageS3    = "s3"
+)
+
+// commandReindex the command to rebuild the metadata index from the files in
+// the repository and exit
+const commandReindex = "reindex"
+
+// trashPurgeInterval the interval at which files in the trash longer than its
+// retention are purged
+const trashPurgeInterval = time.Hour
+
 type cliArgs struct {
+	command    string
 	serverPort string
+	dicomPort  string
+	aeTitle    string
+	indexPath  string
+	remoteAEs  []dimse.RemoteAE
+
+	pseudonymKey        string
+	redactTemplatesPath string
+	duplicatePolicy     string
+
+	storage        string
+	storagePath    string
+	fsync          bool
+	trashRetention time.Duration
+	s3Endpoint     string
+	s3Bucket       string
+	s3Region       string
+	s3Prefix       string
 }
 
 func parseCLIargs() cliArgs {
 	portPtr := flag.String("port", http.DefaultPort, "listen port for server")
+	dicomPortPtr := flag.String("dicom-port", "", "listen port for DIMSE services, disabled if empty")
+	aeTitlePtr := flag.String("ae-title", dimse.DefaultAETitle, "AE title of DIMSE services")
+	indexPathPtr := flag.String("index", defaultIndexPath, "path of the SQLite metadata index")
+	pseudonymKeyPtr := flag.String("pseudonym-key", "", "secret key remapping UIDs and IDs of anonymized files consistently across restarts, random if empty")
+	storagePtr := flag.String("storage", storageLocal, "storage backend of DICOM files, local or s3")
+	storagePathPtr := flag.String("storage-path", os.Getenv(storagePathEnv), "directory DICOM files are stored in, when -storage=local, defaults to $"+storagePathEnv+" or /tmp/dicom")
+	fsyncPtr := flag.Bool("fsync", false, "sync DICOM files to disk before acknowledging them, when -storage=local")
+	trashRetentionPtr := flag.Duration("trash-retention", 7*24*time.Hour, "time deleted DICOM files can be restored for before they are purged, deleted permanently if 0")
+	s3EndpointPtr := flag.String("s3-endpoint", "", "URL of the S3-compatible object store, e.g. http://localhost:9000, when -storage=s3")
+	s3BucketPtr := flag.String("s3-bucket", "", "bucket DICOM files are stored in, when -storage=s3")
+	s3RegionPtr := flag.String("s3-region", "us-east-1", "region of the bucket, when -storage=s3")
+	s3PrefixPtr := flag.String("s3-prefix", "", "prefix of the keys DICOM files are stored under, when -storage=s3")
+	duplicatePolicyPtr := flag.String("duplicate-policy", string(dicom.DuplicateKeepBoth), "policy applied to received files duplicating a stored file, by content or SOP Instance UID, one of reject, overwrite, keepBoth or keepNewest")
+	redactTemplatesPtr := flag.String("redact-templates", "", "path of a JSON file of burned in annotation regions by manufacturer and model, applied when redacting files")
+
+	var remoteAEs []dimse.RemoteAE
+	flag.Func("remote-ae", "known remote AE in the form AETITLE@host:port, C-MOVE destination, may be repeated", func(value string) error {
+		remoteAE, err := dimse.ParseRemoteAE(value)
+		if err != nil {
+			return err
+		}
+		remoteAEs = append(remoteAEs, remoteAE)
+		return nil
+	})
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [%s]\n", os.Args[0], commandReindex)
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 	return cliArgs{
+		command:    flag.Arg(0),
 		serverPort: *portPtr,
+		dicomPort:  *dicomPortPtr,
+		aeTitle:    *aeTitlePtr,
+		indexPath:  *indexPathPtr,
+		remoteAEs:  remoteAEs,
+
+		pseudonymKey:        *pseudonymKeyPtr,
+		redactTemplatesPath: *redactTemplatesPtr,
+		duplicatePolicy:     *duplicatePolicyPtr,
+
+		storage:        *storagePtr,
+		storagePath:    *storagePathPtr,
+		fsync:          *fsyncPtr,
+		trashRetention: *trashRetentionPtr,
+		s3Endpoint:     *s3EndpointPtr,
+		s3Bucket:       *s3BucketPtr,
+		s3Region:       *s3RegionPtr,
+		s3Prefix:       *s3PrefixPtr,
 	}
 }
 
 func main() {
 	args := parseCLIargs()
 
-	service := http.NewServer(
+	// the http and DIMSE services share a single repository and index, so
+	// that files received by either are available to both
+	metadataIndex, err := dicom.NewSQLiteIndex(args.indexPath)
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to open index %s: %s", args.indexPath, err))
+		os.Exit(1)
+	}
+
+	duplicatePolicy, err := dicom.ParseDuplicatePolicy(args.duplicatePolicy)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(2)
+	}
+
+	storageRepository, err := newStorageRepository(args)
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to configure %s storage: %s", args.storage, err))
+		os.Exit(2)
+	}
+
+	switch args.command {
+	case "":
+	case commandReindex:
+		if err := dicom.RebuildIndex(storageRepository, metadataIndex); err != nil {
+			slog.Error(fmt.Sprintf("failed to rebuild index: %s", err))
+			os.Exit(1)
+		}
+		slog.Info(fmt.Sprintf("rebuilt index %s", args.indexPath))
+		return
+	default:
+		slog.Error(fmt.Sprintf("unknown command %s", args.command))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// the index persists between runs, so is only built from the repository
+	// when empty, e.g. on first run
+	indexed, err := metadataIndex.List(dicom.ListQuery{Limit: 1})
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to read index %s: %s", args.indexPath, err))
+	} else if indexed.Total == 0 {
+		if err := dicom.RebuildIndex(storageRepository, metadataIndex); err != nil {
+			slog.Error(fmt.Sprintf("failed to index existing files: %s", err))
+		}
+	}
+
+	fileRepository := dicom.NewIndexedFileRepository(
+		storageRepository,
+		metadataIndex,
+	)
+
+	go purgeTrash(storageRepository)
+
+	if args.dicomPort != "" {
+		dimseService := dimse.NewServer(
+			dimse.UsePort(
+				args.dicomPort,
+			),
+			dimse.UseAETitle(
+				args.aeTitle,
+			),
+			dimse.UseFileRepository(
+				fileRepository,
+			),
+			dimse.UseMetadataIndex(
+				metadataIndex,
+			),
+			dimse.UseRemoteAEs(
+				args.remoteAEs...,
+			),
+			dimse.UseDuplicatePolicy(
+				duplicatePolicy,
+			),
+		)
+
+		go func() {
+			if err := dimseService.ListenAndServe(); err != nil {
+				slog.Error(fmt.Sprintf("DICOM server stopped: %s", err))
+			}
+		}()
+	}
+
+	// without a key, anonymized files are only consistent until restart
+	var pseudonymizer *dicom.Pseudonymizer
+	if args.pseudonymKey != "" {
+		pseudonymizer = dicom.NewPseudonymizer([]byte(args.pseudonymKey))
+	}
+
+	var redactTemplates []dicom.RedactTemplate
+	if args.redactTemplatesPath != "" {
+		redactTemplates, err = readRedactTemplates(args.redactTemplatesPath)
+		if err != nil {
+			slog.Error(fmt.Sprintf("failed to read redact templates %s: %s", args.redactTemplatesPath, err))
+			os.Exit(1)
+		}
+	}
+
+	service, err := http.NewServer(
 		http.UsePort(
 			args.serverPort,
 		),
+		http.UseFileRepository(
+			fileRepository,
+		),
+		http.UseMetadataIndex(
+			metadataIndex,
+		),
+		http.UsePseudonymizer(
+			pseudonymizer,
+		),
+		http.UseRedactTemplates(
+			redactTemplates...,
+		),
+		http.UseDuplicatePolicy(
+			duplicatePolicy,
+		),
 	)
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to construct server: %s", err))
+		os.Exit(1)
+	}
 
 	service.ListenAndServe()
 }
+
+// newStorageRepository utility to construct the repository of the storage
+// backend selected by the args. Credentials of S3 storage are read from the
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables
+func newStorageRepository(args cliArgs) (dicom.FileRepository, error) {
+	switch args.storage {
+	case storageLocal:
+		options := []func(opts *dicom.LocalFileOptions){
+			dicom.LocalFileSync(args.fsync),
+			dicom.LocalFileTrashRetention(args.trashRetention),
+		}
+		if args.storagePath != "" {
+			options = append(options, dicom.LocalFileRoot(args.storagePath))
+		}
+		return dicom.NewLocalFileAdapter(options...), nil
+	case storageS3:
+		return dicom.NewS3FileAdapter(
+			args.s3Endpoint,
+			args.s3Bucket,
+			dicom.S3Region(
+				args.s3Region,
+			),
+			dicom.S3Prefix(
+				args.s3Prefix,
+			),
+			dicom.S3TrashRetention(
+				args.trashRetention,
+			),
+			dicom.S3Credentials(
+				os.Getenv("AWS_ACCESS_KEY_ID"),
+				os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			),
+		)
+	default:
+		return nil, fmt.Errorf("unknown storage %s, must be %s or %s", args.storage, storageLocal, storageS3)
+	}
+}
+
+// purgeTrash utility to purge files in the trash longer than its retention
+// from the repository, now and then at every purge interval
+func purgeTrash(repository dicom.FileRepository) {
+	for {
+		if err := repository.PurgeTrash(); err != nil {
+			slog.Error(fmt.Sprintf("failed to purge trash: %s", err))
+		}
+		time.Sleep(trashPurgeInterval)
+	}
+}
+
+// readRedactTemplates utility to read burned in annotation templates from a
+// JSON file
+func readRedactTemplates(path string) ([]dicom.RedactTemplate, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return dicom.ParseRedactTemplates(file)
+}
@@ -0,0 +1,768 @@
+package dicom
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+	"github.com/suyashkumar/dicom/pkg/uid"
+)
+
+// anonymizeAction the action applied to an attribute when de-identifying a
+// dataset, as coded in PS3.15 Table E.1-1
+type anonymizeAction int
+
+const (
+	// anonymizeKeep (K) keep the attribute unchanged
+	anonymizeKeep anonymizeAction = iota
+	// anonymizeRemove (X) remove the attribute
+	anonymizeRemove
+	// anonymizeZero (Z) replace the value with an empty value
+	anonymizeZero
+	// anonymizeDummy (D) replace the value with a dummy value of the same VR
+	anonymizeDummy
+	// anonymizeRemapUID (U) replace UIDs with consistently remapped UIDs
+	anonymizeRemapUID
+	// anonymizeClean (C) replace identifying text within the value
+	anonymizeClean
+)
+
+// anonymizeOption a PS3.15 profile option that changes the action applied to
+// an attribute
+type anonymizeOption int
+
+const (
+	anonymizeNoOption anonymizeOption = iota
+	anonymizeLongitudinalDates
+	anonymizeDeviceIdentity
+	anonymizeDescriptors
+)
+
+// profileAttribute the action the Basic Profile applies to an attribute, and
+// the profile option, if any, that retains or cleans it instead
+type profileAttribute struct {
+	action anonymizeAction
+	option anonymizeOption
+}
+
+// Codes of the Basic Profile and its options, used to record how a dataset
+// was de-identified. See PS3.16 CID 7050
+const (
+	codeBasicProfile            = "113100"
+	codeCleanDescriptors        = "113105"
+	codeRetainLongitudinalDates = "113106"
+	codeRetainDeviceIdentity    = "113109"
+)
+
+// basicProfile the actions of the Basic Application Level Confidentiality
+// Profile for the attributes it lists, from PS3.15 Table E.1-1. Attributes
+// not listed are kept, other than private attributes, which are removed
+var basicProfile = map[tag.Tag]profileAttribute{
+	// patient identity and characteristics
+	tag.PatientName:                             {anonymizeZero, anonymizeNoOption},
+	tag.PatientID:                               {anonymizeDummy, anonymizeNoOption},
+	tag.IssuerOfPatientID:                       {anonymizeRemove, anonymizeNoOption},
+	tag.PatientBirthDate:                        {anonymizeZero, anonymizeNoOption},
+	tag.PatientBirthTime:                        {anonymizeRemove, anonymizeNoOption},
+	tag.PatientSex:                              {anonymizeZero, anonymizeNoOption},
+	tag.PatientSexNeutered:                      {anonymizeRemove, anonymizeNoOption},
+	tag.PatientAge:                              {anonymizeRemove, anonymizeNoOption},
+	tag.PatientSize:                             {anonymizeRemove, anonymizeNoOption},
+	tag.PatientWeight:                           {anonymizeRemove, anonymizeNoOption},
+	tag.PatientAddress:                          {anonymizeRemove, anonymizeNoOption},
+	tag.PatientTelephoneNumbers:                 {anonymizeRemove, anonymizeNoOption},
+	tag.PatientMotherBirthName:                  {anonymizeRemove, anonymizeNoOption},
+	tag.PatientBirthName:                        {anonymizeRemove, anonymizeNoOption},
+	tag.PatientReligiousPreference:              {anonymizeRemove, anonymizeNoOption},
+	tag.PatientComments:                         {anonymizeRemove, anonymizeDescriptors},
+	tag.PatientState:                            {anonymizeRemove, anonymizeDescriptors},
+	tag.PatientInsurancePlanCodeSequence:        {anonymizeRemove, anonymizeNoOption},
+	tag.PatientPrimaryLanguageCodeSequence:      {anonymizeRemove, anonymizeNoOption},
+	tag.OtherPatientIDs:                         {anonymizeRemove, anonymizeNoOption},
+	tag.OtherPatientIDsSequence:                 {anonymizeRemove, anonymizeNoOption},
+	tag.OtherPatientNames:                       {anonymizeRemove, anonymizeNoOption},
+	tag.ReferencedPatientSequence:               {anonymizeRemove, anonymizeNoOption},
+	tag.CountryOfResidence:                      {anonymizeRemove, anonymizeNoOption},
+	tag.EthnicGroup:                             {anonymizeRemove, anonymizeNoOption},
+	tag.Occupation:                              {anonymizeRemove, anonymizeDescriptors},
+	tag.MilitaryRank:                            {anonymizeRemove, anonymizeNoOption},
+	tag.BranchOfService:                         {anonymizeRemove, anonymizeNoOption},
+	tag.MedicalRecordLocator:                    {anonymizeRemove, anonymizeNoOption},
+	tag.MedicalAlerts:                           {anonymizeRemove, anonymizeNoOption},
+	tag.Allergies:                               {anonymizeRemove, anonymizeDescriptors},
+	tag.SmokingStatus:                           {anonymizeRemove, anonymizeNoOption},
+	tag.PregnancyStatus:                         {anonymizeRemove, anonymizeNoOption},
+	tag.LastMenstrualDate:                       {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.SpecialNeeds:                            {anonymizeRemove, anonymizeDescriptors},
+	tag.AdditionalPatientHistory:                {anonymizeRemove, anonymizeDescriptors},
+	tag.AdmissionID:                             {anonymizeRemove, anonymizeNoOption},
+	tag.AdmittingDate:                           {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.AdmittingTime:                           {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.AdmittingDiagnosesDescription:           {anonymizeRemove, anonymizeDescriptors},
+	tag.AdmittingDiagnosesCodeSequence:          {anonymizeRemove, anonymizeDescriptors},
+	tag.CurrentPatientLocation:                  {anonymizeRemove, anonymizeNoOption},
+	tag.ClinicalTrialSponsorName:                {anonymizeDummy, anonymizeNoOption},
+	tag.ClinicalTrialProtocolName:               {anonymizeZero, anonymizeDescriptors},
+	tag.ClinicalTrialSiteID:                     {anonymizeZero, anonymizeNoOption},
+	tag.ClinicalTrialSiteName:                   {anonymizeZero, anonymizeNoOption},
+	tag.ClinicalTrialSubjectID:                  {anonymizeDummy, anonymizeNoOption},
+	tag.ClinicalTrialSubjectReadingID:           {anonymizeDummy, anonymizeNoOption},
+	tag.ResponsiblePerson:                       {anonymizeRemove, anonymizeNoOption},
+	tag.ResponsibleOrganization:                 {anonymizeRemove, anonymizeNoOption},
+	tag.PatientIdentityRemoved:                  {anonymizeKeep, anonymizeNoOption},
+	tag.DeidentificationMethod:                  {anonymizeKeep, anonymizeNoOption},
+	tag.DeidentificationMethodCodeSequence:      {anonymizeKeep, anonymizeNoOption},
+	tag.LongitudinalTemporalInformationModified: {anonymizeKeep, anonymizeNoOption},
+
+	// study, request and procedure
+	tag.AccessionNumber:                          {anonymizeZero, anonymizeNoOption},
+	tag.StudyID:                                  {anonymizeZero, anonymizeNoOption},
+	tag.StudyDescription:                         {anonymizeRemove, anonymizeDescriptors},
+	tag.SeriesDescription:                        {anonymizeRemove, anonymizeDescriptors},
+	tag.ProtocolName:                             {anonymizeRemove, anonymizeDescriptors},
+	tag.ImageComments:                            {anonymizeRemove, anonymizeDescriptors},
+	tag.FrameComments:                            {anonymizeRemove, anonymizeDescriptors},
+	tag.DerivationDescription:                    {anonymizeRemove, anonymizeDescriptors},
+	tag.AcquisitionDeviceProcessingDescription:   {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.ContrastBolusAgent:                       {anonymizeDummy, anonymizeDescriptors},
+	tag.RequestedContrastAgent:                   {anonymizeRemove, anonymizeDescriptors},
+	tag.ReferencedStudySequence:                  {anonymizeRemove, anonymizeNoOption},
+	tag.ReferencedPerformedProcedureStepSequence: {anonymizeRemove, anonymizeNoOption},
+	tag.RequestAttributesSequence:                {anonymizeRemove, anonymizeNoOption},
+	tag.RequestedProcedureID:                     {anonymizeRemove, anonymizeNoOption},
+	tag.RequestedProcedureDescription:            {anonymizeRemove, anonymizeDescriptors},
+	tag.RequestingPhysician:                      {anonymizeRemove, anonymizeNoOption},
+	tag.RequestingService:                        {anonymizeRemove, anonymizeNoOption},
+	tag.PlacerOrderNumberImagingServiceRequest:   {anonymizeZero, anonymizeNoOption},
+	tag.FillerOrderNumberImagingServiceRequest:   {anonymizeZero, anonymizeNoOption},
+	tag.IssueDateOfImagingServiceRequest:         {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.IssueTimeOfImagingServiceRequest:         {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.PerformedProcedureStepID:                 {anonymizeRemove, anonymizeNoOption},
+	tag.PerformedProcedureStepDescription:        {anonymizeRemove, anonymizeDescriptors},
+	tag.PerformedLocation:                        {anonymizeRemove, anonymizeNoOption},
+	tag.ScheduledProcedureStepID:                 {anonymizeRemove, anonymizeNoOption},
+	tag.ScheduledProcedureStepDescription:        {anonymizeRemove, anonymizeDescriptors},
+	tag.ScheduledProcedureStepLocation:           {anonymizeRemove, anonymizeNoOption},
+	tag.ContentSequence:                          {anonymizeRemove, anonymizeNoOption},
+	tag.TextString:                               {anonymizeRemove, anonymizeNoOption},
+	tag.ModifiedAttributesSequence:               {anonymizeRemove, anonymizeNoOption},
+	tag.OriginalAttributesSequence:               {anonymizeRemove, anonymizeNoOption},
+	{Group: 0x0018, Element: 0x4000}:             {anonymizeRemove, anonymizeDescriptors}, // Acquisition Comments
+	{Group: 0x0032, Element: 0x1030}:             {anonymizeRemove, anonymizeDescriptors}, // Reason for Study
+	{Group: 0x0032, Element: 0x4000}:             {anonymizeRemove, anonymizeDescriptors}, // Study Comments
+	{Group: 0x4000, Element: 0x4000}:             {anonymizeRemove, anonymizeNoOption},    // Text Comments
+
+	// people and institutions
+	tag.InstitutionName:                              {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.InstitutionAddress:                           {anonymizeRemove, anonymizeNoOption},
+	tag.InstitutionCodeSequence:                      {anonymizeRemove, anonymizeNoOption},
+	tag.InstitutionalDepartmentName:                  {anonymizeRemove, anonymizeNoOption},
+	tag.ReferringPhysicianName:                       {anonymizeZero, anonymizeNoOption},
+	tag.ReferringPhysicianAddress:                    {anonymizeRemove, anonymizeNoOption},
+	tag.ReferringPhysicianTelephoneNumbers:           {anonymizeRemove, anonymizeNoOption},
+	tag.PhysiciansOfRecord:                           {anonymizeRemove, anonymizeNoOption},
+	tag.PerformingPhysicianName:                      {anonymizeRemove, anonymizeNoOption},
+	tag.PerformingPhysicianIdentificationSequence:    {anonymizeRemove, anonymizeNoOption},
+	tag.NameOfPhysiciansReadingStudy:                 {anonymizeRemove, anonymizeNoOption},
+	tag.PhysiciansReadingStudyIdentificationSequence: {anonymizeRemove, anonymizeNoOption},
+	tag.ScheduledPerformingPhysicianName:             {anonymizeRemove, anonymizeNoOption},
+	tag.OperatorsName:                                {anonymizeRemove, anonymizeNoOption},
+	tag.ContentCreatorName:                           {anonymizeZero, anonymizeNoOption},
+	tag.VerifyingObserverName:                        {anonymizeDummy, anonymizeNoOption},
+	tag.ReviewerName:                                 {anonymizeRemove, anonymizeNoOption},
+	tag.PersonName:                                   {anonymizeDummy, anonymizeNoOption},
+	tag.SourceApplicationEntityTitle:                 {anonymizeRemove, anonymizeNoOption},
+
+	// devices
+	tag.StationName:             {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.DeviceSerialNumber:      {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.DeviceUID:               {anonymizeRemapUID, anonymizeDeviceIdentity},
+	tag.DeviceDescription:       {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.DetectorID:              {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.GantryID:                {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.CassetteID:              {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.PlateID:                 {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.GeneratorID:             {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.SourceSerialNumber:      {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.PerformedStationAETitle: {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.PerformedStationName:    {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.ScheduledStationAETitle: {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.ScheduledStationName:    {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.DateOfLastCalibration:   {anonymizeRemove, anonymizeDeviceIdentity},
+	tag.TimeOfLastCalibration:   {anonymizeRemove, anonymizeDeviceIdentity},
+
+	// dates and times
+	tag.StudyDate:                        {anonymizeZero, anonymizeLongitudinalDates},
+	tag.StudyTime:                        {anonymizeZero, anonymizeLongitudinalDates},
+	tag.SeriesDate:                       {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.SeriesTime:                       {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.AcquisitionDate:                  {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.AcquisitionTime:                  {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.AcquisitionDateTime:              {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.ContentDate:                      {anonymizeZero, anonymizeLongitudinalDates},
+	tag.ContentTime:                      {anonymizeZero, anonymizeLongitudinalDates},
+	tag.InstanceCreationDate:             {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.InstanceCreationTime:             {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.InstanceCoercionDateTime:         {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.PerformedProcedureStepStartDate:  {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.PerformedProcedureStepStartTime:  {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.PerformedProcedureStepEndDate:    {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.PerformedProcedureStepEndTime:    {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.ScheduledProcedureStepStartDate:  {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.ScheduledProcedureStepStartTime:  {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.ScheduledProcedureStepEndDate:    {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.ScheduledProcedureStepEndTime:    {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.FrameAcquisitionDateTime:         {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.FrameReferenceDateTime:           {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.RadiopharmaceuticalStartTime:     {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.RadiopharmaceuticalStopTime:      {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.RadiopharmaceuticalStartDateTime: {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.RadiopharmaceuticalStopDateTime:  {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.ObservationDateTime:              {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.DateTime:                         {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.Date:                             {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.Time:                             {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.ExpiryDate:                       {anonymizeRemove, anonymizeLongitudinalDates},
+	tag.TimezoneOffsetFromUTC:            {anonymizeRemove, anonymizeLongitudinalDates},
+	{Group: 0x0008, Element: 0x0024}:     {anonymizeRemove, anonymizeLongitudinalDates}, // Overlay Date
+	{Group: 0x0008, Element: 0x0025}:     {anonymizeRemove, anonymizeLongitudinalDates}, // Curve Date
+	{Group: 0x0008, Element: 0x0034}:     {anonymizeRemove, anonymizeLongitudinalDates}, // Overlay Time
+	{Group: 0x0008, Element: 0x0035}:     {anonymizeRemove, anonymizeLongitudinalDates}, // Curve Time
+
+	// unique identifiers
+	tag.StudyInstanceUID:                   {anonymizeRemapUID, anonymizeNoOption},
+	tag.SeriesInstanceUID:                  {anonymizeRemapUID, anonymizeNoOption},
+	tag.SOPInstanceUID:                     {anonymizeRemapUID, anonymizeNoOption},
+	tag.MediaStorageSOPInstanceUID:         {anonymizeRemapUID, anonymizeNoOption},
+	tag.ReferencedSOPInstanceUID:           {anonymizeRemapUID, anonymizeNoOption},
+	tag.FrameOfReferenceUID:                {anonymizeRemapUID, anonymizeNoOption},
+	tag.ReferencedFrameOfReferenceUID:      {anonymizeRemapUID, anonymizeNoOption},
+	tag.RelatedFrameOfReferenceUID:         {anonymizeRemapUID, anonymizeNoOption},
+	tag.SynchronizationFrameOfReferenceUID: {anonymizeRemapUID, anonymizeNoOption},
+	tag.InstanceCreatorUID:                 {anonymizeRemapUID, anonymizeNoOption},
+	tag.IrradiationEventUID:                {anonymizeRemapUID, anonymizeNoOption},
+	tag.ConcatenationUID:                   {anonymizeRemapUID, anonymizeNoOption},
+	tag.DimensionOrganizationUID:           {anonymizeRemapUID, anonymizeNoOption},
+	tag.StorageMediaFileSetUID:             {anonymizeRemapUID, anonymizeNoOption},
+	tag.UID:                                {anonymizeRemapUID, anonymizeNoOption},
+}
+
+// pseudonymizedIDs the identifiers replaced with a pseudonym rather than a
+// fixed dummy value, so that the files of a patient or subject remain linked
+var pseudonymizedIDs = map[tag.Tag]bool{
+	tag.PatientID:                     true,
+	tag.ClinicalTrialSubjectID:        true,
+	tag.ClinicalTrialSubjectReadingID: true,
+}
+
+// AnonymizeOptions options for de-identifying a DICOM file with the Basic
+// Application Level Confidentiality Profile
+type AnonymizeOptions struct {
+	retainLongitudinalDates bool
+	retainDeviceIdentity    bool
+	cleanDescriptors        bool
+	pseudonymizer           *Pseudonymizer
+}
+
+// AnonymizeRetainLongitudinalDates option to keep the dates and times of the
+// study, series and acquisition, per the Retain Longitudinal Temporal
+// Information with Full Dates Option
+func AnonymizeRetainLongitudinalDates(retain bool) func(opts *AnonymizeOptions) {
+	return func(opts *AnonymizeOptions) {
+		opts.retainLongitudinalDates = retain
+	}
+}
+
+// AnonymizeRetainDeviceIdentity option to keep the attributes identifying the
+// device and institution that acquired the images, per the Retain Device
+// Identity Option
+func AnonymizeRetainDeviceIdentity(retain bool) func(opts *AnonymizeOptions) {
+	return func(opts *AnonymizeOptions) {
+		opts.retainDeviceIdentity = retain
+	}
+}
+
+// AnonymizeCleanDescriptors option to keep descriptions and comments with any
+// identifying values of the dataset redacted from them, rather than removing
+// them, per the Clean Descriptors Option
+func AnonymizeCleanDescriptors(clean bool) func(opts *AnonymizeOptions) {
+	return func(opts *AnonymizeOptions) {
+		opts.cleanDescriptors = clean
+	}
+}
+
+// AnonymizePseudonymizer option to derive replacement UIDs and identifiers
+// with the given pseudonymizer, so that they are consistent across files. By
+// default a pseudonymizer with a random key is used for each file
+func AnonymizePseudonymizer(pseudonymizer *Pseudonymizer) func(opts *AnonymizeOptions) {
+	return func(opts *AnonymizeOptions) {
+		opts.pseudonymizer = pseudonymizer
+	}
+}
+
+// Pseudonymizer derives replacement UIDs and identifiers from the originals,
+// keyed by a secret so that they cannot be reversed by guessing the originals.
+// The same original always maps to the same replacement for a given key
+type Pseudonymizer struct {
+	key []byte
+}
+
+// NewPseudonymizer construct a pseudonymizer keyed by the given secret
+func NewPseudonymizer(key []byte) *Pseudonymizer {
+	return &Pseudonymizer{key: key}
+}
+
+// NewRandomPseudonymizer construct a pseudonymizer keyed by a random secret
+func NewRandomPseudonymizer() (*Pseudonymizer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return NewPseudonymizer(key), nil
+}
+
+// UID remap a UID to a UID under the 2.25 root, derived from 128 bits of a
+// keyed hash of the original
+func (p *Pseudonymizer) UID(value string) string {
+	digest := p.digest("uid", value)
+	return "2.25." + new(big.Int).SetBytes(digest[:16]).String()
+}
+
+// ID remap an identifier, such as a patient ID, to 16 hex digits derived from
+// a keyed hash of the original
+func (p *Pseudonymizer) ID(value string) string {
+	digest := p.digest("id", value)
+	return strings.ToUpper(hex.EncodeToString(digest[:8]))
+}
+
+// digest utility to hash a value keyed by the secret, within a namespace so
+// that a UID and identifier of the same value are remapped independently
+func (p *Pseudonymizer) digest(namespace string, value string) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(namespace))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.TrimRight(value, " \x00")))
+	return mac.Sum(nil)
+}
+
+// Anonymize de-identifies the DICOM file with the Basic Application Level
+// Confidentiality Profile and any of its options, returning the de-identified
+// file with the given ID. Private attributes are removed and UIDs remapped,
+// and the file records the profile and options applied. Pixel data is kept
+// unchanged, so any identifying annotations burned into it remain. The
+// de-identified file is spooled to a temporary file, so must be closed
+func (d *File) Anonymize(id string, options ...func(opts *AnonymizeOptions)) (File, error) {
+	var opts AnonymizeOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	if opts.pseudonymizer == nil {
+		pseudonymizer, err := NewRandomPseudonymizer()
+		if err != nil {
+			return File{}, err
+		}
+		opts.pseudonymizer = pseudonymizer
+	}
+
+	// pixel data is read unprocessed, so that it is written back as is
+	dataSet, err := dicom.Parse(d.Raw(), d.size, nil, dicom.SkipProcessingPixelDataValue())
+	if err != nil {
+		return File{}, err
+	}
+
+	anonymizer := anonymizer{
+		opts:        opts,
+		identifiers: identifyingValues(dataSet),
+	}
+
+	elements, err := anonymizer.anonymize(dataSet.Elements)
+	if err != nil {
+		return File{}, err
+	}
+
+	elements, err = anonymizer.recordDeidentification(elements)
+	if err != nil {
+		return File{}, err
+	}
+
+	return spoolFile(id, func(w io.Writer) error {
+		if err := dicom.Write(w, dicom.Dataset{Elements: elements}, dicom.SkipVRVerification()); err != nil {
+			return fmt.Errorf("failed to write de-identified file: %w", err)
+		}
+		return nil
+	})
+}
+
+// anonymizer applies the Basic Profile, with its options, to the elements of
+// a dataset
+type anonymizer struct {
+	opts AnonymizeOptions
+
+	// identifiers a pattern matching identifying values of the dataset,
+	// redacted from descriptors when they are cleaned. Nil if there are none
+	identifiers *regexp.Regexp
+}
+
+// anonymize de-identifies the elements of a dataset or sequence item
+func (a anonymizer) anonymize(elements []*dicom.Element) ([]*dicom.Element, error) {
+	var anonymized []*dicom.Element
+	for _, element := range elements {
+		// private attributes, and the curves and overlay comments of retired
+		// repeating groups, are removed
+		if element.Tag.Group%2 == 1 ||
+			element.Tag.Group&0xff00 == 0x5000 ||
+			(element.Tag.Group&0xff00 == 0x6000 && element.Tag.Element == 0x4000) {
+			continue
+		}
+
+		// group lengths are recalculated when written
+		if element.Tag.Element == 0x0000 {
+			continue
+		}
+
+		element, err := a.anonymizeElement(element)
+		if err != nil {
+			return nil, err
+		}
+		if element != nil {
+			anonymized = append(anonymized, element)
+		}
+	}
+
+	return anonymized, nil
+}
+
+// anonymizeElement de-identifies a single element, returning nil if it is
+// removed
+func (a anonymizer) anonymizeElement(element *dicom.Element) (*dicom.Element, error) {
+	action := a.action(element)
+
+	switch action {
+	case anonymizeRemove:
+		return nil, nil
+	case anonymizeZero:
+		return replaceValue(element, emptyValue(element))
+	case anonymizeDummy:
+		return replaceValue(element, a.dummyValue(element))
+	}
+
+	if element.Value == nil {
+		return element, nil
+	}
+
+	switch element.Value.ValueType() {
+	case dicom.Sequences:
+		items, _ := element.Value.GetValue().([]*dicom.SequenceItemValue)
+		anonymizedItems := make([][]*dicom.Element, 0, len(items))
+		for _, item := range items {
+			itemElements, _ := item.GetValue().([]*dicom.Element)
+			anonymizedItem, err := a.anonymize(itemElements)
+			if err != nil {
+				return nil, err
+			}
+			if anonymizedItem == nil {
+				anonymizedItem = []*dicom.Element{}
+			}
+			anonymizedItems = append(anonymizedItems, anonymizedItem)
+		}
+		return replaceValue(element, anonymizedItems)
+	case dicom.Strings:
+		values, _ := element.Value.GetValue().([]string)
+		anonymizedValues := make([]string, len(values))
+		for idx, value := range values {
+			anonymizedValues[idx] = value
+			switch {
+			case action == anonymizeClean:
+				anonymizedValues[idx] = a.clean(value)
+			case elementVR(element) == "UI":
+				anonymizedValues[idx] = a.remapUID(value, action == anonymizeRemapUID)
+			}
+		}
+		return replaceValue(element, anonymizedValues)
+	}
+
+	return element, nil
+}
+
+// action determines the action to apply to an element, accounting for the
+// options of the profile
+func (a anonymizer) action(element *dicom.Element) anonymizeAction {
+	attribute, ok := basicProfile[element.Tag]
+	if !ok {
+		return anonymizeKeep
+	}
+
+	switch {
+	case attribute.option == anonymizeLongitudinalDates && a.opts.retainLongitudinalDates,
+		attribute.option == anonymizeDeviceIdentity && a.opts.retainDeviceIdentity:
+		return anonymizeKeep
+	case attribute.option == anonymizeDescriptors && a.opts.cleanDescriptors:
+		return anonymizeClean
+	default:
+		return attribute.action
+	}
+}
+
+// remapUID remaps a UID, unless it is a well-known UID defined by the
+// standard, such as a SOP class or transfer syntax. UIDs of attributes not
+// listed by the profile are remapped as they may embed identifying values
+func (a anonymizer) remapUID(value string, listed bool) string {
+	trimmed := strings.TrimRight(value, " \x00")
+	if trimmed == "" {
+		return value
+	}
+
+	if !listed {
+		if _, err := uid.Lookup(trimmed); err == nil || strings.HasPrefix(trimmed, "1.2.840.10008.") {
+			return value
+		}
+	}
+
+	return a.opts.pseudonymizer.UID(trimmed)
+}
+
+// clean redacts the identifying values of the dataset from a descriptor
+func (a anonymizer) clean(value string) string {
+	if a.identifiers == nil {
+		return value
+	}
+
+	return a.identifiers.ReplaceAllStringFunc(value, func(match string) string {
+		return strings.Repeat("*", len(match))
+	})
+}
+
+// dummyValue a dummy value of the VR of an element, or a pseudonym for the
+// pseudonymized identifiers
+func (a anonymizer) dummyValue(element *dicom.Element) interface{} {
+	switch elementVR(element) {
+	case "SQ":
+		return [][]*dicom.Element{}
+	case "US", "SS", "UL", "SL", "AT":
+		return []int{0}
+	case "FL", "FD":
+		return []float64{0}
+	case "DA":
+		return []string{"19000101"}
+	case "TM":
+		return []string{"000000.00"}
+	case "DT":
+		return []string{"19000101000000.000000"}
+	case "IS", "DS":
+		return []string{"0"}
+	case "AS":
+		return []string{"000D"}
+	case "UI":
+		return []string{a.opts.pseudonymizer.UID(firstElementString(element))}
+	case "LO", "SH":
+		if value := firstElementString(element); value != "" && pseudonymizedIDs[element.Tag] {
+			return []string{a.opts.pseudonymizer.ID(value)}
+		}
+		return []string{"ANONYMIZED"}
+	default:
+		return []string{"ANONYMIZED"}
+	}
+}
+
+// recordDeidentification adds the attributes recording that the dataset was
+// de-identified, and the profile and options applied, sorted by tag
+func (a anonymizer) recordDeidentification(elements []*dicom.Element) ([]*dicom.Element, error) {
+	codes := [][]string{{codeBasicProfile, "Basic Application Confidentiality Profile"}}
+	if a.opts.cleanDescriptors {
+		codes = append(codes, []string{codeCleanDescriptors, "Clean Descriptors Option"})
+	}
+	if a.opts.retainLongitudinalDates {
+		codes = append(codes, []string{codeRetainLongitudinalDates, "Retain Longitudinal Temporal Information Full Dates Option"})
+	}
+	if a.opts.retainDeviceIdentity {
+		codes = append(codes, []string{codeRetainDeviceIdentity, "Retain Device Identity Option"})
+	}
+
+	// each method is recorded as a separate value, as LO values are limited
+	// to 64 characters
+	methods := make([]string, 0, len(codes))
+	codeItems := make([][]*dicom.Element, 0, len(codes))
+	for _, code := range codes {
+		item, err := newElements(map[tag.Tag]interface{}{
+			tag.CodeValue:              []string{code[0]},
+			tag.CodingSchemeDesignator: []string{"DCM"},
+			tag.CodeMeaning:            []string{code[1]},
+		})
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, code[1])
+		codeItems = append(codeItems, item)
+	}
+
+	temporalInformation := "REMOVED"
+	if a.opts.retainLongitudinalDates {
+		temporalInformation = "UNMODIFIED"
+	}
+
+	records, err := newElements(map[tag.Tag]interface{}{
+		tag.PatientIdentityRemoved:                  []string{"YES"},
+		tag.DeidentificationMethod:                  methods,
+		tag.DeidentificationMethodCodeSequence:      codeItems,
+		tag.LongitudinalTemporalInformationModified: []string{temporalInformation},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceElements(elements, records), nil
+}
+
+// identifyingValues utility to build a pattern matching the identifying
+// values of a dataset, such as the components of the patient's name, that
+// may appear within its descriptors. Returns nil if there are none
+func identifyingValues(dataSet dicom.Dataset) *regexp.Regexp {
+	var values []string
+	for _, t := range []tag.Tag{
+		tag.PatientName,
+		tag.PatientID,
+		tag.OtherPatientIDs,
+		tag.OtherPatientNames,
+		tag.PatientBirthDate,
+		tag.PatientBirthName,
+		tag.PatientMotherBirthName,
+		tag.AccessionNumber,
+		tag.ReferringPhysicianName,
+		tag.PerformingPhysicianName,
+		tag.OperatorsName,
+		tag.InstitutionName,
+	} {
+		element, err := dataSet.FindElementByTag(t)
+		if err != nil {
+			continue
+		}
+
+		strs, _ := element.Value.GetValue().([]string)
+		for _, str := range strs {
+			// person names are matched by their individual components
+			for _, component := range strings.FieldsFunc(str, func(r rune) bool {
+				return r == '^' || r == '=' || r == '\\'
+			}) {
+				// very short components, such as initials, would redact too
+				// much unrelated text
+				if component = strings.TrimSpace(component); len(component) > 2 {
+					values = append(values, regexp.QuoteMeta(component))
+				}
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	// longer values are matched first, so that they are redacted whole
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	return regexp.MustCompile("(?i)" + strings.Join(values, "|"))
+}
+
+// replaceValue utility to copy an element with a new value
+func replaceValue(element *dicom.Element, data interface{}) (*dicom.Element, error) {
+	value, err := dicom.NewValue(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dicom.Element{
+		Tag:                    element.Tag,
+		ValueRepresentation:    element.ValueRepresentation,
+		RawValueRepresentation: element.RawValueRepresentation,
+		ValueLength:            element.ValueLength,
+		Value:                  value,
+	}, nil
+}
+
+// emptyValue utility to build an empty value of the type held by an element
+func emptyValue(element *dicom.Element) interface{} {
+	if element.Value == nil {
+		return []string{}
+	}
+
+	switch element.Value.ValueType() {
+	case dicom.Sequences:
+		return [][]*dicom.Element{}
+	case dicom.Ints:
+		return []int{}
+	case dicom.Floats:
+		return []float64{}
+	case dicom.Bytes:
+		return []byte{}
+	default:
+		return []string{}
+	}
+}
+
+// firstElementString utility to retrieve the first, trimmed string value of
+// an element. Returns an empty string if the element holds no strings
+func firstElementString(element *dicom.Element) string {
+	if element.Value == nil {
+		return ""
+	}
+
+	values, ok := element.Value.GetValue().([]string)
+	if !ok || len(values) == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(values[0])
+}
+
+// replaceElements utility to merge replacement elements into the elements of
+// a dataset, replacing any elements with the same tag, sorted by tag
+func replaceElements(elements []*dicom.Element, replacements []*dicom.Element) []*dicom.Element {
+	replaced := make(map[tag.Tag]bool, len(replacements))
+	merged := make([]*dicom.Element, 0, len(elements)+len(replacements))
+	for _, replacement := range replacements {
+		replaced[replacement.Tag] = true
+		merged = append(merged, replacement)
+	}
+	for _, element := range elements {
+		if !replaced[element.Tag] {
+			merged = append(merged, element)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Tag.Compare(merged[j].Tag) < 0
+	})
+
+	return merged
+}
+
+// newElements utility to construct elements with the given values, sorted by
+// tag
+func newElements(values map[tag.Tag]interface{}) ([]*dicom.Element, error) {
+	elements := make([]*dicom.Element, 0, len(values))
+	for t, value := range values {
+		element, err := dicom.NewElement(t, value)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i].Tag.Compare(elements[j].Tag) < 0
+	})
+
+	return elements, nil
+}
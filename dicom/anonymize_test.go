@@ -0,0 +1,191 @@
+package dicom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_File_Anonymize(t *testing.T) {
+	privateCreator := tag.Tag{Group: 0x0009, Element: 0x0010}
+	privateTag := tag.Tag{Group: 0x0009, Element: 0x1001}
+
+	newFile := func(t *testing.T) *File {
+		return newTestFile(t,
+			mustNewElement(tag.SOPInstanceUID, []string{"1.2.3.4.5"}),
+			mustNewElement(tag.SOPClassUID, []string{"1.2.840.10008.5.1.4.1.1.7"}),
+			mustNewElement(tag.StudyDate, []string{"20240102"}),
+			mustNewElement(tag.SeriesDate, []string{"20240102"}),
+			mustNewElement(tag.Modality, []string{"OT"}),
+			mustNewElement(tag.InstitutionName, []string{"General Hospital"}),
+			mustNewElement(tag.StationName, []string{"SCANNER1"}),
+			mustNewElement(tag.StudyDescription, []string{"CHEST for DOE JOHN"}),
+			mustNewElement(tag.ReferencedSeriesSequence, [][]*dicom.Element{{
+				mustNewElement(tag.SeriesInstanceUID, []string{"1.2.3.4.6"}),
+				mustNewElement(tag.OperatorsName, []string{"SMITH^JANE"}),
+			}}),
+			&dicom.Element{
+				Tag:                    privateCreator,
+				RawValueRepresentation: "LO",
+				Value:                  mustNewValue([]string{"ACME"}),
+			},
+			&dicom.Element{
+				Tag:                    privateTag,
+				RawValueRepresentation: "LO",
+				Value:                  mustNewValue([]string{"secret"}),
+			},
+			mustNewElement(tag.PatientName, []string{"DOE^JOHN"}),
+			mustNewElement(tag.PatientID, []string{"P1"}),
+			mustNewElement(tag.PatientBirthDate, []string{"19700101"}),
+			mustNewElement(tag.PatientAge, []string{"054Y"}),
+			mustNewElement(tag.StudyInstanceUID, []string{"1.2.3.4"}),
+			mustNewElement(tag.SeriesInstanceUID, []string{"1.2.3.4.6"}),
+			mustNewElement(tag.FrameOfReferenceUID, []string{"1.2.3.4.7"}),
+		)
+	}
+
+	pseudonymizer := NewPseudonymizer([]byte("key"))
+
+	type args struct {
+		options []func(opts *AnonymizeOptions)
+	}
+	tests := []struct {
+		name string
+		args args
+		want map[string][]string
+	}{
+		{
+			name: "applies the basic profile",
+			args: args{},
+			want: map[string][]string{
+				"(0002,0003)":                {pseudonymizer.UID("1.2.3")},
+				"(0008,0016)":                {"1.2.840.10008.5.1.4.1.1.7"},
+				"(0008,0018)":                {pseudonymizer.UID("1.2.3.4.5")},
+				"(0008,0020)":                {},
+				"(0008,0021)":                nil,
+				"(0008,0060)":                {"OT"},
+				"(0008,0080)":                nil,
+				"(0008,1010)":                nil,
+				"(0008,1030)":                nil,
+				"(0008,1115)[0].(0020,000e)": {pseudonymizer.UID("1.2.3.4.6")},
+				"(0008,1115)[0].(0008,1070)": nil,
+				"(0009,0010)":                nil,
+				"(0009,1001)":                nil,
+				"(0010,0010)":                {},
+				"(0010,0020)":                {pseudonymizer.ID("P1")},
+				"(0010,0030)":                {},
+				"(0010,1010)":                nil,
+				"(0012,0062)":                {"YES"},
+				"(0020,000d)":                {pseudonymizer.UID("1.2.3.4")},
+				"(0020,000e)":                {pseudonymizer.UID("1.2.3.4.6")},
+				"(0020,0052)":                {pseudonymizer.UID("1.2.3.4.7")},
+				"(0028,0303)":                {"REMOVED"},
+			},
+		},
+		{
+			name: "retains longitudinal dates",
+			args: args{
+				options: []func(opts *AnonymizeOptions){
+					AnonymizeRetainLongitudinalDates(true),
+				},
+			},
+			want: map[string][]string{
+				"(0008,0020)": {"20240102"},
+				"(0008,0021)": {"20240102"},
+				"(0010,0030)": {},
+				"(0028,0303)": {"UNMODIFIED"},
+			},
+		},
+		{
+			name: "retains device identity",
+			args: args{
+				options: []func(opts *AnonymizeOptions){
+					AnonymizeRetainDeviceIdentity(true),
+				},
+			},
+			want: map[string][]string{
+				"(0008,0080)": {"General Hospital"},
+				"(0008,1010)": {"SCANNER1"},
+			},
+		},
+		{
+			name: "cleans descriptors",
+			args: args{
+				options: []func(opts *AnonymizeOptions){
+					AnonymizeCleanDescriptors(true),
+				},
+			},
+			want: map[string][]string{
+				"(0008,1030)": {"CHEST for *** ****"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := newFile(t)
+
+			options := append([]func(opts *AnonymizeOptions){AnonymizePseudonymizer(pseudonymizer)}, tt.args.options...)
+			anonymized, err := file.Anonymize("anonymized", options...)
+			if err != nil {
+				t.Fatalf("File.Anonymize() error = %v", err)
+			}
+			defer anonymized.Close()
+			if anonymized.ID != "anonymized" {
+				t.Errorf("File.Anonymize() id = %v, want anonymized", anonymized.ID)
+			}
+
+			var paths []ElementPath
+			for key := range tt.want {
+				path, err := ParseElementPath(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				paths = append(paths, path)
+			}
+
+			elements, err := anonymized.FindElements(paths...)
+			if err != nil {
+				t.Fatalf("File.FindElements() error = %v", err)
+			}
+
+			for key, want := range tt.want {
+				element := elements[key]
+				if element == nil {
+					if want != nil {
+						t.Errorf("File.Anonymize() %s removed, want %v", key, want)
+					}
+					continue
+				}
+
+				// values are compared as encoded, so that an empty value and
+				// no values are equivalent
+				values, _ := element.Value.GetValue().([]string)
+				got := strings.TrimRight(strings.Join(values, "\\"), " \x00")
+				if want == nil || got != strings.Join(want, "\\") {
+					t.Errorf("File.Anonymize() %s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_Pseudonymizer(t *testing.T) {
+	pseudonymizer := NewPseudonymizer([]byte("key"))
+
+	uid := pseudonymizer.UID("1.2.3")
+	if uid != pseudonymizer.UID("1.2.3") {
+		t.Errorf("Pseudonymizer.UID() is not consistent")
+	}
+	if uid == pseudonymizer.UID("1.2.4") || uid == NewPseudonymizer([]byte("other")).UID("1.2.3") {
+		t.Errorf("Pseudonymizer.UID() collides")
+	}
+	if !strings.HasPrefix(uid, "2.25.") || len(uid) > 64 {
+		t.Errorf("Pseudonymizer.UID() = %v, want a 2.25 UID of at most 64 characters", uid)
+	}
+
+	if id := pseudonymizer.ID("P1"); len(id) != 16 || id != pseudonymizer.ID("P1 ") {
+		t.Errorf("Pseudonymizer.ID() = %v, want 16 consistent hex digits", id)
+	}
+}
@@ -0,0 +1,365 @@
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/frame"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// Photometric interpretations as defined by the Photometric Interpretation
+// (0028,0004) attribute. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part03/sect_C.7.6.3.html#sect_C.7.6.3.1.2
+const (
+	photometricMonochrome1  = "MONOCHROME1"
+	photometricMonochrome2  = "MONOCHROME2"
+	photometricRGB          = "RGB"
+	photometricYBRFull      = "YBR_FULL"
+	photometricYBRFull422   = "YBR_FULL_422"
+	photometricPaletteColor = "PALETTE COLOR"
+)
+
+// planarConfigurationPlanar the Planar Configuration (0028,0006) value
+// indicating samples are stored colour-by-plane rather than colour-by-pixel
+const planarConfigurationPlanar = 1
+
+var (
+	// ErrUnsupportedPhotometricInterpretation error indicating the photometric
+	// interpretation of the DICOM file cannot be rendered
+	ErrUnsupportedPhotometricInterpretation = errors.New("unsupported photometric interpretation")
+)
+
+// datasetPhotometricInterpretation utility to read the Photometric
+// Interpretation attribute of the dataset, defaulting to MONOCHROME2
+func datasetPhotometricInterpretation(dataset dicom.Dataset) string {
+	photometric := firstString(dataset, tag.PhotometricInterpretation)
+	if photometric == "" {
+		return photometricMonochrome2
+	}
+
+	return photometric
+}
+
+// isColor utility to determine if the dataset holds colour pixel data
+func isColor(dataset dicom.Dataset) bool {
+	switch datasetPhotometricInterpretation(dataset) {
+	case photometricMonochrome1, photometricMonochrome2:
+		return false
+	case photometricPaletteColor:
+		return true
+	default:
+		return firstInt(dataset, tag.SamplesPerPixel, 1) >= 3
+	}
+}
+
+// generateColorFrameImage utility to generate an 8-bit RGBA image from a
+// single frame of colour pixel data
+func generateColorFrameImage(
+	dataset dicom.Dataset,
+	nativeFrame *frame.NativeFrame,
+) (*image.RGBA, error) {
+	photometric := datasetPhotometricInterpretation(dataset)
+
+	if photometric == photometricPaletteColor {
+		palette, err := datasetPalette(dataset)
+		if err != nil {
+			return nil, err
+		}
+		return generatePaletteFrameImage(nativeFrame, palette), nil
+	}
+
+	var toRGB func(a, b, c uint8) color.RGBA
+	switch photometric {
+	case photometricRGB:
+		toRGB = func(r, g, b uint8) color.RGBA {
+			return color.RGBA{R: r, G: g, B: b, A: 0xff}
+		}
+	case photometricYBRFull, photometricYBRFull422:
+		// YBR_FULL uses the same full-range conversion as JFIF
+		toRGB = func(y, cb, cr uint8) color.RGBA {
+			r, g, b := color.YCbCrToRGB(y, cb, cr)
+			return color.RGBA{R: r, G: g, B: b, A: 0xff}
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPhotometricInterpretation, photometric)
+	}
+
+	pixelCount := nativeFrame.Rows * nativeFrame.Cols
+	samples := flattenSamples(nativeFrame)
+	if len(samples) < pixelCount*3 {
+		return nil, errors.New("frame does not contain enough samples for a colour image")
+	}
+
+	// sample offsets of the first, second and third channel of a pixel
+	sampleIndex := func(pixel int, channel int) int {
+		return pixel*3 + channel
+	}
+	if firstInt(dataset, tag.PlanarConfiguration, 0) == planarConfigurationPlanar {
+		sampleIndex = func(pixel int, channel int) int {
+			return channel*pixelCount + pixel
+		}
+	}
+
+	// scale samples of more than 8 bits down to 8 bits
+	shift := 0
+	if nativeFrame.BitsPerSample > 8 {
+		shift = nativeFrame.BitsPerSample - 8
+	}
+
+	outImage := image.NewRGBA(
+		image.Rect(
+			0,
+			0,
+			nativeFrame.Cols,
+			nativeFrame.Rows,
+		),
+	)
+
+	for idx := 0; idx < pixelCount; idx++ {
+		outImage.SetRGBA(
+			idx%nativeFrame.Cols,
+			idx/nativeFrame.Cols,
+			toRGB(
+				uint8(samples[sampleIndex(idx, 0)]>>shift),
+				uint8(samples[sampleIndex(idx, 1)]>>shift),
+				uint8(samples[sampleIndex(idx, 2)]>>shift),
+			),
+		)
+	}
+
+	return outImage, nil
+}
+
+// flattenSamples utility to flatten the samples of every pixel of a frame into
+// a single slice, in the order they were stored
+func flattenSamples(nativeFrame *frame.NativeFrame) []int {
+	var samples []int
+	for _, pixel := range nativeFrame.Data {
+		samples = append(samples, pixel...)
+	}
+
+	return samples
+}
+
+// palette red, green and blue LUTs of a PALETTE COLOR image
+type palette struct {
+	red   lookupTable
+	green lookupTable
+	blue  lookupTable
+}
+
+// generatePaletteFrameImage utility to generate an 8-bit RGBA image from a
+// single frame of PALETTE COLOR pixel data
+func generatePaletteFrameImage(
+	nativeFrame *frame.NativeFrame,
+	palette palette,
+) *image.RGBA {
+	outImage := image.NewRGBA(
+		image.Rect(
+			0,
+			0,
+			nativeFrame.Cols,
+			nativeFrame.Rows,
+		),
+	)
+
+	// scale LUT entries of more than 8 bits down to 8 bits
+	scale := func(lut lookupTable, value float64) uint8 {
+		entry := lut.lookup(value)
+		if lut.bitsPerEntry > 8 {
+			entry >>= lut.bitsPerEntry - 8
+		}
+		return uint8(entry)
+	}
+
+	for idx := 0; idx < len(nativeFrame.Data); idx++ {
+		pixelValue := 0
+		if len(nativeFrame.Data[idx]) > 0 {
+			pixelValue = nativeFrame.Data[idx][0]
+		}
+
+		outImage.SetRGBA(
+			idx%nativeFrame.Cols,
+			idx/nativeFrame.Cols,
+			color.RGBA{
+				R: scale(palette.red, float64(pixelValue)),
+				G: scale(palette.green, float64(pixelValue)),
+				B: scale(palette.blue, float64(pixelValue)),
+				A: 0xff,
+			},
+		)
+	}
+
+	return outImage
+}
+
+// datasetPalette utility to read the red, green and blue palette colour LUTs
+// of the dataset. Both standard and segmented LUT data are supported
+func datasetPalette(dataset dicom.Dataset) (palette, error) {
+	red, err := datasetPaletteLUT(
+		dataset,
+		tag.RedPaletteColorLookupTableDescriptor,
+		tag.RedPaletteColorLookupTableData,
+		tag.SegmentedRedPaletteColorLookupTableData,
+	)
+	if err != nil {
+		return palette{}, err
+	}
+
+	green, err := datasetPaletteLUT(
+		dataset,
+		tag.GreenPaletteColorLookupTableDescriptor,
+		tag.GreenPaletteColorLookupTableData,
+		tag.SegmentedGreenPaletteColorLookupTableData,
+	)
+	if err != nil {
+		return palette{}, err
+	}
+
+	blue, err := datasetPaletteLUT(
+		dataset,
+		tag.BluePaletteColorLookupTableDescriptor,
+		tag.BluePaletteColorLookupTableData,
+		tag.SegmentedBluePaletteColorLookupTableData,
+	)
+	if err != nil {
+		return palette{}, err
+	}
+
+	return palette{
+		red:   red,
+		green: green,
+		blue:  blue,
+	}, nil
+}
+
+// datasetPaletteLUT utility to read a single palette colour LUT of the dataset
+func datasetPaletteLUT(
+	dataset dicom.Dataset,
+	descriptorTag tag.Tag,
+	dataTag tag.Tag,
+	segmentedDataTag tag.Tag,
+) (lookupTable, error) {
+	descriptorElement, err := dataset.FindElementByTag(descriptorTag)
+	if err != nil {
+		return lookupTable{}, err
+	}
+	descriptor, ok := descriptorElement.Value.GetValue().([]int)
+	if !ok || len(descriptor) < 3 {
+		return lookupTable{}, errors.New("malformed palette colour LUT descriptor")
+	}
+
+	if dataElement, err := dataset.FindElementByTag(dataTag); err == nil {
+		return newLookupTable(descriptor, parseLUTData(dataElement.Value))
+	}
+
+	dataElement, err := dataset.FindElementByTag(segmentedDataTag)
+	if err != nil {
+		return lookupTable{}, err
+	}
+	data, err := expandSegmentedLUTData(parseLUTData(dataElement.Value))
+	if err != nil {
+		return lookupTable{}, err
+	}
+
+	return newLookupTable(descriptor, data)
+}
+
+// Segment types of segmented palette colour LUT data. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part03/sect_C.7.9.2.html
+const (
+	segmentTypeDiscrete = 0
+	segmentTypeLinear   = 1
+	segmentTypeIndirect = 2
+)
+
+// expandSegmentedLUTData utility to expand segmented palette colour LUT data
+// into a regular LUT. Indirect segments are not supported
+func expandSegmentedLUTData(segments []int) ([]int, error) {
+	var data []int
+	for idx := 0; idx+1 < len(segments); {
+		segmentType := segments[idx]
+		length := segments[idx+1]
+		idx += 2
+
+		switch segmentType {
+		case segmentTypeDiscrete:
+			if idx+length > len(segments) {
+				return nil, errors.New("malformed discrete LUT segment")
+			}
+			data = append(data, segments[idx:idx+length]...)
+			idx += length
+		case segmentTypeLinear:
+			if idx >= len(segments) || len(data) == 0 {
+				return nil, errors.New("malformed linear LUT segment")
+			}
+			start := data[len(data)-1]
+			end := segments[idx]
+			for step := 1; step <= length; step++ {
+				data = append(data, start+(end-start)*step/length)
+			}
+			idx++
+		case segmentTypeIndirect:
+			return nil, errors.New("indirect LUT segments are not supported")
+		default:
+			return nil, fmt.Errorf("unknown LUT segment type %d", segmentType)
+		}
+	}
+
+	return data, nil
+}
+
+// expandYBRFull422Frames utility to convert raw YBR_FULL_422 pixel data into
+// native frames of interleaved YBR_FULL samples. The underlying DICOM parser
+// expects three samples per pixel and so fails to split YBR_FULL_422 data,
+// which stores two luminance samples per pair of chrominance samples, into
+// frames, leaving the raw pixel data in a single frame
+func expandYBRFull422Frames(
+	dataset dicom.Dataset,
+	pixelDataInfo dicom.PixelDataInfo,
+) ([]*frame.Frame, error) {
+	if len(pixelDataInfo.Frames) != 1 {
+		return nil, errors.New("malformed YBR_FULL_422 pixel data")
+	}
+
+	rows := firstInt(dataset, tag.Rows, 0)
+	cols := firstInt(dataset, tag.Columns, 0)
+	raw := pixelDataInfo.Frames[0].EncapsulatedData.Data
+
+	// each pair of pixels is stored as Y1 Y2 Cb Cr
+	frameSize := rows * cols * 2
+	if frameSize == 0 || cols%2 != 0 || firstInt(dataset, tag.BitsAllocated, 0) != 8 {
+		return nil, errors.New("unsupported YBR_FULL_422 pixel data")
+	}
+
+	var frames []*frame.Frame
+	for offset := 0; offset+frameSize <= len(raw); offset += frameSize {
+		frameData := raw[offset : offset+frameSize]
+
+		data := make([][]int, rows*cols)
+		for pair := 0; pair < rows*cols/2; pair++ {
+			y1 := int(frameData[pair*4])
+			y2 := int(frameData[pair*4+1])
+			cb := int(frameData[pair*4+2])
+			cr := int(frameData[pair*4+3])
+
+			data[pair*2] = []int{y1, cb, cr}
+			data[pair*2+1] = []int{y2, cb, cr}
+		}
+
+		frames = append(frames, &frame.Frame{
+			NativeData: frame.NativeFrame{
+				Data:          data,
+				Rows:          rows,
+				Cols:          cols,
+				BitsPerSample: 8,
+			},
+		})
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,58 @@
+package dicom
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_expandSegmentedLUTData(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []int
+		want     []int
+		wantErr  bool
+	}{
+		{
+			name:     "returns no data for no segments",
+			segments: []int{},
+			want:     nil,
+		},
+		{
+			name:     "expands discrete segment",
+			segments: []int{0, 3, 10, 20, 30},
+			want:     []int{10, 20, 30},
+		},
+		{
+			name:     "expands linear segment from end of previous segment",
+			segments: []int{0, 1, 0, 1, 4, 100},
+			want:     []int{0, 25, 50, 75, 100},
+		},
+		{
+			name:     "errors for linear segment without previous segment",
+			segments: []int{1, 4, 100},
+			wantErr:  true,
+		},
+		{
+			name:     "errors for truncated discrete segment",
+			segments: []int{0, 3, 10},
+			wantErr:  true,
+		},
+		{
+			name:     "errors for indirect segment",
+			segments: []int{0, 1, 0, 2, 1, 0, 0},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandSegmentedLUTData(tt.segments)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandSegmentedLUTData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandSegmentedLUTData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
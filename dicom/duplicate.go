@@ -0,0 +1,307 @@
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// DuplicatePolicy the policy applied when a file being ingested duplicates a
+// file already stored
+type DuplicatePolicy string
+
+const (
+	// DuplicateReject reject the file, keeping the stored file
+	DuplicateReject DuplicatePolicy = "reject"
+
+	// DuplicateOverwrite replace the stored file with the file, keeping the ID
+	// of the stored file
+	DuplicateOverwrite DuplicatePolicy = "overwrite"
+
+	// DuplicateKeepBoth store the file alongside the stored file, with its own
+	// ID
+	DuplicateKeepBoth DuplicatePolicy = "keepBoth"
+
+	// DuplicateKeepNewest replace the stored file with the file if it is at
+	// least as new, by Instance Creation or Content Date and Time, otherwise
+	// keep the stored file
+	DuplicateKeepNewest DuplicatePolicy = "keepNewest"
+)
+
+// duplicatePolicies every duplicate policy
+var duplicatePolicies = []DuplicatePolicy{
+	DuplicateReject,
+	DuplicateOverwrite,
+	DuplicateKeepBoth,
+	DuplicateKeepNewest,
+}
+
+// DuplicateMatch how a file was found to duplicate a stored file
+type DuplicateMatch string
+
+const (
+	// DuplicateMatchContentHash the files have identical contents
+	DuplicateMatchContentHash DuplicateMatch = "contentHash"
+
+	// DuplicateMatchSOPInstanceUID the files hold the same instance, but
+	// their contents differ
+	DuplicateMatchSOPInstanceUID DuplicateMatch = "sopInstanceUid"
+)
+
+var (
+	// ErrDuplicateFile error indicating a file was rejected as it duplicates a
+	// stored file
+	ErrDuplicateFile = errors.New("file duplicates a stored file")
+)
+
+// Duplicate a stored file duplicated by a file being ingested, and the policy
+// applied to it
+type Duplicate struct {
+	FileID string          `json:"fileId"`
+	Match  DuplicateMatch  `json:"match"`
+	Policy DuplicatePolicy `json:"policy"`
+}
+
+// IngestResult the outcome of ingesting a file
+type IngestResult struct {
+	// FileID the ID the file was stored with or, if it was not stored, the ID
+	// of the stored file it duplicates
+	FileID string
+
+	// Stored whether the file was stored
+	Stored bool
+
+	// Duplicate the stored file the file duplicates, if any
+	Duplicate *Duplicate
+}
+
+// ParseDuplicatePolicy parse a duplicate policy by name
+func ParseDuplicatePolicy(value string) (DuplicatePolicy, error) {
+	for _, policy := range duplicatePolicies {
+		if string(policy) == value {
+			return policy, nil
+		}
+	}
+
+	names := make([]string, len(duplicatePolicies))
+	for idx, policy := range duplicatePolicies {
+		names[idx] = string(policy)
+	}
+
+	return "", fmt.Errorf("unknown duplicate policy %s, must be one of %s", value, strings.Join(names, ", "))
+}
+
+// IngestFile utility to create a file in the repository, applying the policy
+// if it duplicates a file in the index. Files duplicate the most recently
+// created file with identical contents or, failing that, with the same SOP
+// Instance UID. Files with identical contents are never stored in place of
+// one another, as they already are. Files that are rejected are returned with
+// ErrDuplicateFile
+func IngestFile(
+	repository FileRepository,
+	index MetadataIndex,
+	file File,
+	policy DuplicatePolicy,
+) (IngestResult, error) {
+	return ingestFile(repository, index, file, policy, false)
+}
+
+// UpdateFile utility to replace the contents of the file with the ID of the
+// file in the repository, as IngestFile. The file keeps its ID, so is stored
+// whatever the policy, unless rejected as a duplicate of another file
+func UpdateFile(
+	repository FileRepository,
+	index MetadataIndex,
+	file File,
+	policy DuplicatePolicy,
+) (IngestResult, error) {
+	return ingestFile(repository, index, file, policy, true)
+}
+
+// ingestFile utility to create or, if update is set, replace a file in the
+// repository, applying the policy if it duplicates another file
+func ingestFile(
+	repository FileRepository,
+	index MetadataIndex,
+	file File,
+	policy DuplicatePolicy,
+	update bool,
+) (IngestResult, error) {
+	if _, err := ParseDuplicatePolicy(string(policy)); err != nil {
+		return IngestResult{}, err
+	}
+
+	metadata, err := NewInstanceMetadata(&file)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	// files with identical contents hold the same instance, so serialising
+	// the ingest of each instance prevents concurrent duplicates both being
+	// stored. Files without a SOP Instance UID are identified by their
+	// contents
+	key := metadata.SOPInstanceUID
+	if key == "" {
+		key = metadata.ContentHash
+	}
+	unlock := ingestLocks.lock(key)
+	defer unlock()
+
+	existing, match, err := findDuplicate(index, metadata)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	result := IngestResult{FileID: file.ID}
+	if existing != nil {
+		result.FileID = existing.FileID
+		result.Duplicate = &Duplicate{
+			FileID: existing.FileID,
+			Match:  match,
+			Policy: policy,
+		}
+
+		switch {
+		case policy == DuplicateReject:
+			return result, fmt.Errorf("%w %s", ErrDuplicateFile, existing.FileID)
+		case policy == DuplicateKeepBoth || update:
+			result.FileID = file.ID
+		case match == DuplicateMatchContentHash:
+			return result, nil
+		case policy == DuplicateKeepNewest && !isNewerInstance(metadata.Attributes, existing.Attributes):
+			return result, nil
+		default:
+			file.ID = existing.FileID
+		}
+	}
+
+	// the metadata already read is indexed, rather than read again
+	metadata.FileID = file.ID
+	if indexed, ok := repository.(*indexedFileRepository); ok {
+		err = indexed.create(file, metadata)
+	} else {
+		err = repository.Create(file)
+	}
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	result.Stored = true
+	return result, nil
+}
+
+// ingestLocks the locks serialising the ingest of files holding the same
+// instance
+var ingestLocks = keyedMutex{locks: make(map[string]*keyedLock)}
+
+// keyedMutex a set of mutual exclusion locks by key, each held only while
+// locked or awaited
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock the lock of a key, and the number of callers holding or awaiting
+// it
+type keyedLock struct {
+	sync.Mutex
+	references int
+}
+
+// lock locks the key, returning a function to unlock it
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		m.locks[key] = l
+	}
+	l.references++
+	m.mu.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		m.mu.Lock()
+		l.references--
+		if l.references == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// findDuplicate utility to find the most recently created file in the index
+// the instance duplicates, by content hash or SOP Instance UID, if any
+func findDuplicate(index MetadataIndex, metadata InstanceMetadata) (*InstanceMetadata, DuplicateMatch, error) {
+	// mostRecent the most recently created of the instances, other than the
+	// instance itself
+	mostRecent := func(instances []InstanceMetadata) *InstanceMetadata {
+		var found *InstanceMetadata
+		for idx, instance := range instances {
+			if instance.FileID != metadata.FileID && (found == nil || instance.Created.After(found.Created)) {
+				found = &instances[idx]
+			}
+		}
+		return found
+	}
+
+	instances, err := index.FindByContentHash(metadata.ContentHash)
+	if err != nil {
+		return nil, "", err
+	}
+	if found := mostRecent(instances); found != nil {
+		return found, DuplicateMatchContentHash, nil
+	}
+
+	// an empty UID would match every instance
+	if metadata.SOPInstanceUID == "" {
+		return nil, "", nil
+	}
+
+	instances, err = index.Find(InstanceUIDs{SOPInstanceUID: metadata.SOPInstanceUID})
+	if err != nil {
+		return nil, "", err
+	}
+	if found := mostRecent(instances); found != nil {
+		return found, DuplicateMatchSOPInstanceUID, nil
+	}
+
+	return nil, "", nil
+}
+
+// isNewerInstance utility to determine whether an instance is at least as
+// new as another, by when they were created. Instances are considered newer
+// unless both record when they were created
+func isNewerInstance(attributes JSONDataset, other JSONDataset) bool {
+	created, otherCreated := instanceTimestamp(attributes), instanceTimestamp(other)
+
+	return created == "" || otherCreated == "" || created >= otherCreated
+}
+
+// instanceTimestamp utility to determine when an instance was created, from
+// its Instance Creation or otherwise Content Date and Time, as a string which
+// sorts chronologically, or empty if unknown
+func instanceTimestamp(attributes JSONDataset) string {
+	for _, tags := range [][2]tag.Tag{
+		{tag.InstanceCreationDate, tag.InstanceCreationTime},
+		{tag.ContentDate, tag.ContentTime},
+	} {
+		date := FirstJSONString(attributes, tags[0])
+		if date == "" {
+			continue
+		}
+
+		// trailing components of times may be omitted, so times are padded
+		// to microseconds
+		digits := strings.NewReplacer(".", "", ":", "").Replace(FirstJSONString(attributes, tags[1]))
+		return date + digits + strings.Repeat("0", max(12-len(digits), 0))
+	}
+
+	return ""
+}
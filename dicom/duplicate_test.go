@@ -0,0 +1,298 @@
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_IngestFile(t *testing.T) {
+	// newFile test helper to encode an instance created at the date
+	newFile := func(t *testing.T, id string, sopInstanceUID string, creationDate string) File {
+		file := newTestFile(t,
+			mustNewElement(tag.SOPInstanceUID, []string{sopInstanceUID}),
+			mustNewElement(tag.StudyInstanceUID, []string{"1.2"}),
+			mustNewElement(tag.SeriesInstanceUID, []string{"1.2.1"}),
+			mustNewElement(tag.InstanceCreationDate, []string{creationDate}),
+		)
+		file.ID = id
+		return *file
+	}
+
+	tests := []struct {
+		name        string
+		file        func(t *testing.T) File
+		policy      DuplicatePolicy
+		want        IngestResult
+		wantErr     error
+		wantIndexed []string
+	}{
+		{
+			name: "stores files without duplicates",
+			file: func(t *testing.T) File {
+				return newFile(t, "new", "1.2.1.2", "20240101")
+			},
+			policy:      DuplicateReject,
+			want:        IngestResult{FileID: "new", Stored: true},
+			wantIndexed: []string{"existing", "new"},
+		},
+		{
+			name: "rejects duplicates",
+			file: func(t *testing.T) File {
+				return newFile(t, "new", "1.2.1.1", "20240101")
+			},
+			policy: DuplicateReject,
+			want: IngestResult{
+				FileID:    "existing",
+				Duplicate: &Duplicate{FileID: "existing", Match: DuplicateMatchContentHash, Policy: DuplicateReject},
+			},
+			wantErr:     ErrDuplicateFile,
+			wantIndexed: []string{"existing"},
+		},
+		{
+			name: "keeps both duplicates",
+			file: func(t *testing.T) File {
+				return newFile(t, "new", "1.2.1.1", "20240101")
+			},
+			policy: DuplicateKeepBoth,
+			want: IngestResult{
+				FileID:    "new",
+				Stored:    true,
+				Duplicate: &Duplicate{FileID: "existing", Match: DuplicateMatchContentHash, Policy: DuplicateKeepBoth},
+			},
+			wantIndexed: []string{"existing", "new"},
+		},
+		{
+			name: "overwrites instances with different contents",
+			file: func(t *testing.T) File {
+				return newFile(t, "new", "1.2.1.1", "20230101")
+			},
+			policy: DuplicateOverwrite,
+			want: IngestResult{
+				FileID:    "existing",
+				Stored:    true,
+				Duplicate: &Duplicate{FileID: "existing", Match: DuplicateMatchSOPInstanceUID, Policy: DuplicateOverwrite},
+			},
+			wantIndexed: []string{"existing"},
+		},
+		{
+			name: "does not overwrite identical contents",
+			file: func(t *testing.T) File {
+				return newFile(t, "new", "1.2.1.1", "20240101")
+			},
+			policy: DuplicateOverwrite,
+			want: IngestResult{
+				FileID:    "existing",
+				Duplicate: &Duplicate{FileID: "existing", Match: DuplicateMatchContentHash, Policy: DuplicateOverwrite},
+			},
+			wantIndexed: []string{"existing"},
+		},
+		{
+			name: "keeps newer stored instances",
+			file: func(t *testing.T) File {
+				return newFile(t, "new", "1.2.1.1", "20230101")
+			},
+			policy: DuplicateKeepNewest,
+			want: IngestResult{
+				FileID:    "existing",
+				Duplicate: &Duplicate{FileID: "existing", Match: DuplicateMatchSOPInstanceUID, Policy: DuplicateKeepNewest},
+			},
+			wantIndexed: []string{"existing"},
+		},
+		{
+			name: "replaces older stored instances",
+			file: func(t *testing.T) File {
+				return newFile(t, "new", "1.2.1.1", "20250101")
+			},
+			policy: DuplicateKeepNewest,
+			want: IngestResult{
+				FileID:    "existing",
+				Stored:    true,
+				Duplicate: &Duplicate{FileID: "existing", Match: DuplicateMatchSOPInstanceUID, Policy: DuplicateKeepNewest},
+			},
+			wantIndexed: []string{"existing"},
+		},
+		{
+			name: "fails for unknown policies",
+			file: func(t *testing.T) File {
+				return newFile(t, "new", "1.2.1.2", "20240101")
+			},
+			policy:      DuplicatePolicy("ignore"),
+			wantErr:     errors.New("unknown duplicate policy"),
+			wantIndexed: []string{"existing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := NewMemoryIndex()
+			repository := NewIndexedFileRepository(NewLocalFileAdapter(LocalFileRoot(t.TempDir())), index)
+			if err := repository.Create(newFile(t, "existing", "1.2.1.1", "20240101")); err != nil {
+				t.Fatal(err)
+			}
+
+			file := tt.file(t)
+			got, err := IngestFile(repository, index, file, tt.policy)
+			if (err != nil) != (tt.wantErr != nil) || (errors.Is(tt.wantErr, ErrDuplicateFile) && !errors.Is(err, ErrDuplicateFile)) {
+				t.Fatalf("IngestFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IngestFile() = %+v, want %+v", got, tt.want)
+			}
+
+			var indexed []string
+			instances, _ := index.Find(InstanceUIDs{})
+			for _, instance := range instances {
+				indexed = append(indexed, instance.FileID)
+			}
+			if !reflect.DeepEqual(indexed, tt.wantIndexed) {
+				t.Errorf("IngestFile() indexed = %v, want %v", indexed, tt.wantIndexed)
+			}
+
+			// files stored in place of another replace its contents
+			if got.Stored && got.FileID != file.ID {
+				instances, _ := index.Find(InstanceUIDs{})
+				wantHash, _ := file.ContentHash()
+				if instances[0].ContentHash != wantHash {
+					t.Errorf("IngestFile() did not replace the contents of %s", got.FileID)
+				}
+			}
+		})
+	}
+}
+
+func Test_UpdateFile(t *testing.T) {
+	// newFile test helper to encode an instance created at the date
+	newFile := func(t *testing.T, id string, sopInstanceUID string, creationDate string) File {
+		file := newTestFile(t,
+			mustNewElement(tag.SOPInstanceUID, []string{sopInstanceUID}),
+			mustNewElement(tag.StudyInstanceUID, []string{"1.2"}),
+			mustNewElement(tag.SeriesInstanceUID, []string{"1.2.1"}),
+			mustNewElement(tag.InstanceCreationDate, []string{creationDate}),
+		)
+		file.ID = id
+		return *file
+	}
+
+	tests := []struct {
+		name    string
+		file    File
+		policy  DuplicatePolicy
+		want    IngestResult
+		wantErr error
+	}{
+		{
+			name:   "replaces a file with another instance",
+			file:   newFile(t, "other", "1.2.1.3", "20240101"),
+			policy: DuplicateReject,
+			want:   IngestResult{FileID: "other", Stored: true},
+		},
+		{
+			name:   "replaces a file with a new version of its instance",
+			file:   newFile(t, "existing", "1.2.1.1", "20230101"),
+			policy: DuplicateReject,
+			want:   IngestResult{FileID: "existing", Stored: true},
+		},
+		{
+			name:   "rejects duplicates of another file",
+			file:   newFile(t, "other", "1.2.1.1", "20240101"),
+			policy: DuplicateReject,
+			want: IngestResult{
+				FileID:    "existing",
+				Duplicate: &Duplicate{FileID: "existing", Match: DuplicateMatchContentHash, Policy: DuplicateReject},
+			},
+			wantErr: ErrDuplicateFile,
+		},
+		{
+			name:   "keeps the ID of the file replaced whatever the policy",
+			file:   newFile(t, "other", "1.2.1.1", "20240101"),
+			policy: DuplicateOverwrite,
+			want: IngestResult{
+				FileID:    "other",
+				Stored:    true,
+				Duplicate: &Duplicate{FileID: "existing", Match: DuplicateMatchContentHash, Policy: DuplicateOverwrite},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := NewMemoryIndex()
+			repository := NewIndexedFileRepository(NewLocalFileAdapter(LocalFileRoot(t.TempDir())), index)
+			for _, file := range []File{
+				newFile(t, "existing", "1.2.1.1", "20240101"),
+				newFile(t, "other", "1.2.1.2", "20240101"),
+			} {
+				if err := repository.Create(file); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := UpdateFile(repository, index, tt.file, tt.policy)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UpdateFile() = %+v, want %+v", got, tt.want)
+			}
+
+			// the contents of the file are replaced only if it was stored
+			instances, _ := index.Find(InstanceUIDs{})
+			if len(instances) != 2 {
+				t.Fatalf("UpdateFile() indexed %d instances, want 2", len(instances))
+			}
+			wantHash, _ := tt.file.ContentHash()
+			for _, instance := range instances {
+				replaced := instance.ContentHash == wantHash
+				if instance.FileID == tt.file.ID && replaced != got.Stored {
+					t.Errorf("UpdateFile() replaced contents of %s = %v, want %v", tt.file.ID, replaced, got.Stored)
+				}
+			}
+		})
+	}
+}
+
+func Test_IngestFile_concurrent(t *testing.T) {
+	for _, policy := range []DuplicatePolicy{DuplicateReject, DuplicateKeepNewest} {
+		t.Run(string(policy), func(t *testing.T) {
+			index := NewMemoryIndex()
+			repository := NewIndexedFileRepository(NewLocalFileAdapter(LocalFileRoot(t.TempDir())), index)
+
+			// copies of an instance, differing in when they were created
+			var files []File
+			for idx := 0; idx < 8; idx++ {
+				file := newTestFile(t,
+					mustNewElement(tag.SOPInstanceUID, []string{"1.2.1.1"}),
+					mustNewElement(tag.StudyInstanceUID, []string{"1.2"}),
+					mustNewElement(tag.SeriesInstanceUID, []string{"1.2.1"}),
+					mustNewElement(tag.InstanceCreationDate, []string{fmt.Sprintf("2024010%d", idx+1)}),
+				)
+				file.ID = fmt.Sprintf("file-%d", idx)
+				files = append(files, *file)
+			}
+
+			// the files are ingested at once, once every goroutine is ready
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			for _, file := range files {
+				wg.Add(1)
+				go func(file File) {
+					defer wg.Done()
+					<-start
+					if _, err := IngestFile(repository, index, file, policy); err != nil && !errors.Is(err, ErrDuplicateFile) {
+						t.Errorf("IngestFile() error = %v", err)
+					}
+				}(file)
+			}
+			close(start)
+			wg.Wait()
+
+			instances, _ := index.Find(InstanceUIDs{})
+			if len(instances) != 1 {
+				t.Errorf("IngestFile() indexed %d instances, want 1", len(instances))
+			}
+		})
+	}
+}
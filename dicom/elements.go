@@ -0,0 +1,143 @@
+package dicom
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// ElementQuery a query to search the elements of a DICOM file, filtered by
+// group and keyword. Empty filters match any element
+type ElementQuery struct {
+	// Group the group of the elements to return, any group if nil
+	Group *uint16
+
+	// Keyword a pattern matched case-insensitively against the dictionary
+	// keywords of elements, in which '*' matches any sequence of characters
+	// and '?' matches a single character
+	Keyword string
+
+	// IncludeBulkData whether to return elements holding bulk data, such as
+	// pixel data
+	IncludeBulkData bool
+
+	// Depth the number of levels of sequences to search the items of
+	Depth int
+
+	Limit  int
+	Offset int
+}
+
+// matches determines whether an element passes the filters of the query
+func (q ElementQuery) matches(element *dicom.Element) bool {
+	if q.Group != nil && element.Tag.Group != *q.Group {
+		return false
+	}
+
+	if q.Keyword != "" {
+		info, err := tag.Find(element.Tag)
+		if err != nil {
+			return false
+		}
+		if !matchWildcard(strings.ToLower(info.Name), strings.ToLower(q.Keyword)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SearchElements retrieves a page of a lookup of the elements matching the
+// query by their path, along with the total number of matching elements.
+// Elements are ordered by path, with the elements of sequence items keyed by
+// the path of their sequence and item, e.g. (0008,1115)[0].(0020,000e). The
+// items of sequences are returned empty, their elements being returned
+// separately if within the query depth
+func (d *File) SearchElements(query ElementQuery) (DICOMElementsLookup, int, error) {
+	// the header holds every element other than pixel data, so the pixel data
+	// need only be read if bulk data is requested
+	dataSet, err := d.Header()
+	if query.IncludeBulkData {
+		dataSet, err = d.DataSet()
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	type match struct {
+		path    string
+		element *dicom.Element
+	}
+
+	var matches []match
+	var searchElements func(elements []*dicom.Element, prefix string, depth int)
+	searchElements = func(elements []*dicom.Element, prefix string, depth int) {
+		for _, element := range elements {
+			if !query.IncludeBulkData && isBulkData(element) {
+				continue
+			}
+
+			path := prefix + element.Tag.String()
+			if element.Value == nil || element.Value.ValueType() != dicom.Sequences {
+				if query.matches(element) {
+					matches = append(matches, match{path: path, element: element})
+				}
+				continue
+			}
+
+			items, _ := element.Value.GetValue().([]*dicom.SequenceItemValue)
+			if query.matches(element) {
+				matches = append(matches, match{path: path, element: emptySequence(element, len(items))})
+			}
+
+			if depth >= query.Depth {
+				continue
+			}
+			for idx, item := range items {
+				itemElements, _ := item.GetValue().([]*dicom.Element)
+				searchElements(itemElements, fmt.Sprintf("%s[%d].", path, idx), depth+1)
+			}
+		}
+	}
+	searchElements(dataSet.Elements, "", 0)
+
+	total := len(matches)
+	if query.Offset >= len(matches) {
+		return DICOMElementsLookup{}, total, nil
+	}
+	matches = matches[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(matches) {
+		matches = matches[:query.Limit]
+	}
+
+	elementsByPath := make(DICOMElementsLookup, len(matches))
+	for _, match := range matches {
+		elementsByPath[match.path] = match.element
+	}
+
+	return elementsByPath, total, nil
+}
+
+// emptySequence utility to copy a sequence element with the given number of
+// items, each holding no elements
+func emptySequence(element *dicom.Element, itemCount int) *dicom.Element {
+	items := make([][]*dicom.Element, itemCount)
+	for idx := range items {
+		items[idx] = []*dicom.Element{}
+	}
+
+	value, err := dicom.NewValue(items)
+	if err != nil {
+		return element
+	}
+
+	return &dicom.Element{
+		Tag:                    element.Tag,
+		ValueRepresentation:    element.ValueRepresentation,
+		RawValueRepresentation: element.RawValueRepresentation,
+		ValueLength:            element.ValueLength,
+		Value:                  value,
+	}
+}
@@ -0,0 +1,248 @@
+package dicom
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// newTestFile test helper to encode the elements as a DICOM file
+func newTestFile(t *testing.T, elements ...*dicom.Element) *File {
+	t.Helper()
+
+	elements = append([]*dicom.Element{
+		mustNewElement(tag.MediaStorageSOPClassUID, []string{"1.2.840.10008.5.1.4.1.1.7"}),
+		mustNewElement(tag.MediaStorageSOPInstanceUID, []string{"1.2.3"}),
+		mustNewElement(tag.TransferSyntaxUID, []string{"1.2.840.10008.1.2.1"}),
+	}, elements...)
+
+	var buffer bytes.Buffer
+	if err := dicom.Write(&buffer, dicom.Dataset{Elements: elements}); err != nil {
+		t.Fatal(err)
+	}
+
+	file := NewFile("test", int64(buffer.Len()), bytes.NewReader(buffer.Bytes()))
+	return &file
+}
+
+func Test_File_SearchElements(t *testing.T) {
+	file := newTestFile(t,
+		mustNewElement(tag.SOPInstanceUID, []string{"1.2.3"}),
+		mustNewElement(tag.Modality, []string{"OT"}),
+		mustNewElement(tag.ReferencedSeriesSequence, [][]*dicom.Element{
+			{
+				mustNewElement(tag.SeriesInstanceUID, []string{"1.2.4"}),
+				mustNewElement(tag.ReferencedInstanceSequence, [][]*dicom.Element{{
+					mustNewElement(tag.ReferencedSOPInstanceUID, []string{"1.2.4.1"}),
+				}}),
+			},
+			{
+				mustNewElement(tag.SeriesInstanceUID, []string{"1.2.5"}),
+			},
+		}),
+		mustNewElement(tag.PatientName, []string{"DOE^JOHN"}),
+		mustNewElement(tag.PatientID, []string{"P1"}),
+		mustNewElement(tag.RedPaletteColorLookupTableData, []byte{0, 1, 2, 3}),
+	)
+
+	group := uint16(0x0010)
+
+	type args struct {
+		query ElementQuery
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      []string
+		wantTotal int
+	}{
+		{
+			name: "returns top level elements without bulk data",
+			args: args{
+				query: ElementQuery{},
+			},
+			want: []string{
+				"(0002,0000)", "(0002,0002)", "(0002,0003)", "(0002,0010)",
+				"(0008,0018)", "(0008,0060)", "(0008,1115)",
+				"(0010,0010)", "(0010,0020)",
+			},
+			wantTotal: 9,
+		},
+		{
+			name: "returns bulk data when requested",
+			args: args{
+				query: ElementQuery{Keyword: "*PaletteColorLookupTableData", IncludeBulkData: true},
+			},
+			want:      []string{"(0028,1201)"},
+			wantTotal: 1,
+		},
+		{
+			name: "filters by group",
+			args: args{
+				query: ElementQuery{Group: &group},
+			},
+			want:      []string{"(0010,0010)", "(0010,0020)"},
+			wantTotal: 2,
+		},
+		{
+			name: "filters by keyword wildcard",
+			args: args{
+				query: ElementQuery{Keyword: "patient*"},
+			},
+			want:      []string{"(0010,0010)", "(0010,0020)"},
+			wantTotal: 2,
+		},
+		{
+			name: "searches sequence items to the depth",
+			args: args{
+				query: ElementQuery{Keyword: "*InstanceUID", Depth: 1},
+			},
+			want: []string{
+				"(0002,0003)", "(0008,0018)",
+				"(0008,1115)[0].(0020,000e)", "(0008,1115)[1].(0020,000e)",
+			},
+			wantTotal: 4,
+		},
+		{
+			name: "searches nested sequence items",
+			args: args{
+				query: ElementQuery{Keyword: "Referenced*", Depth: 2},
+			},
+			want: []string{
+				"(0008,1115)", "(0008,1115)[0].(0008,114a)",
+				"(0008,1115)[0].(0008,114a)[0].(0008,1155)",
+			},
+			wantTotal: 3,
+		},
+		{
+			name: "applies offset and limit",
+			args: args{
+				query: ElementQuery{Depth: 1, Offset: 5, Limit: 3},
+			},
+			want:      []string{"(0008,0060)", "(0008,1115)", "(0008,1115)[0].(0020,000e)"},
+			wantTotal: 12,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := file.SearchElements(tt.args.query)
+			if err != nil {
+				t.Fatalf("File.SearchElements() error = %v", err)
+			}
+
+			var paths []string
+			for path := range got {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+
+			if !reflect.DeepEqual(paths, tt.want) {
+				t.Errorf("File.SearchElements() = %v, want %v", paths, tt.want)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("File.SearchElements() total = %v, want %v", total, tt.wantTotal)
+			}
+		})
+	}
+
+	// sequences are returned with their items emptied
+	got, _, _ := file.SearchElements(ElementQuery{Keyword: "ReferencedSeriesSequence"})
+	items, _ := got["(0008,1115)"].Value.GetValue().([]*dicom.SequenceItemValue)
+	if len(items) != 2 || len(items[0].GetValue().([]*dicom.Element)) != 0 {
+		t.Errorf("File.SearchElements() sequence = %v, want 2 empty items", got["(0008,1115)"])
+	}
+}
+
+func Test_File_FindElements(t *testing.T) {
+	file := newTestFile(t,
+		mustNewElement(tag.SOPInstanceUID, []string{"1.2.3"}),
+		mustNewElement(tag.ReferencedSeriesSequence, [][]*dicom.Element{
+			{
+				mustNewElement(tag.SeriesInstanceUID, []string{"1.2.4"}),
+			},
+			{
+				mustNewElement(tag.SeriesInstanceUID, []string{"1.2.5"}),
+				mustNewElement(tag.ReferencedInstanceSequence, [][]*dicom.Element{{
+					mustNewElement(tag.ReferencedSOPInstanceUID, []string{"1.2.5.1"}),
+				}}),
+			},
+		}),
+	)
+
+	mustParse := func(value string) ElementPath {
+		path, err := ParseElementPath(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	type args struct {
+		paths []ElementPath
+	}
+	tests := []struct {
+		name string
+		args args
+		want map[string]string
+	}{
+		{
+			name: "finds top level elements",
+			args: args{
+				paths: []ElementPath{mustParse("SOPInstanceUID")},
+			},
+			want: map[string]string{"(0008,0018)": "1.2.3"},
+		},
+		{
+			name: "finds elements nested in sequences",
+			args: args{
+				paths: []ElementPath{
+					mustParse("ReferencedSeriesSequence[1].SeriesInstanceUID"),
+					mustParse("00081115[1].ReferencedInstanceSequence[0].(0008,1155)"),
+				},
+			},
+			want: map[string]string{
+				"(0008,1115)[1].(0020,000e)":                "1.2.5",
+				"(0008,1115)[1].(0008,114a)[0].(0008,1155)": "1.2.5.1",
+			},
+		},
+		{
+			name: "returns nil for missing items and elements",
+			args: args{
+				paths: []ElementPath{
+					mustParse("ReferencedSeriesSequence[2].SeriesInstanceUID"),
+					mustParse("SOPInstanceUID[0].SeriesInstanceUID"),
+					mustParse("PatientName"),
+				},
+			},
+			want: map[string]string{
+				"(0008,1115)[2].(0020,000e)": "",
+				"(0008,0018)[0].(0020,000e)": "",
+				"(0010,0010)":                "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := file.FindElements(tt.args.paths...)
+			if err != nil {
+				t.Fatalf("File.FindElements() error = %v", err)
+			}
+
+			gotValues := make(map[string]string, len(got))
+			for path, element := range got {
+				gotValues[path] = ""
+				if element != nil {
+					values, _ := element.Value.GetValue().([]string)
+					gotValues[path] = values[0]
+				}
+			}
+			if !reflect.DeepEqual(gotValues, tt.want) {
+				t.Errorf("File.FindElements() = %v, want %v", gotValues, tt.want)
+			}
+		})
+	}
+}
@@ -1,59 +1,148 @@
 package dicom
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"image"
 	"io"
+	"os"
 
 	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/frame"
 	"github.com/suyashkumar/dicom/pkg/tag"
 )
 
-// File represents a DICOM file
+// File represents a DICOM file. The contents of the file are read as needed,
+// rather than held in memory, so a file backed by an open file or other
+// resource must be closed once no longer needed
 type File struct {
 	ID string
 
-	file io.ReadSeeker
-	size int64
+	contents io.ReaderAt
+	size     int64
 
 	// read-thru cache to avoid unnecessary parsing and image processing
 	cache struct {
-		dataset *dicom.Dataset
-		image   *image.Gray
+		dataset     *dicom.Dataset
+		header      *dicom.Dataset
+		contentHash string
 	}
 }
 
-// NewFile constructs a new DICOM file
+var (
+	// ErrFrameNotFound error indicating the specified frame does not exist
+	// within the DICOM file
+	ErrFrameNotFound = errors.New("frame was not found")
+
+	// ErrPixelOutOfBounds error indicating the specified pixel lies outside
+	// of the frame
+	ErrPixelOutOfBounds = errors.New("pixel is out of bounds")
+)
+
+// NewFile constructs a new DICOM file of the size bytes of contents. Closing
+// the file closes the contents if they implement io.Closer, e.g. *os.File
 func NewFile(
 	id string,
 	size int64,
-	contents io.ReadSeeker,
+	contents io.ReaderAt,
 ) File {
 	return File{
-		ID:   id,
-		size: size,
-		file: contents,
+		ID:       id,
+		size:     size,
+		contents: contents,
+	}
+}
+
+// SpoolFile constructs a new DICOM file by copying the contents to a
+// temporary file, so that contents which can only be read once, such as a
+// request body, can be read as needed without holding them in memory. The
+// temporary file is removed when the file is closed
+func SpoolFile(id string, contents io.Reader) (File, error) {
+	return spoolFile(id, func(w io.Writer) error {
+		_, err := io.Copy(w, contents)
+		return err
+	})
+}
+
+// spoolFile utility to construct a new DICOM file of the contents written by
+// write to a temporary file, removed when the file is closed
+func spoolFile(id string, write func(w io.Writer) error) (File, error) {
+	temp, err := os.CreateTemp("", "dicomviewer-spool-*")
+	if err != nil {
+		return File{}, err
+	}
+
+	spooled := &spooledContents{File: temp}
+	writer := bufio.NewWriter(temp)
+	if err := write(writer); err != nil {
+		spooled.Close()
+		return File{}, err
+	}
+	if err := writer.Flush(); err != nil {
+		spooled.Close()
+		return File{}, err
+	}
+
+	info, err := temp.Stat()
+	if err != nil {
+		spooled.Close()
+		return File{}, err
+	}
+
+	return NewFile(id, info.Size(), spooled), nil
+}
+
+// spooledContents the contents of a spooled file, removed when closed
+type spooledContents struct {
+	*os.File
+}
+
+func (c *spooledContents) Close() error {
+	err := c.File.Close()
+	if removeErr := os.Remove(c.File.Name()); removeErr != nil && err == nil {
+		err = removeErr
+	}
+
+	return err
+}
+
+// Close releases the contents of the file
+func (d *File) Close() error {
+	if closer, ok := d.contents.(io.Closer); ok {
+		return closer.Close()
 	}
+
+	return nil
 }
 
 // Size returns the size of the DICOM file contents
-func (d File) Size() int64 {
+func (d *File) Size() int64 {
 	return d.size
 }
 
-// Raw returns the raw DICOM file
-func (d File) Raw() io.ReadSeeker {
-	return d.file
+// Raw returns a reader of the raw DICOM file, from its start. Each reader is
+// independent of any others, so the file may be read concurrently
+func (d *File) Raw() io.ReadSeeker {
+	return io.NewSectionReader(d.contents, 0, d.size)
 }
 
 // DataSet returns a parsed datastructure representing the data within
 // the DICOM file
-func (d File) DataSet() (*dicom.Dataset, error) {
+func (d *File) DataSet() (*dicom.Dataset, error) {
 	if d.cache.dataset != nil {
 		return d.cache.dataset, nil
 	}
 
-	data, err := dicom.Parse(d.file, d.size, nil)
+	// tolerate pixel data whose length does not match the image dimensions,
+	// as is the case for YBR_FULL_422 pixel data
+	data, err := dicom.Parse(
+		d.Raw(),
+		d.size,
+		nil,
+		dicom.AllowMismatchPixelDataLength(),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -62,9 +151,85 @@ func (d File) DataSet() (*dicom.Dataset, error) {
 	return d.cache.dataset, nil
 }
 
+// Header returns a parsed datastructure representing the data within the
+// DICOM file, excluding pixel data. Prefer Header over DataSet when pixel data
+// is not needed, as it avoids reading and processing the pixel data
+func (d *File) Header() (*dicom.Dataset, error) {
+	if d.cache.dataset != nil {
+		return d.cache.dataset, nil
+	}
+	if d.cache.header != nil {
+		return d.cache.header, nil
+	}
+
+	data, err := dicom.Parse(
+		d.Raw(),
+		d.size,
+		nil,
+		dicom.SkipPixelData(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.cache.header = &data
+	return d.cache.header, nil
+}
+
+// ContentHash returns the hex encoded SHA-256 hash of the raw DICOM file,
+// identifying files with identical contents
+func (d *File) ContentHash() (string, error) {
+	if d.cache.contentHash != "" {
+		return d.cache.contentHash, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, d.Raw()); err != nil {
+		return "", err
+	}
+
+	d.cache.contentHash = hex.EncodeToString(hash.Sum(nil))
+	return d.cache.contentHash, nil
+}
+
+// InstanceUIDs the UIDs identifying a DICOM instance and the series and study
+// it belongs to
+type InstanceUIDs struct {
+	StudyInstanceUID  string
+	SeriesInstanceUID string
+	SOPInstanceUID    string
+}
+
+// UIDs returns the study, series and SOP instance UIDs of the DICOM file
+func (d *File) UIDs() (InstanceUIDs, error) {
+	dataSet, err := d.Header()
+	if err != nil {
+		return InstanceUIDs{}, err
+	}
+
+	return InstanceUIDs{
+		StudyInstanceUID:  firstString(*dataSet, tag.StudyInstanceUID),
+		SeriesInstanceUID: firstString(*dataSet, tag.SeriesInstanceUID),
+		SOPInstanceUID:    firstString(*dataSet, tag.SOPInstanceUID),
+	}, nil
+}
+
+// Matches determines whether the UIDs belong to the study, series or instance
+// identified by the query UIDs. Empty query UIDs match any UID
+func (u InstanceUIDs) Matches(query InstanceUIDs) bool {
+	matches := func(uid string, queryUID string) bool {
+		return queryUID == "" || uid == queryUID
+	}
+
+	return matches(u.StudyInstanceUID, query.StudyInstanceUID) &&
+		matches(u.SeriesInstanceUID, query.SeriesInstanceUID) &&
+		matches(u.SOPInstanceUID, query.SOPInstanceUID)
+}
+
 // PNGGenerateOptions options for generating a PNG from a DICOM
 type PNGGenerateOptions struct {
 	shouldRemap bool
+	window      *Window
 }
 
 // PNGRemapValues option to remap pixel value ranges in PNG for better visibility
@@ -74,12 +239,106 @@ func PNGRemapPixels(shouldRemap bool) func(opts *PNGGenerateOptions) {
 	}
 }
 
-// PNG returns a greyscale PNG of the DICOM file
-func (d File) PNG(options ...func(opts *PNGGenerateOptions)) (*image.Gray, error) {
-	if d.cache.image != nil {
-		return d.cache.image, nil
+// PNGWindow option to map pixel values in PNG using the given window,
+// overriding any window or VOI LUT defined by the DICOM file
+func PNGWindow(window Window) func(opts *PNGGenerateOptions) {
+	return func(opts *PNGGenerateOptions) {
+		opts.window = &window
+	}
+}
+
+// PNG returns a PNG of the first frame of the DICOM file. Greyscale files are
+// rendered as *image.Gray and colour files as *image.RGBA
+func (d *File) PNG(options ...func(opts *PNGGenerateOptions)) (image.Image, error) {
+	image, err := d.Frame(0, options...)
+	if errors.Is(err, ErrFrameNotFound) {
+		return nil, errors.New("file does not contain any images")
+	}
+
+	return image, err
+}
+
+// FrameInfo describes a single frame of pixel data within a DICOM file
+type FrameInfo struct {
+	Index         int  `json:"index"`
+	Rows          int  `json:"rows"`
+	Cols          int  `json:"cols"`
+	BitsPerSample int  `json:"bitsPerSample"`
+	Encapsulated  bool `json:"encapsulated"`
+
+	// TimeOffset the offset in milliseconds of the frame from the start of a
+	// cine sequence, if the file specifies frame timing
+	TimeOffset *float64 `json:"timeOffsetMs,omitempty"`
+}
+
+// FrameCount returns the number of frames of pixel data within the DICOM file.
+// The count is read from the Number of Frames (0028,0008) attribute without
+// reading the pixel data, which is only read for files without the attribute
+func (d *File) FrameCount() (int, error) {
+	header, err := d.Header()
+	if err != nil {
+		return 0, err
+	}
+
+	if element, err := header.FindElementByTag(tag.NumberOfFrames); err == nil {
+		if values := parseDecimalStrings(element.Value); len(values) == 1 && values[0] >= 1 {
+			return int(values[0]), nil
+		}
+	}
+
+	dataSet, err := d.DataSet()
+	if err != nil {
+		return 0, err
+	}
+
+	pixelDataInfo, err := getPixelDataInfo(*dataSet)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(pixelDataInfo.Frames), nil
+}
+
+// Frames returns a description of each frame of pixel data within the DICOM
+// file
+func (d *File) Frames() ([]FrameInfo, error) {
+	dataSet, err := d.DataSet()
+	if err != nil {
+		return nil, err
+	}
+
+	pixelDataInfo, err := getPixelDataInfo(*dataSet)
+	if err != nil {
+		return nil, err
+	}
+
+	timeOffsets := frameTimeOffsets(*dataSet, len(pixelDataInfo.Frames))
+
+	frames := make([]FrameInfo, 0, len(pixelDataInfo.Frames))
+	for idx, fr := range pixelDataInfo.Frames {
+		frameInfo := FrameInfo{
+			Index:         idx,
+			Rows:          fr.NativeData.Rows,
+			Cols:          fr.NativeData.Cols,
+			BitsPerSample: fr.NativeData.BitsPerSample,
+			Encapsulated:  fr.Encapsulated,
+		}
+		if timeOffsets != nil {
+			frameInfo.TimeOffset = &timeOffsets[idx]
+		}
+
+		frames = append(frames, frameInfo)
 	}
 
+	return frames, nil
+}
+
+// Frame returns a PNG of the nth (zero-indexed) frame of the DICOM file.
+// Greyscale files are rendered as *image.Gray and colour files as *image.RGBA
+func (d *File) Frame(
+	n int,
+	options ...func(opts *PNGGenerateOptions),
+) (image.Image, error) {
 	var opts = PNGGenerateOptions{
 		shouldRemap: true,
 	}
@@ -87,60 +346,119 @@ func (d File) PNG(options ...func(opts *PNGGenerateOptions)) (*image.Gray, error
 		opt(&opts)
 	}
 
-	dataSet, err := d.DataSet()
+	dataSet, fr, err := d.frame(n)
 	if err != nil {
 		return nil, err
 	}
-	images, err := generateImage(
+
+	return generateFrameImage(
 		*dataSet,
-		opts.shouldRemap,
+		fr,
+		opts,
 	)
+}
+
+// PixelValue the stored and modality values of a single pixel of a frame
+type PixelValue struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+
+	// Stored the stored value of each sample of the pixel
+	Stored []int `json:"stored"`
+
+	// Modality the value of the pixel after applying the modality LUT
+	// transformation, e.g. Hounsfield units for CT
+	Modality float64 `json:"modality"`
+	Units    string  `json:"units,omitempty"`
+}
+
+// PixelValue returns the stored and modality values of the pixel at (x, y) of
+// the nth (zero-indexed) frame of the DICOM file
+func (d *File) PixelValue(n int, x int, y int) (PixelValue, error) {
+	dataSet, fr, err := d.frame(n)
 	if err != nil {
-		return nil, err
+		return PixelValue{}, err
 	}
 
-	if len(images) == 0 {
-		return nil, errors.New("file does not contain any images")
+	nativeFrame := storedFrame(*dataSet, &fr.NativeData)
+	idx := y*nativeFrame.Cols + x
+	if x < 0 || x >= nativeFrame.Cols ||
+		y < 0 || y >= nativeFrame.Rows ||
+		idx >= len(nativeFrame.Data) ||
+		len(nativeFrame.Data[idx]) == 0 {
+		return PixelValue{}, ErrPixelOutOfBounds
 	}
 
-	d.cache.image = images[0]
+	modality := datasetModalityFunction(*dataSet)
 
-	return d.cache.image, nil
+	return PixelValue{
+		X:        x,
+		Y:        y,
+		Stored:   nativeFrame.Data[idx],
+		Modality: modality(nativeFrame.Data[idx][0]),
+		Units:    datasetModalityUnits(*dataSet),
+	}, nil
 }
 
-// DICOMElementsLookup is a map of DICOM tags to their corresponding elements
-type DICOMElementsLookup map[string]*dicom.Element
-
-// FindElements given a list of tags, retrieves a lookup of elements by tag
-func (d File) FindElements(tags ...tag.Tag) (DICOMElementsLookup, error) {
-	dataSet, err := d.DataSet()
+// ModalityValues returns the modality values of every pixel of the nth
+// (zero-indexed) frame of the DICOM file, in row-major order
+func (d *File) ModalityValues(n int) ([]float64, error) {
+	dataSet, fr, err := d.frame(n)
 	if err != nil {
 		return nil, err
 	}
 
-	elementsByTag := make(map[string]*dicom.Element)
-	if len(tags) > 0 {
-		for _, tag := range tags {
-			// ignore error and assume element cannot be found
-			element, _ := dataSet.FindElementByTag(tag)
-			elementsByTag[tag.String()] = element
+	modality := datasetModalityFunction(*dataSet)
+
+	nativeFrame := storedFrame(*dataSet, &fr.NativeData)
+
+	values := make([]float64, len(nativeFrame.Data))
+	for idx, pixel := range nativeFrame.Data {
+		if len(pixel) == 0 {
+			continue
 		}
+		values[idx] = modality(pixel[0])
+	}
+
+	return values, nil
+}
+
+// frame utility to retrieve the dataset and nth (zero-indexed) frame of the
+// DICOM file
+func (d *File) frame(n int) (*dicom.Dataset, *frame.Frame, error) {
+	dataSet, err := d.DataSet()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return elementsByTag, nil
+	pixelDataInfo, err := getPixelDataInfo(*dataSet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if n < 0 || n >= len(pixelDataInfo.Frames) {
+		return nil, nil, ErrFrameNotFound
+	}
+
+	return dataSet, pixelDataInfo.Frames[n], nil
 }
 
-// AllElements retrieves a lookup of all elements by tag
-func (d File) AllElements() (DICOMElementsLookup, error) {
+// DICOMElementsLookup is a map of DICOM tags to their corresponding elements
+type DICOMElementsLookup map[string]*dicom.Element
+
+// FindElements given a list of paths to elements, which may be nested within
+// sequences, retrieves a lookup of elements by path. Elements that cannot be
+// found are nil
+func (d *File) FindElements(paths ...ElementPath) (DICOMElementsLookup, error) {
 	dataSet, err := d.DataSet()
 	if err != nil {
 		return nil, err
 	}
 
-	elementsByTag := make(map[string]*dicom.Element)
-	for _, element := range dataSet.Elements {
-		elementsByTag[element.Tag.String()] = element
+	elementsByPath := make(map[string]*dicom.Element)
+	for _, path := range paths {
+		elementsByPath[path.String()] = path.find(dataSet.Elements)
 	}
 
-	return elementsByTag, nil
+	return elementsByPath, nil
 }
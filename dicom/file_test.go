@@ -0,0 +1,209 @@
+package dicom
+
+import (
+	"errors"
+	"image"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/frame"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_SpoolFile(t *testing.T) {
+	file, err := SpoolFile("spooled", strings.NewReader("0123456789"))
+	if err != nil {
+		t.Fatalf("SpoolFile() error = %v", err)
+	}
+
+	if file.Size() != 10 {
+		t.Errorf("SpoolFile() size = %d, want 10", file.Size())
+	}
+
+	// each reader reads the file from its start, independently of others
+	var wg sync.WaitGroup
+	for idx := 0; idx < 4; idx++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := io.ReadAll(file.Raw()); err != nil || string(got) != "0123456789" {
+				t.Errorf("File.Raw() = %q, %v, want 0123456789", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	name := file.contents.(*spooledContents).Name()
+	if err := file.Close(); err != nil {
+		t.Fatalf("File.Close() error = %v", err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("File.Close() did not remove spooled file: %v", err)
+	}
+}
+
+// newTestFramesFile test helper to encode a greyscale file of 2x2 frames,
+// where each pixel of a frame holds the index of the frame. Number of Frames
+// is only given for multi-frame files
+func newTestFramesFile(t *testing.T, frameCount int, elements ...*dicom.Element) *File {
+	t.Helper()
+
+	frames := make([]*frame.Frame, frameCount)
+	for idx := range frames {
+		frames[idx] = &frame.Frame{
+			NativeData: frame.NativeFrame{
+				Data:          [][]int{{idx}, {idx}, {idx}, {idx}},
+				Rows:          2,
+				Cols:          2,
+				BitsPerSample: 8,
+			},
+		}
+	}
+
+	header := []*dicom.Element{
+		mustNewElement(tag.SOPInstanceUID, []string{"1.2.3"}),
+		mustNewElement(tag.SamplesPerPixel, []int{1}),
+		mustNewElement(tag.PhotometricInterpretation, []string{"MONOCHROME2"}),
+	}
+
+	// single frame files may omit the number of frames
+	if frameCount > 1 {
+		header = append(header, mustNewElement(tag.NumberOfFrames, []string{strconv.Itoa(frameCount)}))
+	}
+
+	return newTestFile(t, append(append(header,
+		mustNewElement(tag.Rows, []int{2}),
+		mustNewElement(tag.Columns, []int{2}),
+		mustNewElement(tag.BitsAllocated, []int{8}),
+		mustNewElement(tag.BitsStored, []int{8}),
+		mustNewElement(tag.HighBit, []int{7}),
+		mustNewElement(tag.PixelRepresentation, []int{0}),
+		&dicom.Element{
+			Tag:                    tag.PixelData,
+			RawValueRepresentation: "OW",
+			Value:                  mustNewValue(dicom.PixelDataInfo{Frames: frames}),
+		},
+	), elements...)...)
+}
+
+func Test_File_Frames(t *testing.T) {
+	// offsets test helper to take the address of each frame time offset
+	offsets := func(values ...float64) []*float64 {
+		pointers := make([]*float64, len(values))
+		for idx := range values {
+			pointers[idx] = &values[idx]
+		}
+		return pointers
+	}
+
+	tests := []struct {
+		name        string
+		file        *File
+		wantOffsets []*float64
+	}{
+		{
+			name:        "describes a single frame",
+			file:        newTestFramesFile(t, 1),
+			wantOffsets: []*float64{nil},
+		},
+		{
+			name:        "describes every frame without timing",
+			file:        newTestFramesFile(t, 3),
+			wantOffsets: []*float64{nil, nil, nil},
+		},
+		{
+			name:        "describes the time offset of each frame",
+			file:        newTestFramesFile(t, 3, mustNewElement(tag.FrameTime, []string{"40"})),
+			wantOffsets: offsets(0, 40, 80),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frameCount, err := tt.file.FrameCount()
+			if err != nil {
+				t.Fatalf("File.FrameCount() error = %v", err)
+			}
+			if frameCount != len(tt.wantOffsets) {
+				t.Errorf("File.FrameCount() = %v, want %v", frameCount, len(tt.wantOffsets))
+			}
+
+			frames, err := tt.file.Frames()
+			if err != nil {
+				t.Fatalf("File.Frames() error = %v", err)
+			}
+
+			if len(frames) != len(tt.wantOffsets) {
+				t.Fatalf("File.Frames() = %d frames, want %d", len(frames), len(tt.wantOffsets))
+			}
+			for idx, frameInfo := range frames {
+				want := FrameInfo{
+					Index:         idx,
+					Rows:          2,
+					Cols:          2,
+					BitsPerSample: 8,
+					TimeOffset:    tt.wantOffsets[idx],
+				}
+				if !reflect.DeepEqual(frameInfo, want) {
+					t.Errorf("File.Frames()[%d] = %+v, want %+v", idx, frameInfo, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_File_Frame(t *testing.T) {
+	file := newTestFramesFile(t, 3)
+
+	tests := []struct {
+		name    string
+		n       int
+		want    uint8
+		wantErr error
+	}{
+		{
+			name: "renders the first frame",
+			n:    0,
+			want: 0,
+		},
+		{
+			name: "renders the last frame",
+			n:    2,
+			want: 2,
+		},
+		{
+			name:    "errors for a negative frame",
+			n:       -1,
+			wantErr: ErrFrameNotFound,
+		},
+		{
+			name:    "errors for a frame past the last",
+			n:       3,
+			wantErr: ErrFrameNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := file.Frame(tt.n, PNGRemapPixels(false))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("File.Frame() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			gray, ok := got.(*image.Gray)
+			if !ok {
+				t.Fatalf("File.Frame() = %T, want *image.Gray", got)
+			}
+			if value := gray.GrayAt(1, 1).Y; value != tt.want {
+				t.Errorf("File.Frame() pixel = %v, want %v", value, tt.want)
+			}
+		})
+	}
+}
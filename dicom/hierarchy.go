@@ -0,0 +1,242 @@
+package dicom
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+var (
+	// ErrStudyNotFound error indicating specified study was not found
+	ErrStudyNotFound = errors.New("study was not found")
+
+	// ErrSeriesNotFound error indicating specified series was not found
+	ErrSeriesNotFound = errors.New("series was not found")
+)
+
+// StudyRepository a FileRepository which organises the files it stores into
+// the patient, study, series and instance hierarchy of the DICOM information
+// model, identified by their UIDs
+type StudyRepository interface {
+	FileRepository
+	ListStudies() ([]Study, error)
+	ListSeries(studyUID string) ([]Series, error)
+	ListInstances(studyUID string, seriesUID string) ([]Instance, error)
+	DeleteStudy(studyUID string) ([]string, error)
+	DeleteSeries(studyUID string, seriesUID string) ([]string, error)
+}
+
+// Patient the patient a study was performed on
+type Patient struct {
+	PatientID   string `json:"patientId"`
+	PatientName string `json:"patientName"`
+	BirthDate   string `json:"birthDate,omitempty"`
+	Sex         string `json:"sex,omitempty"`
+}
+
+// Study a study of a patient, made up of one or more series
+type Study struct {
+	StudyInstanceUID  string   `json:"studyInstanceUid"`
+	Patient           Patient  `json:"patient"`
+	StudyDate         string   `json:"studyDate,omitempty"`
+	StudyTime         string   `json:"studyTime,omitempty"`
+	StudyDescription  string   `json:"studyDescription,omitempty"`
+	AccessionNumber   string   `json:"accessionNumber,omitempty"`
+	Modalities        []string `json:"modalities"`
+	NumberOfSeries    int      `json:"numberOfSeries"`
+	NumberOfInstances int      `json:"numberOfInstances"`
+}
+
+// Series a series of a study, made up of one or more instances
+type Series struct {
+	SeriesInstanceUID string `json:"seriesInstanceUid"`
+	StudyInstanceUID  string `json:"studyInstanceUid"`
+	Modality          string `json:"modality,omitempty"`
+	SeriesNumber      int    `json:"seriesNumber,omitempty"`
+	SeriesDescription string `json:"seriesDescription,omitempty"`
+	NumberOfInstances int    `json:"numberOfInstances"`
+}
+
+// Instance a single instance of a series, stored as the file with the ID
+type Instance struct {
+	FileID            string `json:"fileId"`
+	SOPInstanceUID    string `json:"sopInstanceUid"`
+	SOPClassUID       string `json:"sopClassUid"`
+	SeriesInstanceUID string `json:"seriesInstanceUid"`
+	StudyInstanceUID  string `json:"studyInstanceUid"`
+	InstanceNumber    int    `json:"instanceNumber,omitempty"`
+}
+
+// ListStudies retrieve every study with files in the repository, most recent
+// first. Studies are grouped by the index, rather than from every instance
+func (r *indexedFileRepository) ListStudies() ([]Study, error) {
+	entities, err := r.index.Search(SearchQuery{
+		Level:      QueryLevelStudy,
+		IncludeAll: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newStudies(entities), nil
+}
+
+// ListSeries retrieve the series of a study, ordered by series number
+func (r *indexedFileRepository) ListSeries(studyUID string) ([]Series, error) {
+	entities, err := r.index.Search(SearchQuery{
+		Level:      QueryLevelSeries,
+		Keys:       map[tag.Tag]string{tag.StudyInstanceUID: studyUID},
+		IncludeAll: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, ErrStudyNotFound
+	}
+
+	return newSeries(entities), nil
+}
+
+// ListInstances retrieve the instances of a series of a study, ordered by
+// instance number
+func (r *indexedFileRepository) ListInstances(studyUID string, seriesUID string) ([]Instance, error) {
+	instances, err := r.index.Find(InstanceUIDs{StudyInstanceUID: studyUID, SeriesInstanceUID: seriesUID})
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, ErrSeriesNotFound
+	}
+
+	return newInstances(instances), nil
+}
+
+// DeleteStudy delete every file of a study, returning the IDs of the files
+// deleted
+func (r *indexedFileRepository) DeleteStudy(studyUID string) ([]string, error) {
+	return r.deleteInstances(InstanceUIDs{StudyInstanceUID: studyUID}, ErrStudyNotFound)
+}
+
+// DeleteSeries delete every file of a series of a study, returning the IDs of
+// the files deleted
+func (r *indexedFileRepository) DeleteSeries(studyUID string, seriesUID string) ([]string, error) {
+	return r.deleteInstances(
+		InstanceUIDs{StudyInstanceUID: studyUID, SeriesInstanceUID: seriesUID},
+		ErrSeriesNotFound,
+	)
+}
+
+// deleteInstances utility to delete the files of the instances matching the
+// query, returning the IDs of the files deleted before any error
+func (r *indexedFileRepository) deleteInstances(query InstanceUIDs, errNotFound error) ([]string, error) {
+	instances, err := r.index.Find(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, errNotFound
+	}
+
+	fileIDs := []string{}
+	for _, instance := range instances {
+		if err := r.Delete(instance.FileID); err != nil && !errors.Is(err, ErrFileNotFound) {
+			return fileIDs, err
+		}
+		fileIDs = append(fileIDs, instance.FileID)
+	}
+
+	return fileIDs, nil
+}
+
+// newStudies utility to read the studies of study level search results
+func newStudies(entities []JSONDataset) []Study {
+	studies := make([]Study, 0, len(entities))
+	for _, entity := range entities {
+		modalities := entity[JSONTagKey(tag.ModalitiesInStudy)].Strings()
+		if modalities == nil {
+			modalities = []string{}
+		}
+
+		studies = append(studies, Study{
+			StudyInstanceUID: FirstJSONString(entity, tag.StudyInstanceUID),
+			Patient: Patient{
+				PatientID:   FirstJSONString(entity, tag.PatientID),
+				PatientName: FirstJSONString(entity, tag.PatientName),
+				BirthDate:   FirstJSONString(entity, tag.PatientBirthDate),
+				Sex:         FirstJSONString(entity, tag.PatientSex),
+			},
+			StudyDate:         FirstJSONString(entity, tag.StudyDate),
+			StudyTime:         FirstJSONString(entity, tag.StudyTime),
+			StudyDescription:  FirstJSONString(entity, tag.StudyDescription),
+			AccessionNumber:   FirstJSONString(entity, tag.AccessionNumber),
+			Modalities:        modalities,
+			NumberOfSeries:    firstJSONInteger(entity, tag.NumberOfStudyRelatedSeries),
+			NumberOfInstances: firstJSONInteger(entity, tag.NumberOfStudyRelatedInstances),
+		})
+	}
+
+	sort.SliceStable(studies, func(i, j int) bool {
+		if studies[i].StudyDate != studies[j].StudyDate {
+			return studies[i].StudyDate > studies[j].StudyDate
+		}
+		return studies[i].StudyTime > studies[j].StudyTime
+	})
+
+	return studies
+}
+
+// newSeries utility to read the series of series level search results
+func newSeries(entities []JSONDataset) []Series {
+	series := make([]Series, 0, len(entities))
+	for _, entity := range entities {
+		series = append(series, Series{
+			SeriesInstanceUID: FirstJSONString(entity, tag.SeriesInstanceUID),
+			StudyInstanceUID:  FirstJSONString(entity, tag.StudyInstanceUID),
+			Modality:          FirstJSONString(entity, tag.Modality),
+			SeriesNumber:      firstJSONInteger(entity, tag.SeriesNumber),
+			SeriesDescription: FirstJSONString(entity, tag.SeriesDescription),
+			NumberOfInstances: firstJSONInteger(entity, tag.NumberOfSeriesRelatedInstances),
+		})
+	}
+
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i].SeriesNumber < series[j].SeriesNumber
+	})
+
+	return series
+}
+
+// newInstances utility to read the instances of indexed instance metadata
+func newInstances(instances []InstanceMetadata) []Instance {
+	result := make([]Instance, 0, len(instances))
+	for _, instance := range instances {
+		result = append(result, Instance{
+			FileID:            instance.FileID,
+			SOPInstanceUID:    instance.SOPInstanceUID,
+			SOPClassUID:       FirstJSONString(instance.Attributes, tag.SOPClassUID),
+			SeriesInstanceUID: instance.SeriesInstanceUID,
+			StudyInstanceUID:  instance.StudyInstanceUID,
+			InstanceNumber:    firstJSONInteger(instance.Attributes, tag.InstanceNumber),
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].InstanceNumber < result[j].InstanceNumber
+	})
+
+	return result
+}
+
+// firstJSONInteger utility to read the first value of an attribute of a DICOM
+// JSON dataset as an integer. Missing or invalid values are read as 0
+func firstJSONInteger(dataset JSONDataset, t tag.Tag) int {
+	value, err := strconv.Atoi(FirstJSONString(dataset, t))
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
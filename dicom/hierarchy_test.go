@@ -0,0 +1,257 @@
+package dicom
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_indexedFileRepository_hierarchy(t *testing.T) {
+	newInstance := func(studyUID, seriesUID, sopUID, studyDate, modality, seriesNumber, instanceNumber string) InstanceMetadata {
+		return InstanceMetadata{
+			FileID: "file-" + sopUID,
+			InstanceUIDs: InstanceUIDs{
+				StudyInstanceUID:  studyUID,
+				SeriesInstanceUID: seriesUID,
+				SOPInstanceUID:    sopUID,
+			},
+			Attributes: NewJSONDataset([]*dicom.Element{
+				mustNewElement(tag.SOPClassUID, []string{"1.2.840.10008.5.1.4.1.1.7"}),
+				mustNewElement(tag.StudyInstanceUID, []string{studyUID}),
+				mustNewElement(tag.SeriesInstanceUID, []string{seriesUID}),
+				mustNewElement(tag.SOPInstanceUID, []string{sopUID}),
+				mustNewElement(tag.PatientID, []string{"P" + studyUID}),
+				mustNewElement(tag.PatientName, []string{"DOE^" + studyUID}),
+				mustNewElement(tag.StudyDate, []string{studyDate}),
+				mustNewElement(tag.Modality, []string{modality}),
+				mustNewElement(tag.SeriesNumber, []string{seriesNumber}),
+				mustNewElement(tag.InstanceNumber, []string{instanceNumber}),
+			}),
+		}
+	}
+
+	index := NewMemoryIndex()
+	for _, instance := range []InstanceMetadata{
+		newInstance("1", "1.2", "1.2.1", "20240301", "PT", "2", "1"),
+		newInstance("1", "1.1", "1.1.2", "20240301", "CT", "1", "2"),
+		newInstance("1", "1.1", "1.1.1", "20240301", "CT", "1", "1"),
+		newInstance("2", "2.1", "2.1.1", "20240310", "MR", "1", "1"),
+	} {
+		index.Add(instance)
+	}
+	repository := NewIndexedFileRepository(nil, index)
+
+	tests := []struct {
+		name    string
+		list    func() (interface{}, error)
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name: "lists studies most recent first",
+			list: func() (interface{}, error) {
+				return repository.ListStudies()
+			},
+			want: []Study{
+				{
+					StudyInstanceUID:  "2",
+					Patient:           Patient{PatientID: "P2", PatientName: "DOE^2"},
+					StudyDate:         "20240310",
+					Modalities:        []string{"MR"},
+					NumberOfSeries:    1,
+					NumberOfInstances: 1,
+				},
+				{
+					StudyInstanceUID:  "1",
+					Patient:           Patient{PatientID: "P1", PatientName: "DOE^1"},
+					StudyDate:         "20240301",
+					Modalities:        []string{"PT", "CT"},
+					NumberOfSeries:    2,
+					NumberOfInstances: 3,
+				},
+			},
+		},
+		{
+			name: "lists series of a study by series number",
+			list: func() (interface{}, error) {
+				return repository.ListSeries("1")
+			},
+			want: []Series{
+				{SeriesInstanceUID: "1.1", StudyInstanceUID: "1", Modality: "CT", SeriesNumber: 1, NumberOfInstances: 2},
+				{SeriesInstanceUID: "1.2", StudyInstanceUID: "1", Modality: "PT", SeriesNumber: 2, NumberOfInstances: 1},
+			},
+		},
+		{
+			name: "lists instances of a series by instance number",
+			list: func() (interface{}, error) {
+				return repository.ListInstances("1", "1.1")
+			},
+			want: []Instance{
+				{
+					FileID:            "file-1.1.1",
+					SOPInstanceUID:    "1.1.1",
+					SOPClassUID:       "1.2.840.10008.5.1.4.1.1.7",
+					SeriesInstanceUID: "1.1",
+					StudyInstanceUID:  "1",
+					InstanceNumber:    1,
+				},
+				{
+					FileID:            "file-1.1.2",
+					SOPInstanceUID:    "1.1.2",
+					SOPClassUID:       "1.2.840.10008.5.1.4.1.1.7",
+					SeriesInstanceUID: "1.1",
+					StudyInstanceUID:  "1",
+					InstanceNumber:    2,
+				},
+			},
+		},
+		{
+			name: "fails for unknown studies",
+			list: func() (interface{}, error) {
+				return repository.ListSeries("3")
+			},
+			want:    []Series(nil),
+			wantErr: ErrStudyNotFound,
+		},
+		{
+			name: "fails for unknown series",
+			list: func() (interface{}, error) {
+				return repository.ListInstances("3", "3.1")
+			},
+			want:    []Instance(nil),
+			wantErr: ErrSeriesNotFound,
+		},
+		{
+			name: "fails for series of another study",
+			list: func() (interface{}, error) {
+				return repository.ListInstances("2", "1.1")
+			},
+			want:    []Instance(nil),
+			wantErr: ErrSeriesNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.list()
+			if err != tt.wantErr {
+				t.Errorf("list error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("list = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_indexedFileRepository_delete(t *testing.T) {
+	index := NewMemoryIndex()
+	repository := NewIndexedFileRepository(NewLocalFileAdapter(LocalFileRoot(t.TempDir())), index)
+
+	for _, uids := range []InstanceUIDs{
+		{StudyInstanceUID: "1", SeriesInstanceUID: "1.1", SOPInstanceUID: "1.1.1"},
+		{StudyInstanceUID: "1", SeriesInstanceUID: "1.1", SOPInstanceUID: "1.1.2"},
+		{StudyInstanceUID: "1", SeriesInstanceUID: "1.2", SOPInstanceUID: "1.2.1"},
+		{StudyInstanceUID: "2", SeriesInstanceUID: "2.1", SOPInstanceUID: "2.1.1"},
+	} {
+		file := newTestFile(t,
+			mustNewElement(tag.StudyInstanceUID, []string{uids.StudyInstanceUID}),
+			mustNewElement(tag.SeriesInstanceUID, []string{uids.SeriesInstanceUID}),
+			mustNewElement(tag.SOPInstanceUID, []string{uids.SOPInstanceUID}),
+		)
+		file.ID = "file-" + uids.SOPInstanceUID
+		if err := repository.Create(*file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// indexedFileIDs test helper to list the IDs of the indexed files
+	indexedFileIDs := func() []string {
+		instances, _ := index.Find(InstanceUIDs{})
+		var fileIDs []string
+		for _, instance := range instances {
+			fileIDs = append(fileIDs, instance.FileID)
+		}
+		sort.Strings(fileIDs)
+		return fileIDs
+	}
+
+	deleted, err := repository.DeleteSeries("1", "1.1")
+	if err != nil {
+		t.Fatalf("DeleteSeries() error = %v", err)
+	}
+	sort.Strings(deleted)
+	if want := []string{"file-1.1.1", "file-1.1.2"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("DeleteSeries() = %v, want %v", deleted, want)
+	}
+	if got, want := indexedFileIDs(), []string{"file-1.2.1", "file-2.1.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DeleteSeries() indexed = %v, want %v", got, want)
+	}
+
+	if _, err := repository.DeleteSeries("2", "1.2"); !errors.Is(err, ErrSeriesNotFound) {
+		t.Errorf("DeleteSeries() of series of another study error = %v, want %v", err, ErrSeriesNotFound)
+	}
+
+	deleted, err = repository.DeleteStudy("1")
+	if err != nil {
+		t.Fatalf("DeleteStudy() error = %v", err)
+	}
+	if want := []string{"file-1.2.1"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("DeleteStudy() = %v, want %v", deleted, want)
+	}
+	if _, err := repository.DeleteStudy("1"); !errors.Is(err, ErrStudyNotFound) {
+		t.Errorf("DeleteStudy() of deleted study error = %v, want %v", err, ErrStudyNotFound)
+	}
+
+	// restored files are indexed again
+	if err := repository.Restore("file-1.1.1"); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if got, want := indexedFileIDs(), []string{"file-1.1.1", "file-2.1.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Restore() indexed = %v, want %v", got, want)
+	}
+}
+
+func Test_indexedFileRepository_Restore(t *testing.T) {
+	for name, newIndex := range testMetadataIndexes() {
+		t.Run(name, func(t *testing.T) {
+			index := newIndex(t)
+			repository := NewIndexedFileRepository(NewLocalFileAdapter(LocalFileRoot(t.TempDir())), index)
+
+			file := newTestFile(t,
+				mustNewElement(tag.StudyInstanceUID, []string{"1"}),
+				mustNewElement(tag.SeriesInstanceUID, []string{"1.1"}),
+				mustNewElement(tag.SOPInstanceUID, []string{"1.1.1"}),
+			)
+			file.ID = "file"
+			if err := repository.Create(*file); err != nil {
+				t.Fatal(err)
+			}
+
+			instances, err := index.Find(InstanceUIDs{})
+			if err != nil || len(instances) != 1 {
+				t.Fatalf("Find() = %v, %v, want 1 instance", instances, err)
+			}
+			created := instances[0].Created
+
+			if err := repository.Delete("file"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if err := repository.Restore("file"); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+
+			instances, err = index.Find(InstanceUIDs{})
+			if err != nil || len(instances) != 1 {
+				t.Fatalf("Find() after Restore() = %v, %v, want 1 instance", instances, err)
+			}
+			if got := instances[0].Created; !got.Equal(created) {
+				t.Errorf("Restore() created = %v, want %v", got, created)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/suyashkumar/dicom"
+)
+
+// fileMetaInformationGroup the group of the file meta information elements
+const fileMetaInformationGroup = 0x0002
+
+var (
+	// ErrInvalidFile error indicating a file could not be parsed as DICOM
+	ErrInvalidFile = errors.New("file is not a valid DICOM file")
+)
+
+// InstanceMetadata the indexed metadata of a single DICOM instance
+type InstanceMetadata struct {
+	FileID string
+	InstanceUIDs
+
+	// Attributes the attributes of the instance in the DICOM JSON Model,
+	// excluding bulk data
+	Attributes JSONDataset
+
+	// Size the size of the file in bytes
+	Size int64
+
+	// ContentHash the hex encoded SHA-256 hash of the file
+	ContentHash string
+
+	// Created the time the file was added to the repository
+	Created time.Time
+}
+
+// NewInstanceMetadata reads the metadata of a DICOM file for indexing
+func NewInstanceMetadata(file *File) (InstanceMetadata, error) {
+	dataSet, err := file.Header()
+	if err != nil {
+		return InstanceMetadata{}, fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+
+	uids, err := file.UIDs()
+	if err != nil {
+		return InstanceMetadata{}, fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+
+	contentHash, err := file.ContentHash()
+	if err != nil {
+		return InstanceMetadata{}, err
+	}
+
+	// file meta information describes the encoding of the file rather than
+	// the instance, so is not indexed
+	var elements []*dicom.Element
+	for _, element := range dataSet.Elements {
+		if element.Tag.Group != fileMetaInformationGroup && !isBulkData(element) {
+			elements = append(elements, element)
+		}
+	}
+
+	return InstanceMetadata{
+		FileID:       file.ID,
+		InstanceUIDs: uids,
+		Attributes:   NewJSONDataset(elements),
+		Size:         file.Size(),
+		ContentHash:  contentHash,
+	}, nil
+}
+
+// MetadataIndex an index of the metadata of DICOM instances, allowing
+// studies, series and instances to be found without parsing every file
+type MetadataIndex interface {
+	Add(metadata InstanceMetadata) error
+	Remove(fileID string) error
+	Removed(fileID string) (time.Time, bool, error)
+	Find(query InstanceUIDs) ([]InstanceMetadata, error)
+	FindByContentHash(contentHash string) ([]InstanceMetadata, error)
+	Search(query SearchQuery) ([]JSONDataset, error)
+	List(query ListQuery) (ListResult, error)
+}
+
+// memoryMetadataIndex an implementation of MetadataIndex that holds the index
+// in memory
+type memoryMetadataIndex struct {
+	mu        sync.RWMutex
+	instances []InstanceMetadata
+
+	// removed when each file removed from the index was created, until it is
+	// added again
+	removed map[string]time.Time
+}
+
+// NewMemoryIndex construct an in-memory metadata index
+func NewMemoryIndex() MetadataIndex {
+	return &memoryMetadataIndex{}
+}
+
+// Add add the metadata of an instance to the index, replacing any metadata
+// already indexed for the file
+func (m *memoryMetadataIndex) Add(metadata InstanceMetadata) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.removed, metadata.FileID)
+
+	for idx, instance := range m.instances {
+		if instance.FileID == metadata.FileID {
+			m.instances[idx] = metadata
+			return nil
+		}
+	}
+
+	m.instances = append(m.instances, metadata)
+	return nil
+}
+
+// Remove remove the metadata of a file from the index, noting when the file
+// was created in case it is restored
+func (m *memoryMetadataIndex) Remove(fileID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for idx, instance := range m.instances {
+		if instance.FileID == fileID {
+			if m.removed == nil {
+				m.removed = make(map[string]time.Time)
+			}
+			m.removed[fileID] = instance.Created
+
+			m.instances = append(m.instances[:idx], m.instances[idx+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+// Removed retrieve when a file removed from the index was created, if it was
+// indexed
+func (m *memoryMetadataIndex) Removed(fileID string) (time.Time, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	created, ok := m.removed[fileID]
+	return created, ok, nil
+}
+
+// Find retrieve the metadata of the instances belonging to the study, series
+// or instance identified by the given UIDs
+func (m *memoryMetadataIndex) Find(query InstanceUIDs) ([]InstanceMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var instances []InstanceMetadata
+	for _, instance := range m.instances {
+		if instance.Matches(query) {
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+// FindByContentHash retrieve the metadata of the instances of files with the
+// content hash
+func (m *memoryMetadataIndex) FindByContentHash(contentHash string) ([]InstanceMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var instances []InstanceMetadata
+	for _, instance := range m.instances {
+		if instance.ContentHash == contentHash {
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+// Search search the index for studies, series or instances matching the query
+func (m *memoryMetadataIndex) Search(query SearchQuery) ([]JSONDataset, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return search(m.instances, query), nil
+}
+
+// List list the instances matching the filters of the query, sorted by the
+// query sort key then file ID
+func (m *memoryMetadataIndex) List(query ListQuery) (ListResult, error) {
+	if err := query.validate(); err != nil {
+		return ListResult{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var instances []InstanceMetadata
+	for _, instance := range m.instances {
+		if query.matches(instance) {
+			instances = append(instances, instance)
+		}
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return query.cursor(instances[i]).compare(query.cursor(instances[j])) < 0
+	})
+
+	total := len(instances)
+	if query.Cursor != nil {
+		after := sort.Search(len(instances), func(i int) bool {
+			return query.cursor(instances[i]).compare(*query.Cursor) > 0
+		})
+		instances = instances[after:]
+	}
+
+	if query.Offset >= len(instances) {
+		return query.page(nil, total), nil
+	}
+
+	return query.page(instances[query.Offset:], total), nil
+}
+
+// indexedFileRepository a FileRepository decorator that adds the metadata of
+// every file created to a metadata index
+type indexedFileRepository struct {
+	FileRepository
+	index MetadataIndex
+}
+
+// NewIndexedFileRepository construct a file repository which indexes the
+// metadata of every file created in the given repository, listing the files by
+// study and series from the index. Files that cannot be parsed as DICOM are
+// rejected
+func NewIndexedFileRepository(
+	repository FileRepository,
+	index MetadataIndex,
+) StudyRepository {
+	return &indexedFileRepository{
+		FileRepository: repository,
+		index:          index,
+	}
+}
+
+// Create create a new DICOM file and index its metadata
+func (r *indexedFileRepository) Create(file File) error {
+	metadata, err := NewInstanceMetadata(&file)
+	if err != nil {
+		return err
+	}
+
+	return r.create(file, metadata)
+}
+
+// create utility to create a new DICOM file and index the metadata already
+// read from it
+func (r *indexedFileRepository) create(file File, metadata InstanceMetadata) error {
+	if err := r.FileRepository.Create(file); err != nil {
+		return err
+	}
+
+	metadata.Created = time.Now()
+	return r.index.Add(metadata)
+}
+
+// Delete delete a DICOM file and remove its metadata from the index. The
+// metadata is removed even if the file is no longer in the repository, so that
+// the index does not list missing files
+func (r *indexedFileRepository) Delete(id string) error {
+	err := r.FileRepository.Delete(id)
+	if err != nil && !errors.Is(err, ErrFileNotFound) {
+		return err
+	}
+
+	if err := r.index.Remove(id); err != nil {
+		return err
+	}
+
+	return err
+}
+
+// Restore restore a deleted DICOM file and index its metadata again. The file
+// keeps the time it was first created, so it is listed and matched as a
+// duplicate as it was before it was deleted
+func (r *indexedFileRepository) Restore(id string) error {
+	if err := r.FileRepository.Restore(id); err != nil {
+		return err
+	}
+
+	file, err := r.FileRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	metadata, err := NewInstanceMetadata(file)
+	if err != nil {
+		return err
+	}
+
+	created, ok, err := r.index.Removed(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		created = time.Now()
+	}
+
+	metadata.Created = created
+	return r.index.Add(metadata)
+}
+
+// RebuildIndex utility to add the metadata of every file in the repository to
+// the index, removing files no longer in the repository. Files that cannot be
+// parsed are skipped. Files already indexed keep the time they were created
+func RebuildIndex(repository FileRepository, index MetadataIndex) error {
+	fileIDs, err := repository.GetAll()
+	if err != nil {
+		return err
+	}
+
+	indexed, err := index.Find(InstanceUIDs{})
+	if err != nil {
+		return err
+	}
+
+	stale := make(map[string]time.Time, len(indexed))
+	for _, instance := range indexed {
+		stale[instance.FileID] = instance.Created
+	}
+
+	for _, fileID := range fileIDs {
+		file, err := repository.Get(fileID)
+		if err != nil {
+			if errors.Is(err, ErrFileNotFound) {
+				continue
+			}
+			return err
+		}
+
+		metadata, err := NewInstanceMetadata(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+
+		created, ok := stale[fileID]
+		if !ok {
+			created = time.Now()
+		}
+		delete(stale, fileID)
+		metadata.Created = created
+
+		if err := index.Add(metadata); err != nil {
+			return err
+		}
+	}
+
+	for fileID := range stale {
+		if err := index.Remove(fileID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,530 @@
+package dicom
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+var (
+	// ErrInvalidJSONAttribute error indicating an attribute in the DICOM JSON
+	// Model cannot be decoded into an element
+	ErrInvalidJSONAttribute = errors.New("invalid DICOM JSON attribute")
+)
+
+// JSONDataset a DICOM dataset in the DICOM JSON Model, keyed by tags in the
+// form GGGGEEEE. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part18/chapter_F.html
+type JSONDataset map[string]JSONAttribute
+
+// JSONAttribute a single attribute of a dataset in the DICOM JSON Model
+type JSONAttribute struct {
+	VR           string        `json:"vr"`
+	Value        []interface{} `json:"Value,omitempty"`
+	InlineBinary string        `json:"InlineBinary,omitempty"`
+	BulkDataURI  string        `json:"BulkDataURI,omitempty"`
+}
+
+// JSONPersonName a person name value in the DICOM JSON Model, split into its
+// component groups
+type JSONPersonName struct {
+	Alphabetic  string `json:"Alphabetic,omitempty"`
+	Ideographic string `json:"Ideographic,omitempty"`
+	Phonetic    string `json:"Phonetic,omitempty"`
+}
+
+// Strings returns the values of the attribute in their DICOM string
+// representation, e.g. person names as their component groups separated by
+// "=". Empty values are returned as empty strings and sequences are ignored
+func (a JSONAttribute) Strings() []string {
+	var values []string
+	for _, value := range a.Value {
+		switch v := value.(type) {
+		case string:
+			values = append(values, v)
+		case json.Number:
+			values = append(values, v.String())
+		case int:
+			values = append(values, strconv.Itoa(v))
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'g', -1, 64))
+		case JSONPersonName:
+			values = append(values, strings.TrimRight(
+				strings.Join([]string{v.Alphabetic, v.Ideographic, v.Phonetic}, "="), "="))
+		case nil:
+			values = append(values, "")
+		}
+	}
+
+	return values
+}
+
+// UnmarshalJSON decodes an attribute in the DICOM JSON Model, reading person
+// names as JSONPersonName, sequence items as JSONDataset and numbers as
+// json.Number, as they are encoded
+func (a *JSONAttribute) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		VR           string            `json:"vr"`
+		Value        []json.RawMessage `json:"Value"`
+		InlineBinary string            `json:"InlineBinary"`
+		BulkDataURI  string            `json:"BulkDataURI"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	attribute := JSONAttribute{
+		VR:           raw.VR,
+		InlineBinary: raw.InlineBinary,
+		BulkDataURI:  raw.BulkDataURI,
+	}
+
+	for _, rawValue := range raw.Value {
+		var value interface{}
+		switch {
+		case string(rawValue) == "null":
+		case raw.VR == "PN":
+			var name JSONPersonName
+			if err := json.Unmarshal(rawValue, &name); err != nil {
+				return err
+			}
+			value = name
+		case raw.VR == "SQ":
+			var item JSONDataset
+			if err := json.Unmarshal(rawValue, &item); err != nil {
+				return err
+			}
+			value = item
+		default:
+			decoder := json.NewDecoder(bytes.NewReader(rawValue))
+			decoder.UseNumber()
+			if err := decoder.Decode(&value); err != nil {
+				return err
+			}
+		}
+
+		attribute.Value = append(attribute.Value, value)
+	}
+
+	*a = attribute
+	return nil
+}
+
+// JSONEncodeOptions options for encoding a dataset in the DICOM JSON Model
+type JSONEncodeOptions struct {
+	bulkDataURI func(t tag.Tag) string
+}
+
+// JSONBulkDataURI option to reference bulk data, such as pixel data, by URI
+// rather than omitting or inlining it. Bulk data is inlined if the function
+// returns an empty URI
+func JSONBulkDataURI(bulkDataURI func(t tag.Tag) string) func(opts *JSONEncodeOptions) {
+	return func(opts *JSONEncodeOptions) {
+		opts.bulkDataURI = bulkDataURI
+	}
+}
+
+// NewJSONDataset encodes the given elements in the DICOM JSON Model. Pixel
+// data is omitted unless a bulk data URI is provided for it
+func NewJSONDataset(
+	elements []*dicom.Element,
+	options ...func(opts *JSONEncodeOptions),
+) JSONDataset {
+	var opts JSONEncodeOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	return newJSONDataset(elements, opts)
+}
+
+// JSONDataset encodes the elements of the lookup in the DICOM JSON Model as a
+// single dataset. Elements nested in sequences are encoded within their
+// sequence item, preceded by empty items if need be, and missing elements are
+// omitted
+func (l DICOMElementsLookup) JSONDataset(options ...func(opts *JSONEncodeOptions)) (JSONDataset, error) {
+	var opts JSONEncodeOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	dataset := make(JSONDataset, len(l))
+	for key, element := range l {
+		if element == nil {
+			continue
+		}
+
+		path, err := ParseElementPath(key)
+		if err != nil {
+			return nil, err
+		}
+
+		attribute, ok := newJSONAttribute(element, opts)
+		if !ok {
+			continue
+		}
+
+		item := dataset
+		for _, sequenceItem := range path.Items {
+			item = jsonSequenceItem(item, sequenceItem)
+		}
+
+		// a sequence may have already been added to hold its nested elements
+		tagKey := JSONTagKey(path.Tag)
+		if existing, ok := item[tagKey]; ok && attribute.VR == "SQ" {
+			for idx := len(existing.Value); idx < len(attribute.Value); idx++ {
+				existing.Value = append(existing.Value, JSONDataset{})
+			}
+			attribute = existing
+		}
+		item[tagKey] = attribute
+	}
+
+	return dataset, nil
+}
+
+// jsonSequenceItem utility to retrieve an item of a sequence of the dataset,
+// adding the sequence and any items preceding the item if they do not exist
+func jsonSequenceItem(dataset JSONDataset, sequenceItem SequenceItem) JSONDataset {
+	key := JSONTagKey(sequenceItem.Tag)
+	sequence, ok := dataset[key]
+	if !ok {
+		sequence = JSONAttribute{VR: "SQ"}
+	}
+
+	for len(sequence.Value) <= sequenceItem.Index {
+		sequence.Value = append(sequence.Value, JSONDataset{})
+	}
+	dataset[key] = sequence
+
+	item, _ := sequence.Value[sequenceItem.Index].(JSONDataset)
+	return item
+}
+
+func newJSONDataset(elements []*dicom.Element, opts JSONEncodeOptions) JSONDataset {
+	dataset := make(JSONDataset, len(elements))
+	for _, element := range elements {
+		// group lengths are retired and have no meaning once re-encoded
+		if element.Tag.Element == 0x0000 {
+			continue
+		}
+
+		attribute, ok := newJSONAttribute(element, opts)
+		if !ok {
+			continue
+		}
+
+		dataset[JSONTagKey(element.Tag)] = attribute
+	}
+
+	return dataset
+}
+
+// newJSONAttribute encodes a single element in the DICOM JSON Model. Returns
+// false if the element should be omitted
+func newJSONAttribute(element *dicom.Element, opts JSONEncodeOptions) (JSONAttribute, bool) {
+	vr := elementVR(element)
+	attribute := JSONAttribute{VR: vr}
+
+	if element.Value == nil {
+		return attribute, true
+	}
+
+	if opts.bulkDataURI != nil && isBulkData(element) {
+		if uri := opts.bulkDataURI(element.Tag); uri != "" {
+			attribute.BulkDataURI = uri
+			return attribute, true
+		}
+	}
+
+	switch element.Value.ValueType() {
+	case dicom.PixelData:
+		return JSONAttribute{}, false
+	case dicom.Bytes:
+		data, _ := element.Value.GetValue().([]byte)
+		if len(data) > 0 {
+			attribute.InlineBinary = base64.StdEncoding.EncodeToString(data)
+		}
+	case dicom.Sequences:
+		items, _ := element.Value.GetValue().([]*dicom.SequenceItemValue)
+		for _, item := range items {
+			itemElements, _ := item.GetValue().([]*dicom.Element)
+			attribute.Value = append(attribute.Value, newJSONDataset(itemElements, opts))
+		}
+	case dicom.Ints:
+		values, _ := element.Value.GetValue().([]int)
+		if vr == "AT" {
+			// attribute tags are parsed as pairs of group and element
+			for idx := 0; idx+1 < len(values); idx += 2 {
+				attribute.Value = append(attribute.Value, JSONTagKey(tag.Tag{
+					Group:   uint16(values[idx]),
+					Element: uint16(values[idx+1]),
+				}))
+			}
+			break
+		}
+		for _, value := range values {
+			attribute.Value = append(attribute.Value, value)
+		}
+	case dicom.Floats:
+		values, _ := element.Value.GetValue().([]float64)
+		for _, value := range values {
+			attribute.Value = append(attribute.Value, value)
+		}
+	case dicom.Strings:
+		values, _ := element.Value.GetValue().([]string)
+		attribute.Value = jsonStringValues(vr, values)
+	}
+
+	return attribute, true
+}
+
+// jsonStringValues utility to encode string values according to their VR.
+// Numeric strings are encoded as numbers and person names as component groups
+func jsonStringValues(vr string, values []string) []interface{} {
+	// a single empty value denotes an empty element
+	if len(values) == 1 && strings.TrimSpace(values[0]) == "" {
+		return nil
+	}
+
+	var jsonValues []interface{}
+	for _, value := range values {
+		value = strings.TrimRight(value, " \x00")
+
+		switch vr {
+		case "IS":
+			number, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				jsonValues = append(jsonValues, nil)
+				continue
+			}
+			jsonValues = append(jsonValues, json.Number(strconv.FormatInt(number, 10)))
+		case "DS":
+			number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				jsonValues = append(jsonValues, nil)
+				continue
+			}
+			jsonValues = append(jsonValues, json.Number(strconv.FormatFloat(number, 'g', -1, 64)))
+		case "PN":
+			if value == "" {
+				jsonValues = append(jsonValues, nil)
+				continue
+			}
+			jsonValues = append(jsonValues, newJSONPersonName(value))
+		default:
+			if value == "" {
+				jsonValues = append(jsonValues, nil)
+				continue
+			}
+			jsonValues = append(jsonValues, value)
+		}
+	}
+
+	return jsonValues
+}
+
+// newJSONPersonName utility to split a person name into its alphabetic,
+// ideographic and phonetic component groups
+func newJSONPersonName(value string) JSONPersonName {
+	groups := strings.SplitN(value, "=", 3)
+	for len(groups) < 3 {
+		groups = append(groups, "")
+	}
+
+	return JSONPersonName{
+		Alphabetic:  groups[0],
+		Ideographic: groups[1],
+		Phonetic:    groups[2],
+	}
+}
+
+// JSONTagKey formats a tag in the form GGGGEEEE, as used to key the
+// attributes of a dataset in the DICOM JSON Model
+func JSONTagKey(t tag.Tag) string {
+	return fmt.Sprintf("%04X%04X", t.Group, t.Element)
+}
+
+// elementVR utility to determine the VR of an element, falling back to the
+// dictionary VR and then UN
+func elementVR(element *dicom.Element) string {
+	vr := strings.TrimSpace(element.RawValueRepresentation)
+	if len(vr) == 2 {
+		return vr
+	}
+
+	if info, err := tag.Find(element.Tag); err == nil && len(info.VR) == 2 {
+		return info.VR
+	}
+
+	return tag.UnknownVR
+}
+
+// isBulkData utility to determine whether an element holds bulk data, which
+// may be referenced by URI rather than included in a dataset
+func isBulkData(element *dicom.Element) bool {
+	if element.Tag == tag.PixelData {
+		return true
+	}
+
+	switch elementVR(element) {
+	case "OB", "OD", "OF", "OL", "OV", "OW", "UN":
+		return true
+	default:
+		return false
+	}
+}
+
+// Elements decodes the dataset into DICOM elements, sorted by tag. Attributes
+// holding bulk data by URI rather than inline are omitted, as the bulk data
+// cannot be resolved
+func (d JSONDataset) Elements() ([]*dicom.Element, error) {
+	elements := make([]*dicom.Element, 0, len(d))
+	for key, attribute := range d {
+		t, err := parseJSONTagKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if attribute.BulkDataURI != "" && attribute.InlineBinary == "" {
+			continue
+		}
+
+		element, err := attribute.element(t)
+		if err != nil {
+			return nil, fmt.Errorf("%w %s: %w", ErrInvalidJSONAttribute, key, err)
+		}
+		elements = append(elements, element)
+	}
+
+	sort.Slice(elements, func(i, j int) bool {
+		return elements[i].Tag.Compare(elements[j].Tag) < 0
+	})
+
+	return elements, nil
+}
+
+// element decodes the attribute into a DICOM element with the given tag,
+// holding values of the type the parser reads for its VR
+func (a JSONAttribute) element(t tag.Tag) (*dicom.Element, error) {
+	vr := a.VR
+	if len(vr) != 2 {
+		return nil, fmt.Errorf("malformed vr %q", vr)
+	}
+
+	var data interface{}
+	switch vr {
+	case "SQ":
+		items := make([][]*dicom.Element, 0, len(a.Value))
+		for _, value := range a.Value {
+			item, ok := value.(JSONDataset)
+			if !ok {
+				return nil, fmt.Errorf("sequence item is not a dataset")
+			}
+			itemElements, err := item.Elements()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, itemElements)
+		}
+		data = items
+	case "OB", "OD", "OF", "OL", "OV", "OW", "UN":
+		binary, err := base64.StdEncoding.DecodeString(a.InlineBinary)
+		if err != nil {
+			return nil, err
+		}
+		data = binary
+
+		// pixel data is held unprocessed, so that it is written back as is
+		if t == tag.PixelData {
+			data = dicom.PixelDataInfo{
+				IntentionallyUnprocessed: true,
+				UnprocessedValueData:     binary,
+			}
+		}
+	case "AT":
+		values := make([]int, 0, 2*len(a.Value))
+		for _, value := range a.Value {
+			key, _ := value.(string)
+			attributeTag, err := parseJSONTagKey(key)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, int(attributeTag.Group), int(attributeTag.Element))
+		}
+		data = values
+	case "US", "SS", "UL", "SL", "UV", "SV":
+		values := make([]int, 0, len(a.Value))
+		for _, value := range a.Value {
+			number, err := strconv.ParseInt(jsonNumberString(value), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, int(number))
+		}
+		data = values
+	case "FL", "FD":
+		values := make([]float64, 0, len(a.Value))
+		for _, value := range a.Value {
+			number, err := strconv.ParseFloat(jsonNumberString(value), 64)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, number)
+		}
+		data = values
+	default:
+		values := a.Strings()
+		if values == nil {
+			values = []string{}
+		}
+		data = values
+	}
+
+	value, err := dicom.NewValue(data)
+	if err != nil {
+		return nil, err
+	}
+
+	element := &dicom.Element{
+		Tag:                    t,
+		ValueRepresentation:    tag.GetVRKind(t, vr),
+		RawValueRepresentation: vr,
+		Value:                  value,
+	}
+	if info, ok := data.(dicom.PixelDataInfo); ok {
+		element.ValueLength = uint32(len(info.UnprocessedValueData))
+	}
+
+	return element, nil
+}
+
+// jsonNumberString utility to format a numeric value of an attribute as a
+// string, as decoded or as encoded by NewJSONDataset
+func jsonNumberString(value interface{}) string {
+	values := JSONAttribute{Value: []interface{}{value}}.Strings()
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// parseJSONTagKey utility to parse a tag in the form GGGGEEEE, as used to key
+// the attributes of a dataset in the DICOM JSON Model
+func parseJSONTagKey(key string) (tag.Tag, error) {
+	parsed, err := strconv.ParseUint(key, 16, 32)
+	if err != nil || len(key) != 8 {
+		return tag.Tag{}, fmt.Errorf("%w %s", ErrMalformedTag, key)
+	}
+
+	return tag.Tag{Group: uint16(parsed >> 16), Element: uint16(parsed)}, nil
+}
@@ -0,0 +1,305 @@
+package dicom
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/frame"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_NewJSONDataset(t *testing.T) {
+	pixelDataValue, _ := dicom.NewValue(dicom.PixelDataInfo{
+		Frames: []*frame.Frame{
+			{
+				NativeData: frame.NativeFrame{
+					Data: [][]int{{0}},
+					Rows: 1,
+					Cols: 1,
+				},
+			},
+		},
+	})
+
+	type args struct {
+		elements []*dicom.Element
+		options  []func(opts *JSONEncodeOptions)
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "encodes empty dataset",
+			args: args{},
+			want: `{}`,
+		},
+		{
+			name: "encodes string values",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.Modality, []string{"CT"}),
+				},
+			},
+			want: `{"00080060":{"vr":"CS","Value":["CT"]}}`,
+		},
+		{
+			name: "encodes empty string values without a value",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.AccessionNumber, []string{""}),
+				},
+			},
+			want: `{"00080050":{"vr":"SH"}}`,
+		},
+		{
+			name: "encodes person name component groups",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.PatientName, []string{"Yamada^Tarou=山田^太郎=やまだ^たろう"}),
+				},
+			},
+			want: `{"00100010":{"vr":"PN","Value":[{"Alphabetic":"Yamada^Tarou","Ideographic":"山田^太郎","Phonetic":"やまだ^たろう"}]}}`,
+		},
+		{
+			name: "encodes numeric strings as numbers",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.SliceThickness, []string{" 2.50"}),
+					mustNewElement(tag.InstanceNumber, []string{"007"}),
+				},
+			},
+			want: `{"00180050":{"vr":"DS","Value":[2.5]},"00200013":{"vr":"IS","Value":[7]}}`,
+		},
+		{
+			name: "encodes binary values inline",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.FileMetaInformationVersion, []byte{0x00, 0x01}),
+				},
+			},
+			want: `{"00020001":{"vr":"OB","InlineBinary":"AAE="}}`,
+		},
+		{
+			name: "encodes sequences as nested datasets",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.ReferencedSeriesSequence, [][]*dicom.Element{
+						{
+							mustNewElement(tag.SeriesInstanceUID, []string{"1.2.3"}),
+						},
+					}),
+				},
+			},
+			want: `{"00081115":{"vr":"SQ","Value":[{"0020000E":{"vr":"UI","Value":["1.2.3"]}}]}}`,
+		},
+		{
+			name: "omits pixel data",
+			args: args{
+				elements: []*dicom.Element{
+					{
+						Tag:                    tag.PixelData,
+						RawValueRepresentation: "OW",
+						Value:                  pixelDataValue,
+					},
+				},
+			},
+			want: `{}`,
+		},
+		{
+			name: "references pixel data by bulk data uri",
+			args: args{
+				elements: []*dicom.Element{
+					{
+						Tag:                    tag.PixelData,
+						RawValueRepresentation: "OW",
+						Value:                  pixelDataValue,
+					},
+				},
+				options: []func(opts *JSONEncodeOptions){
+					JSONBulkDataURI(func(t tag.Tag) string {
+						return "http://localhost/bulk/" + JSONTagKey(t)
+					}),
+				},
+			},
+			want: `{"7FE00010":{"vr":"OW","BulkDataURI":"http://localhost/bulk/7FE00010"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(NewJSONDataset(tt.args.elements, tt.args.options...))
+			if err != nil {
+				t.Errorf("NewJSONDataset() error = %v", err)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("NewJSONDataset() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_JSONDataset_Elements(t *testing.T) {
+	type args struct {
+		json string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr error
+	}{
+		{
+			name: "decodes string, numeric and person name values",
+			args: args{
+				json: `{
+					"00080060":{"vr":"CS","Value":["CT"]},
+					"00100010":{"vr":"PN","Value":[{"Alphabetic":"Yamada^Tarou","Ideographic":"山田^太郎"}]},
+					"00180050":{"vr":"DS","Value":[2.5]},
+					"00200013":{"vr":"IS","Value":[7]},
+					"00280010":{"vr":"US","Value":[512]},
+					"00189087":{"vr":"FD","Value":[0.25]}
+				}`,
+			},
+			want: `{"00080060":{"vr":"CS","Value":["CT"]},` +
+				`"00100010":{"vr":"PN","Value":[{"Alphabetic":"Yamada^Tarou","Ideographic":"山田^太郎"}]},` +
+				`"00180050":{"vr":"DS","Value":[2.5]},"00189087":{"vr":"FD","Value":[0.25]},` +
+				`"00200013":{"vr":"IS","Value":[7]},"00280010":{"vr":"US","Value":[512]}}`,
+		},
+		{
+			name: "decodes empty values",
+			args: args{
+				json: `{"00080050":{"vr":"SH"},"00080020":{"vr":"DA","Value":[null]}}`,
+			},
+			want: `{"00080020":{"vr":"DA"},"00080050":{"vr":"SH"}}`,
+		},
+		{
+			name: "decodes inline binary, attribute tags and sequences",
+			args: args{
+				json: `{
+					"00020001":{"vr":"OB","InlineBinary":"AAE="},
+					"00209165":{"vr":"AT","Value":["00209111","0020000E"]},
+					"00081115":{"vr":"SQ","Value":[{"0020000E":{"vr":"UI","Value":["1.2.3"]}},{}]}
+				}`,
+			},
+			want: `{"00020001":{"vr":"OB","InlineBinary":"AAE="},` +
+				`"00081115":{"vr":"SQ","Value":[{"0020000E":{"vr":"UI","Value":["1.2.3"]}},{}]},` +
+				`"00209165":{"vr":"AT","Value":["00209111","0020000E"]}}`,
+		},
+		{
+			name: "omits bulk data referenced by uri",
+			args: args{
+				json: `{"7FE00010":{"vr":"OW","BulkDataURI":"http://localhost/bulk"}}`,
+			},
+			want: `{}`,
+		},
+		{
+			name: "fails for malformed tags",
+			args: args{
+				json: `{"0008006":{"vr":"CS","Value":["CT"]}}`,
+			},
+			wantErr: ErrMalformedTag,
+		},
+		{
+			name: "fails for malformed values",
+			args: args{
+				json: `{"00280010":{"vr":"US","Value":["wide"]}}`,
+			},
+			wantErr: ErrInvalidJSONAttribute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dataset JSONDataset
+			if err := json.Unmarshal([]byte(tt.args.json), &dataset); err != nil {
+				t.Fatal(err)
+			}
+
+			elements, err := dataset.Elements()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("JSONDataset.Elements() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// the decoded elements must be writable, and encode as they were
+			// decoded
+			if _, err := newTestFile(t, elements...).DataSet(); err != nil {
+				t.Errorf("File.DataSet() error = %v", err)
+			}
+
+			got, err := json.Marshal(NewJSONDataset(elements))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("JSONDataset.Elements() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_DICOMElementsLookup_JSONDataset(t *testing.T) {
+	sequence := mustNewElement(tag.ReferencedSeriesSequence, [][]*dicom.Element{{}, {}})
+
+	type args struct {
+		lookup DICOMElementsLookup
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "encodes top level elements and omits missing elements",
+			args: args{
+				lookup: DICOMElementsLookup{
+					"(0008,0060)": mustNewElement(tag.Modality, []string{"CT"}),
+					"(0010,0010)": nil,
+				},
+			},
+			want: `{"00080060":{"vr":"CS","Value":["CT"]}}`,
+		},
+		{
+			name: "encodes nested elements within their sequence items",
+			args: args{
+				lookup: DICOMElementsLookup{
+					"(0008,1115)[1].(0020,000e)":                mustNewElement(tag.SeriesInstanceUID, []string{"1.2.5"}),
+					"(0008,1115)[1].(0008,114a)[0].(0008,1155)": mustNewElement(tag.ReferencedSOPInstanceUID, []string{"1.2.5.1"}),
+				},
+			},
+			want: `{"00081115":{"vr":"SQ","Value":[{},{"0008114A":{"vr":"SQ","Value":[` +
+				`{"00081155":{"vr":"UI","Value":["1.2.5.1"]}}]},"0020000E":{"vr":"UI","Value":["1.2.5"]}}]}}`,
+		},
+		{
+			name: "merges sequences with their nested elements",
+			args: args{
+				lookup: DICOMElementsLookup{
+					"(0008,1115)":                sequence,
+					"(0008,1115)[0].(0020,000e)": mustNewElement(tag.SeriesInstanceUID, []string{"1.2.4"}),
+				},
+			},
+			want: `{"00081115":{"vr":"SQ","Value":[{"0020000E":{"vr":"UI","Value":["1.2.4"]}},{}]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataset, err := tt.args.lookup.JSONDataset()
+			if err != nil {
+				t.Fatalf("DICOMElementsLookup.JSONDataset() error = %v", err)
+			}
+
+			got, err := json.Marshal(dataset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("DICOMElementsLookup.JSONDataset() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
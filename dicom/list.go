@@ -0,0 +1,225 @@
+package dicom
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+var (
+	// ErrInvalidCursor error indicating a list cursor is malformed or was
+	// issued for a different sort order
+	ErrInvalidCursor = errors.New("cursor is not valid")
+)
+
+// ListSort the key instances are sorted by when listed
+type ListSort string
+
+// Keys instances can be sorted by
+const (
+	ListSortCreated   ListSort = "created"
+	ListSortStudyDate ListSort = "studyDate"
+	ListSortSize      ListSort = "size"
+)
+
+// ListQuery a query to list indexed instances, filtered by key attributes.
+// Empty filters match any instance
+type ListQuery struct {
+	Modality  string
+	PatientID string
+
+	// StudyDateFrom, StudyDateTo the inclusive range of study dates, in the
+	// form YYYYMMDD
+	StudyDateFrom string
+	StudyDateTo   string
+
+	Sort       ListSort
+	Descending bool
+
+	// Cursor the position to continue listing after, as returned with the
+	// previous page. Must have been issued for the same sort order
+	Cursor *ListCursor
+
+	Limit  int
+	Offset int
+}
+
+// ListResult a page of instances matching a list query, with the total
+// number of matching instances
+type ListResult struct {
+	Instances []InstanceMetadata
+	Total     int
+
+	// NextCursor the position to list the next page from, nil if this is
+	// the last page
+	NextCursor *ListCursor
+}
+
+// ListCursor a position in a sorted listing of instances, identified by the
+// sort key and file ID of the last instance listed
+type ListCursor struct {
+	Sort       ListSort `json:"s"`
+	Descending bool     `json:"d,omitempty"`
+	Key        string   `json:"k"`
+	FileID     string   `json:"f"`
+}
+
+// ParseListCursor parse a cursor in the opaque form returned by String
+func ParseListCursor(value string) (ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return ListCursor{}, ErrInvalidCursor
+	}
+
+	var cursor ListCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.FileID == "" {
+		return ListCursor{}, ErrInvalidCursor
+	}
+
+	if _, err := cursor.key(); err != nil {
+		return ListCursor{}, err
+	}
+
+	return cursor, nil
+}
+
+// String encode the cursor in an opaque form, safe for use in URLs
+func (c ListCursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// key the sort key of the cursor, as an integer for the sorts by number and
+// as a string otherwise. Keys not of their sort are invalid
+func (c ListCursor) key() (interface{}, error) {
+	switch c.Sort {
+	case ListSortCreated, ListSortSize:
+		key, err := strconv.ParseInt(c.Key, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return key, nil
+	case ListSortStudyDate:
+		return c.Key, nil
+	default:
+		return nil, ErrInvalidCursor
+	}
+}
+
+// compare determines the order of two positions in the listing, negative if
+// the cursor comes before the other
+func (c ListCursor) compare(other ListCursor) int {
+	result := 0
+	switch c.Sort {
+	case ListSortCreated, ListSortSize:
+		key, _ := strconv.ParseInt(c.Key, 10, 64)
+		otherKey, _ := strconv.ParseInt(other.Key, 10, 64)
+		switch {
+		case key < otherKey:
+			result = -1
+		case key > otherKey:
+			result = 1
+		}
+	default:
+		result = strings.Compare(c.Key, other.Key)
+	}
+
+	if result == 0 {
+		result = strings.Compare(c.FileID, other.FileID)
+	}
+
+	if c.Descending {
+		return -result
+	}
+	return result
+}
+
+// sort the sort key of the query, defaulting to the time created
+func (q ListQuery) sort() ListSort {
+	switch q.Sort {
+	case ListSortStudyDate, ListSortSize:
+		return q.Sort
+	default:
+		return ListSortCreated
+	}
+}
+
+// cursor the position of an instance in the listing of the query
+func (q ListQuery) cursor(instance InstanceMetadata) ListCursor {
+	cursor := ListCursor{
+		Sort:       q.sort(),
+		Descending: q.Descending,
+		FileID:     instance.FileID,
+	}
+
+	switch cursor.Sort {
+	case ListSortStudyDate:
+		cursor.Key = FirstJSONString(instance.Attributes, tag.StudyDate)
+	case ListSortSize:
+		cursor.Key = strconv.FormatInt(instance.Size, 10)
+	default:
+		cursor.Key = strconv.FormatInt(instance.Created.UnixNano(), 10)
+	}
+
+	return cursor
+}
+
+// validate determines whether the query cursor was issued for the query sort
+// order, with a key of that sort
+func (q ListQuery) validate() error {
+	if q.Cursor == nil {
+		return nil
+	}
+
+	if q.Cursor.Sort != q.sort() || q.Cursor.Descending != q.Descending {
+		return ErrInvalidCursor
+	}
+
+	_, err := q.Cursor.key()
+	return err
+}
+
+// matches determines whether an instance passes the filters of the query
+func (q ListQuery) matches(instance InstanceMetadata) bool {
+	if q.Modality != "" && FirstJSONString(instance.Attributes, tag.Modality) != q.Modality {
+		return false
+	}
+	if q.PatientID != "" && FirstJSONString(instance.Attributes, tag.PatientID) != q.PatientID {
+		return false
+	}
+
+	studyDate := FirstJSONString(instance.Attributes, tag.StudyDate)
+	if q.StudyDateFrom != "" && studyDate < q.StudyDateFrom {
+		return false
+	}
+	if q.StudyDateTo != "" && (studyDate == "" || studyDate > q.StudyDateTo) {
+		return false
+	}
+
+	return true
+}
+
+// page utility to build a page of the listing from the sorted instances
+// following the cursor and offset of the query, of which there may be more
+// than the query limit
+func (q ListQuery) page(instances []InstanceMetadata, total int) ListResult {
+	result := ListResult{
+		Instances: []InstanceMetadata{},
+		Total:     total,
+	}
+
+	if q.Limit > 0 && len(instances) > q.Limit {
+		instances = instances[:q.Limit]
+		next := q.cursor(instances[len(instances)-1])
+		result.NextCursor = &next
+	}
+	if len(instances) > 0 {
+		result.Instances = instances
+	}
+
+	return result
+}
@@ -0,0 +1,272 @@
+package dicom
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_MetadataIndex_List(t *testing.T) {
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	newInstance := func(fileID, studyUID, patientID, studyDate, modality string, size int64, age time.Duration) InstanceMetadata {
+		return InstanceMetadata{
+			FileID: fileID,
+			InstanceUIDs: InstanceUIDs{
+				StudyInstanceUID:  studyUID,
+				SeriesInstanceUID: studyUID + ".1",
+				SOPInstanceUID:    studyUID + ".1." + fileID,
+			},
+			Attributes: NewJSONDataset([]*dicom.Element{
+				mustNewElement(tag.StudyInstanceUID, []string{studyUID}),
+				mustNewElement(tag.PatientID, []string{patientID}),
+				mustNewElement(tag.PatientName, []string{"DOE^" + patientID}),
+				mustNewElement(tag.StudyDate, []string{studyDate}),
+				mustNewElement(tag.Modality, []string{modality}),
+				mustNewElement(tag.Rows, []int{512}),
+			}),
+			Size:    size,
+			Created: created.Add(age),
+		}
+	}
+
+	instances := []InstanceMetadata{
+		newInstance("a", "1", "P1", "20240301", "CT", 300, 2*time.Hour),
+		newInstance("b", "1", "P1", "20240301", "CT", 100, time.Hour),
+		newInstance("c", "2", "P2", "20240310", "MR", 200, 3*time.Hour),
+		newInstance("d", "3", "P1", "20240320", "MR", 400, 0),
+	}
+
+	type args struct {
+		query ListQuery
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      []string
+		wantTotal int
+	}{
+		{
+			name:      "lists by created time",
+			args:      args{query: ListQuery{}},
+			want:      []string{"d", "b", "a", "c"},
+			wantTotal: 4,
+		},
+		{
+			name:      "lists by study date descending",
+			args:      args{query: ListQuery{Sort: ListSortStudyDate, Descending: true}},
+			want:      []string{"d", "c", "b", "a"},
+			wantTotal: 4,
+		},
+		{
+			name:      "lists by size with offset and limit",
+			args:      args{query: ListQuery{Sort: ListSortSize, Offset: 1, Limit: 2}},
+			want:      []string{"c", "a"},
+			wantTotal: 4,
+		},
+		{
+			name:      "filters by modality and patient ID",
+			args:      args{query: ListQuery{Modality: "MR", PatientID: "P1"}},
+			want:      []string{"d"},
+			wantTotal: 1,
+		},
+		{
+			name:      "filters by study date range",
+			args:      args{query: ListQuery{StudyDateFrom: "20240305", StudyDateTo: "20240315"}},
+			want:      []string{"c"},
+			wantTotal: 1,
+		},
+		{
+			name:      "lists nothing for offset beyond matches",
+			args:      args{query: ListQuery{Offset: 4}},
+			want:      []string{},
+			wantTotal: 4,
+		},
+	}
+	for name, newIndex := range testMetadataIndexes() {
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				index := newIndex(t)
+				for _, instance := range instances {
+					if err := index.Add(instance); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				got, err := index.List(tt.args.query)
+				if err != nil {
+					t.Fatalf("List() error = %v", err)
+				}
+
+				gotIDs := []string{}
+				for _, instance := range got.Instances {
+					gotIDs = append(gotIDs, instance.FileID)
+				}
+				if !reflect.DeepEqual(gotIDs, tt.want) {
+					t.Errorf("List() = %v, want %v", gotIDs, tt.want)
+				}
+				if got.Total != tt.wantTotal {
+					t.Errorf("List() total = %v, want %v", got.Total, tt.wantTotal)
+				}
+			})
+		}
+	}
+}
+
+func Test_MetadataIndex_List_cursor(t *testing.T) {
+	var instances []InstanceMetadata
+	for idx, size := range []int64{300, 100, 200, 100, 400} {
+		fileID := strconv.Itoa(idx)
+		instances = append(instances, InstanceMetadata{
+			FileID:       fileID,
+			InstanceUIDs: InstanceUIDs{SOPInstanceUID: fileID},
+			Attributes: NewJSONDataset([]*dicom.Element{
+				mustNewElement(tag.StudyDate, []string{fmt.Sprintf("2024030%d", size/100)}),
+			}),
+			Size:    size,
+			Created: time.Date(2024, 3, 1, 0, 0, idx%2, 0, time.UTC),
+		})
+	}
+
+	type args struct {
+		query ListQuery
+	}
+	tests := []struct {
+		name string
+		args args
+		want []string
+	}{
+		{
+			name: "pages by created time",
+			args: args{query: ListQuery{Limit: 2}},
+			want: []string{"0", "2", "4", "1", "3"},
+		},
+		{
+			name: "pages by size descending",
+			args: args{query: ListQuery{Sort: ListSortSize, Descending: true, Limit: 2}},
+			want: []string{"4", "0", "2", "3", "1"},
+		},
+		{
+			name: "pages by study date",
+			args: args{query: ListQuery{Sort: ListSortStudyDate, Limit: 3}},
+			want: []string{"1", "3", "2", "0", "4"},
+		},
+	}
+	for name, newIndex := range testMetadataIndexes() {
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				index := newIndex(t)
+				for _, instance := range instances {
+					if err := index.Add(instance); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				got := []string{}
+				query := tt.args.query
+				for page := 0; page <= len(instances); page++ {
+					result, err := index.List(query)
+					if err != nil {
+						t.Fatalf("List() error = %v", err)
+					}
+					if result.Total != len(instances) {
+						t.Errorf("List() total = %v, want %v", result.Total, len(instances))
+					}
+					for _, instance := range result.Instances {
+						got = append(got, instance.FileID)
+					}
+					if result.NextCursor == nil {
+						break
+					}
+
+					cursor, err := ParseListCursor(result.NextCursor.String())
+					if err != nil {
+						t.Fatalf("ParseListCursor() error = %v", err)
+					}
+					query.Cursor = &cursor
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("List() = %v, want %v", got, tt.want)
+				}
+
+				// cursors may only continue the sort order they were issued for
+				query.Sort, query.Descending = ListSortCreated, !query.Descending
+				if query.Cursor != nil {
+					if _, err := index.List(query); err != ErrInvalidCursor {
+						t.Errorf("List() error = %v, want %v", err, ErrInvalidCursor)
+					}
+				}
+
+				// cursors of numeric sorts must have numeric keys
+				malformed := ListQuery{Cursor: &ListCursor{Sort: ListSortCreated, Key: "first", FileID: "0"}}
+				if _, err := index.List(malformed); err != ErrInvalidCursor {
+					t.Errorf("List() error = %v, want %v", err, ErrInvalidCursor)
+				}
+			})
+		}
+	}
+}
+
+func Test_ParseListCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    ListCursor
+		wantErr bool
+	}{
+		{
+			name:  "parses a cursor",
+			value: ListCursor{Sort: ListSortSize, Descending: true, Key: "100", FileID: "a"}.String(),
+			want:  ListCursor{Sort: ListSortSize, Descending: true, Key: "100", FileID: "a"},
+		},
+		{
+			name:    "fails for malformed cursors",
+			value:   "not a cursor",
+			wantErr: true,
+		},
+		{
+			name:    "fails for non-numeric keys of numeric sorts",
+			value:   ListCursor{Sort: ListSortCreated, Key: "yesterday", FileID: "a"}.String(),
+			wantErr: true,
+		},
+		{
+			name:    "fails for unknown sorts",
+			value:   ListCursor{Sort: "name", Key: "a", FileID: "a"}.String(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseListCursor(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseListCursor() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseListCursor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testMetadataIndexes utility to construct each implementation of
+// MetadataIndex for testing
+func testMetadataIndexes() map[string]func(t *testing.T) MetadataIndex {
+	return map[string]func(t *testing.T) MetadataIndex{
+		"memory": func(t *testing.T) MetadataIndex {
+			return NewMemoryIndex()
+		},
+		"sqlite": func(t *testing.T) MetadataIndex {
+			index, err := NewSQLiteIndex(filepath.Join(t.TempDir(), "index.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return index
+		},
+	}
+}
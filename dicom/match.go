@@ -0,0 +1,176 @@
+package dicom
+
+import (
+	"strings"
+)
+
+// matchAttribute determines whether any value of an attribute with the given
+// VR matches the key, following the attribute matching rules of PS3.4. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part04/sect_C.2.2.2.html
+//
+// Supported are universal, single value, list of UID, wildcard and range
+// matching. Person names are matched case-insensitively
+func matchAttribute(vr string, values []string, key string) bool {
+	if key == "" {
+		return true
+	}
+
+	switch {
+	case vr == "UI":
+		return matchUIDList(values, key)
+	case isTemporalVR(vr) && strings.Contains(key, "-"):
+		return matchRange(vr, values, key)
+	case allowsWildcards(vr) && strings.ContainsAny(key, "*?"):
+		return matchAny(values, func(value string) bool {
+			if vr == "PN" {
+				return matchWildcard(strings.ToUpper(value), strings.ToUpper(key))
+			}
+			return matchWildcard(value, key)
+		})
+	default:
+		return matchAny(values, func(value string) bool {
+			if vr == "PN" {
+				return strings.EqualFold(value, key)
+			}
+			if isTemporalVR(vr) {
+				return normalizeTemporal(vr, value, '0') == normalizeTemporal(vr, key, '0')
+			}
+			return value == key
+		})
+	}
+}
+
+// matchAny utility to determine whether any of the values satisfy the match
+func matchAny(values []string, match func(value string) bool) bool {
+	for _, value := range values {
+		if match(strings.TrimSpace(value)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchUIDList utility to match values against a backslash separated list of
+// UIDs
+func matchUIDList(values []string, key string) bool {
+	for _, uid := range strings.Split(key, `\`) {
+		if matchAny(values, func(value string) bool {
+			return value == strings.TrimSpace(uid)
+		}) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchRange utility to match date, time and date time values against an
+// inclusive range of the form <lower>-<upper>, either bound of which may be
+// omitted
+func matchRange(vr string, values []string, key string) bool {
+	lower, upper, _ := strings.Cut(key, "-")
+	lower = normalizeTemporal(vr, lower, '0')
+	upper = normalizeTemporal(vr, upper, '9')
+
+	return matchAny(values, func(value string) bool {
+		if value == "" {
+			return false
+		}
+
+		value = normalizeTemporal(vr, value, '0')
+		return (lower == "" || value >= lower) &&
+			(upper == "" || value <= upper)
+	})
+}
+
+// matchWildcard utility to match a value against a pattern in which '*'
+// matches any sequence of characters, including none, and '?' matches a single
+// character
+func matchWildcard(value string, pattern string) bool {
+	valueRunes, patternRunes := []rune(value), []rune(pattern)
+
+	// position to backtrack to after the last '*' encountered
+	star, starValue := -1, 0
+
+	v, p := 0, 0
+	for v < len(valueRunes) {
+		switch {
+		case p < len(patternRunes) &&
+			(patternRunes[p] == '?' || patternRunes[p] == valueRunes[v]):
+			v++
+			p++
+		case p < len(patternRunes) && patternRunes[p] == '*':
+			star, starValue = p, v
+			p++
+		case star >= 0:
+			starValue++
+			v, p = starValue, star+1
+		default:
+			return false
+		}
+	}
+
+	for p < len(patternRunes) && patternRunes[p] == '*' {
+		p++
+	}
+
+	return p == len(patternRunes)
+}
+
+// isTemporalVR utility to determine whether the VR holds dates or times
+func isTemporalVR(vr string) bool {
+	switch vr {
+	case "DA", "TM", "DT":
+		return true
+	default:
+		return false
+	}
+}
+
+// allowsWildcards utility to determine whether wildcard matching applies to
+// values of the VR
+func allowsWildcards(vr string) bool {
+	switch vr {
+	case "DA", "TM", "DT", "UI",
+		"AT", "DS", "IS", "FL", "FD", "SL", "SS", "SV", "UL", "US", "UV",
+		"OB", "OD", "OF", "OL", "OV", "OW", "UN", "SQ":
+		return false
+	default:
+		return true
+	}
+}
+
+// normalizeTemporal utility to normalize a date, time or date time so that
+// values compare lexically. Separators and time zone offsets are removed and
+// partial values padded to full precision with fill, allowing e.g. a range
+// upper bound of "12" to include every time within that hour
+func normalizeTemporal(vr string, value string, fill byte) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	if vr == "DT" {
+		if idx := strings.IndexAny(value, "+-"); idx >= 0 {
+			value = value[:idx]
+		}
+	}
+
+	value = strings.NewReplacer(".", "", ":", "", "-", "").Replace(value)
+
+	// YYYYMMDD, HHMMSSFFFFFF and YYYYMMDDHHMMSSFFFFFF
+	width := 8
+	switch vr {
+	case "TM":
+		width = 12
+	case "DT":
+		width = 20
+	}
+
+	if len(value) < width {
+		value += strings.Repeat(string(fill), width-len(value))
+	}
+
+	return value
+}
@@ -0,0 +1,129 @@
+package dicom
+
+import "testing"
+
+func Test_matchAttribute(t *testing.T) {
+	type args struct {
+		vr     string
+		values []string
+		key    string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "universal matching matches any value",
+			args: args{vr: "LO", values: []string{"123"}, key: ""},
+			want: true,
+		},
+		{
+			name: "single value matching matches equal value",
+			args: args{vr: "LO", values: []string{"123"}, key: "123"},
+			want: true,
+		},
+		{
+			name: "single value matching does not match different value",
+			args: args{vr: "LO", values: []string{"123"}, key: "1234"},
+			want: false,
+		},
+		{
+			name: "single value matching matches any of multiple values",
+			args: args{vr: "CS", values: []string{"CT", "PT"}, key: "PT"},
+			want: true,
+		},
+		{
+			name: "single value matching does not match missing value",
+			args: args{vr: "LO", key: "123"},
+			want: false,
+		},
+		{
+			name: "person names match case-insensitively",
+			args: args{vr: "PN", values: []string{"DOE^JOHN"}, key: "doe^john"},
+			want: true,
+		},
+		{
+			name: "wildcard matching matches any sequence of characters",
+			args: args{vr: "PN", values: []string{"DOE^JOHN"}, key: "doe*"},
+			want: true,
+		},
+		{
+			name: "wildcard matching matches a single character",
+			args: args{vr: "SH", values: []string{"ACC1"}, key: "ACC?"},
+			want: true,
+		},
+		{
+			name: "wildcard matching does not match shorter value",
+			args: args{vr: "SH", values: []string{"ACC"}, key: "ACC?"},
+			want: false,
+		},
+		{
+			name: "wildcard matching backtracks over multiple wildcards",
+			args: args{vr: "LO", values: []string{"abcbcd"}, key: "*bc*d"},
+			want: true,
+		},
+		{
+			name: "wildcards are literal for UIDs",
+			args: args{vr: "UI", values: []string{"1.2.3"}, key: "1.2.*"},
+			want: false,
+		},
+		{
+			name: "list of UID matching matches any listed UID",
+			args: args{vr: "UI", values: []string{"1.2.3"}, key: `1.2.4\1.2.3`},
+			want: true,
+		},
+		{
+			name: "date range matching matches date within range",
+			args: args{vr: "DA", values: []string{"20240315"}, key: "20240301-20240331"},
+			want: true,
+		},
+		{
+			name: "date range matching matches inclusive bounds",
+			args: args{vr: "DA", values: []string{"20240331"}, key: "20240301-20240331"},
+			want: true,
+		},
+		{
+			name: "date range matching does not match date outside range",
+			args: args{vr: "DA", values: []string{"20240401"}, key: "20240301-20240331"},
+			want: false,
+		},
+		{
+			name: "date range matching matches open lower bound",
+			args: args{vr: "DA", values: []string{"19600614"}, key: "-20000101"},
+			want: true,
+		},
+		{
+			name: "date range matching matches open upper bound",
+			args: args{vr: "DA", values: []string{"20240315"}, key: "20240101-"},
+			want: true,
+		},
+		{
+			name: "date range matching does not match missing date",
+			args: args{vr: "DA", values: []string{""}, key: "20240101-"},
+			want: false,
+		},
+		{
+			name: "time range matching includes partial upper bound",
+			args: args{vr: "TM", values: []string{"121530.5"}, key: "10-12"},
+			want: true,
+		},
+		{
+			name: "time range matching excludes later time",
+			args: args{vr: "TM", values: []string{"130000"}, key: "10-12"},
+			want: false,
+		},
+		{
+			name: "single date matching matches equal date",
+			args: args{vr: "DA", values: []string{"20240315"}, key: "20240315"},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchAttribute(tt.args.vr, tt.args.values, tt.args.key); got != tt.want {
+				t.Errorf("matchAttribute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package dicom
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// memoryFileAdapter a FileRepository holding files in memory, which are lost
+// on restart. Deleted files are held in the trash until it is purged
+type memoryFileAdapter struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	trash map[string][]byte
+}
+
+// NewMemoryFileAdapter construct an in-memory file repository
+func NewMemoryFileAdapter() FileRepository {
+	return &memoryFileAdapter{
+		files: make(map[string][]byte),
+		trash: make(map[string][]byte),
+	}
+}
+
+func (m *memoryFileAdapter) GetAll() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := []string{}
+	for id := range m.files {
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Create create a new DICOM file, replacing any file with the same ID
+func (m *memoryFileAdapter) Create(file File) error {
+	data, err := io.ReadAll(file.Raw())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[file.ID] = data
+	return nil
+}
+
+// Get retrieve a DICOM file by id
+func (m *memoryFileAdapter) Get(id string) (*File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[id]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+
+	file := NewFile(id, int64(len(data)), bytes.NewReader(data))
+	return &file, nil
+}
+
+// Delete delete a DICOM file by id, moving it to the trash
+func (m *memoryFileAdapter) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[id]
+	if !ok {
+		return ErrFileNotFound
+	}
+
+	m.trash[id] = data
+	delete(m.files, id)
+	return nil
+}
+
+// Restore restore a deleted DICOM file from the trash, replacing any file
+// created with the same ID since
+func (m *memoryFileAdapter) Restore(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.trash[id]
+	if !ok {
+		return ErrFileNotFound
+	}
+
+	m.files[id] = data
+	delete(m.trash, id)
+	return nil
+}
+
+// PurgeTrash permanently remove every file in the trash
+func (m *memoryFileAdapter) PurgeTrash() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trash = make(map[string][]byte)
+	return nil
+}
@@ -0,0 +1,62 @@
+package dicom
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_memoryFileAdapter(t *testing.T) {
+	repository := NewMemoryFileAdapter()
+
+	file := newTestFile(t, mustNewElement(tag.SOPInstanceUID, []string{"1.2.1.1"}))
+	file.ID = "file"
+	want, _ := io.ReadAll(file.Raw())
+	if err := repository.Create(*file); err != nil {
+		t.Fatalf("memoryFileAdapter.Create() error = %v", err)
+	}
+
+	// read test helper to read the content of the file with the ID
+	read := func(id string) ([]byte, error) {
+		file, err := repository.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(file.Raw())
+	}
+
+	if got, err := read("file"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("memoryFileAdapter.Get() = %d bytes, %v, want %d bytes", len(got), err, len(want))
+	}
+	if ids, _ := repository.GetAll(); !reflect.DeepEqual(ids, []string{"file"}) {
+		t.Errorf("memoryFileAdapter.GetAll() = %v, want %v", ids, []string{"file"})
+	}
+
+	// deleted files are restored from the trash until it is purged
+	if err := repository.Delete("file"); err != nil {
+		t.Fatalf("memoryFileAdapter.Delete() error = %v", err)
+	}
+	if _, err := read("file"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("memoryFileAdapter.Get() of deleted file error = %v, want %v", err, ErrFileNotFound)
+	}
+	if err := repository.Restore("file"); err != nil {
+		t.Fatalf("memoryFileAdapter.Restore() error = %v", err)
+	}
+	if got, err := read("file"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("memoryFileAdapter.Get() of restored file = %d bytes, %v, want %d bytes", len(got), err, len(want))
+	}
+
+	if err := repository.Delete("file"); err != nil {
+		t.Fatalf("memoryFileAdapter.Delete() error = %v", err)
+	}
+	if err := repository.PurgeTrash(); err != nil {
+		t.Fatalf("memoryFileAdapter.PurgeTrash() error = %v", err)
+	}
+	if err := repository.Restore("file"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("memoryFileAdapter.Restore() of purged file error = %v, want %v", err, ErrFileNotFound)
+	}
+}
@@ -0,0 +1,102 @@
+package dicom
+
+import (
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// unitsHounsfield units of CT modality values
+const unitsHounsfield = "HU"
+
+// modalityFunction maps a stored pixel value to a modality value, e.g.
+// Hounsfield units for CT
+type modalityFunction func(storedValue int) float64
+
+// identityModalityFunction a modalityFunction for datasets without a modality
+// LUT transformation
+func identityModalityFunction(storedValue int) float64 {
+	return float64(storedValue)
+}
+
+// datasetModalityFunction returns a modalityFunction derived from the modality
+// LUT attributes of the dataset. The Modality LUT Sequence (0028,3000) is
+// preferred over the Rescale Slope (0028,1053) and Rescale Intercept
+// (0028,1052) attributes. If neither is present, stored values are returned
+// as is
+func datasetModalityFunction(dataset dicom.Dataset) modalityFunction {
+	if lut, ok := datasetModalityLUT(dataset); ok {
+		return func(storedValue int) float64 {
+			return float64(lut.lookup(float64(storedValue)))
+		}
+	}
+
+	slope, intercept, ok := datasetRescale(dataset)
+	if !ok {
+		return identityModalityFunction
+	}
+
+	return func(storedValue int) float64 {
+		return float64(storedValue)*slope + intercept
+	}
+}
+
+// datasetModalityLUT utility to read the first LUT of the Modality LUT
+// Sequence of the dataset
+func datasetModalityLUT(dataset dicom.Dataset) (lookupTable, bool) {
+	items := firstSequenceItem(dataset, tag.ModalityLUTSequence)
+	if items == nil {
+		return lookupTable{}, false
+	}
+
+	lut, err := parseLookupTable(items)
+	if err != nil {
+		return lookupTable{}, false
+	}
+
+	return signedFirstMapped(dataset, lut), true
+}
+
+// datasetRescale utility to read the Rescale Slope and Rescale Intercept
+// attributes of the dataset. Slope defaults to 1 and intercept to 0 if only
+// one of the two is present
+func datasetRescale(dataset dicom.Dataset) (float64, float64, bool) {
+	slope, intercept := 1.0, 0.0
+
+	slopeElement, slopeErr := dataset.FindElementByTag(tag.RescaleSlope)
+	if slopeErr == nil {
+		if values := parseDecimalStrings(slopeElement.Value); len(values) > 0 {
+			slope = values[0]
+		}
+	}
+
+	interceptElement, interceptErr := dataset.FindElementByTag(tag.RescaleIntercept)
+	if interceptErr == nil {
+		if values := parseDecimalStrings(interceptElement.Value); len(values) > 0 {
+			intercept = values[0]
+		}
+	}
+
+	return slope, intercept, slopeErr == nil || interceptErr == nil
+}
+
+// datasetModalityUnits utility to determine the units of modality values from
+// the Modality LUT Type (0028,3004) or Rescale Type (0028,1054) attributes.
+// CT values default to Hounsfield units
+func datasetModalityUnits(dataset dicom.Dataset) string {
+	if items := firstSequenceItem(dataset, tag.ModalityLUTSequence); items != nil {
+		item := dicom.Dataset{Elements: items}
+		if units := firstString(item, tag.ModalityLUTType); units != "" {
+			return units
+		}
+	}
+
+	if units := firstString(dataset, tag.RescaleType); units != "" {
+		return units
+	}
+
+	if firstString(dataset, tag.Modality) == "CT" {
+		return unitsHounsfield
+	}
+
+	return ""
+}
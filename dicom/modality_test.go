@@ -0,0 +1,133 @@
+package dicom
+
+import (
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_datasetModalityFunction(t *testing.T) {
+	type args struct {
+		dataset     dicom.Dataset
+		storedValue int
+	}
+	tests := []struct {
+		name string
+		args args
+		want float64
+	}{
+		{
+			name: "returns stored value for dataset without modality LUT",
+			args: args{
+				dataset:     dicom.Dataset{},
+				storedValue: 1024,
+			},
+			want: 1024,
+		},
+		{
+			name: "applies rescale slope and intercept",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.RescaleSlope, []string{"1"}),
+						mustNewElement(tag.RescaleIntercept, []string{"-1024"}),
+					},
+				},
+				storedValue: 1024,
+			},
+			want: 0,
+		},
+		{
+			name: "applies fractional rescale slope",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.RescaleSlope, []string{"0.5"}),
+						mustNewElement(tag.RescaleIntercept, []string{"10"}),
+					},
+				},
+				storedValue: 5,
+			},
+			want: 12.5,
+		},
+		{
+			name: "defaults slope to 1 if only intercept is present",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.RescaleIntercept, []string{"-1000"}),
+					},
+				},
+				storedValue: 1000,
+			},
+			want: 0,
+		},
+		{
+			name: "prefers modality LUT sequence over rescale",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.RescaleSlope, []string{"2"}),
+						mustNewElement(tag.ModalityLUTSequence, [][]*dicom.Element{
+							{
+								mustNewElement(tag.LUTDescriptor, []int{3, 0, 16}),
+								mustNewElement(tag.LUTData, []int{100, 200, 300}),
+							},
+						}),
+					},
+				},
+				storedValue: 1,
+			},
+			want: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modality := datasetModalityFunction(tt.args.dataset)
+			if got := modality(tt.args.storedValue); got != tt.want {
+				t.Errorf("datasetModalityFunction()() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_datasetModalityUnits(t *testing.T) {
+	tests := []struct {
+		name    string
+		dataset dicom.Dataset
+		want    string
+	}{
+		{
+			name:    "returns no units for empty dataset",
+			dataset: dicom.Dataset{},
+			want:    "",
+		},
+		{
+			name: "defaults CT to hounsfield units",
+			dataset: dicom.Dataset{
+				Elements: []*dicom.Element{
+					mustNewElement(tag.Modality, []string{"CT"}),
+				},
+			},
+			want: "HU",
+		},
+		{
+			name: "returns rescale type",
+			dataset: dicom.Dataset{
+				Elements: []*dicom.Element{
+					mustNewElement(tag.Modality, []string{"PT"}),
+					mustNewElement(tag.RescaleType, []string{"BQML"}),
+				},
+			},
+			want: "BQML",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := datasetModalityUnits(tt.dataset); got != tt.want {
+				t.Errorf("datasetModalityUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
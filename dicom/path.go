@@ -0,0 +1,148 @@
+package dicom
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+var (
+	// ErrMalformedTag error indicating a tag is neither a known keyword nor
+	// in a supported hex form
+	ErrMalformedTag = errors.New("malformed tag")
+)
+
+// ElementPath the path to an element of a dataset, through the items of any
+// sequences containing it
+type ElementPath struct {
+	Items []SequenceItem
+	Tag   tag.Tag
+}
+
+// SequenceItem an item of a sequence, identified by the tag of the sequence
+// and the zero-based index of the item
+type SequenceItem struct {
+	Tag   tag.Tag
+	Index int
+}
+
+// ParseTag parse a tag given as a dictionary keyword, e.g. PatientName, as 8
+// hex digits, e.g. 00100010, or as a hex group and element, e.g. (0010,0010)
+func ParseTag(value string) (tag.Tag, error) {
+	if strings.ContainsAny(value, "(),") {
+		parts := strings.Split(strings.Trim(value, "()"), ",")
+		if len(parts) != 2 {
+			return tag.Tag{}, fmt.Errorf("%w %s", ErrMalformedTag, value)
+		}
+
+		group, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 16, 16)
+		if err != nil {
+			return tag.Tag{}, fmt.Errorf("%w %s", ErrMalformedTag, value)
+		}
+		element, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 16, 16)
+		if err != nil {
+			return tag.Tag{}, fmt.Errorf("%w %s", ErrMalformedTag, value)
+		}
+
+		return tag.Tag{Group: uint16(group), Element: uint16(element)}, nil
+	}
+
+	if len(value) == 8 {
+		if parsed, err := strconv.ParseUint(value, 16, 32); err == nil {
+			return tag.Tag{Group: uint16(parsed >> 16), Element: uint16(parsed)}, nil
+		}
+	}
+
+	info, err := tag.FindByName(value)
+	if err != nil {
+		return tag.Tag{}, fmt.Errorf("%w, unknown keyword %s", ErrMalformedTag, value)
+	}
+
+	return info.Tag, nil
+}
+
+// ParseElementPath parse the path to an element, as tags in any form accepted
+// by ParseTag separated by '.', each sequence followed by the zero-based index
+// of an item, e.g. ReferencedSeriesSequence[0].SeriesInstanceUID
+func ParseElementPath(value string) (ElementPath, error) {
+	segments := strings.Split(value, ".")
+
+	var path ElementPath
+	for idx, segment := range segments {
+		if idx == len(segments)-1 {
+			t, err := ParseTag(segment)
+			if err != nil {
+				return ElementPath{}, err
+			}
+			path.Tag = t
+			break
+		}
+
+		open := strings.LastIndex(segment, "[")
+		if open < 0 || !strings.HasSuffix(segment, "]") {
+			return ElementPath{}, fmt.Errorf("%w %s, sequence %s must be followed by an item index",
+				ErrMalformedTag, value, segment)
+		}
+
+		t, err := ParseTag(segment[:open])
+		if err != nil {
+			return ElementPath{}, err
+		}
+
+		index, err := strconv.Atoi(segment[open+1 : len(segment)-1])
+		if err != nil || index < 0 {
+			return ElementPath{}, fmt.Errorf("%w %s, malformed item index of %s", ErrMalformedTag, value, segment)
+		}
+
+		path.Items = append(path.Items, SequenceItem{Tag: t, Index: index})
+	}
+
+	return path, nil
+}
+
+// String formats the path with tags in the form (gggg,eeee), e.g.
+// (0008,1115)[0].(0020,000e)
+func (p ElementPath) String() string {
+	var builder strings.Builder
+	for _, item := range p.Items {
+		fmt.Fprintf(&builder, "%s[%d].", item.Tag, item.Index)
+	}
+	builder.WriteString(p.Tag.String())
+
+	return builder.String()
+}
+
+// find utility to find the element at the path within the elements of a
+// dataset, or nil if there is none
+func (p ElementPath) find(elements []*dicom.Element) *dicom.Element {
+	for _, item := range p.Items {
+		sequence := findElement(elements, item.Tag)
+		if sequence == nil || sequence.Value == nil || sequence.Value.ValueType() != dicom.Sequences {
+			return nil
+		}
+
+		items, _ := sequence.Value.GetValue().([]*dicom.SequenceItemValue)
+		if item.Index >= len(items) {
+			return nil
+		}
+		elements, _ = items[item.Index].GetValue().([]*dicom.Element)
+	}
+
+	return findElement(elements, p.Tag)
+}
+
+// findElement utility to find the element with the tag, or nil if there is
+// none
+func findElement(elements []*dicom.Element, t tag.Tag) *dicom.Element {
+	for _, element := range elements {
+		if element.Tag == t {
+			return element
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package dicom
+
+import (
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/frame"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// pixelRepresentationSigned the Pixel Representation (0028,0103) value
+// indicating pixel samples are stored as two's complement signed integers
+const pixelRepresentationSigned = 1
+
+// pixelLayout describes how stored values are packed within the allocated bits
+// of each pixel sample
+type pixelLayout struct {
+	bitsAllocated int
+	bitsStored    int
+	highBit       int
+	signed        bool
+}
+
+// datasetPixelLayout utility to read the Bits Allocated (0028,0100), Bits
+// Stored (0028,0101), High Bit (0028,0102) and Pixel Representation
+// (0028,0103) attributes of the dataset. Missing or inconsistent attributes
+// default to stored values occupying every allocated bit
+func datasetPixelLayout(dataset dicom.Dataset, nativeFrame *frame.NativeFrame) pixelLayout {
+	bitsAllocated := firstInt(dataset, tag.BitsAllocated, nativeFrame.BitsPerSample)
+	if bitsAllocated <= 0 {
+		bitsAllocated = nativeFrame.BitsPerSample
+	}
+
+	bitsStored := firstInt(dataset, tag.BitsStored, bitsAllocated)
+	if bitsStored <= 0 || (bitsAllocated > 0 && bitsStored > bitsAllocated) {
+		bitsStored = bitsAllocated
+	}
+
+	highBit := firstInt(dataset, tag.HighBit, bitsStored-1)
+	if highBit < bitsStored-1 || (bitsAllocated > 0 && highBit >= bitsAllocated) {
+		highBit = bitsStored - 1
+	}
+
+	return pixelLayout{
+		bitsAllocated: bitsAllocated,
+		bitsStored:    bitsStored,
+		highBit:       highBit,
+		signed:        isSigned(dataset),
+	}
+}
+
+// isSigned utility to determine if the dataset stores signed pixel samples
+func isSigned(dataset dicom.Dataset) bool {
+	return firstInt(dataset, tag.PixelRepresentation, 0) == pixelRepresentationSigned
+}
+
+// isIdentity determines whether stored values can be read as is, i.e. they
+// are unsigned and occupy every allocated bit
+func (l pixelLayout) isIdentity() bool {
+	return !l.signed &&
+		l.bitsStored == l.bitsAllocated &&
+		l.highBit == l.bitsStored-1
+}
+
+// storedValue extracts the stored value from a raw pixel sample, masking out
+// any bits outside of the stored bits and sign extending signed values
+func (l pixelLayout) storedValue(sample int) int {
+	if l.bitsStored <= 0 {
+		return sample
+	}
+
+	shift := l.highBit + 1 - l.bitsStored
+	mask := 1<<l.bitsStored - 1
+	value := (sample >> shift) & mask
+
+	if l.signed && value&(1<<(l.bitsStored-1)) != 0 {
+		value -= 1 << l.bitsStored
+	}
+
+	return value
+}
+
+// rawSample packs a stored value into a raw pixel sample, the inverse of
+// storedValue. Any bits outside of the stored bits are cleared
+func (l pixelLayout) rawSample(value int) int {
+	if l.bitsStored <= 0 {
+		return value
+	}
+
+	shift := l.highBit + 1 - l.bitsStored
+	mask := 1<<l.bitsStored - 1
+
+	return (value & mask) << shift
+}
+
+// storedFrame utility to convert the raw samples of a frame, as read by the
+// underlying DICOM parser, to stored values. The frame is returned as is if
+// no conversion is required
+func storedFrame(dataset dicom.Dataset, nativeFrame *frame.NativeFrame) *frame.NativeFrame {
+	layout := datasetPixelLayout(dataset, nativeFrame)
+	if layout.isIdentity() {
+		return nativeFrame
+	}
+
+	data := make([][]int, len(nativeFrame.Data))
+	for idx, pixel := range nativeFrame.Data {
+		data[idx] = make([]int, len(pixel))
+		for sample, value := range pixel {
+			data[idx][sample] = layout.storedValue(value)
+		}
+	}
+
+	return &frame.NativeFrame{
+		Data:          data,
+		Rows:          nativeFrame.Rows,
+		Cols:          nativeFrame.Cols,
+		BitsPerSample: layout.bitsStored,
+	}
+}
+
+// signedFirstMapped utility to interpret the first mapped value of a LUT
+// descriptor as a signed value for datasets storing signed pixel samples. LUT
+// descriptors are always parsed as unsigned
+func signedFirstMapped(dataset dicom.Dataset, lut lookupTable) lookupTable {
+	if isSigned(dataset) && lut.firstMapped >= 1<<15 {
+		lut.firstMapped -= 1 << 16
+	}
+
+	return lut
+}
@@ -0,0 +1,85 @@
+package dicom
+
+import (
+	"testing"
+)
+
+func Test_pixelLayout_storedValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout pixelLayout
+		sample int
+		want   int
+	}{
+		{
+			name: "returns unsigned sample as is",
+			layout: pixelLayout{
+				bitsAllocated: 16,
+				bitsStored:    16,
+				highBit:       15,
+			},
+			sample: 0xffff,
+			want:   0xffff,
+		},
+		{
+			name: "sign extends signed sample",
+			layout: pixelLayout{
+				bitsAllocated: 16,
+				bitsStored:    16,
+				highBit:       15,
+				signed:        true,
+			},
+			sample: 0xffff,
+			want:   -1,
+		},
+		{
+			name: "masks bits above high bit",
+			layout: pixelLayout{
+				bitsAllocated: 16,
+				bitsStored:    12,
+				highBit:       11,
+			},
+			sample: 0xf123,
+			want:   0x123,
+		},
+		{
+			name: "sign extends from bits stored",
+			layout: pixelLayout{
+				bitsAllocated: 16,
+				bitsStored:    12,
+				highBit:       11,
+				signed:        true,
+			},
+			sample: 0x0fff,
+			want:   -1,
+		},
+		{
+			name: "shifts stored bits below high bit",
+			layout: pixelLayout{
+				bitsAllocated: 16,
+				bitsStored:    12,
+				highBit:       15,
+			},
+			sample: 0x1230,
+			want:   0x123,
+		},
+		{
+			name: "shifts and sign extends stored bits below high bit",
+			layout: pixelLayout{
+				bitsAllocated: 16,
+				bitsStored:    12,
+				highBit:       15,
+				signed:        true,
+			},
+			sample: 0xfff0,
+			want:   -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.layout.storedValue(tt.sample); got != tt.want {
+				t.Errorf("pixelLayout.storedValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
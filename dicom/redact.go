@@ -0,0 +1,263 @@
+package dicom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/frame"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+var (
+	// ErrNoRedactRegions error indicating there are no regions to redact,
+	// neither given nor defined by a template matching the file
+	ErrNoRedactRegions = errors.New("no regions to redact")
+
+	// ErrUnsupportedPixelData error indicating the pixel data cannot be
+	// redacted, e.g. as it is compressed
+	ErrUnsupportedPixelData = errors.New("unsupported pixel data")
+)
+
+// RedactRegion a rectangular region of a frame, in pixels from the top left
+// corner
+type RedactRegion struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// RedactTemplate the regions of burned in annotations of images from a
+// manufacturer, optionally only for a model and image dimensions
+type RedactTemplate struct {
+	// Manufacturer matched case insensitively against Manufacturer (0008,0070)
+	Manufacturer string `json:"manufacturer"`
+	// Model matched case insensitively against Manufacturer's Model Name
+	// (0008,1090), any model if empty
+	Model string `json:"model,omitempty"`
+	// Rows and Columns the image dimensions, any dimensions if zero
+	Rows    int `json:"rows,omitempty"`
+	Columns int `json:"columns,omitempty"`
+
+	Regions []RedactRegion `json:"regions"`
+}
+
+// RedactOptions options when redacting the pixel data of a file
+type RedactOptions struct {
+	regions   []RedactRegion
+	templates []RedactTemplate
+}
+
+// RedactRegions option to specify regions to redact from every frame
+func RedactRegions(regions ...RedactRegion) func(opts *RedactOptions) {
+	return func(opts *RedactOptions) {
+		opts.regions = append(opts.regions, regions...)
+	}
+}
+
+// RedactTemplates option to specify templates, the regions of those matching
+// the manufacturer and model of the file being redacted from every frame
+func RedactTemplates(templates ...RedactTemplate) func(opts *RedactOptions) {
+	return func(opts *RedactOptions) {
+		opts.templates = append(opts.templates, templates...)
+	}
+}
+
+// ParseRedactRegion parse a region given as x,y,width,height
+func ParseRedactRegion(value string) (RedactRegion, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return RedactRegion{}, fmt.Errorf("malformed region %s, must be x,y,width,height", value)
+	}
+
+	var values [4]int
+	for idx, part := range parts {
+		parsed, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || parsed < 0 {
+			return RedactRegion{}, fmt.Errorf("malformed region %s, must be x,y,width,height", value)
+		}
+		values[idx] = parsed
+	}
+
+	return RedactRegion{X: values[0], Y: values[1], Width: values[2], Height: values[3]}, nil
+}
+
+// ParseRedactTemplates parse templates encoded as a JSON array
+func ParseRedactTemplates(r io.Reader) ([]RedactTemplate, error) {
+	var templates []RedactTemplate
+	if err := json.NewDecoder(r).Decode(&templates); err != nil {
+		return nil, fmt.Errorf("malformed redact templates: %w", err)
+	}
+
+	for _, template := range templates {
+		if template.Manufacturer == "" {
+			return nil, errors.New("malformed redact templates: manufacturer is required")
+		}
+	}
+
+	return templates, nil
+}
+
+// matches determines whether the template applies to the dataset
+func (t RedactTemplate) matches(dataset dicom.Dataset) bool {
+	if !strings.EqualFold(t.Manufacturer, firstString(dataset, tag.Manufacturer)) {
+		return false
+	}
+	if t.Model != "" && !strings.EqualFold(t.Model, firstString(dataset, tag.ManufacturerModelName)) {
+		return false
+	}
+	if t.Rows != 0 && t.Rows != firstInt(dataset, tag.Rows, 0) {
+		return false
+	}
+	if t.Columns != 0 && t.Columns != firstInt(dataset, tag.Columns, 0) {
+		return false
+	}
+
+	return true
+}
+
+// Redact blacks out regions of every frame of the pixel data, returning the
+// redacted file, a new instance with the given ID. Regions are those given
+// and those of templates matching the file, and are clipped to the frame.
+// Burned In Annotation (0028,0301) of the redacted file is set to NO. Only
+// native, uncompressed, pixel data can be redacted. The redacted file is
+// spooled to a temporary file, so must be closed
+func (d *File) Redact(id string, options ...func(opts *RedactOptions)) (File, error) {
+	var opts RedactOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	// the dataset is parsed afresh, rather than read from the cache, as its
+	// frames are modified in place
+	dataSet, err := dicom.Parse(d.Raw(), d.size, nil, dicom.AllowMismatchPixelDataLength())
+	if err != nil {
+		return File{}, err
+	}
+
+	regions := opts.regions
+	for _, template := range opts.templates {
+		if template.matches(dataSet) {
+			regions = append(regions, template.Regions...)
+		}
+	}
+	if len(regions) == 0 {
+		return File{}, ErrNoRedactRegions
+	}
+
+	// YBR_FULL_422 frames are expanded when read, so cannot be written back
+	if datasetPhotometricInterpretation(dataSet) == photometricYBRFull422 {
+		return File{}, fmt.Errorf("%w: %s", ErrUnsupportedPixelData, photometricYBRFull422)
+	}
+
+	pixelDataInfo, err := getPixelDataInfo(dataSet)
+	if err != nil {
+		return File{}, err
+	}
+
+	for _, fr := range pixelDataInfo.Frames {
+		if fr.Encapsulated {
+			return File{}, fmt.Errorf("%w: encapsulated pixel data", ErrUnsupportedPixelData)
+		}
+		redactFrame(dataSet, &fr.NativeData, regions)
+	}
+
+	instanceUID := newUID()
+	replacements, err := newElements(map[tag.Tag]interface{}{
+		tag.MediaStorageSOPInstanceUID: []string{instanceUID},
+		tag.SOPInstanceUID:             []string{instanceUID},
+		tag.BurnedInAnnotation:         []string{"NO"},
+	})
+	if err != nil {
+		return File{}, err
+	}
+
+	elements := replaceElements(dataSet.Elements, replacements)
+
+	return spoolFile(id, func(w io.Writer) error {
+		if err := dicom.Write(w, dicom.Dataset{Elements: elements}, dicom.SkipVRVerification()); err != nil {
+			return fmt.Errorf("failed to write redacted file: %w", err)
+		}
+		return nil
+	})
+}
+
+// redactFrame utility to black out the regions of a native frame, setting
+// every sample of the pixels within them to the raw sample value of black
+func redactFrame(dataset dicom.Dataset, nativeFrame *frame.NativeFrame, regions []RedactRegion) {
+	if len(nativeFrame.Data) == 0 {
+		return
+	}
+
+	pixelCount := nativeFrame.Rows * nativeFrame.Cols
+	samplesPerPixel := len(nativeFrame.Data[0])
+	black := blackSamples(dataset, nativeFrame, samplesPerPixel)
+
+	// sample offsets as stored, as for colour images, mapped back to the
+	// pixel and sample of the frame they were read into
+	sampleIndex := func(pixel int, channel int) int {
+		return pixel*samplesPerPixel + channel
+	}
+	if samplesPerPixel > 1 && firstInt(dataset, tag.PlanarConfiguration, 0) == planarConfigurationPlanar {
+		sampleIndex = func(pixel int, channel int) int {
+			return channel*pixelCount + pixel
+		}
+	}
+
+	for _, region := range regions {
+		left, top := max(region.X, 0), max(region.Y, 0)
+		right := min(region.X+region.Width, nativeFrame.Cols)
+		bottom := min(region.Y+region.Height, nativeFrame.Rows)
+
+		for y := top; y < bottom; y++ {
+			for x := left; x < right; x++ {
+				for channel := 0; channel < samplesPerPixel; channel++ {
+					idx := sampleIndex(y*nativeFrame.Cols+x, channel)
+					if idx/samplesPerPixel < len(nativeFrame.Data) {
+						nativeFrame.Data[idx/samplesPerPixel][idx%samplesPerPixel] = black[channel]
+					}
+				}
+			}
+		}
+	}
+}
+
+// blackSamples utility to determine the raw sample values of a black pixel:
+// the maximum stored value for MONOCHROME1, zero luminance and neutral
+// chrominance for YBR_FULL, and otherwise the minimum stored value. For
+// PALETTE COLOR this is the first entry of the palette
+func blackSamples(dataset dicom.Dataset, nativeFrame *frame.NativeFrame, samplesPerPixel int) []int {
+	layout := datasetPixelLayout(dataset, nativeFrame)
+
+	minimum, maximum := 0, 1<<layout.bitsStored-1
+	if layout.signed {
+		minimum, maximum = -(1 << (layout.bitsStored - 1)), 1<<(layout.bitsStored-1)-1
+	}
+
+	black := make([]int, samplesPerPixel)
+	for channel := range black {
+		switch photometric := datasetPhotometricInterpretation(dataset); {
+		case photometric == photometricMonochrome1:
+			black[channel] = layout.rawSample(maximum)
+		case photometric == photometricYBRFull && channel > 0:
+			black[channel] = layout.rawSample(1 << (layout.bitsStored - 1))
+		default:
+			black[channel] = layout.rawSample(minimum)
+		}
+	}
+
+	return black
+}
+
+// newUID utility to generate a new, unique UID under the 2.25 root
+func newUID() string {
+	id := uuid.New()
+	return "2.25." + new(big.Int).SetBytes(id[:]).String()
+}
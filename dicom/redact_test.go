@@ -0,0 +1,187 @@
+package dicom
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/frame"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_File_Redact(t *testing.T) {
+	// newFile test helper to encode a 4x2 image of the given samples, one
+	// sample per pixel
+	newFile := func(t *testing.T, photometric string, samples []int) *File {
+		data := make([][]int, len(samples))
+		for idx, sample := range samples {
+			data[idx] = []int{sample}
+		}
+
+		return newTestFile(t,
+			mustNewElement(tag.SOPInstanceUID, []string{"1.2.3"}),
+			mustNewElement(tag.Manufacturer, []string{"ACME"}),
+			mustNewElement(tag.ManufacturerModelName, []string{"Scanner 1"}),
+			mustNewElement(tag.SamplesPerPixel, []int{1}),
+			mustNewElement(tag.PhotometricInterpretation, []string{photometric}),
+			mustNewElement(tag.Rows, []int{2}),
+			mustNewElement(tag.Columns, []int{4}),
+			mustNewElement(tag.BitsAllocated, []int{8}),
+			mustNewElement(tag.BitsStored, []int{8}),
+			mustNewElement(tag.HighBit, []int{7}),
+			mustNewElement(tag.PixelRepresentation, []int{0}),
+			mustNewElement(tag.BurnedInAnnotation, []string{"YES"}),
+			&dicom.Element{
+				Tag:                    tag.PixelData,
+				RawValueRepresentation: "OW",
+				Value: mustNewValue(dicom.PixelDataInfo{
+					Frames: []*frame.Frame{{
+						NativeData: frame.NativeFrame{
+							Data:          data,
+							Rows:          2,
+							Cols:          4,
+							BitsPerSample: 8,
+						},
+					}},
+				}),
+			},
+		)
+	}
+
+	samples := []int{1, 2, 3, 4, 5, 6, 7, 8}
+
+	type args struct {
+		photometric string
+		options     []func(opts *RedactOptions)
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []int
+		wantErr error
+	}{
+		{
+			name: "blacks out regions clipped to the frame",
+			args: args{
+				photometric: "MONOCHROME2",
+				options: []func(opts *RedactOptions){
+					RedactRegions(RedactRegion{X: 0, Y: 0, Width: 2, Height: 1}, RedactRegion{X: 3, Y: 1, Width: 5, Height: 5}),
+				},
+			},
+			want: []int{0, 0, 3, 4, 5, 6, 7, 0},
+		},
+		{
+			name: "blacks out MONOCHROME1 as the maximum value",
+			args: args{
+				photometric: "MONOCHROME1",
+				options: []func(opts *RedactOptions){
+					RedactRegions(RedactRegion{X: 1, Y: 1, Width: 2, Height: 1}),
+				},
+			},
+			want: []int{1, 2, 3, 4, 5, 255, 255, 8},
+		},
+		{
+			name: "applies matching templates",
+			args: args{
+				photometric: "MONOCHROME2",
+				options: []func(opts *RedactOptions){
+					RedactTemplates(
+						RedactTemplate{Manufacturer: "acme", Model: "SCANNER 1", Regions: []RedactRegion{{X: 0, Y: 1, Width: 4, Height: 1}}},
+						RedactTemplate{Manufacturer: "acme", Model: "Scanner 2", Regions: []RedactRegion{{X: 0, Y: 0, Width: 4, Height: 1}}},
+						RedactTemplate{Manufacturer: "acme", Rows: 512, Regions: []RedactRegion{{X: 0, Y: 0, Width: 4, Height: 1}}},
+					),
+				},
+			},
+			want: []int{1, 2, 3, 4, 0, 0, 0, 0},
+		},
+		{
+			name: "returns an error without regions",
+			args: args{
+				photometric: "MONOCHROME2",
+				options: []func(opts *RedactOptions){
+					RedactTemplates(RedactTemplate{Manufacturer: "Other", Regions: []RedactRegion{{Width: 1, Height: 1}}}),
+				},
+			},
+			wantErr: ErrNoRedactRegions,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := newFile(t, tt.args.photometric, samples)
+
+			redacted, err := file.Redact("redacted", tt.args.options...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("File.Redact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			defer redacted.Close()
+
+			dataSet, err := redacted.DataSet()
+			if err != nil {
+				t.Fatalf("File.DataSet() error = %v", err)
+			}
+
+			pixelDataInfo, err := getPixelDataInfo(*dataSet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := flattenSamples(&pixelDataInfo.Frames[0].NativeData); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("File.Redact() samples = %v, want %v", got, tt.want)
+			}
+
+			if got := firstString(*dataSet, tag.BurnedInAnnotation); got != "NO" {
+				t.Errorf("File.Redact() burned in annotation = %v, want NO", got)
+			}
+			if got := firstString(*dataSet, tag.SOPInstanceUID); got == "1.2.3" || !strings.HasPrefix(got, "2.25.") {
+				t.Errorf("File.Redact() SOP instance UID = %v, want a new UID", got)
+			}
+
+			// the original file is left unchanged
+			original, _ := file.DataSet()
+			originalInfo, _ := getPixelDataInfo(*original)
+			if got := flattenSamples(&originalInfo.Frames[0].NativeData); !reflect.DeepEqual(got, samples) {
+				t.Errorf("File.Redact() modified the original samples = %v", got)
+			}
+		})
+	}
+}
+
+func Test_ParseRedactRegion(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    RedactRegion
+		wantErr bool
+	}{
+		{
+			name:  "parses a region",
+			value: "10, 20,30,40",
+			want:  RedactRegion{X: 10, Y: 20, Width: 30, Height: 40},
+		},
+		{
+			name:    "returns an error for missing values",
+			value:   "10,20,30",
+			wantErr: true,
+		},
+		{
+			name:    "returns an error for negative values",
+			value:   "-1,20,30,40",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRedactRegion(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRedactRegion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRedactRegion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,102 +1,525 @@
 package dicom
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 const defaultFileDest = "/tmp/dicom"
 
+// defaultTrashRetention the time deleted files are kept in the trash, from
+// which they can be restored, before they are purged
+const defaultTrashRetention = 7 * 24 * time.Hour
+
+// localIDsDir the directory of the links from file IDs to the files they
+// identify, within the root of a local file adapter
+const localIDsDir = ".ids"
+
+// localTrashDir the directory deleted files are moved to, named by their ID,
+// within the root of a local file adapter
+const localTrashDir = ".trash"
+
+// localUnknownUID the path segment used in place of a missing or malformed
+// UID
+const localUnknownUID = "unknown"
+
 var (
 	// ErrFileNotFound error indicating specified file was not found
 	ErrFileNotFound = errors.New("file was not found")
 )
 
-// FileRepository represents a persistent store for DICOM files
+// FileRepository represents a persistent store for DICOM files. Files
+// retrieved with Get must be closed once no longer needed. Deleted files are
+// moved to the trash, from which they can be restored until they have been
+// in the trash longer than its retention, when they are purged
 type FileRepository interface {
 	GetAll() ([]string, error)
 	Get(id string) (*File, error)
 	Create(d File) error
+	Delete(id string) error
+	Restore(id string) error
+	PurgeTrash() error
+}
+
+// LocalFileOptions options when instantiating a local file adapter
+type LocalFileOptions struct {
+	root           string
+	fsync          bool
+	trashRetention time.Duration
 }
 
-// localDICOMFileAdapter an implementation of FileRepository that uses local
-// temp file storage to store DICOM files
-type localDICOMFileAdapter struct{}
+// LocalFileRoot option to specify the directory files are stored in.
+// Defaults to /tmp/dicom
+func LocalFileRoot(root string) func(opts *LocalFileOptions) {
+	return func(opts *LocalFileOptions) {
+		opts.root = root
+	}
+}
+
+// LocalFileSync option to specify whether files, and the directories
+// containing them, are synced to disk before they are created, so that
+// created files survive a crash or power loss
+func LocalFileSync(fsync bool) func(opts *LocalFileOptions) {
+	return func(opts *LocalFileOptions) {
+		opts.fsync = fsync
+	}
+}
+
+// LocalFileTrashRetention option to specify the time deleted files are kept
+// in the trash before they are purged. Files are deleted permanently if zero.
+// Defaults to 7 days
+func LocalFileTrashRetention(retention time.Duration) func(opts *LocalFileOptions) {
+	return func(opts *LocalFileOptions) {
+		opts.trashRetention = retention
+	}
+}
+
+// localDICOMFileAdapter an implementation of FileRepository that stores DICOM
+// files on the local filesystem, at {StudyUID}/{SeriesUID}/{SOPUID}.dcm
+// within its root. Files are identified by links within the .ids directory,
+// sharded by the first characters of their ID, to the files. Files stored
+// directly within the root, named by their ID, as by earlier versions, can
+// still be read. Deleted files are moved to the .trash directory
+type localDICOMFileAdapter struct {
+	opts LocalFileOptions
+}
 
 // NewLocalFileAdapter construct a local file adapter repository
-func NewLocalFileAdapter() FileRepository {
-	return &localDICOMFileAdapter{}
+func NewLocalFileAdapter(options ...func(opts *LocalFileOptions)) FileRepository {
+	opts := LocalFileOptions{
+		root:           defaultFileDest,
+		trashRetention: defaultTrashRetention,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	return &localDICOMFileAdapter{
+		opts: opts,
+	}
 }
 
 func (d *localDICOMFileAdapter) GetAll() ([]string, error) {
-	entries, err := os.ReadDir(defaultFileDest)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return []string{}, nil
-		}
+	fileNames := []string{}
+
+	shards, err := os.ReadDir(filepath.Join(d.opts.root, localIDsDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
+	for _, shard := range shards {
+		links, err := os.ReadDir(filepath.Join(d.opts.root, localIDsDir, shard.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if !isLocalTempFile(link.Name()) {
+				fileNames = append(fileNames, link.Name())
+			}
+		}
+	}
 
-	var fileNames []string
+	// files stored directly within the root by earlier versions
+	entries, err := os.ReadDir(d.opts.root)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
 	for _, e := range entries {
-		fileNames = append(fileNames, e.Name())
+		if e.Type().IsRegular() && !isLocalTempFile(e.Name()) {
+			fileNames = append(fileNames, e.Name())
+		}
 	}
 
 	return fileNames, nil
 }
 
-// Create create a new DICOM file
+// Create create a new DICOM file, replacing any file with the same ID. The
+// file is written to a temporary file which is then renamed, so that a file
+// is never left partially written
 func (d *localDICOMFileAdapter) Create(file File) error {
-	filename := d.generateFileName(file.ID)
+	if !isValidLocalID(file.ID) {
+		return fmt.Errorf("invalid file id %s", file.ID)
+	}
+
+	uids, err := file.UIDs()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+
+	linkName := d.linkName(file.ID)
+	previous := d.readLink(linkName)
+
+	// a file stored directly within the root by earlier versions is replaced
+	// as any other, so that it is not left behind under the same ID
+	if previous == "" {
+		legacy := filepath.Join(d.opts.root, file.ID)
+		if fileInfo, err := os.Lstat(legacy); err == nil && fileInfo.Mode().IsRegular() {
+			previous = legacy
+		}
+	}
+
+	filename := filepath.Join(
+		d.opts.root,
+		localPathSegment(uids.StudyInstanceUID),
+		localPathSegment(uids.SeriesInstanceUID),
+		localPathSegment(uids.SOPInstanceUID)+".dcm",
+	)
+
+	// instances with the same SOP instance UID but different IDs are kept
+	// side by side
+	if _, err := os.Lstat(filename); err == nil && filename != previous {
+		filename = strings.TrimSuffix(filename, ".dcm") + "." + file.ID + ".dcm"
+	}
+
+	if err := d.writeAtomic(filename, func(temp *os.File) error {
+		_, err := io.Copy(temp, file.Raw())
+		return err
+	}); err != nil {
+		return err
+	}
 
-	var buffer bytes.Buffer
-	if _, err := io.Copy(&buffer, file.Raw()); err != nil {
+	target, err := filepath.Rel(filepath.Dir(linkName), filename)
+	if err != nil {
+		return err
+	}
+	if err := d.linkAtomic(target, linkName); err != nil {
 		return err
 	}
 
-	if _, err := os.Stat(defaultFileDest); os.IsNotExist(err) {
-		os.MkdirAll(defaultFileDest, 0700)
+	// a replaced file stored elsewhere, e.g. as its UIDs changed, is removed
+	if previous != "" && previous != filename {
+		if err := os.Remove(previous); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 	}
 
-	return os.WriteFile(filename, buffer.Bytes(), 0644)
+	return nil
 }
 
-// Get retrieve a DICOM file by id
+// Get retrieve a DICOM file by id. The file is read from disk as it is read,
+// so must be closed
 func (d *localDICOMFileAdapter) Get(id string) (*File, error) {
-	filename := d.generateFileName(id)
-	file, err := os.Open(filename)
+	if !isValidLocalID(id) {
+		return nil, ErrFileNotFound
+	}
+
+	file, err := os.Open(d.linkName(id))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(d.opts.root, id))
+	}
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, ErrFileNotFound
 		}
 		return nil, err
 	}
-	defer file.Close()
-
-	var buffer bytes.Buffer
-	if _, err := io.Copy(&buffer, file); err != nil {
-		return nil, err
-	}
 
 	fileInfo, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
 
+	// the root also holds the directories files are stored in, which are not
+	// files themselves
+	if !fileInfo.Mode().IsRegular() {
+		file.Close()
+		return nil, ErrFileNotFound
+	}
+
 	dicomFile := NewFile(
 		id,
 		fileInfo.Size(),
-		// rather than return file, return a bytes reader so that we can
-		// safely manage file closing in this scope
-		bytes.NewReader(buffer.Bytes()),
+		file,
 	)
 
 	return &dicomFile, nil
 }
 
-func (d localDICOMFileAdapter) generateFileName(id string) string {
-	return fmt.Sprintf(defaultFileDest+"/%s", id)
+// Delete delete a DICOM file by id, moving it to the trash, or removing it
+// permanently if the trash is disabled. Directories left empty by the file
+// are removed
+func (d *localDICOMFileAdapter) Delete(id string) error {
+	if !isValidLocalID(id) {
+		return ErrFileNotFound
+	}
+
+	linkName := d.linkName(id)
+	filename := d.readLink(linkName)
+	if filename == "" {
+		linkName = ""
+		filename = filepath.Join(d.opts.root, id)
+	}
+
+	if _, err := os.Lstat(filename); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// a link left by an interrupted delete
+			if linkName != "" {
+				os.Remove(linkName)
+			}
+			return ErrFileNotFound
+		}
+		return err
+	}
+
+	// the file is moved before its link is removed, so that an interrupted
+	// delete never leaves a file without a link
+	if d.opts.trashRetention > 0 {
+		trashName := d.trashName(id)
+		if err := os.MkdirAll(filepath.Dir(trashName), 0700); err != nil {
+			return err
+		}
+		if err := os.Rename(filename, trashName); err != nil {
+			return err
+		}
+
+		// the modification time records when the file was deleted
+		now := time.Now()
+		if err := os.Chtimes(trashName, now, now); err != nil {
+			return err
+		}
+		if err := d.syncDir(filepath.Dir(trashName)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(filename); err != nil {
+		return err
+	}
+
+	if linkName != "" {
+		if err := os.Remove(linkName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		d.pruneDirs(filepath.Dir(linkName))
+	}
+	d.pruneDirs(filepath.Dir(filename))
+
+	return nil
+}
+
+// Restore restore a deleted DICOM file from the trash, replacing any file
+// created with the same ID since. Files purged, or due to be, can not be
+// restored
+func (d *localDICOMFileAdapter) Restore(id string) error {
+	if !isValidLocalID(id) {
+		return ErrFileNotFound
+	}
+
+	trashName := d.trashName(id)
+	trashed, err := os.Open(trashName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrFileNotFound
+		}
+		return err
+	}
+
+	fileInfo, err := trashed.Stat()
+	if err != nil {
+		trashed.Close()
+		return err
+	}
+	if isTrashExpired(fileInfo.ModTime(), d.opts.trashRetention) {
+		trashed.Close()
+		os.Remove(trashName)
+		return ErrFileNotFound
+	}
+
+	// the file is restored as it was created, so that it is stored by its
+	// UIDs as any other file
+	file := NewFile(id, fileInfo.Size(), trashed)
+	err = d.Create(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(trashName)
+}
+
+// PurgeTrash permanently remove files which have been in the trash longer
+// than its retention
+func (d *localDICOMFileAdapter) PurgeTrash() error {
+	entries, err := os.ReadDir(filepath.Join(d.opts.root, localTrashDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		fileInfo, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if isTrashExpired(fileInfo.ModTime(), d.opts.trashRetention) {
+			err := os.Remove(filepath.Join(d.opts.root, localTrashDir, entry.Name()))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// linkName utility to determine the name of the link identifying a file
+func (d *localDICOMFileAdapter) linkName(id string) string {
+	shard := id
+	if len(shard) > 2 {
+		shard = shard[:2]
+	}
+
+	return filepath.Join(d.opts.root, localIDsDir, shard, id)
+}
+
+// trashName utility to determine the name of a file in the trash
+func (d *localDICOMFileAdapter) trashName(id string) string {
+	return filepath.Join(d.opts.root, localTrashDir, id)
+}
+
+// readLink utility to read the name of the file a link identifies, or an
+// empty string if there is no link
+func (d *localDICOMFileAdapter) readLink(linkName string) string {
+	target, err := os.Readlink(linkName)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(linkName), target)
+	}
+
+	return target
+}
+
+// writeAtomic utility to write a file by writing a temporary file in the same
+// directory and renaming it over the file
+func (d *localDICOMFileAdapter) writeAtomic(filename string, write func(temp *os.File) error) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := write(temp); err != nil {
+		temp.Close()
+		return err
+	}
+	if d.opts.fsync {
+		if err := temp.Sync(); err != nil {
+			temp.Close()
+			return err
+		}
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp.Name(), filename); err != nil {
+		return err
+	}
+
+	return d.syncDir(dir)
+}
+
+// linkAtomic utility to create or replace a link by creating a temporary
+// link in the same directory and renaming it over the link
+func (d *localDICOMFileAdapter) linkAtomic(target string, linkName string) error {
+	dir := filepath.Dir(linkName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	temp := filepath.Join(dir, "."+filepath.Base(linkName)+".tmp-link")
+	os.Remove(temp)
+	if err := os.Symlink(target, temp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp, linkName); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return d.syncDir(dir)
+}
+
+// syncDir utility to sync a directory to disk, persisting the files renamed
+// into it, if syncing is enabled
+func (d *localDICOMFileAdapter) syncDir(dir string) error {
+	if !d.opts.fsync {
+		return nil
+	}
+
+	directory, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer directory.Close()
+
+	return directory.Sync()
+}
+
+// pruneDirs utility to remove a directory, and those containing it within the
+// root, for as long as they are empty
+func (d *localDICOMFileAdapter) pruneDirs(dir string) {
+	root := filepath.Clean(d.opts.root)
+	for dir = filepath.Clean(dir); strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+// isTrashExpired utility to determine whether a file deleted at the time has
+// been in the trash longer than its retention
+func isTrashExpired(deleted time.Time, retention time.Duration) bool {
+	return time.Since(deleted) > retention
+}
+
+// isValidLocalID utility to determine whether an ID can safely be used as a
+// file name, i.e. it can not escape the root of the repository
+func isValidLocalID(id string) bool {
+	return id != "" &&
+		!strings.HasPrefix(id, ".") &&
+		!strings.ContainsAny(id, `/\`)
+}
+
+// isLocalTempFile utility to determine whether a file name is that of a
+// temporary file or link, which is being or failed to be written
+func isLocalTempFile(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// localPathSegment utility to sanitize a UID for use as a path segment,
+// replacing any characters other than those of valid UIDs
+func localPathSegment(uid string) string {
+	segment := strings.Map(func(r rune) rune {
+		if ('0' <= r && r <= '9') || r == '.' {
+			return r
+		}
+		return '_'
+	}, strings.TrimRight(uid, " \x00"))
+
+	if strings.Trim(segment, ".") == "" {
+		return localUnknownUID
+	}
+
+	return segment
 }
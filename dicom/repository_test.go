@@ -0,0 +1,212 @@
+package dicom
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_localDICOMFileAdapter(t *testing.T) {
+	root := t.TempDir()
+	repository := NewLocalFileAdapter(LocalFileRoot(root), LocalFileSync(true))
+
+	// newFile test helper to encode an instance of a series with the ID
+	newFile := func(t *testing.T, id string, sopInstanceUID string) File {
+		file := newTestFile(t,
+			mustNewElement(tag.SOPInstanceUID, []string{sopInstanceUID}),
+			mustNewElement(tag.StudyInstanceUID, []string{"1.2"}),
+			mustNewElement(tag.SeriesInstanceUID, []string{"1.2.1"}),
+		)
+		file.ID = id
+		return *file
+	}
+
+	create := func(t *testing.T, file File) {
+		t.Helper()
+		if err := repository.Create(file); err != nil {
+			t.Fatalf("localDICOMFileAdapter.Create() error = %v", err)
+		}
+	}
+
+	// files are stored by their UIDs
+	create(t, newFile(t, "first", "1.2.1.1"))
+	if _, err := os.Stat(filepath.Join(root, "1.2", "1.2.1", "1.2.1.1.dcm")); err != nil {
+		t.Errorf("localDICOMFileAdapter.Create() did not store file by UIDs: %v", err)
+	}
+
+	// an instance with the same SOP instance UID is kept side by side
+	create(t, newFile(t, "second", "1.2.1.1"))
+	if _, err := os.Stat(filepath.Join(root, "1.2", "1.2.1", "1.2.1.1.second.dcm")); err != nil {
+		t.Errorf("localDICOMFileAdapter.Create() did not keep duplicate instance: %v", err)
+	}
+
+	// replacing a file with different UIDs removes the replaced file
+	create(t, newFile(t, "second", "1.2.1.2"))
+	if _, err := os.Stat(filepath.Join(root, "1.2", "1.2.1", "1.2.1.1.second.dcm")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("localDICOMFileAdapter.Create() did not remove replaced file: %v", err)
+	}
+
+	// files stored directly within the root remain readable
+	legacy := newFile(t, "legacy", "1.2.1.3")
+	legacyData, _ := io.ReadAll(legacy.Raw())
+	if err := os.WriteFile(filepath.Join(root, "legacy"), legacyData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := repository.GetAll()
+	if err != nil {
+		t.Fatalf("localDICOMFileAdapter.GetAll() error = %v", err)
+	}
+	sort.Strings(ids)
+	if want := []string{"first", "legacy", "second"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("localDICOMFileAdapter.GetAll() = %v, want %v", ids, want)
+	}
+
+	for id, want := range map[string]string{"first": "1.2.1.1", "second": "1.2.1.2", "legacy": "1.2.1.3"} {
+		file, err := repository.Get(id)
+		if err != nil {
+			t.Fatalf("localDICOMFileAdapter.Get(%s) error = %v", id, err)
+		}
+		uids, err := file.UIDs()
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uids.SOPInstanceUID != want {
+			t.Errorf("localDICOMFileAdapter.Get(%s) SOP instance UID = %v, want %v", id, uids.SOPInstanceUID, want)
+		}
+	}
+
+	// replacing a file stored directly within the root removes it
+	create(t, newFile(t, "legacy", "1.2.1.4"))
+	if _, err := os.Stat(filepath.Join(root, "legacy")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("localDICOMFileAdapter.Create() did not remove replaced file within the root: %v", err)
+	}
+
+	ids, err = repository.GetAll()
+	if err != nil {
+		t.Fatalf("localDICOMFileAdapter.GetAll() error = %v", err)
+	}
+	sort.Strings(ids)
+	if want := []string{"first", "legacy", "second"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("localDICOMFileAdapter.GetAll() after replacing file within the root = %v, want %v", ids, want)
+	}
+
+	for _, id := range []string{"missing", "..", ".ids", "../first", "1.2"} {
+		if _, err := repository.Get(id); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("localDICOMFileAdapter.Get(%s) error = %v, want %v", id, err, ErrFileNotFound)
+		}
+	}
+
+	// no temporary files are left behind
+	filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && entry.Name() != localIDsDir && isLocalTempFile(entry.Name()) {
+			t.Errorf("localDICOMFileAdapter.Create() left temporary file %s", path)
+		}
+		return err
+	})
+}
+
+func Test_localPathSegment(t *testing.T) {
+	tests := []struct {
+		uid  string
+		want string
+	}{
+		{uid: "1.2.840.10008", want: "1.2.840.10008"},
+		{uid: "1.2.3\x00", want: "1.2.3"},
+		{uid: "../1.2", want: ".._1.2"},
+		{uid: "..", want: localUnknownUID},
+		{uid: "", want: localUnknownUID},
+	}
+	for _, tt := range tests {
+		if got := localPathSegment(tt.uid); got != tt.want {
+			t.Errorf("localPathSegment(%q) = %v, want %v", tt.uid, got, tt.want)
+		}
+	}
+}
+
+func Test_localDICOMFileAdapter_Delete(t *testing.T) {
+	root := t.TempDir()
+	repository := NewLocalFileAdapter(LocalFileRoot(root))
+
+	for id, sopInstanceUID := range map[string]string{"first": "1.2.1.1", "second": "1.2.1.2"} {
+		file := newTestFile(t,
+			mustNewElement(tag.SOPInstanceUID, []string{sopInstanceUID}),
+			mustNewElement(tag.StudyInstanceUID, []string{"1.2"}),
+			mustNewElement(tag.SeriesInstanceUID, []string{"1.2.1"}),
+		)
+		file.ID = id
+		if err := repository.Create(*file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// deleted files are moved to the trash
+	if err := repository.Delete("first"); err != nil {
+		t.Fatalf("localDICOMFileAdapter.Delete() error = %v", err)
+	}
+	if _, err := repository.Get("first"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("localDICOMFileAdapter.Get() of deleted file error = %v, want %v", err, ErrFileNotFound)
+	}
+	if _, err := os.Stat(filepath.Join(root, localTrashDir, "first")); err != nil {
+		t.Errorf("localDICOMFileAdapter.Delete() did not move file to trash: %v", err)
+	}
+	if err := repository.Delete("first"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("localDICOMFileAdapter.Delete() of deleted file error = %v, want %v", err, ErrFileNotFound)
+	}
+
+	// directories left empty are removed
+	if err := repository.Delete("second"); err != nil {
+		t.Fatalf("localDICOMFileAdapter.Delete() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "1.2")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("localDICOMFileAdapter.Delete() did not remove empty study directory: %v", err)
+	}
+	if ids, _ := repository.GetAll(); len(ids) != 0 {
+		t.Errorf("localDICOMFileAdapter.GetAll() = %v, want none", ids)
+	}
+
+	// restored files are stored by their UIDs again
+	if err := repository.Restore("first"); err != nil {
+		t.Fatalf("localDICOMFileAdapter.Restore() error = %v", err)
+	}
+	file, err := repository.Get("first")
+	if err != nil {
+		t.Fatalf("localDICOMFileAdapter.Get() of restored file error = %v", err)
+	}
+	file.Close()
+	if _, err := os.Stat(filepath.Join(root, "1.2", "1.2.1", "1.2.1.1.dcm")); err != nil {
+		t.Errorf("localDICOMFileAdapter.Restore() did not store file by UIDs: %v", err)
+	}
+
+	// files in the trash longer than its retention are purged
+	expired := time.Now().Add(-defaultTrashRetention - time.Hour)
+	if err := os.Chtimes(filepath.Join(root, localTrashDir, "second"), expired, expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.PurgeTrash(); err != nil {
+		t.Fatalf("localDICOMFileAdapter.PurgeTrash() error = %v", err)
+	}
+	if err := repository.Restore("second"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("localDICOMFileAdapter.Restore() of purged file error = %v, want %v", err, ErrFileNotFound)
+	}
+
+	// files are removed permanently without a trash
+	repository = NewLocalFileAdapter(LocalFileRoot(root), LocalFileTrashRetention(0))
+	if err := repository.Delete("first"); err != nil {
+		t.Fatalf("localDICOMFileAdapter.Delete() error = %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, localTrashDir)); len(entries) != 0 {
+		t.Errorf("localDICOMFileAdapter.Delete() moved %d files to trash, want none", len(entries))
+	}
+	if err := repository.Restore("first"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("localDICOMFileAdapter.Restore() of removed file error = %v, want %v", err, ErrFileNotFound)
+	}
+}
@@ -0,0 +1,735 @@
+package dicom
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultS3Region   = "us-east-1"
+	defaultS3PartSize = 16 << 20
+
+	// s3ReadChunkSize the size of the ranges of an object read at a time
+	s3ReadChunkSize = 4 << 20
+
+	// s3TrashPrefix the prefix, following the key prefix, of the keys deleted
+	// files are moved to
+	s3TrashPrefix = ".trash/"
+
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3DateFormat      = "20060102T150405Z"
+)
+
+// s3EmptyPayloadHash the SHA-256 hash of an empty request body
+var s3EmptyPayloadHash = hex.EncodeToString(sha256.New().Sum(nil))
+
+// S3Options options when instantiating an S3 file adapter
+type S3Options struct {
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	prefix          string
+	partSize        int64
+	trashRetention  time.Duration
+	httpClient      *http.Client
+}
+
+// S3Region option to specify the region requests are signed for. Defaults to
+// us-east-1, which S3-compatible stores such as MinIO accept by default
+func S3Region(region string) func(opts *S3Options) {
+	return func(opts *S3Options) {
+		opts.region = region
+	}
+}
+
+// S3Credentials option to specify the access key requests are signed with.
+// Requests are sent unsigned, anonymously, without credentials
+func S3Credentials(accessKeyID string, secretAccessKey string) func(opts *S3Options) {
+	return func(opts *S3Options) {
+		opts.accessKeyID = accessKeyID
+		opts.secretAccessKey = secretAccessKey
+	}
+}
+
+// S3Prefix option to specify a prefix of the keys files are stored under,
+// e.g. dicom/
+func S3Prefix(prefix string) func(opts *S3Options) {
+	return func(opts *S3Options) {
+		opts.prefix = prefix
+	}
+}
+
+// S3PartSize option to specify the size of the parts of multipart uploads.
+// Files larger than a single part are uploaded in parts, which S3 requires to
+// be at least 5 MiB. Defaults to 16 MiB
+func S3PartSize(size int64) func(opts *S3Options) {
+	return func(opts *S3Options) {
+		opts.partSize = size
+	}
+}
+
+// S3TrashRetention option to specify the time deleted files are kept in the
+// trash before they are purged. Files are deleted permanently if zero.
+// Defaults to 7 days
+func S3TrashRetention(retention time.Duration) func(opts *S3Options) {
+	return func(opts *S3Options) {
+		opts.trashRetention = retention
+	}
+}
+
+// S3HTTPClient option to specify the http client requests are sent with
+func S3HTTPClient(client *http.Client) func(opts *S3Options) {
+	return func(opts *S3Options) {
+		opts.httpClient = client
+	}
+}
+
+// s3DICOMFileAdapter an implementation of FileRepository that stores DICOM
+// files as objects of an S3-compatible object store, such as AWS S3 or MinIO.
+// Objects are addressed path-style, i.e. {endpoint}/{bucket}/{key}. Deleted
+// files are moved to keys under .trash/, following the key prefix
+type s3DICOMFileAdapter struct {
+	endpoint *url.URL
+	bucket   string
+	opts     S3Options
+
+	readChunkSize int
+}
+
+// NewS3FileAdapter construct an S3 file adapter repository storing files in
+// the bucket of the object store at the endpoint, e.g. http://localhost:9000
+func NewS3FileAdapter(
+	endpoint string,
+	bucket string,
+	options ...func(opts *S3Options),
+) (FileRepository, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, fmt.Errorf("malformed S3 endpoint %s, must be a URL such as http://localhost:9000", endpoint)
+	}
+	if bucket == "" {
+		return nil, errors.New("S3 bucket is required")
+	}
+
+	opts := S3Options{
+		region:         defaultS3Region,
+		partSize:       defaultS3PartSize,
+		trashRetention: defaultTrashRetention,
+		httpClient:     http.DefaultClient,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	return &s3DICOMFileAdapter{
+		endpoint:      endpointURL,
+		bucket:        bucket,
+		opts:          opts,
+		readChunkSize: s3ReadChunkSize,
+	}, nil
+}
+
+func (d *s3DICOMFileAdapter) GetAll() ([]string, error) {
+	objects, err := d.list(d.opts.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, object := range objects {
+		id := strings.TrimPrefix(object.Key, d.opts.prefix)
+		if !strings.HasPrefix(id, s3TrashPrefix) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// Create create a new DICOM file, uploading it in parts if it is larger than
+// a single part
+func (d *s3DICOMFileAdapter) Create(file File) error {
+	raw := file.Raw()
+	if file.Size() > d.opts.partSize {
+		return d.createMultipart(d.key(file.ID), raw)
+	}
+
+	header := http.Header{"Content-Type": {"application/dicom"}}
+	resp, err := d.do(http.MethodPut, d.key(file.ID), nil, header, raw, file.Size())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Get retrieve a DICOM file by id. The file is read from the object store as
+// it is read, a range at a time
+func (d *s3DICOMFileAdapter) Get(id string) (*File, error) {
+	resp, err := d.do(http.MethodHead, d.key(id), nil, nil, nil, 0)
+	if err != nil {
+		return nil, s3NotFoundError(err)
+	}
+	resp.Body.Close()
+
+	dicomFile := NewFile(
+		id,
+		resp.ContentLength,
+		&s3ObjectReader{
+			adapter: d,
+			key:     d.key(id),
+			size:    resp.ContentLength,
+		},
+	)
+
+	return &dicomFile, nil
+}
+
+// Delete delete a DICOM file by id, moving it to the trash, or removing it
+// permanently if the trash is disabled
+func (d *s3DICOMFileAdapter) Delete(id string) error {
+	key := d.key(id)
+
+	if d.opts.trashRetention > 0 {
+		if err := d.copy(key, d.trashKey(id)); err != nil {
+			return err
+		}
+	} else {
+		// deleting a missing object succeeds, so its existence is checked
+		resp, err := d.do(http.MethodHead, key, nil, nil, nil, 0)
+		if err != nil {
+			return s3NotFoundError(err)
+		}
+		resp.Body.Close()
+	}
+
+	return d.remove(key)
+}
+
+// Restore restore a deleted DICOM file from the trash, replacing any file
+// created with the same ID since. Files purged, or due to be, can not be
+// restored
+func (d *s3DICOMFileAdapter) Restore(id string) error {
+	trashKey := d.trashKey(id)
+
+	resp, err := d.do(http.MethodHead, trashKey, nil, nil, nil, 0)
+	if err != nil {
+		return s3NotFoundError(err)
+	}
+	resp.Body.Close()
+
+	// objects are copied to the trash, so were last modified when deleted
+	deleted, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return fmt.Errorf("malformed S3 response: %w", err)
+	}
+	if isTrashExpired(deleted, d.opts.trashRetention) {
+		d.remove(trashKey)
+		return ErrFileNotFound
+	}
+
+	if err := d.copy(trashKey, d.key(id)); err != nil {
+		return err
+	}
+
+	return d.remove(trashKey)
+}
+
+// PurgeTrash permanently remove files which have been in the trash longer
+// than its retention
+func (d *s3DICOMFileAdapter) PurgeTrash() error {
+	objects, err := d.list(d.opts.prefix + s3TrashPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		if isTrashExpired(object.LastModified, d.opts.trashRetention) {
+			if err := d.remove(object.Key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// s3Object an object listed in the bucket
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// list utility to list every object with keys starting with the prefix, a
+// page at a time
+func (d *s3DICOMFileAdapter) list(prefix string) ([]s3Object, error) {
+	type listBucketResult struct {
+		Contents              []s3Object `xml:"Contents"`
+		IsTruncated           bool       `xml:"IsTruncated"`
+		NextContinuationToken string     `xml:"NextContinuationToken"`
+	}
+
+	var objects []s3Object
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+	}
+	for {
+		var result listBucketResult
+		if err := d.doXML(http.MethodGet, "", query, nil, &result); err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, result.Contents...)
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// copy utility to copy an object within the bucket
+func (d *s3DICOMFileAdapter) copy(sourceKey string, key string) error {
+	header := http.Header{
+		"X-Amz-Copy-Source": {s3Escape("/"+d.bucket+"/"+sourceKey, false)},
+	}
+
+	// copying may fail after the response status is sent, so is reported as
+	// an error document of a successful response
+	var copied struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := d.doXML(http.MethodPut, key, nil, header, &copied); err != nil {
+		return s3NotFoundError(err)
+	}
+	if copied.XMLName.Local == "Error" {
+		return &s3Error{statusCode: http.StatusOK, code: copied.Code, message: copied.Message}
+	}
+
+	return nil
+}
+
+// remove utility to delete an object
+func (d *s3DICOMFileAdapter) remove(key string) error {
+	resp, err := d.do(http.MethodDelete, key, nil, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// createMultipart utility to upload an object in parts, reading a single
+// part into memory at a time. The upload is aborted if any part fails
+func (d *s3DICOMFileAdapter) createMultipart(key string, contents io.Reader) error {
+	type initiateResult struct {
+		UploadID string `xml:"UploadId"`
+	}
+	type completePart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	type completeRequest struct {
+		XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+		Parts   []completePart `xml:"Part"`
+	}
+
+	header := http.Header{"Content-Type": {"application/dicom"}}
+	var initiated initiateResult
+	if err := d.doXML(http.MethodPost, key, url.Values{"uploads": {""}}, header, &initiated); err != nil {
+		return err
+	}
+
+	upload := func() error {
+		var parts []completePart
+		buffer := make([]byte, d.opts.partSize)
+		for partNumber := 1; ; partNumber++ {
+			n, err := io.ReadFull(contents, buffer)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return err
+			}
+
+			query := url.Values{
+				"partNumber": {strconv.Itoa(partNumber)},
+				"uploadId":   {initiated.UploadID},
+			}
+			resp, err := d.do(http.MethodPut, key, query, nil, bytes.NewReader(buffer[:n]), int64(n))
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+
+			parts = append(parts, completePart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+			if n < len(buffer) {
+				break
+			}
+		}
+
+		body, err := xml.Marshal(completeRequest{Parts: parts})
+		if err != nil {
+			return err
+		}
+
+		// completion may fail after the response status is sent, so is
+		// reported as an error document of a successful response
+		var completed struct {
+			XMLName xml.Name
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		query := url.Values{"uploadId": {initiated.UploadID}}
+		resp, err := d.do(http.MethodPost, key, query, nil, bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err := xml.NewDecoder(resp.Body).Decode(&completed); err != nil {
+			return fmt.Errorf("malformed S3 response: %w", err)
+		}
+		if completed.XMLName.Local == "Error" {
+			return &s3Error{statusCode: resp.StatusCode, code: completed.Code, message: completed.Message}
+		}
+
+		return nil
+	}
+
+	if err := upload(); err != nil {
+		query := url.Values{"uploadId": {initiated.UploadID}}
+		if resp, abortErr := d.do(http.MethodDelete, key, query, nil, nil, 0); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	return nil
+}
+
+// key utility to determine the key of the object storing a file
+func (d *s3DICOMFileAdapter) key(id string) string {
+	return d.opts.prefix + id
+}
+
+// trashKey utility to determine the key of the object storing a deleted file
+func (d *s3DICOMFileAdapter) trashKey(id string) string {
+	return d.opts.prefix + s3TrashPrefix + id
+}
+
+// doXML utility to send a request without a body, decoding the XML response
+func (d *s3DICOMFileAdapter) doXML(
+	method string,
+	key string,
+	query url.Values,
+	header http.Header,
+	result interface{},
+) error {
+	resp, err := d.do(method, key, query, header, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("malformed S3 response: %w", err)
+	}
+
+	return nil
+}
+
+// do utility to send a signed request for an object, or the bucket if the key
+// is empty. Responses other than 2xx are returned as an *s3Error
+func (d *s3DICOMFileAdapter) do(
+	method string,
+	key string,
+	query url.Values,
+	header http.Header,
+	body io.Reader,
+	contentLength int64,
+) (*http.Response, error) {
+	objectPath := d.endpoint.Path + "/" + d.bucket
+	if key != "" {
+		objectPath += "/" + key
+	}
+
+	requestURL := *d.endpoint
+	requestURL.Path = objectPath
+	requestURL.RawPath = s3Escape(objectPath, false)
+	requestURL.RawQuery = s3CanonicalQuery(query)
+
+	if contentLength == 0 {
+		body = nil
+	}
+	req, err := http.NewRequest(method, requestURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = contentLength
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := s3EmptyPayloadHash
+	if body != nil {
+		payloadHash = s3UnsignedPayload
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if d.opts.accessKeyID != "" {
+		signS3Request(req, d.opts.region, d.opts.accessKeyID, d.opts.secretAccessKey, time.Now())
+	}
+
+	resp, err := d.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+
+		s3Err := &s3Error{statusCode: resp.StatusCode}
+		var errorResponse struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if xml.NewDecoder(resp.Body).Decode(&errorResponse) == nil {
+			s3Err.code = errorResponse.Code
+			s3Err.message = errorResponse.Message
+		}
+		return nil, s3Err
+	}
+
+	return resp, nil
+}
+
+// s3Error an error response of the object store
+type s3Error struct {
+	statusCode int
+	code       string
+	message    string
+}
+
+func (e *s3Error) Error() string {
+	if e.code == "" {
+		return fmt.Sprintf("S3 request failed with status %d", e.statusCode)
+	}
+
+	return fmt.Sprintf("S3 request failed with status %d: %s %s", e.statusCode, e.code, e.message)
+}
+
+// s3NotFoundError utility to map an error response for a missing object to
+// ErrFileNotFound
+func s3NotFoundError(err error) error {
+	var s3Err *s3Error
+	if errors.As(err, &s3Err) && (s3Err.statusCode == http.StatusNotFound || s3Err.code == "NoSuchKey") {
+		return ErrFileNotFound
+	}
+
+	return err
+}
+
+// s3ObjectReader reads an object a range at a time, holding only the most
+// recently read range in memory
+type s3ObjectReader struct {
+	adapter *s3DICOMFileAdapter
+	key     string
+	size    int64
+
+	// chunk the most recently read range of the object, from chunkOffset
+	mu          sync.Mutex
+	chunk       []byte
+	chunkOffset int64
+}
+
+func (r *s3ObjectReader) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		position := offset + int64(n)
+		if position >= r.size {
+			return n, io.EOF
+		}
+
+		if position < r.chunkOffset || position >= r.chunkOffset+int64(len(r.chunk)) {
+			if err := r.readChunk(position); err != nil {
+				return n, err
+			}
+		}
+
+		n += copy(p[n:], r.chunk[position-r.chunkOffset:])
+	}
+
+	return n, nil
+}
+
+// readChunk utility to read the range of the object from the offset
+func (r *s3ObjectReader) readChunk(offset int64) error {
+	end := min(offset+int64(r.adapter.readChunkSize), r.size)
+
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, end-1)}}
+	resp, err := r.adapter.do(http.MethodGet, r.key, nil, header, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if cap(r.chunk) < int(end-offset) {
+		r.chunk = make([]byte, end-offset)
+	}
+	r.chunk = r.chunk[:end-offset]
+	r.chunkOffset = offset
+
+	if _, err := io.ReadFull(resp.Body, r.chunk); err != nil {
+		r.chunk = r.chunk[:0]
+		return err
+	}
+
+	return nil
+}
+
+// signS3Request utility to sign a request with AWS Signature Version 4. The
+// host, content type, range and x-amz-* headers are signed, along with the
+// payload hash of the X-Amz-Content-Sha256 header. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signS3Request(
+	req *http.Request,
+	region string,
+	accessKeyID string,
+	secretAccessKey string,
+	now time.Time,
+) {
+	amzDate := now.UTC().Format(s3DateFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = s3EmptyPayloadHash
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, value := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, value)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// hmacSHA256 utility to compute the HMAC-SHA256 of a value
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery utility to encode query params sorted by key, escaped as
+// required by Signature Version 4
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// s3Escape utility to percent-encode every byte other than unreserved
+// characters and, optionally, '/'
+func s3Escape(value string, escapeSlash bool) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~',
+			b == '/' && !escapeSlash:
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,343 @@
+package dicom
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// QueryLevel a level of the patient root or study root information model
+// hierarchy at which a search is performed, as defined by the Query/Retrieve
+// Level (0008,0052) attribute
+type QueryLevel string
+
+const (
+	QueryLevelPatient QueryLevel = "PATIENT"
+	QueryLevelStudy   QueryLevel = "STUDY"
+	QueryLevelSeries  QueryLevel = "SERIES"
+	QueryLevelImage   QueryLevel = "IMAGE"
+)
+
+// defaultReturnTags attributes returned for each query level in addition to
+// any matching keys and included fields. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part18/sect_6.7.html#table_6.7.1-2
+var defaultReturnTags = map[QueryLevel][]tag.Tag{
+	QueryLevelPatient: {
+		tag.SpecificCharacterSet,
+		tag.PatientName,
+		tag.PatientID,
+		tag.PatientBirthDate,
+		tag.PatientSex,
+		tag.NumberOfPatientRelatedStudies,
+		tag.NumberOfPatientRelatedSeries,
+		tag.NumberOfPatientRelatedInstances,
+	},
+	QueryLevelStudy: {
+		tag.SpecificCharacterSet,
+		tag.StudyDate,
+		tag.StudyTime,
+		tag.AccessionNumber,
+		tag.ModalitiesInStudy,
+		tag.ReferringPhysicianName,
+		tag.PatientName,
+		tag.PatientID,
+		tag.PatientBirthDate,
+		tag.PatientSex,
+		tag.StudyInstanceUID,
+		tag.StudyID,
+		tag.NumberOfStudyRelatedSeries,
+		tag.NumberOfStudyRelatedInstances,
+	},
+	QueryLevelSeries: {
+		tag.SpecificCharacterSet,
+		tag.Modality,
+		tag.SeriesDescription,
+		tag.SeriesNumber,
+		tag.StudyInstanceUID,
+		tag.SeriesInstanceUID,
+		tag.NumberOfSeriesRelatedInstances,
+		tag.PerformedProcedureStepStartDate,
+		tag.PerformedProcedureStepStartTime,
+	},
+	QueryLevelImage: {
+		tag.SpecificCharacterSet,
+		tag.SOPClassUID,
+		tag.StudyInstanceUID,
+		tag.SeriesInstanceUID,
+		tag.SOPInstanceUID,
+		tag.InstanceNumber,
+		tag.Rows,
+		tag.Columns,
+		tag.BitsAllocated,
+		tag.NumberOfFrames,
+	},
+}
+
+// SearchQuery a search for the patients, studies, series or instances whose
+// attributes match a set of keys
+type SearchQuery struct {
+	Level QueryLevel
+
+	// Keys matching keys by attribute tag. Keys with empty values match every
+	// entity and only request the attribute be returned
+	Keys map[tag.Tag]string
+
+	// IncludeFields additional attributes to return for each match
+	IncludeFields []tag.Tag
+
+	// IncludeAll return every available attribute for each match
+	IncludeAll bool
+
+	// Limit the maximum number of matches to return. Zero means no limit
+	Limit int
+
+	// Offset the number of matches to skip
+	Offset int
+}
+
+// search utility to search the given instances, returning the attributes of
+// each matching entity in the DICOM JSON Model. Entities are returned in the
+// order they were first indexed
+func search(instances []InstanceMetadata, query SearchQuery) []JSONDataset {
+	return searchEntities(groupInstances(instances, query.Level), query)
+}
+
+// searchEntities utility to select the entities matching the query, returning
+// the attributes of each match within the offset and limit of the query
+func searchEntities(entities []JSONDataset, query SearchQuery) []JSONDataset {
+	var matches []JSONDataset
+	for _, entity := range entities {
+		if matchesKeys(entity, query) {
+			matches = append(matches, entity)
+		}
+	}
+
+	if query.Offset >= len(matches) {
+		return []JSONDataset{}
+	}
+	matches = matches[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(matches) {
+		matches = matches[:query.Limit]
+	}
+
+	results := make([]JSONDataset, 0, len(matches))
+	for _, entity := range matches {
+		results = append(results, returnAttributes(entity, query))
+	}
+
+	return results
+}
+
+// entityGroup the instances of a patient, study or series
+type entityGroup struct {
+	// attributes the attributes of the first instance of the group
+	attributes JSONDataset
+
+	studies   int
+	series    int
+	instances int
+
+	// modalities the distinct modalities of the series of the group, in the
+	// order the series were first indexed
+	modalities []string
+}
+
+// entity utility to create the entity of a group at the query level, the
+// attributes of its first instance along with the number of related studies,
+// series and instances
+func (g entityGroup) entity(level QueryLevel) JSONDataset {
+	entity := make(JSONDataset, len(g.attributes)+3)
+	for attributeTag, attribute := range g.attributes {
+		entity[attributeTag] = attribute
+	}
+
+	switch level {
+	case QueryLevelPatient:
+		entity[JSONTagKey(tag.NumberOfPatientRelatedStudies)] = jsonInteger(g.studies)
+		entity[JSONTagKey(tag.NumberOfPatientRelatedSeries)] = jsonInteger(g.series)
+		entity[JSONTagKey(tag.NumberOfPatientRelatedInstances)] = jsonInteger(g.instances)
+	case QueryLevelSeries:
+		entity[JSONTagKey(tag.NumberOfSeriesRelatedInstances)] = jsonInteger(g.instances)
+	default:
+		entity[JSONTagKey(tag.NumberOfStudyRelatedSeries)] = jsonInteger(g.series)
+		entity[JSONTagKey(tag.NumberOfStudyRelatedInstances)] = jsonInteger(g.instances)
+
+		modalities := JSONAttribute{VR: "CS"}
+		for _, modality := range g.modalities {
+			modalities.Value = append(modalities.Value, modality)
+		}
+		entity[JSONTagKey(tag.ModalitiesInStudy)] = modalities
+	}
+
+	return entity
+}
+
+// groupInstances utility to group instances into the entities of the query
+// level. See entityGroup
+func groupInstances(instances []InstanceMetadata, level QueryLevel) []JSONDataset {
+	if level == QueryLevelImage {
+		entities := make([]JSONDataset, 0, len(instances))
+		for _, instance := range instances {
+			entities = append(entities, instance.Attributes)
+		}
+		return entities
+	}
+
+	type group struct {
+		entityGroup
+		studies map[string]bool
+		series  map[string]bool
+	}
+
+	var keys []string
+	groups := make(map[string]*group)
+	for _, instance := range instances {
+		var key string
+		switch level {
+		case QueryLevelPatient:
+			key = FirstJSONString(instance.Attributes, tag.PatientID)
+		case QueryLevelSeries:
+			key = instance.SeriesInstanceUID
+		default:
+			key = instance.StudyInstanceUID
+		}
+
+		g, ok := groups[key]
+		if !ok {
+			g = &group{
+				entityGroup: entityGroup{attributes: instance.Attributes},
+				studies:     make(map[string]bool),
+				series:      make(map[string]bool),
+			}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+
+		g.instances++
+		g.studies[instance.StudyInstanceUID] = true
+		if !g.series[instance.SeriesInstanceUID] {
+			g.series[instance.SeriesInstanceUID] = true
+			if modality := FirstJSONString(instance.Attributes, tag.Modality); modality != "" {
+				g.modalities = appendUnique(g.modalities, modality)
+			}
+		}
+	}
+
+	entities := make([]JSONDataset, 0, len(keys))
+	for _, key := range keys {
+		g := groups[key]
+		g.entityGroup.studies = len(g.studies)
+		g.entityGroup.series = len(g.series)
+		entities = append(entities, g.entity(level))
+	}
+
+	return entities
+}
+
+// matchesKeys utility to determine whether an entity matches every key of the
+// query. At the study level, Modality keys match the modalities in the study
+func matchesKeys(entity JSONDataset, query SearchQuery) bool {
+	for keyTag, key := range query.Keys {
+		if key == "" {
+			continue
+		}
+
+		if query.Level == QueryLevelStudy && keyTag == tag.Modality {
+			keyTag = tag.ModalitiesInStudy
+		}
+
+		attribute, ok := entity[JSONTagKey(keyTag)]
+		if !ok {
+			return false
+		}
+
+		vr := attribute.VR
+		if vr == "" {
+			if info, err := tag.Find(keyTag); err == nil {
+				vr = info.VR
+			}
+		}
+
+		if !matchAttribute(vr, jsonAttributeStrings(attribute), key) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// returnAttributes utility to select the attributes of an entity to return for
+// the query
+func returnAttributes(entity JSONDataset, query SearchQuery) JSONDataset {
+	if query.IncludeAll {
+		return entity
+	}
+
+	returnTags := append([]tag.Tag{}, defaultReturnTags[query.Level]...)
+	returnTags = append(returnTags, query.IncludeFields...)
+	for keyTag := range query.Keys {
+		returnTags = append(returnTags, keyTag)
+	}
+
+	result := make(JSONDataset, len(returnTags))
+	for _, returnTag := range returnTags {
+		key := JSONTagKey(returnTag)
+		if attribute, ok := entity[key]; ok {
+			result[key] = attribute
+		}
+	}
+
+	return result
+}
+
+// jsonAttributeStrings utility to read the values of a DICOM JSON attribute as
+// strings for matching. Person names are returned as each of their non-empty
+// component groups
+func jsonAttributeStrings(attribute JSONAttribute) []string {
+	if attribute.VR != "PN" {
+		return attribute.Strings()
+	}
+
+	var values []string
+	for _, value := range attribute.Strings() {
+		for _, group := range strings.Split(value, "=") {
+			if group != "" {
+				values = append(values, group)
+			}
+		}
+	}
+
+	return values
+}
+
+// FirstJSONString utility to read the first value of an attribute of a DICOM
+// JSON dataset as a string
+func FirstJSONString(dataset JSONDataset, t tag.Tag) string {
+	values := jsonAttributeStrings(dataset[JSONTagKey(t)])
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// jsonInteger utility to create an IS attribute holding a single integer
+func jsonInteger(value int) JSONAttribute {
+	return JSONAttribute{
+		VR:    "IS",
+		Value: []interface{}{json.Number(strconv.Itoa(value))},
+	}
+}
+
+// appendUnique utility to append a value to a slice if not already present
+func appendUnique(values []string, value string) []string {
+	for _, existing := range values {
+		if existing == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
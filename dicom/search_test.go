@@ -0,0 +1,194 @@
+package dicom
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_search(t *testing.T) {
+	newInstance := func(studyUID, seriesUID, sopUID, patientID, patientName, studyDate, modality string) InstanceMetadata {
+		return InstanceMetadata{
+			FileID: sopUID,
+			InstanceUIDs: InstanceUIDs{
+				StudyInstanceUID:  studyUID,
+				SeriesInstanceUID: seriesUID,
+				SOPInstanceUID:    sopUID,
+			},
+			Attributes: NewJSONDataset([]*dicom.Element{
+				mustNewElement(tag.StudyInstanceUID, []string{studyUID}),
+				mustNewElement(tag.SeriesInstanceUID, []string{seriesUID}),
+				mustNewElement(tag.SOPInstanceUID, []string{sopUID}),
+				mustNewElement(tag.PatientID, []string{patientID}),
+				mustNewElement(tag.PatientName, []string{patientName}),
+				mustNewElement(tag.StudyDate, []string{studyDate}),
+				mustNewElement(tag.Modality, []string{modality}),
+			}),
+		}
+	}
+
+	instances := []InstanceMetadata{
+		newInstance("1", "1.1", "1.1.1", "P1", "DOE^JOHN", "20240301", "CT"),
+		newInstance("1", "1.1", "1.1.2", "P1", "DOE^JOHN", "20240301", "CT"),
+		newInstance("1", "1.2", "1.2.1", "P1", "DOE^JOHN", "20240301", "PT"),
+		newInstance("2", "2.1", "2.1.1", "P2", "ROE^JANE", "20240310", "MR"),
+	}
+
+	type args struct {
+		query SearchQuery
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "returns every study with related counts",
+			args: args{
+				query: SearchQuery{
+					Level: QueryLevelStudy,
+				},
+			},
+			want: `[` +
+				`{"00080020":{"vr":"DA","Value":["20240301"]},"00080061":{"vr":"CS","Value":["CT","PT"]},"00100010":{"vr":"PN","Value":[{"Alphabetic":"DOE^JOHN"}]},"00100020":{"vr":"LO","Value":["P1"]},"0020000D":{"vr":"UI","Value":["1"]},"00201206":{"vr":"IS","Value":[2]},"00201208":{"vr":"IS","Value":[3]}},` +
+				`{"00080020":{"vr":"DA","Value":["20240310"]},"00080061":{"vr":"CS","Value":["MR"]},"00100010":{"vr":"PN","Value":[{"Alphabetic":"ROE^JANE"}]},"00100020":{"vr":"LO","Value":["P2"]},"0020000D":{"vr":"UI","Value":["2"]},"00201206":{"vr":"IS","Value":[1]},"00201208":{"vr":"IS","Value":[1]}}` +
+				`]`,
+		},
+		{
+			name: "returns patients with related counts",
+			args: args{
+				query: SearchQuery{
+					Level: QueryLevelPatient,
+					Keys: map[tag.Tag]string{
+						tag.PatientName: "DOE*",
+					},
+				},
+			},
+			want: `[{"00100010":{"vr":"PN","Value":[{"Alphabetic":"DOE^JOHN"}]},"00100020":{"vr":"LO","Value":["P1"]},"00201200":{"vr":"IS","Value":[1]},"00201202":{"vr":"IS","Value":[2]},"00201204":{"vr":"IS","Value":[3]}}]`,
+		},
+		{
+			name: "matches studies by modality in study",
+			args: args{
+				query: SearchQuery{
+					Level: QueryLevelStudy,
+					Keys: map[tag.Tag]string{
+						tag.Modality: "PT",
+					},
+				},
+			},
+			want: `[{"00080020":{"vr":"DA","Value":["20240301"]},"00080060":{"vr":"CS","Value":["CT"]},"00080061":{"vr":"CS","Value":["CT","PT"]},"00100010":{"vr":"PN","Value":[{"Alphabetic":"DOE^JOHN"}]},"00100020":{"vr":"LO","Value":["P1"]},"0020000D":{"vr":"UI","Value":["1"]},"00201206":{"vr":"IS","Value":[2]},"00201208":{"vr":"IS","Value":[3]}}]`,
+		},
+		{
+			name: "matches studies by patient name wildcard and date range",
+			args: args{
+				query: SearchQuery{
+					Level: QueryLevelStudy,
+					Keys: map[tag.Tag]string{
+						tag.PatientName:      "roe*",
+						tag.StudyDate:        "20240305-",
+						tag.StudyInstanceUID: "",
+					},
+				},
+			},
+			want: `[{"00080020":{"vr":"DA","Value":["20240310"]},"00080061":{"vr":"CS","Value":["MR"]},"00100010":{"vr":"PN","Value":[{"Alphabetic":"ROE^JANE"}]},"00100020":{"vr":"LO","Value":["P2"]},"0020000D":{"vr":"UI","Value":["2"]},"00201206":{"vr":"IS","Value":[1]},"00201208":{"vr":"IS","Value":[1]}}]`,
+		},
+		{
+			name: "returns the series of a study",
+			args: args{
+				query: SearchQuery{
+					Level: QueryLevelSeries,
+					Keys: map[tag.Tag]string{
+						tag.StudyInstanceUID: "1",
+					},
+				},
+			},
+			want: `[` +
+				`{"00080060":{"vr":"CS","Value":["CT"]},"0020000D":{"vr":"UI","Value":["1"]},"0020000E":{"vr":"UI","Value":["1.1"]},"00201209":{"vr":"IS","Value":[2]}},` +
+				`{"00080060":{"vr":"CS","Value":["PT"]},"0020000D":{"vr":"UI","Value":["1"]},"0020000E":{"vr":"UI","Value":["1.2"]},"00201209":{"vr":"IS","Value":[1]}}` +
+				`]`,
+		},
+		{
+			name: "matches instances by UID list and patient ID wildcard",
+			args: args{
+				query: SearchQuery{
+					Level: QueryLevelImage,
+					Keys: map[tag.Tag]string{
+						tag.SOPInstanceUID: `1.1.1\2.1.1\1.2.1`,
+						tag.PatientID:      "P?",
+						tag.PatientName:    "doe^john",
+					},
+				},
+			},
+			want: `[` +
+				`{"00080018":{"vr":"UI","Value":["1.1.1"]},"00100010":{"vr":"PN","Value":[{"Alphabetic":"DOE^JOHN"}]},"00100020":{"vr":"LO","Value":["P1"]},"0020000D":{"vr":"UI","Value":["1"]},"0020000E":{"vr":"UI","Value":["1.1"]}},` +
+				`{"00080018":{"vr":"UI","Value":["1.2.1"]},"00100010":{"vr":"PN","Value":[{"Alphabetic":"DOE^JOHN"}]},"00100020":{"vr":"LO","Value":["P1"]},"0020000D":{"vr":"UI","Value":["1"]},"0020000E":{"vr":"UI","Value":["1.2"]}}` +
+				`]`,
+		},
+		{
+			name: "matches series by exact date and modality wildcard",
+			args: args{
+				query: SearchQuery{
+					Level: QueryLevelSeries,
+					Keys: map[tag.Tag]string{
+						tag.StudyDate: "20240301",
+						tag.Modality:  "P*",
+					},
+				},
+			},
+			want: `[{"00080020":{"vr":"DA","Value":["20240301"]},"00080060":{"vr":"CS","Value":["PT"]},"0020000D":{"vr":"UI","Value":["1"]},"0020000E":{"vr":"UI","Value":["1.2"]},"00201209":{"vr":"IS","Value":[1]}}]`,
+		},
+		{
+			name: "applies offset and limit to instances",
+			args: args{
+				query: SearchQuery{
+					Level:  QueryLevelImage,
+					Limit:  1,
+					Offset: 1,
+				},
+			},
+			want: `[{"00080018":{"vr":"UI","Value":["1.1.2"]},"0020000D":{"vr":"UI","Value":["1"]},"0020000E":{"vr":"UI","Value":["1.1"]}}]`,
+		},
+		{
+			name: "returns no matches for offset beyond matches",
+			args: args{
+				query: SearchQuery{
+					Level:  QueryLevelImage,
+					Offset: 4,
+				},
+			},
+			want: `[]`,
+		},
+	}
+	sqliteIndex, err := NewSQLiteIndex(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, index := range map[string]MetadataIndex{"memory": NewMemoryIndex(), "sqlite": sqliteIndex} {
+		for _, instance := range instances {
+			if err := index.Add(instance); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				results, err := index.Search(tt.args.query)
+				if err != nil {
+					t.Fatalf("Search() error = %v", err)
+				}
+
+				got, err := json.Marshal(results)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("Search() = %s, want %s", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,626 @@
+package dicom
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// sqliteSchema the schema of the SQLite metadata index. Key attributes of each
+// instance are held in columns for filtering and sorting, alongside all of its
+// attributes in the DICOM JSON Model
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS instances (
+	file_id          TEXT PRIMARY KEY,
+	study_uid        TEXT NOT NULL,
+	series_uid       TEXT NOT NULL,
+	sop_uid          TEXT NOT NULL,
+	sop_class_uid    TEXT NOT NULL,
+	patient_id       TEXT NOT NULL,
+	patient_name     TEXT NOT NULL,
+	study_date       TEXT NOT NULL,
+	series_date      TEXT NOT NULL,
+	modality         TEXT NOT NULL,
+	image_rows       INTEGER NOT NULL,
+	image_columns    INTEGER NOT NULL,
+	number_of_frames INTEGER NOT NULL,
+	size             INTEGER NOT NULL,
+	created          INTEGER NOT NULL,
+	attributes       TEXT NOT NULL,
+	content_hash     TEXT NOT NULL,
+	accession_number TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS instances_study_uid ON instances (study_uid);
+CREATE INDEX IF NOT EXISTS instances_series_uid ON instances (series_uid);
+CREATE INDEX IF NOT EXISTS instances_sop_uid ON instances (sop_uid);
+CREATE INDEX IF NOT EXISTS instances_patient_id ON instances (patient_id);
+CREATE INDEX IF NOT EXISTS instances_patient_name ON instances (patient_name);
+CREATE INDEX IF NOT EXISTS instances_modality ON instances (modality);
+CREATE INDEX IF NOT EXISTS instances_accession_number ON instances (accession_number);
+CREATE INDEX IF NOT EXISTS instances_content_hash ON instances (content_hash);
+CREATE INDEX IF NOT EXISTS instances_study_date ON instances (study_date, file_id);
+CREATE INDEX IF NOT EXISTS instances_size ON instances (size, file_id);
+CREATE INDEX IF NOT EXISTS instances_created ON instances (created, file_id);
+CREATE TABLE IF NOT EXISTS removed (
+	file_id TEXT PRIMARY KEY,
+	created INTEGER NOT NULL
+);
+`
+
+// sqliteKeyColumns the columns holding key attributes of each instance, read
+// from its attributes. Person names are held as their component groups joined
+// by '=', so that any group can be matched
+var sqliteKeyColumns = []struct {
+	name  string
+	value func(attributes JSONDataset) interface{}
+}{
+	{name: "sop_class_uid", value: sqliteStringColumn(tag.SOPClassUID)},
+	{name: "patient_id", value: sqliteStringColumn(tag.PatientID)},
+	{name: "patient_name", value: func(attributes JSONDataset) interface{} {
+		return strings.Join(jsonAttributeStrings(attributes[JSONTagKey(tag.PatientName)]), "=")
+	}},
+	{name: "study_date", value: sqliteStringColumn(tag.StudyDate)},
+	{name: "series_date", value: sqliteStringColumn(tag.SeriesDate)},
+	{name: "modality", value: sqliteStringColumn(tag.Modality)},
+	{name: "accession_number", value: sqliteStringColumn(tag.AccessionNumber)},
+	{name: "image_rows", value: sqliteIntegerColumn(tag.Rows)},
+	{name: "image_columns", value: sqliteIntegerColumn(tag.Columns)},
+	{name: "number_of_frames", value: sqliteIntegerColumn(tag.NumberOfFrames)},
+}
+
+// sqliteSearchColumns the key columns matched by search keys of each
+// attribute, narrowing the instances searched before they are read
+var sqliteSearchColumns = map[tag.Tag]string{
+	tag.StudyInstanceUID:  "study_uid",
+	tag.SeriesInstanceUID: "series_uid",
+	tag.SOPInstanceUID:    "sop_uid",
+	tag.SOPClassUID:       "sop_class_uid",
+	tag.PatientID:         "patient_id",
+	tag.PatientName:       "patient_name",
+	tag.StudyDate:         "study_date",
+	tag.Modality:          "modality",
+	tag.AccessionNumber:   "accession_number",
+}
+
+// sqliteGroupColumns the column instances are grouped by into the entities of
+// each query level
+var sqliteGroupColumns = map[QueryLevel]string{
+	QueryLevelPatient: "patient_id",
+	QueryLevelStudy:   "study_uid",
+	QueryLevelSeries:  "series_uid",
+}
+
+// sqliteColumns the columns read to build the metadata of an instance
+const sqliteColumns = "file_id, study_uid, series_uid, sop_uid, attributes, size, created, content_hash"
+
+// sqliteSortColumns the column instances are sorted by for each list sort key
+var sqliteSortColumns = map[ListSort]string{
+	ListSortCreated:   "created",
+	ListSortStudyDate: "study_date",
+	ListSortSize:      "size",
+}
+
+// sqliteMetadataIndex an implementation of MetadataIndex that persists the
+// index in an embedded SQLite database
+type sqliteMetadataIndex struct {
+	db *sql.DB
+}
+
+// NewSQLiteIndex construct a metadata index persisted in the SQLite database
+// at the given path, which is created if it does not exist
+func NewSQLiteIndex(path string) (MetadataIndex, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, so access is serialised over one
+	// connection rather than failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create index schema: %w", err)
+	}
+
+	return &sqliteMetadataIndex{db: db}, nil
+}
+
+// sqliteKeyValues utility to read the values of the key columns from the
+// attributes of an instance, in the order of sqliteKeyColumns
+func sqliteKeyValues(attributes JSONDataset) []interface{} {
+	values := make([]interface{}, 0, len(sqliteKeyColumns))
+	for _, column := range sqliteKeyColumns {
+		values = append(values, column.value(attributes))
+	}
+
+	return values
+}
+
+// sqliteStringColumn utility to read the first value of an attribute as a key
+// column value
+func sqliteStringColumn(t tag.Tag) func(attributes JSONDataset) interface{} {
+	return func(attributes JSONDataset) interface{} {
+		return FirstJSONString(attributes, t)
+	}
+}
+
+// sqliteIntegerColumn utility to read the first value of an attribute as an
+// integer key column value
+func sqliteIntegerColumn(t tag.Tag) func(attributes JSONDataset) interface{} {
+	return func(attributes JSONDataset) interface{} {
+		return firstJSONInteger(attributes, t)
+	}
+}
+
+// Add add the metadata of an instance to the index, replacing any metadata
+// already indexed for the file
+func (s *sqliteMetadataIndex) Add(metadata InstanceMetadata) error {
+	attributes, err := json.Marshal(metadata.Attributes)
+	if err != nil {
+		return err
+	}
+
+	columns := []string{"file_id", "study_uid", "series_uid", "sop_uid", "size", "created", "attributes", "content_hash"}
+	values := []interface{}{
+		metadata.FileID,
+		metadata.StudyInstanceUID,
+		metadata.SeriesInstanceUID,
+		metadata.SOPInstanceUID,
+		metadata.Size,
+		metadata.Created.UnixNano(),
+		string(attributes),
+		metadata.ContentHash,
+	}
+	for _, column := range sqliteKeyColumns {
+		columns = append(columns, column.name)
+	}
+	values = append(values, sqliteKeyValues(metadata.Attributes)...)
+
+	updates := make([]string, 0, len(columns)-1)
+	for _, column := range columns[1:] {
+		updates = append(updates, column+" = excluded."+column)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		fmt.Sprintf("INSERT INTO instances (%s) VALUES (?%s) ON CONFLICT (file_id) DO UPDATE SET %s",
+			strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)-1), strings.Join(updates, ", ")),
+		values...,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM removed WHERE file_id = ?", metadata.FileID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Remove remove the metadata of a file from the index, noting when the file
+// was created in case it is restored
+func (s *sqliteMetadataIndex) Remove(fileID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT OR REPLACE INTO removed (file_id, created) SELECT file_id, created FROM instances WHERE file_id = ?",
+		fileID,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM instances WHERE file_id = ?", fileID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Removed retrieve when a file removed from the index was created, if it was
+// indexed
+func (s *sqliteMetadataIndex) Removed(fileID string) (time.Time, bool, error) {
+	var created int64
+	err := s.db.QueryRow("SELECT created FROM removed WHERE file_id = ?", fileID).Scan(&created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return time.Unix(0, created), true, nil
+}
+
+// Find retrieve the metadata of the instances belonging to the study, series
+// or instance identified by the given UIDs
+func (s *sqliteMetadataIndex) Find(query InstanceUIDs) ([]InstanceMetadata, error) {
+	var conditions []string
+	var args []interface{}
+	for column, uid := range map[string]string{
+		"study_uid":  query.StudyInstanceUID,
+		"series_uid": query.SeriesInstanceUID,
+		"sop_uid":    query.SOPInstanceUID,
+	} {
+		if uid != "" {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, uid)
+		}
+	}
+
+	return s.query(
+		"SELECT "+sqliteColumns+" FROM instances"+sqliteWhere(conditions)+" ORDER BY rowid",
+		args...,
+	)
+}
+
+// FindByContentHash retrieve the metadata of the instances of files with the
+// content hash
+func (s *sqliteMetadataIndex) FindByContentHash(contentHash string) ([]InstanceMetadata, error) {
+	return s.query(
+		"SELECT "+sqliteColumns+" FROM instances WHERE content_hash = ? ORDER BY rowid",
+		contentHash,
+	)
+}
+
+// Search search the index for studies, series or instances matching the
+// query. The instances searched are narrowed by conditions on the key columns
+// matching at least every instance the keys match, and patients, studies and
+// series are grouped by the database, so that only the attributes of their
+// first instances are read. The keys are then matched against the entities
+func (s *sqliteMetadataIndex) Search(query SearchQuery) ([]JSONDataset, error) {
+	conditions, args := sqliteSearchConditions(query)
+
+	column, ok := sqliteGroupColumns[query.Level]
+	if !ok {
+		instances, err := s.query(
+			"SELECT "+sqliteColumns+" FROM instances"+sqliteWhere(conditions)+" ORDER BY rowid",
+			args...,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return search(instances, query), nil
+	}
+
+	// the attributes of an entity are those of its first instance, so the
+	// conditions select the entities with any matching instance, and each
+	// entity is read with every one of its instances
+	var where string
+	if len(conditions) > 0 {
+		where = fmt.Sprintf(" WHERE %s IN (SELECT %s FROM instances%s)", column, column, sqliteWhere(conditions))
+	}
+
+	groups, err := s.groups(column, where, args)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]JSONDataset, 0, len(groups))
+	for _, group := range groups {
+		entities = append(entities, group.entity(query.Level))
+	}
+
+	return searchEntities(entities, query), nil
+}
+
+// groups utility to group the instances selected by the WHERE clause by the
+// column, in the order their first instances were indexed. The modalities of
+// each group are those of the first instance of each of its series
+func (s *sqliteMetadataIndex) groups(column string, where string, args []interface{}) ([]*entityGroup, error) {
+	// SQLite reads bare columns of an aggregate query using MIN from the row
+	// holding the minimum, i.e. the first instance of each group
+	var groups []*entityGroup
+	byKey := make(map[string]*entityGroup)
+	err := s.each(fmt.Sprintf(`
+		SELECT %s, attributes, COUNT(DISTINCT study_uid), COUNT(DISTINCT series_uid), COUNT(*), MIN(rowid) AS first
+		FROM instances%s
+		GROUP BY %s
+		ORDER BY first`, column, where, column),
+		args,
+		func(rows *sql.Rows) error {
+			var key, attributes string
+			var first int64
+			group := &entityGroup{}
+			if err := rows.Scan(&key, &attributes, &group.studies, &group.series, &group.instances, &first); err != nil {
+				return err
+			}
+
+			if err := json.Unmarshal([]byte(attributes), &group.attributes); err != nil {
+				return fmt.Errorf("failed to read indexed attributes of %s: %w", key, err)
+			}
+
+			groups = append(groups, group)
+			byKey[key] = group
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(fmt.Sprintf(`
+		SELECT %s, modality, MIN(rowid) AS first
+		FROM instances%s
+		GROUP BY %s, series_uid
+		ORDER BY first`, column, where, column),
+		args,
+		func(rows *sql.Rows) error {
+			var key, modality string
+			var first int64
+			if err := rows.Scan(&key, &modality, &first); err != nil {
+				return err
+			}
+
+			if group, ok := byKey[key]; ok && modality != "" {
+				group.modalities = appendUnique(group.modalities, modality)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// sqliteSearchConditions utility to translate the keys of a search query into
+// conditions on the key columns. Each condition matches at least every
+// instance the key matches, so may be applied before the key. Keys that
+// cannot be translated are only matched against the entities found. At the
+// study level, a Modality key matches the modalities in the study, so selects
+// studies with any instance of a matching modality
+func sqliteSearchConditions(query SearchQuery) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	for keyTag, key := range query.Keys {
+		column, ok := sqliteSearchColumns[keyTag]
+		if !ok || key == "" {
+			continue
+		}
+
+		info, err := tag.Find(keyTag)
+		if err != nil {
+			continue
+		}
+
+		condition, conditionArgs, ok := sqliteMatchCondition(column, info.VR, key)
+		if !ok {
+			continue
+		}
+
+		if query.Level == QueryLevelStudy && keyTag == tag.Modality {
+			condition = "study_uid IN (SELECT study_uid FROM instances WHERE " + condition + ")"
+		}
+
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+	}
+
+	return conditions, args
+}
+
+// sqliteMatchCondition utility to translate a key matching attributes of the
+// VR into a condition on a key column, following the matching rules of
+// matchAttribute. Returns false if the key cannot be translated
+func sqliteMatchCondition(column string, vr string, key string) (string, []interface{}, bool) {
+	switch {
+	case vr == "UI":
+		var args []interface{}
+		for _, uid := range strings.Split(key, `\`) {
+			args = append(args, strings.TrimSpace(uid))
+		}
+		return fmt.Sprintf("%s IN (?%s)", column, strings.Repeat(", ?", len(args)-1)), args, true
+
+	case vr == "DA":
+		// dates not held as YYYYMMDD, e.g. of the ACR-NEMA YYYY.MM.DD form, do
+		// not compare lexically, so are matched against the key instead
+		other := "length(" + column + ") != 8 OR " + column + " GLOB '*[^0-9]*' OR "
+		if !strings.Contains(key, "-") {
+			return "(" + other + column + " = ?)", []interface{}{normalizeTemporal(vr, key, '0')}, true
+		}
+
+		lower, upper, _ := strings.Cut(key, "-")
+		conditions := []string{column + " != ''"}
+		var args []interface{}
+		if lower := normalizeTemporal(vr, lower, '0'); lower != "" {
+			conditions = append(conditions, column+" >= ?")
+			args = append(args, lower)
+		}
+		if upper := normalizeTemporal(vr, upper, '9'); upper != "" {
+			conditions = append(conditions, column+" <= ?")
+			args = append(args, upper)
+		}
+		return "(" + other + "(" + strings.Join(conditions, " AND ") + "))", args, true
+
+	case vr == "PN":
+		// LIKE only ignores the case of ASCII characters, whereas names are
+		// matched ignoring the case of any character
+		if !isASCII(key) {
+			return "", nil, false
+		}
+
+		pattern := sqliteLikeEscaper.Replace(key)
+		if strings.ContainsAny(key, "*?") {
+			pattern = strings.NewReplacer("*", "%", "?", "_").Replace(pattern)
+		}
+		return "('=' || " + column + " || '=') LIKE ? ESCAPE '\\'", []interface{}{"%=" + pattern + "=%"}, true
+
+	case isTemporalVR(vr):
+		return "", nil, false
+
+	case strings.ContainsAny(key, "*?"):
+		return column + " GLOB ?", []interface{}{strings.ReplaceAll(key, "[", "[[]")}, true
+
+	default:
+		return column + " = ?", []interface{}{key}, true
+	}
+}
+
+// sqliteLikeEscaper escapes the characters of a LIKE pattern matching any
+// characters
+var sqliteLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// isASCII utility to determine whether a string holds only ASCII characters
+func isASCII(value string) bool {
+	for idx := 0; idx < len(value); idx++ {
+		if value[idx] >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// List list the instances matching the filters of the query, sorted by the
+// query sort key then file ID
+func (s *sqliteMetadataIndex) List(query ListQuery) (ListResult, error) {
+	if err := query.validate(); err != nil {
+		return ListResult{}, err
+	}
+
+	var conditions []string
+	var args []interface{}
+	if query.Modality != "" {
+		conditions = append(conditions, "modality = ?")
+		args = append(args, query.Modality)
+	}
+	if query.PatientID != "" {
+		conditions = append(conditions, "patient_id = ?")
+		args = append(args, query.PatientID)
+	}
+	if query.StudyDateFrom != "" {
+		conditions = append(conditions, "study_date >= ?")
+		args = append(args, query.StudyDateFrom)
+	}
+	if query.StudyDateTo != "" {
+		conditions = append(conditions, "study_date != '' AND study_date <= ?")
+		args = append(args, query.StudyDateTo)
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM instances"+sqliteWhere(conditions), args...).Scan(&total); err != nil {
+		return ListResult{}, err
+	}
+
+	column := sqliteSortColumns[query.sort()]
+	direction, after := "ASC", ">"
+	if query.Descending {
+		direction, after = "DESC", "<"
+	}
+
+	if query.Cursor != nil {
+		key, err := query.Cursor.key()
+		if err != nil {
+			return ListResult{}, err
+		}
+
+		conditions = append(conditions, fmt.Sprintf("(%s, file_id) %s (?, ?)", column, after))
+		args = append(args, key, query.Cursor.FileID)
+	}
+
+	// one instance more than the limit is read to determine whether there is
+	// a next page
+	limit := -1
+	if query.Limit > 0 {
+		limit = query.Limit + 1
+	}
+
+	instances, err := s.query(
+		fmt.Sprintf("SELECT %s FROM instances%s ORDER BY %s %s, file_id %s LIMIT ? OFFSET ?",
+			sqliteColumns, sqliteWhere(conditions), column, direction, direction),
+		append(args, limit, query.Offset)...,
+	)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	return query.page(instances, total), nil
+}
+
+// query utility to read the metadata of the instances selected by a query
+// of the sqliteColumns of the index
+func (s *sqliteMetadataIndex) query(query string, args ...interface{}) ([]InstanceMetadata, error) {
+	var instances []InstanceMetadata
+	err := s.each(query, args, func(rows *sql.Rows) error {
+		var instance InstanceMetadata
+		var attributes string
+		var created int64
+		if err := rows.Scan(
+			&instance.FileID,
+			&instance.StudyInstanceUID,
+			&instance.SeriesInstanceUID,
+			&instance.SOPInstanceUID,
+			&attributes,
+			&instance.Size,
+			&created,
+			&instance.ContentHash,
+		); err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal([]byte(attributes), &instance.Attributes); err != nil {
+			return fmt.Errorf("failed to read indexed attributes of %s: %w", instance.FileID, err)
+		}
+		instance.Created = time.Unix(0, created)
+
+		instances = append(instances, instance)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return instances, nil
+}
+
+// each utility to scan each row selected by a query. The index has a single
+// connection, which the rows hold until released, so they are released
+// before returning, allowing further queries
+func (s *sqliteMetadataIndex) each(query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// sqliteWhere utility to join conditions into a WHERE clause
+func sqliteWhere(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
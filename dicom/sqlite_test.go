@@ -0,0 +1,143 @@
+package dicom
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_sqliteMetadataIndex(t *testing.T) {
+	instance := InstanceMetadata{
+		FileID: "a",
+		InstanceUIDs: InstanceUIDs{
+			StudyInstanceUID:  "1",
+			SeriesInstanceUID: "1.1",
+			SOPInstanceUID:    "1.1.1",
+		},
+		Attributes: NewJSONDataset([]*dicom.Element{
+			mustNewElement(tag.StudyInstanceUID, []string{"1"}),
+			mustNewElement(tag.PatientName, []string{"DOE^JOHN"}),
+			mustNewElement(tag.SeriesNumber, []string{"3"}),
+			mustNewElement(tag.Rows, []int{512}),
+			mustNewElement(tag.ReferencedSeriesSequence, [][]*dicom.Element{{
+				mustNewElement(tag.SeriesInstanceUID, []string{"1.2"}),
+			}}),
+		}),
+		Size:        100,
+		ContentHash: "abc",
+		Created:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	index, err := NewSQLiteIndex(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := index.Add(instance); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := index.Find(InstanceUIDs{SeriesInstanceUID: "1.1"})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Find() = %v instances, want 1", len(got))
+	}
+
+	gotAttributes, _ := json.Marshal(got[0].Attributes)
+	wantAttributes, _ := json.Marshal(instance.Attributes)
+	if string(gotAttributes) != string(wantAttributes) {
+		t.Errorf("Find() attributes = %s, want %s", gotAttributes, wantAttributes)
+	}
+	if got[0].Size != instance.Size || !got[0].Created.Equal(instance.Created) {
+		t.Errorf("Find() = %+v, want %+v", got[0], instance)
+	}
+	if got := FirstJSONString(got[0].Attributes, tag.PatientName); got != "DOE^JOHN" {
+		t.Errorf("Find() patient name = %v, want DOE^JOHN", got)
+	}
+
+	byHash, err := index.FindByContentHash("abc")
+	if err != nil {
+		t.Fatalf("FindByContentHash() error = %v", err)
+	}
+	if len(byHash) != 1 || byHash[0].FileID != "a" || byHash[0].ContentHash != "abc" {
+		t.Errorf("FindByContentHash() = %+v, want instance a", byHash)
+	}
+
+	// adding an indexed file replaces its metadata
+	instance.Size = 200
+	if err := index.Add(instance); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := index.List(ListQuery{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if listed.Total != 1 || listed.Instances[0].Size != 200 {
+		t.Errorf("List() = %+v, want a single instance of size 200", listed)
+	}
+
+	if err := index.Remove(instance.FileID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	got, err = index.Find(InstanceUIDs{})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Find() = %v instances after Remove(), want 0", len(got))
+	}
+}
+
+func Test_sqliteMatchCondition(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// conditions must select at least every value the key matches
+	tests := []struct {
+		vr     string
+		values []string
+		keys   []string
+	}{
+		{vr: "UI", values: []string{"1.2.3", "1.2.4"}, keys: []string{"1.2.3", `1.2.4\1.2.5`, "1.2.*"}},
+		{vr: "DA", values: []string{"20240301", "2024.03.10", "2024", ""}, keys: []string{"20240301", "20240305-", "-20240305", "20240101-20241231", "2024"}},
+		{vr: "PN", values: []string{"DOE^JOHN", "DOE^JOHN=ド^ジョン", "O'BRIEN^100%_"}, keys: []string{"doe^john", "DOE*", "ド^ジョン", "*100%_", "o'brien*", "D?E^*"}},
+		{vr: "LO", values: []string{"P1", "P[1]", "p1"}, keys: []string{"P1", "P?", "P[*", "*1*"}},
+	}
+	for _, tt := range tests {
+		for _, value := range tt.values {
+			for _, key := range tt.keys {
+				condition, args, ok := sqliteMatchCondition("value", tt.vr, key)
+				if !ok {
+					continue
+				}
+
+				var values []string
+				if tt.vr == "PN" {
+					values = strings.Split(value, "=")
+				} else if value != "" {
+					values = []string{value}
+				}
+				want := matchAttribute(tt.vr, values, key)
+
+				var got bool
+				if err := db.QueryRow("SELECT "+condition+" FROM (SELECT ? AS value)", append(args, value)...).Scan(&got); err != nil {
+					t.Fatalf("sqliteMatchCondition(%s, %q) condition %s error = %v", tt.vr, key, condition, err)
+				}
+				if want && !got {
+					t.Errorf("sqliteMatchCondition(%s, %q) does not select %q", tt.vr, key, value)
+				}
+			}
+		}
+	}
+}
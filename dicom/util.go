@@ -4,6 +4,9 @@ import (
 	"errors"
 	"image"
 	"image/color"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/suyashkumar/dicom"
 	"github.com/suyashkumar/dicom/pkg/frame"
@@ -71,17 +74,20 @@ func mapValue(
 	targetDomainRange := targetDomain.max - targetDomain.min
 	sourceDomainRange := sourceDomain.max - sourceDomain.min
 
+	// a source domain of a single value cannot be scaled
+	if sourceDomainRange == 0 {
+		return targetDomain.min
+	}
+
 	return targetDomain.min + (targetDomainRange)*(value-sourceDomain.min)/(sourceDomainRange)
 }
 
-// generateImage utility to generate an 8-bit normalized image from a
-// dicom dataset. generateImage optionally re-maps the pixel range to allow for better
-// image visibility. See https://github.com/suyashkumar/dicom/issues/301 for
-// more details
-func generateImage(dataset dicom.Dataset, shouldRemap bool) ([]*image.Gray, error) {
+// getPixelDataInfo utility to retrieve the pixel data info from a dicom
+// dataset
+func getPixelDataInfo(dataset dicom.Dataset) (dicom.PixelDataInfo, error) {
 	pixelDataElement, err := dataset.FindElementByTag(tag.PixelData)
 	if err != nil {
-		return nil, err
+		return dicom.PixelDataInfo{}, err
 	}
 
 	var pixelDataInfo dicom.PixelDataInfo
@@ -96,57 +102,277 @@ func generateImage(dataset dicom.Dataset, shouldRemap bool) ([]*image.Gray, erro
 		pixelDataInfo = dicom.MustGetPixelDataInfo(pixelDataElement.Value)
 	}()
 	if err != nil {
-		return nil, err
+		return dicom.PixelDataInfo{}, err
 	}
 
-	pixelTargetDomain := targetPixelDomain()
+	if pixelDataInfo.ParseErr != nil {
+		if datasetPhotometricInterpretation(dataset) != photometricYBRFull422 {
+			return dicom.PixelDataInfo{}, pixelDataInfo.ParseErr
+		}
 
-	var images []*image.Gray
+		pixelDataInfo.Frames, err = expandYBRFull422Frames(dataset, pixelDataInfo)
+		if err != nil {
+			return dicom.PixelDataInfo{}, err
+		}
+	}
+
+	return pixelDataInfo, nil
+}
+
+// generateImage utility to generate an 8-bit normalized image from a
+// dicom dataset. Colour pixel data is rendered as RGBA. Greyscale pixel
+// values are mapped to greyscale using the window specified by the options,
+// or otherwise the window or VOI LUT defined by the dataset. If neither is
+// available, generateImage optionally re-maps the pixel range to allow for
+// better image visibility. See https://github.com/suyashkumar/dicom/issues/301
+// for more details
+func generateImage(dataset dicom.Dataset, opts PNGGenerateOptions) ([]image.Image, error) {
+	pixelDataInfo, err := getPixelDataInfo(dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []image.Image
 	for _, fr := range pixelDataInfo.Frames {
-		// get source domain of pixels in the frame
-		pixelSourceDomain := findBounds(&fr.NativeData)
-
-		// generate a blank greyscale image
-		outImage := image.NewGray(
-			image.Rect(
-				0,
-				0,
-				fr.NativeData.Cols,
-				fr.NativeData.Rows,
-			),
+		image, err := generateFrameImage(dataset, fr, opts)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// generateFrameImage utility to generate an 8-bit normalized image from a
+// single frame of pixel data
+func generateFrameImage(
+	dataset dicom.Dataset,
+	fr *frame.Frame,
+	opts PNGGenerateOptions,
+) (image.Image, error) {
+	// encapsulated frames are decoded as is
+	if fr.Encapsulated {
+		return fr.EncapsulatedData.GetImage()
+	}
+
+	nativeFrame := storedFrame(dataset, &fr.NativeData)
+
+	if isColor(dataset) {
+		return generateColorFrameImage(dataset, nativeFrame)
+	}
+
+	return generateGreyFrameImage(dataset, nativeFrame, opts), nil
+}
+
+// generateGreyFrameImage utility to generate an 8-bit normalized greyscale
+// image from a single frame of greyscale stored values
+func generateGreyFrameImage(
+	dataset dicom.Dataset,
+	nativeFrame *frame.NativeFrame,
+	opts PNGGenerateOptions,
+) *image.Gray {
+	modality := datasetModalityFunction(dataset)
+	voi := resolveVOIFunction(dataset, nativeFrame, modality, opts)
+
+	// MONOCHROME1 images display minimum values as white
+	if datasetPhotometricInterpretation(dataset) == photometricMonochrome1 {
+		noninvertedVOI := voi
+		voi = func(value float64) uint8 {
+			return 255 - noninvertedVOI(value)
+		}
+	}
+
+	// generate a blank greyscale image
+	outImage := image.NewGray(
+		image.Rect(
+			0,
+			0,
+			nativeFrame.Cols,
+			nativeFrame.Rows,
+		),
+	)
+
+	for idx := 0; idx < len(nativeFrame.Data); idx++ {
+		x := idx % nativeFrame.Cols
+		y := idx / nativeFrame.Cols
+
+		pixelValue := 0
+		if len(nativeFrame.Data[idx]) > 0 {
+			pixelValue = nativeFrame.Data[idx][0]
+		}
+
+		// write to image
+		outImage.SetGray(
+			x,
+			y,
+			color.Gray{
+				Y: voi(modality(pixelValue)),
+			},
 		)
+	}
 
-		for idx := 0; idx < len(fr.NativeData.Data); idx++ {
-			x := idx % fr.NativeData.Cols
-			y := idx / fr.NativeData.Cols
+	return outImage
+}
 
-			pixelValue := 0
-			if len(fr.NativeData.Data[idx]) > 0 {
-				pixelValue = fr.NativeData.Data[idx][0]
-			}
+// resolveVOIFunction utility to determine how modality values of a frame are
+// mapped to greyscale. In order of precedence: a window specified by the
+// options, the VOI attributes of the dataset, a remap of the frame's modality
+// value range to 0-255, and finally the raw modality values
+func resolveVOIFunction(
+	dataset dicom.Dataset,
+	nativeFrame *frame.NativeFrame,
+	modality modalityFunction,
+	opts PNGGenerateOptions,
+) voiFunction {
+	if opts.window != nil {
+		return windowFunction(*opts.window, voiLUTFunctionLinear)
+	}
 
-			// remap pixel value to target domain (0-255)
-			mappedPixelValue := pixelValue
-			if shouldRemap {
-				mappedPixelValue = mapValue(
-					pixelValue,
-					pixelSourceDomain,
-					pixelTargetDomain,
-				)
-			}
+	if !opts.shouldRemap {
+		// values outside of the target domain are clamped, rather than wrapped
+		return func(value float64) uint8 {
+			return uint8(math.Min(math.Max(value, 0), 255))
+		}
+	}
+
+	if voi := datasetVOIFunction(dataset); voi != nil {
+		return voi
+	}
 
-			// write to image
-			outImage.SetGray(
-				x,
-				y,
-				color.Gray{
-					Y: uint8(mappedPixelValue),
-				},
-			)
+	// remap pixel value to target domain (0-255)
+	pixelSourceDomain := modalityBounds(findBounds(nativeFrame), modality)
+	pixelTargetDomain := targetPixelDomain()
+	return func(value float64) uint8 {
+		return uint8(mapValue(int(value), pixelSourceDomain, pixelTargetDomain))
+	}
+}
+
+// modalityBounds utility to map a domain of stored pixel values to the domain
+// of their corresponding modality values
+func modalityBounds(storedDomain domain1D, modality modalityFunction) domain1D {
+	min := int(modality(storedDomain.min))
+	max := int(modality(storedDomain.max))
+	if min > max {
+		min, max = max, min
+	}
+
+	return domain1D{min, max}
+}
+
+// frameTimeOffsets utility to compute the time offset in milliseconds of each
+// frame in a cine sequence from either the Frame Time or Frame Time Vector
+// attributes. Returns nil if neither attribute is present
+func frameTimeOffsets(dataset dicom.Dataset, frameCount int) []float64 {
+	if element, err := dataset.FindElementByTag(tag.FrameTimeVector); err == nil {
+		increments := parseDecimalStrings(element.Value)
+		if len(increments) != frameCount {
+			return nil
 		}
 
-		images = append(images, outImage)
+		// the vector holds the increment from the previous frame, the first
+		// of which is always zero
+		offsets := make([]float64, frameCount)
+		for idx := 1; idx < frameCount; idx++ {
+			offsets[idx] = offsets[idx-1] + increments[idx]
+		}
+		return offsets
 	}
 
-	return images, nil
+	if element, err := dataset.FindElementByTag(tag.FrameTime); err == nil {
+		frameTime := parseDecimalStrings(element.Value)
+		if len(frameTime) == 0 {
+			return nil
+		}
+
+		offsets := make([]float64, frameCount)
+		for idx := range offsets {
+			offsets[idx] = float64(idx) * frameTime[0]
+		}
+		return offsets
+	}
+
+	return nil
+}
+
+// parseDecimalStrings utility to parse the values of a decimal string (DS)
+// element, skipping any values that are malformed
+func parseDecimalStrings(value dicom.Value) []float64 {
+	strs, ok := value.GetValue().([]string)
+	if !ok {
+		return nil
+	}
+
+	var values []float64
+	for _, str := range strs {
+		f, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, f)
+	}
+
+	return values
+}
+
+// firstSequenceItem utility to retrieve the elements of the first item of a
+// sequence element in the dataset. Returns nil if the sequence is not present
+// or is empty
+func firstSequenceItem(dataset dicom.Dataset, t tag.Tag) []*dicom.Element {
+	sequenceElement, err := dataset.FindElementByTag(t)
+	if err != nil {
+		return nil
+	}
+
+	items, ok := sequenceElement.Value.GetValue().([]*dicom.SequenceItemValue)
+	if !ok || len(items) == 0 {
+		return nil
+	}
+
+	elements, ok := items[0].GetValue().([]*dicom.Element)
+	if !ok {
+		return nil
+	}
+
+	return elements
+}
+
+// firstString utility to retrieve the first, trimmed string value of an
+// element in the dataset. Returns an empty string if the element is not present
+func firstString(dataset dicom.Dataset, t tag.Tag) string {
+	element, err := dataset.FindElementByTag(t)
+	if err != nil {
+		return ""
+	}
+
+	values, ok := element.Value.GetValue().([]string)
+	if !ok || len(values) == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(values[0])
+}
+
+// firstInt utility to retrieve the first integer value of an element in the
+// dataset. Returns the fallback value if the element is not present
+func firstInt(dataset dicom.Dataset, t tag.Tag, fallback int) int {
+	element, err := dataset.FindElementByTag(t)
+	if err != nil {
+		return fallback
+	}
+
+	switch values := element.Value.GetValue().(type) {
+	case []int:
+		if len(values) > 0 {
+			return values[0]
+		}
+	case []string:
+		if len(values) > 0 {
+			if value, err := strconv.Atoi(strings.TrimSpace(values[0])); err == nil {
+				return value
+			}
+		}
+	}
+
+	return fallback
 }
@@ -2,6 +2,7 @@ package dicom
 
 import (
 	"image"
+	"image/color"
 	"reflect"
 	"testing"
 
@@ -10,6 +11,24 @@ import (
 	"github.com/suyashkumar/dicom/pkg/tag"
 )
 
+// mustNewElement test helper to construct a DICOM element, panicking on error
+func mustNewElement(t tag.Tag, data interface{}) *dicom.Element {
+	element, err := dicom.NewElement(t, data)
+	if err != nil {
+		panic(err)
+	}
+	return element
+}
+
+// mustNewValue test helper to construct a DICOM value, panicking on error
+func mustNewValue(data interface{}) dicom.Value {
+	value, err := dicom.NewValue(data)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
 func Test_findBounds(t *testing.T) {
 	type args struct {
 		frame *frame.NativeFrame
@@ -391,7 +410,6 @@ func Test_mapValue(t *testing.T) {
 }
 
 func Test_generateImage(t *testing.T) {
-
 	emptyDicomPixelElement, _ := dicom.NewValue(dicom.PixelDataInfo{
 
 		// Frames hold the processed PixelData frames (either Native or Encapsulated
@@ -414,13 +432,68 @@ func Test_generateImage(t *testing.T) {
 		},
 	})
 
+	rgbDicomPixelElement, _ := dicom.NewValue(dicom.PixelDataInfo{
+		Frames: []*frame.Frame{
+			{
+				NativeData: frame.NativeFrame{
+					Data:          [][]int{{255, 0, 0}, {0, 255, 0}},
+					Rows:          1,
+					Cols:          2,
+					BitsPerSample: 8,
+				},
+			},
+		},
+	})
+
+	paletteDicomPixelElement, _ := dicom.NewValue(dicom.PixelDataInfo{
+		Frames: []*frame.Frame{
+			{
+				NativeData: frame.NativeFrame{
+					Data:          [][]int{{0}, {1}},
+					Rows:          1,
+					Cols:          2,
+					BitsPerSample: 8,
+				},
+			},
+		},
+	})
+
+	signedDicomPixelElement, _ := dicom.NewValue(dicom.PixelDataInfo{
+		Frames: []*frame.Frame{
+			{
+				NativeData: frame.NativeFrame{
+					// -2, -1, 0 and 1 as two's complement 16-bit values
+					Data:          [][]int{{0xfffe}, {0xffff}, {0}, {1}},
+					Rows:          2,
+					Cols:          2,
+					BitsPerSample: 16,
+				},
+			},
+		},
+	})
+
+	maskedDicomPixelElement, _ := dicom.NewValue(dicom.PixelDataInfo{
+		Frames: []*frame.Frame{
+			{
+				NativeData: frame.NativeFrame{
+					// 0, 1, 3 and 4 stored in the low 12 bits, with overlay
+					// data in the high 4 bits
+					Data:          [][]int{{0xf000}, {0x1001}, {0x3003}, {0x0004}},
+					Rows:          2,
+					Cols:          2,
+					BitsPerSample: 16,
+				},
+			},
+		},
+	})
+
 	type args struct {
 		dataset dicom.Dataset
 	}
 	tests := []struct {
 		name    string
 		args    args
-		want    []*image.Gray
+		want    []image.Image
 		wantErr bool
 	}{
 		{
@@ -487,34 +560,391 @@ func Test_generateImage(t *testing.T) {
 				},
 			},
 			wantErr: false,
-			want: []*image.Gray{
-				{
+			want: []image.Image{
+				&image.Gray{
 					Pix:    []uint8{0, 63, 191, 255},
 					Stride: 2,
 					Rect:   image.Rect(0, 0, 2, 2),
 				},
 			},
 		},
+		{
+			name: "applies window to rescaled modality values",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.RescaleSlope, []string{"1"}),
+						mustNewElement(tag.RescaleIntercept, []string{"-2"}),
+						mustNewElement(tag.WindowCenter, []string{"0"}),
+						mustNewElement(tag.WindowWidth, []string{"2"}),
+						{
+							Tag:   tag.PixelData,
+							Value: validDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.Gray{
+					Pix:    []uint8{0, 0, 255, 255},
+					Stride: 2,
+					Rect:   image.Rect(0, 0, 2, 2),
+				},
+			},
+		},
+		{
+			name: "returns inverted image for MONOCHROME1 pixel element",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.PhotometricInterpretation, []string{"MONOCHROME1"}),
+						{
+							Tag:   tag.PixelData,
+							Value: validDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.Gray{
+					Pix:    []uint8{255, 192, 64, 0},
+					Stride: 2,
+					Rect:   image.Rect(0, 0, 2, 2),
+				},
+			},
+		},
+		{
+			name: "returns non-inverted image for MONOCHROME2 pixel element",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.PhotometricInterpretation, []string{"MONOCHROME2"}),
+						{
+							Tag:   tag.PixelData,
+							Value: validDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.Gray{
+					Pix:    []uint8{0, 63, 191, 255},
+					Stride: 2,
+					Rect:   image.Rect(0, 0, 2, 2),
+				},
+			},
+		},
+		{
+			name: "remaps signed pixel element",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.BitsAllocated, []int{16}),
+						mustNewElement(tag.BitsStored, []int{16}),
+						mustNewElement(tag.HighBit, []int{15}),
+						mustNewElement(tag.PixelRepresentation, []int{1}),
+						{
+							Tag:   tag.PixelData,
+							Value: signedDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.Gray{
+					Pix:    []uint8{0, 85, 170, 255},
+					Stride: 2,
+					Rect:   image.Rect(0, 0, 2, 2),
+				},
+			},
+		},
+		{
+			name: "applies window to signed pixel element",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.BitsAllocated, []int{16}),
+						mustNewElement(tag.BitsStored, []int{16}),
+						mustNewElement(tag.HighBit, []int{15}),
+						mustNewElement(tag.PixelRepresentation, []int{1}),
+						mustNewElement(tag.WindowCenter, []string{"0"}),
+						mustNewElement(tag.WindowWidth, []string{"2"}),
+						{
+							Tag:   tag.PixelData,
+							Value: signedDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.Gray{
+					Pix:    []uint8{0, 0, 255, 255},
+					Stride: 2,
+					Rect:   image.Rect(0, 0, 2, 2),
+				},
+			},
+		},
+		{
+			name: "masks bits outside of bits stored",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.BitsAllocated, []int{16}),
+						mustNewElement(tag.BitsStored, []int{12}),
+						mustNewElement(tag.HighBit, []int{11}),
+						mustNewElement(tag.PixelRepresentation, []int{0}),
+						{
+							Tag:   tag.PixelData,
+							Value: maskedDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.Gray{
+					Pix:    []uint8{0, 63, 191, 255},
+					Stride: 2,
+					Rect:   image.Rect(0, 0, 2, 2),
+				},
+			},
+		},
+		{
+			name: "returns colour image for interleaved RGB pixel element",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.PhotometricInterpretation, []string{"RGB"}),
+						mustNewElement(tag.SamplesPerPixel, []int{3}),
+						{
+							Tag:   tag.PixelData,
+							Value: rgbDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.RGBA{
+					Pix:    []uint8{255, 0, 0, 255, 0, 255, 0, 255},
+					Stride: 8,
+					Rect:   image.Rect(0, 0, 2, 1),
+				},
+			},
+		},
+		{
+			name: "returns colour image for planar RGB pixel element",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.PhotometricInterpretation, []string{"RGB"}),
+						mustNewElement(tag.SamplesPerPixel, []int{3}),
+						mustNewElement(tag.PlanarConfiguration, []int{1}),
+						{
+							Tag:   tag.PixelData,
+							Value: rgbDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.RGBA{
+					Pix:    []uint8{255, 0, 255, 255, 0, 0, 0, 255},
+					Stride: 8,
+					Rect:   image.Rect(0, 0, 2, 1),
+				},
+			},
+		},
+		{
+			name: "returns colour image for YBR_FULL pixel element",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.PhotometricInterpretation, []string{"YBR_FULL"}),
+						mustNewElement(tag.SamplesPerPixel, []int{3}),
+						{
+							Tag:   tag.PixelData,
+							Value: rgbDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.RGBA{
+					Pix:    []uint8{76, 255, 29, 255, 0, 47, 225, 255},
+					Stride: 8,
+					Rect:   image.Rect(0, 0, 2, 1),
+				},
+			},
+		},
+		{
+			name: "returns colour image for palette colour pixel element",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.PhotometricInterpretation, []string{"PALETTE COLOR"}),
+						mustNewElement(tag.SamplesPerPixel, []int{1}),
+						mustNewElement(tag.RedPaletteColorLookupTableDescriptor, []int{2, 0, 16}),
+						mustNewElement(tag.GreenPaletteColorLookupTableDescriptor, []int{2, 0, 16}),
+						mustNewElement(tag.BluePaletteColorLookupTableDescriptor, []int{2, 0, 16}),
+						mustNewElement(tag.RedPaletteColorLookupTableData, []byte{0x00, 0xff, 0x00, 0x00}),
+						mustNewElement(tag.GreenPaletteColorLookupTableData, []byte{0x00, 0x00, 0x00, 0xff}),
+						mustNewElement(tag.BluePaletteColorLookupTableData, []byte{0x00, 0x00, 0x00, 0x00}),
+						{
+							Tag:   tag.PixelData,
+							Value: paletteDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: false,
+			want: []image.Image{
+				&image.RGBA{
+					Pix:    []uint8{255, 0, 0, 255, 0, 255, 0, 255},
+					Stride: 8,
+					Rect:   image.Rect(0, 0, 2, 1),
+				},
+			},
+		},
+		{
+			name: "errors on palette colour pixel element without palette",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.PhotometricInterpretation, []string{"PALETTE COLOR"}),
+						{
+							Tag:   tag.PixelData,
+							Value: paletteDicomPixelElement,
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := generateImage(tt.args.dataset, true)
+			got, err := generateImage(tt.args.dataset, PNGGenerateOptions{shouldRemap: true})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("generateImage() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
+			if len(got) != len(tt.want) {
+				t.Errorf("generateImage() returned %d images, want %d", len(got), len(tt.want))
+				return
+			}
+
 			for idx := range tt.want {
 				wantImages := tt.want[idx]
 				gotImages := got[idx]
 
-				for idx2 := range wantImages.Pix {
-					if wantImages.Pix[idx2] != gotImages.Pix[idx2] {
-						t.Errorf("generateImage() = %+v, want %+v", got, tt.want)
-						return
+				if wantImages.Bounds() != gotImages.Bounds() {
+					t.Errorf("generateImage() = %+v, want %+v", got, tt.want)
+					return
+				}
+
+				bounds := wantImages.Bounds()
+				for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+					for x := bounds.Min.X; x < bounds.Max.X; x++ {
+						if color.RGBAModel.Convert(wantImages.At(x, y)) != color.RGBAModel.Convert(gotImages.At(x, y)) {
+							t.Errorf("generateImage() = %+v, want %+v", got, tt.want)
+							return
+						}
 					}
 				}
 			}
 		})
 	}
 }
+
+func Test_resolveVOIFunction(t *testing.T) {
+	tests := []struct {
+		name  string
+		value float64
+		want  uint8
+	}{
+		{"value within range", 100, 100},
+		{"value below range", -5, 0},
+		{"value above range", 300, 255},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voi := resolveVOIFunction(dicom.Dataset{}, nil, identityModalityFunction, PNGGenerateOptions{})
+			if got := voi(tt.value); got != tt.want {
+				t.Errorf("resolveVOIFunction()(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_frameTimeOffsets(t *testing.T) {
+	type args struct {
+		dataset    dicom.Dataset
+		frameCount int
+	}
+	tests := []struct {
+		name string
+		args args
+		want []float64
+	}{
+		{
+			name: "returns nil for dataset without frame timing",
+			args: args{
+				dataset:    dicom.Dataset{},
+				frameCount: 3,
+			},
+			want: nil,
+		},
+		{
+			name: "returns evenly spaced offsets for frame time",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.FrameTime, []string{"33.3"}),
+					},
+				},
+				frameCount: 3,
+			},
+			want: []float64{0, 33.3, 66.6},
+		},
+		{
+			name: "returns accumulated offsets for frame time vector",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.FrameTimeVector, []string{"0", "10", "20"}),
+					},
+				},
+				frameCount: 3,
+			},
+			want: []float64{0, 10, 30},
+		},
+		{
+			name: "returns nil for frame time vector of wrong length",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.FrameTimeVector, []string{"0", "10"}),
+					},
+				},
+				frameCount: 3,
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := frameTimeOffsets(tt.args.dataset, tt.args.frameCount); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("frameTimeOffsets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package dicom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// VOI LUT functions as defined by the VOI LUT Function (0028,1056) attribute.
+// See https://dicom.nema.org/medical/dicom/current/output/chtml/part03/sect_C.11.2.html
+const (
+	voiLUTFunctionLinear      = "LINEAR"
+	voiLUTFunctionLinearExact = "LINEAR_EXACT"
+	voiLUTFunctionSigmoid     = "SIGMOID"
+)
+
+var (
+	// ErrUnknownWindowPreset error indicating the requested window preset is
+	// not defined
+	ErrUnknownWindowPreset = errors.New("unknown window preset")
+)
+
+// Window a window center/width pair used to map pixel values to greyscale
+type Window struct {
+	Center float64
+	Width  float64
+}
+
+// windowPresets commonly used CT window presets, in Hounsfield units
+var windowPresets = map[string]Window{
+	"lung":    {Center: -600, Width: 1500},
+	"bone":    {Center: 400, Width: 1800},
+	"brain":   {Center: 40, Width: 80},
+	"abdomen": {Center: 40, Width: 400},
+}
+
+// WindowPreset retrieves a named window preset (lung, bone, brain, abdomen)
+func WindowPreset(name string) (Window, error) {
+	window, ok := windowPresets[strings.ToLower(name)]
+	if !ok {
+		return Window{}, ErrUnknownWindowPreset
+	}
+
+	return window, nil
+}
+
+// voiFunction maps a pixel value to an 8-bit greyscale value
+type voiFunction func(value float64) uint8
+
+// windowFunction returns a voiFunction that applies the given window using the
+// specified VOI LUT function. Unrecognized functions default to LINEAR
+func windowFunction(window Window, function string) voiFunction {
+	const yMax = 255.0
+
+	center := window.Center
+	width := window.Width
+	if width <= 0 {
+		width = 1
+	}
+
+	switch function {
+	case voiLUTFunctionSigmoid:
+		return func(value float64) uint8 {
+			return uint8(math.Round(yMax / (1 + math.Exp(-4*(value-center)/width))))
+		}
+	case voiLUTFunctionLinearExact:
+		return func(value float64) uint8 {
+			switch {
+			case value <= center-width/2:
+				return 0
+			case value > center+width/2:
+				return yMax
+			default:
+				return uint8(math.Round(((value-center)/width + 0.5) * yMax))
+			}
+		}
+	default:
+		// LINEAR requires a width of at least 1
+		width = math.Max(width, 1)
+		return func(value float64) uint8 {
+			switch {
+			case value <= center-0.5-(width-1)/2:
+				return 0
+			case value > center-0.5+(width-1)/2:
+				return yMax
+			default:
+				return uint8(math.Round(((value-(center-0.5))/(width-1) + 0.5) * yMax))
+			}
+		}
+	}
+}
+
+// lookupTable a LUT as described by a LUT Descriptor (0028,3002) and LUT Data
+// (0028,3006)
+type lookupTable struct {
+	firstMapped  int
+	bitsPerEntry int
+	data         []int
+}
+
+// lookup maps a value through the LUT, clamping values outside the LUT's input
+// range to the first or last entry
+func (l lookupTable) lookup(value float64) int {
+	idx := int(math.Floor(value)) - l.firstMapped
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(l.data) {
+		idx = len(l.data) - 1
+	}
+
+	return l.data[idx]
+}
+
+// lutFunction returns a voiFunction that maps values through the LUT and
+// scales the LUT output to 8 bits
+func lutFunction(lut lookupTable) voiFunction {
+	outputDomain := domain1D{
+		min: 0,
+		max: 1<<lut.bitsPerEntry - 1,
+	}
+
+	return func(value float64) uint8 {
+		return uint8(mapValue(lut.lookup(value), outputDomain, targetPixelDomain()))
+	}
+}
+
+// parseLookupTable utility to parse a LUT from an item of a LUT sequence such
+// as the VOI LUT Sequence (0028,3010)
+func parseLookupTable(elements []*dicom.Element) (lookupTable, error) {
+	item := dicom.Dataset{Elements: elements}
+
+	descriptorElement, err := item.FindElementByTag(tag.LUTDescriptor)
+	if err != nil {
+		return lookupTable{}, err
+	}
+	descriptor, ok := descriptorElement.Value.GetValue().([]int)
+	if !ok || len(descriptor) < 3 {
+		return lookupTable{}, errors.New("malformed LUT descriptor")
+	}
+
+	dataElement, err := item.FindElementByTag(tag.LUTData)
+	if err != nil {
+		return lookupTable{}, err
+	}
+
+	return newLookupTable(descriptor, parseLUTData(dataElement.Value))
+}
+
+// newLookupTable utility to construct a LUT from a LUT descriptor, holding the
+// number of entries, first mapped value and bits per entry, and the LUT data
+func newLookupTable(descriptor []int, data []int) (lookupTable, error) {
+	if len(descriptor) < 3 {
+		return lookupTable{}, errors.New("malformed LUT descriptor")
+	}
+	if len(data) == 0 {
+		return lookupTable{}, errors.New("malformed LUT data")
+	}
+
+	// a descriptor entry count of 0 denotes 2^16 entries
+	entries := descriptor[0]
+	if entries == 0 {
+		entries = 1 << 16
+	}
+	if entries < len(data) {
+		data = data[:entries]
+	}
+
+	bitsPerEntry := descriptor[2]
+	if bitsPerEntry <= 0 || bitsPerEntry > 16 {
+		bitsPerEntry = 16
+	}
+
+	return lookupTable{
+		firstMapped:  descriptor[1],
+		bitsPerEntry: bitsPerEntry,
+		data:         data,
+	}, nil
+}
+
+// parseLUTData utility to parse LUT Data (0028,3006). Depending on the VR it
+// was encoded with, LUT data may be parsed as ints (US), bytes (OW) or, for
+// implicit VR files, a raw string
+func parseLUTData(value dicom.Value) []int {
+	switch v := value.GetValue().(type) {
+	case []int:
+		return v
+	case []byte:
+		return parseWords(v)
+	case string:
+		return parseWords([]byte(v))
+	case []string:
+		return parseWords([]byte(strings.Join(v, "\\")))
+	default:
+		return nil
+	}
+}
+
+// parseWords utility to parse little endian 16-bit words
+func parseWords(data []byte) []int {
+	words := make([]int, len(data)/2)
+	for idx := range words {
+		words[idx] = int(binary.LittleEndian.Uint16(data[idx*2:]))
+	}
+
+	return words
+}
+
+// datasetVOIFunction returns a voiFunction derived from the VOI attributes of
+// the dataset. The Window Center (0028,1050) and Window Width (0028,1051)
+// attributes are preferred over the VOI LUT Sequence (0028,3010). Returns nil
+// if the dataset does not define a VOI transformation
+func datasetVOIFunction(dataset dicom.Dataset) voiFunction {
+	if window, ok := datasetWindow(dataset); ok {
+		return windowFunction(window, datasetVOILUTFunction(dataset))
+	}
+
+	items := firstSequenceItem(dataset, tag.VOILUTSequence)
+	if items == nil {
+		return nil
+	}
+	lut, err := parseLookupTable(items)
+	if err != nil {
+		return nil
+	}
+
+	return lutFunction(signedFirstMapped(dataset, lut))
+}
+
+// datasetWindow utility to read the first window defined by the Window Center
+// and Window Width attributes of the dataset
+func datasetWindow(dataset dicom.Dataset) (Window, bool) {
+	centerElement, err := dataset.FindElementByTag(tag.WindowCenter)
+	if err != nil {
+		return Window{}, false
+	}
+	widthElement, err := dataset.FindElementByTag(tag.WindowWidth)
+	if err != nil {
+		return Window{}, false
+	}
+
+	centers := parseDecimalStrings(centerElement.Value)
+	widths := parseDecimalStrings(widthElement.Value)
+	if len(centers) == 0 || len(widths) == 0 {
+		return Window{}, false
+	}
+
+	return Window{
+		Center: centers[0],
+		Width:  widths[0],
+	}, true
+}
+
+// datasetVOILUTFunction utility to read the VOI LUT Function attribute of the
+// dataset, defaulting to LINEAR
+func datasetVOILUTFunction(dataset dicom.Dataset) string {
+	function := firstString(dataset, tag.VOILUTFunction)
+	if function == "" {
+		return voiLUTFunctionLinear
+	}
+
+	return strings.ToUpper(function)
+}
@@ -0,0 +1,197 @@
+package dicom
+
+import (
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_windowFunction(t *testing.T) {
+	type args struct {
+		window   Window
+		function string
+		value    float64
+	}
+	tests := []struct {
+		name string
+		args args
+		want uint8
+	}{
+		{
+			name: "linear maps values below window to 0",
+			args: args{
+				window:   Window{Center: 40, Width: 400},
+				function: voiLUTFunctionLinear,
+				value:    -1000,
+			},
+			want: 0,
+		},
+		{
+			name: "linear maps values above window to 255",
+			args: args{
+				window:   Window{Center: 40, Width: 400},
+				function: voiLUTFunctionLinear,
+				value:    1000,
+			},
+			want: 255,
+		},
+		{
+			name: "linear maps window center to mid grey",
+			args: args{
+				window:   Window{Center: 40, Width: 400},
+				function: voiLUTFunctionLinear,
+				value:    40,
+			},
+			want: 128,
+		},
+		{
+			name: "linear treats a width of 1 as a threshold",
+			args: args{
+				window:   Window{Center: 40, Width: 1},
+				function: voiLUTFunctionLinear,
+				value:    40,
+			},
+			want: 255,
+		},
+		{
+			name: "defaults unknown function to linear",
+			args: args{
+				window:   Window{Center: 40, Width: 400},
+				function: "UNKNOWN",
+				value:    40,
+			},
+			want: 128,
+		},
+		{
+			name: "linear exact maps window bounds exactly",
+			args: args{
+				window:   Window{Center: 0, Width: 100},
+				function: voiLUTFunctionLinearExact,
+				value:    50,
+			},
+			want: 255,
+		},
+		{
+			name: "linear exact maps window center to mid grey",
+			args: args{
+				window:   Window{Center: 0, Width: 100},
+				function: voiLUTFunctionLinearExact,
+				value:    0,
+			},
+			want: 128,
+		},
+		{
+			name: "sigmoid maps window center to mid grey",
+			args: args{
+				window:   Window{Center: 0, Width: 100},
+				function: voiLUTFunctionSigmoid,
+				value:    0,
+			},
+			want: 128,
+		},
+		{
+			name: "sigmoid tends towards 255 above window",
+			args: args{
+				window:   Window{Center: 0, Width: 100},
+				function: voiLUTFunctionSigmoid,
+				value:    1000,
+			},
+			want: 255,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voi := windowFunction(tt.args.window, tt.args.function)
+			if got := voi(tt.args.value); got != tt.want {
+				t.Errorf("windowFunction()() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_datasetVOIFunction(t *testing.T) {
+	voiLUTSequence := mustNewElement(tag.VOILUTSequence, [][]*dicom.Element{
+		{
+			mustNewElement(tag.LUTDescriptor, []int{3, 10, 8}),
+			mustNewElement(tag.LUTData, []int{0, 100, 255}),
+		},
+	})
+
+	type args struct {
+		dataset dicom.Dataset
+		value   float64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantNil bool
+		want    uint8
+	}{
+		{
+			name: "returns nil for dataset without VOI attributes",
+			args: args{
+				dataset: dicom.Dataset{},
+			},
+			wantNil: true,
+		},
+		{
+			name: "applies window center and width",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{
+						mustNewElement(tag.WindowCenter, []string{"40"}),
+						mustNewElement(tag.WindowWidth, []string{"400"}),
+					},
+				},
+				value: 1000,
+			},
+			want: 255,
+		},
+		{
+			name: "applies VOI LUT sequence",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{voiLUTSequence},
+				},
+				value: 11,
+			},
+			want: 100,
+		},
+		{
+			name: "clamps values below VOI LUT input range",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{voiLUTSequence},
+				},
+				value: -5,
+			},
+			want: 0,
+		},
+		{
+			name: "clamps values above VOI LUT input range",
+			args: args{
+				dataset: dicom.Dataset{
+					Elements: []*dicom.Element{voiLUTSequence},
+				},
+				value: 50,
+			},
+			want: 255,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			voi := datasetVOIFunction(tt.args.dataset)
+			if (voi == nil) != tt.wantNil {
+				t.Errorf("datasetVOIFunction() nil = %v, wantNil %v", voi == nil, tt.wantNil)
+				return
+			}
+			if voi == nil {
+				return
+			}
+			if got := voi(tt.args.value); got != tt.want {
+				t.Errorf("datasetVOIFunction()() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package dicom
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// XMLDataset a DICOM dataset in the Native DICOM Model, with its attributes
+// ordered by tag. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part19/chapter_A.html
+type XMLDataset struct {
+	XMLName    xml.Name       `xml:"http://dicom.nema.org/PS3.19/models/NativeDICOM NativeDicomModel"`
+	Attributes []XMLAttribute `xml:"DicomAttribute"`
+}
+
+// XMLAttribute a single attribute of a dataset in the Native DICOM Model,
+// holding either values, person names, sequence items or binary data
+type XMLAttribute struct {
+	Tag            string          `xml:"tag,attr"`
+	VR             string          `xml:"vr,attr"`
+	Keyword        string          `xml:"keyword,attr,omitempty"`
+	PrivateCreator string          `xml:"privateCreator,attr,omitempty"`
+	Values         []XMLValue      `xml:"Value"`
+	PersonNames    []XMLPersonName `xml:"PersonName"`
+	Items          []XMLItem       `xml:"Item"`
+	InlineBinary   string          `xml:"InlineBinary,omitempty"`
+	BulkData       *XMLBulkData    `xml:"BulkData"`
+}
+
+// XMLValue a single value of an attribute, numbered from 1
+type XMLValue struct {
+	Number int    `xml:"number,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// XMLPersonName a single person name value of an attribute, numbered from 1,
+// split into its component groups
+type XMLPersonName struct {
+	Number      int                `xml:"number,attr"`
+	Alphabetic  *XMLNameComponents `xml:"Alphabetic"`
+	Ideographic *XMLNameComponents `xml:"Ideographic"`
+	Phonetic    *XMLNameComponents `xml:"Phonetic"`
+}
+
+// XMLNameComponents the components of a person name component group
+type XMLNameComponents struct {
+	FamilyName string `xml:"FamilyName,omitempty"`
+	GivenName  string `xml:"GivenName,omitempty"`
+	MiddleName string `xml:"MiddleName,omitempty"`
+	NamePrefix string `xml:"NamePrefix,omitempty"`
+	NameSuffix string `xml:"NameSuffix,omitempty"`
+}
+
+// XMLItem a single item of a sequence, numbered from 1
+type XMLItem struct {
+	Number     int            `xml:"number,attr"`
+	Attributes []XMLAttribute `xml:"DicomAttribute"`
+}
+
+// XMLBulkData a reference to bulk data held outside of the dataset
+type XMLBulkData struct {
+	URI string `xml:"uri,attr"`
+}
+
+// NewXMLDataset encodes the given elements in the Native DICOM Model. Bulk
+// data is handled as by NewJSONDataset, so pixel data is omitted unless a
+// bulk data URI is provided for it
+func NewXMLDataset(
+	elements []*dicom.Element,
+	options ...func(opts *JSONEncodeOptions),
+) XMLDataset {
+	return NewJSONDataset(elements, options...).XMLDataset()
+}
+
+// XMLDataset encodes the dataset in the Native DICOM Model
+func (d JSONDataset) XMLDataset() XMLDataset {
+	return XMLDataset{
+		Attributes: newXMLAttributes(d),
+	}
+}
+
+// newXMLAttributes utility to encode the attributes of a dataset in the
+// Native DICOM Model, ordered by tag
+func newXMLAttributes(dataset JSONDataset) []XMLAttribute {
+	// keys in the form GGGGEEEE sort in the order of their tags
+	keys := make([]string, 0, len(dataset))
+	for key := range dataset {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]XMLAttribute, 0, len(keys))
+	for _, key := range keys {
+		attribute := dataset[key]
+		xmlAttribute := XMLAttribute{
+			Tag:          key,
+			VR:           attribute.VR,
+			InlineBinary: attribute.InlineBinary,
+		}
+
+		if t, err := parseJSONTagKey(key); err == nil {
+			xmlAttribute.Keyword, xmlAttribute.PrivateCreator = xmlKeyword(dataset, t)
+		}
+
+		if attribute.BulkDataURI != "" {
+			xmlAttribute.BulkData = &XMLBulkData{URI: attribute.BulkDataURI}
+		}
+
+		switch attribute.VR {
+		case "SQ":
+			for idx, value := range attribute.Value {
+				item, _ := value.(JSONDataset)
+				xmlAttribute.Items = append(xmlAttribute.Items, XMLItem{
+					Number:     idx + 1,
+					Attributes: newXMLAttributes(item),
+				})
+			}
+		case "PN":
+			for idx, value := range attribute.Value {
+				name, _ := value.(JSONPersonName)
+				xmlAttribute.PersonNames = append(xmlAttribute.PersonNames, XMLPersonName{
+					Number:      idx + 1,
+					Alphabetic:  newXMLNameComponents(name.Alphabetic),
+					Ideographic: newXMLNameComponents(name.Ideographic),
+					Phonetic:    newXMLNameComponents(name.Phonetic),
+				})
+			}
+		default:
+			for idx, value := range (JSONAttribute{Value: attribute.Value}).Strings() {
+				xmlAttribute.Values = append(xmlAttribute.Values, XMLValue{
+					Number: idx + 1,
+					Value:  value,
+				})
+			}
+		}
+
+		attributes = append(attributes, xmlAttribute)
+	}
+
+	return attributes
+}
+
+// newXMLNameComponents utility to split a person name component group into
+// its components, nil if the group is empty
+func newXMLNameComponents(group string) *XMLNameComponents {
+	if group == "" {
+		return nil
+	}
+
+	components := strings.SplitN(group, "^", 5)
+	for len(components) < 5 {
+		components = append(components, "")
+	}
+
+	return &XMLNameComponents{
+		FamilyName: components[0],
+		GivenName:  components[1],
+		MiddleName: components[2],
+		NamePrefix: components[3],
+		NameSuffix: components[4],
+	}
+}
+
+// xmlKeyword utility to determine the dictionary keyword of an attribute or,
+// for private attributes, the private creator of its block
+func xmlKeyword(dataset JSONDataset, t tag.Tag) (string, string) { // keyword, private creator
+	if t.Group%2 == 0 {
+		if info, err := tag.Find(t); err == nil {
+			return info.Name, ""
+		}
+		return "", ""
+	}
+
+	// private creators reserve blocks of elements (gggg,xx00-xxff) with an
+	// element (gggg,00xx)
+	if t.Element <= 0x00ff {
+		return "", ""
+	}
+	creator := dataset[fmt.Sprintf("%04X00%02X", t.Group, t.Element>>8)]
+	if values := creator.Strings(); len(values) > 0 {
+		return "", values[0]
+	}
+
+	return "", ""
+}
@@ -0,0 +1,130 @@
+package dicom
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func Test_NewXMLDataset(t *testing.T) {
+	privateTag := tag.Tag{Group: 0x0009, Element: 0x1001}
+
+	type args struct {
+		elements []*dicom.Element
+		options  []func(opts *JSONEncodeOptions)
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "encodes empty dataset",
+			args: args{},
+			want: `<NativeDicomModel xmlns="http://dicom.nema.org/PS3.19/models/NativeDICOM"></NativeDicomModel>`,
+		},
+		{
+			name: "encodes values ordered by tag",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.InstanceNumber, []string{"7"}),
+					mustNewElement(tag.ImageType, []string{"ORIGINAL", "PRIMARY"}),
+					mustNewElement(tag.AccessionNumber, []string{""}),
+				},
+			},
+			want: `<NativeDicomModel xmlns="http://dicom.nema.org/PS3.19/models/NativeDICOM">` +
+				`<DicomAttribute tag="00080008" vr="CS" keyword="ImageType">` +
+				`<Value number="1">ORIGINAL</Value><Value number="2">PRIMARY</Value></DicomAttribute>` +
+				`<DicomAttribute tag="00080050" vr="SH" keyword="AccessionNumber"></DicomAttribute>` +
+				`<DicomAttribute tag="00200013" vr="IS" keyword="InstanceNumber">` +
+				`<Value number="1">7</Value></DicomAttribute>` +
+				`</NativeDicomModel>`,
+		},
+		{
+			name: "encodes person name components",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.PatientName, []string{"Yamada^Tarou=山田^太郎"}),
+				},
+			},
+			want: `<NativeDicomModel xmlns="http://dicom.nema.org/PS3.19/models/NativeDICOM">` +
+				`<DicomAttribute tag="00100010" vr="PN" keyword="PatientName"><PersonName number="1">` +
+				`<Alphabetic><FamilyName>Yamada</FamilyName><GivenName>Tarou</GivenName></Alphabetic>` +
+				`<Ideographic><FamilyName>山田</FamilyName><GivenName>太郎</GivenName></Ideographic>` +
+				`</PersonName></DicomAttribute>` +
+				`</NativeDicomModel>`,
+		},
+		{
+			name: "encodes sequence items",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.ReferencedSeriesSequence, [][]*dicom.Element{
+						{
+							mustNewElement(tag.SeriesInstanceUID, []string{"1.2.3"}),
+						},
+					}),
+				},
+			},
+			want: `<NativeDicomModel xmlns="http://dicom.nema.org/PS3.19/models/NativeDICOM">` +
+				`<DicomAttribute tag="00081115" vr="SQ" keyword="ReferencedSeriesSequence"><Item number="1">` +
+				`<DicomAttribute tag="0020000E" vr="UI" keyword="SeriesInstanceUID"><Value number="1">1.2.3</Value></DicomAttribute>` +
+				`</Item></DicomAttribute>` +
+				`</NativeDicomModel>`,
+		},
+		{
+			name: "encodes private attributes with their private creator",
+			args: args{
+				elements: []*dicom.Element{
+					{
+						Tag:                    tag.Tag{Group: 0x0009, Element: 0x0010},
+						RawValueRepresentation: "LO",
+						Value:                  mustNewValue([]string{"ACME"}),
+					},
+					{
+						Tag:                    privateTag,
+						RawValueRepresentation: "LO",
+						Value:                  mustNewValue([]string{"secret"}),
+					},
+				},
+			},
+			want: `<NativeDicomModel xmlns="http://dicom.nema.org/PS3.19/models/NativeDICOM">` +
+				`<DicomAttribute tag="00090010" vr="LO"><Value number="1">ACME</Value></DicomAttribute>` +
+				`<DicomAttribute tag="00091001" vr="LO" privateCreator="ACME"><Value number="1">secret</Value></DicomAttribute>` +
+				`</NativeDicomModel>`,
+		},
+		{
+			name: "encodes binary values inline or by bulk data uri",
+			args: args{
+				elements: []*dicom.Element{
+					mustNewElement(tag.FileMetaInformationVersion, []byte{0x00, 0x01}),
+					mustNewElement(tag.RedPaletteColorLookupTableData, []byte{0x00, 0x01}),
+				},
+				options: []func(opts *JSONEncodeOptions){
+					JSONBulkDataURI(func(t tag.Tag) string {
+						if t == tag.RedPaletteColorLookupTableData {
+							return "http://localhost/bulk/" + JSONTagKey(t)
+						}
+						return ""
+					}),
+				},
+			},
+			want: `<NativeDicomModel xmlns="http://dicom.nema.org/PS3.19/models/NativeDICOM">` +
+				`<DicomAttribute tag="00020001" vr="OB" keyword="FileMetaInformationVersion"><InlineBinary>AAE=</InlineBinary></DicomAttribute>` +
+				`<DicomAttribute tag="00281201" vr="OW" keyword="RedPaletteColorLookupTableData"><BulkData uri="http://localhost/bulk/00281201"></BulkData></DicomAttribute>` +
+				`</NativeDicomModel>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := xml.Marshal(NewXMLDataset(tt.args.elements, tt.args.options...))
+			if err != nil {
+				t.Fatalf("NewXMLDataset() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("NewXMLDataset() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,525 @@
+package dimse
+
+import (
+	"bytes"
+	"dicomviewer/dicom"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// errReleased error indicating the remote AE released the association
+	errReleased = errors.New("association was released")
+
+	// errAborted error indicating the remote AE aborted the association
+	errAborted = errors.New("association was aborted")
+
+	// errUnexpectedPDU error indicating a PDU was received that is invalid in
+	// the current state of the association
+	errUnexpectedPDU = errors.New("unexpected pdu")
+)
+
+// message a DIMSE message, made up of a command and an optional dataset, sent
+// on a presentation context
+type message struct {
+	contextID byte
+	command   command
+	dataSet   []byte
+
+	// dataSetReader when sending, a dataset streamed in place of dataSet, so
+	// that large instances are not held in memory
+	dataSetReader io.Reader
+
+	// file when receiving a C-STORE request, the instance sent, spooled with
+	// its file meta information to a temporary file rather than held in
+	// memory. The file must be closed once handled
+	file *dicom.File
+}
+
+// received a message read from the remote AE, or the error that ended the
+// association
+type received struct {
+	msg message
+	err error
+}
+
+// suboperations returns the progress of the C-MOVE or C-GET request the
+// message responds to, or zero counts if absent
+func (m message) suboperations() Suboperations {
+	if m.command.suboperations == nil {
+		return Suboperations{}
+	}
+
+	return *m.command.suboperations
+}
+
+// close releases the instance received with the message, if any
+func (m message) close() {
+	if m.file != nil {
+		m.file.Close()
+	}
+}
+
+// association an established association between this and a remote AE
+type association struct {
+	conn net.Conn
+
+	localAETitle  string
+	remoteAETitle string
+
+	// maxPDULength the maximum length of PDUs the remote AE accepts
+	maxPDULength uint32
+
+	// contexts the accepted presentation contexts by ID, each holding the
+	// single negotiated transfer syntax
+	contexts map[byte]presentationContext
+
+	// timeout the maximum time to wait for each PDU from the remote AE
+	timeout time.Duration
+
+	// remoteSCPRoles the SOP classes for which the remote AE, having requested
+	// the association, accepted the SCP role. Instances may only be sent to
+	// the remote AE via C-GET for these SOP classes
+	remoteSCPRoles map[string]bool
+
+	// messageID the message ID of the last request sent to the remote AE
+	messageID uint16
+
+	// incoming messages read from the remote AE while serving the association,
+	// allowing requests to be cancelled while being processed. See receive
+	incoming chan received
+
+	// cancellations the message IDs of requests the remote AE requested be
+	// cancelled while they were processed
+	cancellations map[uint16]bool
+
+	// pending the presentation data values of the last P-DATA-TF PDU read
+	// that are yet to be consumed
+	pending []presentationDataValue
+
+	// deadlineMu guards busy against the reads of receive
+	deadlineMu sync.Mutex
+
+	// busy whether a request of the remote AE is being processed, during
+	// which the remote AE sends nothing unless cancelling the request, so
+	// reads are not bounded by the timeout. See serving
+	busy bool
+}
+
+// readPDU utility to read the next PDU from the remote AE
+func (a *association) readPDU() (pdu, error) {
+	a.deadlineMu.Lock()
+	if a.timeout > 0 && !a.busy {
+		a.conn.SetReadDeadline(time.Now().Add(a.timeout))
+	}
+	a.deadlineMu.Unlock()
+
+	return readPDU(a.conn, defaultMaxPDULength)
+}
+
+// serving marks whether a request of the remote AE is being processed. The
+// read deadline is cleared while it is, however long the request takes, and
+// re-armed once it is complete
+func (a *association) serving(busy bool) {
+	a.deadlineMu.Lock()
+	defer a.deadlineMu.Unlock()
+
+	a.busy = busy
+	if a.timeout > 0 && !busy {
+		a.conn.SetReadDeadline(time.Now().Add(a.timeout))
+	} else {
+		a.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// expecting bounds the reads of the remote AE by the timeout while a
+// response is awaited during a request, clearing the deadline again once
+// done is called
+func (a *association) expecting() (done func()) {
+	a.deadlineMu.Lock()
+	defer a.deadlineMu.Unlock()
+
+	if a.timeout > 0 {
+		a.conn.SetReadDeadline(time.Now().Add(a.timeout))
+	}
+
+	return func() {
+		a.deadlineMu.Lock()
+		defer a.deadlineMu.Unlock()
+
+		if a.busy {
+			a.conn.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
+// writePDU utility to write a PDU to the remote AE
+func (a *association) writePDU(p pdu) error {
+	if a.timeout > 0 {
+		a.conn.SetWriteDeadline(time.Now().Add(a.timeout))
+	}
+
+	return writePDU(a.conn, p)
+}
+
+// readMessage reads the next DIMSE message from the remote AE, reassembling
+// its command and dataset from their fragments. The dataset of a C-STORE
+// request is spooled to a file, see message. Returns errReleased once the
+// remote AE requests release, after responding to the request, and
+// errAborted if the remote AE aborts the association
+func (a *association) readMessage() (message, error) {
+	var msg message
+	var commandData, dataSet bytes.Buffer
+	commandDone := false
+
+	for {
+		pdv, err := a.readValue()
+		if err != nil {
+			return message{}, err
+		}
+		msg.contextID = pdv.contextID
+
+		if pdv.command {
+			commandData.Write(pdv.data)
+			if !pdv.last {
+				continue
+			}
+
+			msg.command, err = decodeCommand(commandData.Bytes())
+			if err != nil {
+				a.abort(abortSourceServiceProvider, abortReasonUnexpectedPDU)
+				return message{}, err
+			}
+			if !msg.command.hasDataSet {
+				return msg, nil
+			}
+			if msg.command.field == commandCStoreRequest {
+				msg.file, err = a.readInstance(msg)
+				if err != nil {
+					return message{}, err
+				}
+				return msg, nil
+			}
+			commandDone = true
+			continue
+		}
+
+		if !commandDone {
+			a.abort(abortSourceServiceProvider, abortReasonUnexpectedPDU)
+			return message{}, fmt.Errorf("%w: dataset received before command", errUnexpectedPDU)
+		}
+
+		dataSet.Write(pdv.data)
+		if pdv.last {
+			msg.dataSet = dataSet.Bytes()
+			return msg, nil
+		}
+	}
+}
+
+// readValue utility to read the next presentation data value from the remote
+// AE, reading P-DATA-TF PDUs as needed
+func (a *association) readValue() (presentationDataValue, error) {
+	for len(a.pending) == 0 {
+		p, err := a.readPDU()
+		if err != nil {
+			return presentationDataValue{}, err
+		}
+
+		switch p := p.(type) {
+		case *dataTransfer:
+			a.pending = p.values
+		case *releaseRequest:
+			a.writePDU(&releaseResponse{})
+			return presentationDataValue{}, errReleased
+		case *abort:
+			return presentationDataValue{}, errAborted
+		default:
+			a.abort(abortSourceServiceProvider, abortReasonUnexpectedPDU)
+			return presentationDataValue{}, errUnexpectedPDU
+		}
+	}
+
+	pdv := a.pending[0]
+	a.pending = a.pending[1:]
+
+	if _, ok := a.contexts[pdv.contextID]; !ok {
+		a.abort(abortSourceServiceProvider, abortReasonUnexpectedPDU)
+		return presentationDataValue{}, fmt.Errorf("%w: unknown presentation context %d", errUnexpectedPDU, pdv.contextID)
+	}
+
+	return pdv, nil
+}
+
+// readInstance utility to spool the dataset of a C-STORE request, as it is
+// received, to a DICOM file prefixed with its file meta information
+func (a *association) readInstance(msg message) (*dicom.File, error) {
+	header := encodePart10Header(fileMeta{
+		sopClassUID:       msg.command.affectedSOPClassUID,
+		sopInstanceUID:    msg.command.affectedSOPInstanceUID,
+		transferSyntaxUID: a.contexts[msg.contextID].transferSyntaxes[0],
+	}, a.remoteAETitle)
+
+	file, err := dicom.SpoolFile(uuid.NewString(), io.MultiReader(
+		bytes.NewReader(header),
+		&dataSetReader{assoc: a, contextID: msg.contextID},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// dataSetReader reads the fragments of a dataset sent on a presentation
+// context as they are received from the remote AE
+type dataSetReader struct {
+	assoc     *association
+	contextID byte
+
+	fragment []byte
+	done     bool
+}
+
+func (r *dataSetReader) Read(p []byte) (int, error) {
+	for len(r.fragment) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		pdv, err := r.assoc.readValue()
+		if err != nil {
+			return 0, err
+		}
+		if pdv.command || pdv.contextID != r.contextID {
+			r.assoc.abort(abortSourceServiceProvider, abortReasonUnexpectedPDU)
+			return 0, fmt.Errorf("%w: command received within dataset", errUnexpectedPDU)
+		}
+
+		r.fragment = pdv.data
+		r.done = pdv.last
+	}
+
+	n := copy(p, r.fragment)
+	r.fragment = r.fragment[n:]
+	return n, nil
+}
+
+// writeMessage writes a DIMSE message to the remote AE, fragmenting its
+// command and dataset to fit within the maximum PDU length of the remote AE
+func (a *association) writeMessage(msg message) error {
+	msg.command.hasDataSet = msg.dataSet != nil || msg.dataSetReader != nil
+
+	if err := a.writeFragments(msg.contextID, true, bytes.NewReader(msg.command.encode())); err != nil {
+		return err
+	}
+
+	switch {
+	case msg.dataSetReader != nil:
+		return a.writeFragments(msg.contextID, false, msg.dataSetReader)
+	case msg.dataSet != nil:
+		return a.writeFragments(msg.contextID, false, bytes.NewReader(msg.dataSet))
+	default:
+		return nil
+	}
+}
+
+// writeFragments utility to write a command or dataset as a series of
+// P-DATA-TF PDUs, each holding a single fragment. The data is read a fragment
+// ahead, so the last fragment can be marked as such
+func (a *association) writeFragments(contextID byte, command bool, data io.Reader) error {
+	maxPDULength := a.maxPDULength
+	if maxPDULength == maxPDULengthUnlimited || maxPDULength > defaultMaxPDULength {
+		maxPDULength = defaultMaxPDULength
+	}
+	fragmentLength := int(maxPDULength) - pdvHeaderLength
+
+	readFragment := func(buffer []byte) (int, error) {
+		n, err := io.ReadFull(data, buffer)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = nil
+		}
+		return n, err
+	}
+
+	fragment, next := make([]byte, fragmentLength), make([]byte, fragmentLength)
+	n, err := readFragment(fragment)
+	if err != nil {
+		return err
+	}
+
+	for {
+		nextN := 0
+		if n == fragmentLength {
+			if nextN, err = readFragment(next); err != nil {
+				return err
+			}
+		}
+
+		if err := a.writePDU(&dataTransfer{
+			values: []presentationDataValue{
+				{
+					contextID: contextID,
+					command:   command,
+					last:      nextN == 0,
+					data:      fragment[:n],
+				},
+			},
+		}); err != nil {
+			return err
+		}
+
+		if nextN == 0 {
+			return nil
+		}
+		fragment, next, n = next, fragment, nextN
+	}
+}
+
+// receive reads messages from the remote AE onto the incoming channel until
+// an error ends the association or done is closed
+func (a *association) receive(done <-chan struct{}) {
+	for {
+		msg, err := a.readMessage()
+
+		select {
+		case a.incoming <- received{msg: msg, err: err}:
+		case <-done:
+			msg.close()
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// cancelled reports whether the remote AE has requested the cancellation of
+// the request with the given message ID. Only cancel requests may be
+// received while a request is processed, as asynchronous operations are not
+// negotiated
+func (a *association) cancelled(messageID uint16) (bool, error) {
+	for {
+		select {
+		case r := <-a.incoming:
+			if r.err != nil {
+				return false, r.err
+			}
+			if err := a.noteCancel(r.msg); err != nil {
+				return false, err
+			}
+		default:
+			return a.cancellations[messageID], nil
+		}
+	}
+}
+
+// await waits for the response to a request sent to the remote AE while
+// processing a request of the remote AE, as for the C-STORE sub-operations
+// of C-GET, for no longer than the timeout. Cancel requests received
+// meanwhile are noted
+func (a *association) await(field uint16, messageID uint16) (message, error) {
+	defer a.expecting()()
+
+	for r := range a.incoming {
+		if r.err != nil {
+			return message{}, r.err
+		}
+		if r.msg.command.field == field && r.msg.command.messageIDRespondedTo == messageID {
+			return r.msg, nil
+		}
+		if err := a.noteCancel(r.msg); err != nil {
+			return message{}, err
+		}
+	}
+
+	return message{}, errUnexpectedPDU
+}
+
+// noteCancel utility to note a cancel request received while processing a
+// request, failing for any other message
+func (a *association) noteCancel(msg message) error {
+	if msg.command.field != commandCCancelRequest {
+		msg.close()
+		return fmt.Errorf("%w: message 0x%04X received while processing a request",
+			errUnexpectedPDU, msg.command.field)
+	}
+
+	if a.cancellations == nil {
+		a.cancellations = make(map[uint16]bool)
+	}
+	a.cancellations[msg.command.messageIDRespondedTo] = true
+
+	return nil
+}
+
+// nextMessageID utility to allocate the message ID of a request sent to the
+// remote AE
+func (a *association) nextMessageID() uint16 {
+	a.messageID++
+	return a.messageID
+}
+
+// findContext utility to find an accepted presentation context for the
+// abstract syntax and transfer syntax
+func (a *association) findContext(abstractSyntax string, transferSyntax string) (byte, bool) {
+	for id, pc := range a.contexts {
+		if pc.abstractSyntax == abstractSyntax && pc.transferSyntaxes[0] == transferSyntax {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+// findAbstractSyntax utility to find an accepted presentation context for the
+// first of the abstract syntaxes accepted, returning its ID and transfer
+// syntax
+func (a *association) findAbstractSyntax(abstractSyntaxes ...string) (byte, string, bool) {
+	for _, abstractSyntax := range abstractSyntaxes {
+		for id, pc := range a.contexts {
+			if pc.abstractSyntax == abstractSyntax {
+				return id, pc.transferSyntaxes[0], true
+			}
+		}
+	}
+
+	return 0, "", false
+}
+
+// release requests the release of the association and waits for the remote
+// AE to respond, closing the connection
+func (a *association) release() error {
+	defer a.conn.Close()
+
+	if err := a.writePDU(&releaseRequest{}); err != nil {
+		return err
+	}
+
+	for {
+		p, err := a.readPDU()
+		if err != nil {
+			return err
+		}
+
+		switch p.(type) {
+		case *releaseResponse:
+			return nil
+		case *abort:
+			return errAborted
+		}
+	}
+}
+
+// abort aborts the association and closes the connection
+func (a *association) abort(source byte, reason byte) {
+	a.writePDU(&abort{source: source, reason: reason})
+	a.conn.Close()
+}
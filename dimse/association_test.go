@@ -0,0 +1,68 @@
+package dimse
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func Test_association_writeFragments(t *testing.T) {
+	// fragments of 10 bytes, given the length of each PDV header
+	const maxPDULength = 10 + pdvHeaderLength
+
+	tests := []struct {
+		name          string
+		length        int
+		wantFragments int
+	}{
+		{name: "writes an empty dataset as a single fragment", length: 0, wantFragments: 1},
+		{name: "writes a partial fragment", length: 5, wantFragments: 1},
+		{name: "marks an exact fragment as last", length: 10, wantFragments: 1},
+		{name: "writes many fragments", length: 25, wantFragments: 3},
+		{name: "marks the last of exact fragments as last", length: 30, wantFragments: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer local.Close()
+			defer remote.Close()
+
+			contexts := map[byte]presentationContext{1: {id: 1}}
+			sender := &association{conn: local, maxPDULength: maxPDULength, contexts: contexts}
+			receiver := &association{conn: remote, contexts: contexts}
+
+			data := make([]byte, tt.length)
+			for idx := range data {
+				data[idx] = byte(idx)
+			}
+
+			errs := make(chan error, 1)
+			go func() {
+				errs <- sender.writeFragments(1, false, bytes.NewReader(data))
+			}()
+
+			var got []byte
+			for fragments := 1; ; fragments++ {
+				pdv, err := receiver.readValue()
+				if err != nil {
+					t.Fatalf("association.readValue() error = %v", err)
+				}
+				got = append(got, pdv.data...)
+
+				if pdv.last {
+					if fragments != tt.wantFragments {
+						t.Errorf("association.writeFragments() wrote %d fragments, want %d", fragments, tt.wantFragments)
+					}
+					break
+				}
+			}
+
+			if err := <-errs; err != nil {
+				t.Fatalf("association.writeFragments() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("association.writeFragments() = %v, want %v", got, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,496 @@
+package dimse
+
+import (
+	"dicomviewer/dicom"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+var (
+	// ErrAssociationRejected error indicating the remote AE rejected the
+	// requested association
+	ErrAssociationRejected = errors.New("association was rejected")
+
+	// ErrNoPresentationContext error indicating the remote AE did not accept a
+	// presentation context suitable for the request
+	ErrNoPresentationContext = errors.New("no presentation context was accepted for the request")
+)
+
+// PresentationContext an abstract syntax, e.g. a SOP class, along with the
+// transfer syntaxes proposed for it when requesting an association
+type PresentationContext struct {
+	AbstractSyntax   string
+	TransferSyntaxes []string
+
+	// SCPRole propose taking the SCP role for the abstract syntax, as
+	// required to receive instances via C-GET
+	SCPRole bool
+}
+
+// ClientOptions options when requesting an association
+type ClientOptions struct {
+	callingAETitle string
+	timeout        time.Duration
+}
+
+// UseCallingAETitle option to specify the AE title the association is
+// requested from
+func UseCallingAETitle(aeTitle string) func(opts *ClientOptions) {
+	return func(opts *ClientOptions) {
+		opts.callingAETitle = aeTitle
+	}
+}
+
+// UseClientTimeout option to specify the maximum time to wait to connect and
+// for each PDU from the remote AE
+func UseClientTimeout(timeout time.Duration) func(opts *ClientOptions) {
+	return func(opts *ClientOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// Client a DIMSE service class user (SCU), requesting services of a remote AE
+// over an established association. A client is not safe for concurrent use
+type Client struct {
+	assoc *association
+}
+
+// Dial requests an association with the remote AE at the given address,
+// proposing the given presentation contexts
+func Dial(
+	address string,
+	calledAETitle string,
+	contexts []PresentationContext,
+	options ...func(opts *ClientOptions),
+) (*Client, error) {
+	var opts = ClientOptions{
+		callingAETitle: DefaultAETitle,
+		timeout:        defaultTimeout,
+	}
+
+	for _, optFn := range options {
+		optFn(&opts)
+	}
+
+	conn, err := net.DialTimeout("tcp", address, opts.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	assoc := &association{
+		conn:          conn,
+		localAETitle:  opts.callingAETitle,
+		remoteAETitle: calledAETitle,
+		timeout:       opts.timeout,
+		contexts:      make(map[byte]presentationContext),
+	}
+
+	request := &associate{
+		calledAETitle:      calledAETitle,
+		callingAETitle:     opts.callingAETitle,
+		applicationContext: applicationContextName,
+		userInformation: userInformation{
+			maxPDULength:              defaultMaxPDULength,
+			implementationClassUID:    implementationClassUID,
+			implementationVersionName: implementationVersionName,
+		},
+	}
+
+	// presentation context IDs are odd numbers
+	proposed := make(map[byte]PresentationContext)
+	for idx, context := range contexts {
+		id := byte(idx*2 + 1)
+		proposed[id] = context
+		request.presentationContexts = append(request.presentationContexts, presentationContext{
+			id:               id,
+			abstractSyntax:   context.AbstractSyntax,
+			transferSyntaxes: context.TransferSyntaxes,
+		})
+
+		if context.SCPRole {
+			request.userInformation.roleSelections = append(request.userInformation.roleSelections, roleSelection{
+				sopClassUID: context.AbstractSyntax,
+				scu:         true,
+				scp:         true,
+			})
+		}
+	}
+
+	if err := assoc.writePDU(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	p, err := assoc.readPDU()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	switch p := p.(type) {
+	case *associate:
+		if !p.accept {
+			assoc.abort(abortSourceServiceUser, abortReasonUnexpectedPDU)
+			return nil, errUnexpectedPDU
+		}
+
+		assoc.maxPDULength = p.userInformation.maxPDULength
+		for _, pc := range p.presentationContexts {
+			context, ok := proposed[pc.id]
+			if !ok || pc.result != presentationContextAccepted || len(pc.transferSyntaxes) == 0 {
+				continue
+			}
+
+			pc.abstractSyntax = context.AbstractSyntax
+			assoc.contexts[pc.id] = pc
+		}
+	case *associateReject:
+		conn.Close()
+		return nil, fmt.Errorf("%w: source %d, reason %d", ErrAssociationRejected, p.source, p.reason)
+	default:
+		assoc.abort(abortSourceServiceUser, abortReasonUnexpectedPDU)
+		return nil, errUnexpectedPDU
+	}
+
+	return &Client{assoc: assoc}, nil
+}
+
+// StorageContexts returns the presentation contexts required to store the
+// given files, one for each combination of SOP class and transfer syntax
+func StorageContexts(files ...*dicom.File) ([]PresentationContext, error) {
+	metas := make([]fileMeta, 0, len(files))
+	for _, file := range files {
+		meta, _, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, meta)
+	}
+
+	return storageContexts(metas), nil
+}
+
+// storageContexts utility to create the presentation contexts required to
+// store instances with the given file meta information, one for each
+// combination of SOP class and transfer syntax
+func storageContexts(metas []fileMeta) []PresentationContext {
+	var contexts []PresentationContext
+	seen := make(map[fileMeta]bool)
+
+	for _, meta := range metas {
+		meta.sopInstanceUID = ""
+		if seen[meta] {
+			continue
+		}
+		seen[meta] = true
+
+		contexts = append(contexts, PresentationContext{
+			AbstractSyntax:   meta.sopClassUID,
+			TransferSyntaxes: []string{meta.transferSyntaxUID},
+		})
+	}
+
+	return contexts
+}
+
+// QueryContexts returns the presentation contexts required to verify
+// connectivity with and query a remote AE
+func QueryContexts() []PresentationContext {
+	return uncompressedContexts(verificationSOPClass, patientRootFind, studyRootFind)
+}
+
+// RetrieveContexts returns the presentation contexts required to retrieve
+// instances from a remote AE via C-MOVE or C-GET. Retrieving via C-GET also
+// requires storage presentation contexts proposing the SCP role
+func RetrieveContexts() []PresentationContext {
+	return uncompressedContexts(patientRootMove, studyRootMove, patientRootGet, studyRootGet)
+}
+
+// uncompressedContexts utility to create presentation contexts proposing the
+// uncompressed transfer syntaxes for each abstract syntax
+func uncompressedContexts(abstractSyntaxes ...string) []PresentationContext {
+	var contexts []PresentationContext
+	for _, abstractSyntax := range abstractSyntaxes {
+		contexts = append(contexts, PresentationContext{
+			AbstractSyntax:   abstractSyntax,
+			TransferSyntaxes: uncompressedTransferSyntaxes,
+		})
+	}
+
+	return contexts
+}
+
+// Echo verifies connectivity with the remote AE via C-ECHO, returning the
+// status of the response
+func (c *Client) Echo() (Status, error) {
+	contextID, _, ok := c.assoc.findAbstractSyntax(verificationSOPClass)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNoPresentationContext, verificationSOPClass)
+	}
+
+	response, err := c.request(message{
+		contextID: contextID,
+		command: command{
+			field:               commandCEchoRequest,
+			affectedSOPClassUID: verificationSOPClass,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return response.command.status, nil
+}
+
+// Find queries the remote AE via C-FIND at the given level, returning the
+// identifier of each match along with the status of the final response.
+// Queries use the study root information model where accepted, other than at
+// the patient level
+func (c *Client) Find(level dicom.QueryLevel, keys []*dicomutil.Element) ([]dicomutil.Dataset, Status, error) {
+	contextID, transferSyntax, identifier, err := c.identifier(level, keys, patientRootFind, studyRootFind)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := c.request(message{
+		contextID: contextID,
+		command: command{
+			field:               commandCFindRequest,
+			affectedSOPClassUID: c.assoc.contexts[contextID].abstractSyntax,
+			priority:            priorityMedium,
+		},
+		dataSet: identifier,
+	})
+
+	var matches []dicomutil.Dataset
+	for {
+		if err != nil {
+			return nil, 0, err
+		}
+		if !response.command.status.IsPending() {
+			return matches, response.command.status, nil
+		}
+
+		var match dicomutil.Dataset
+		if match, err = decodeDataSet(response.dataSet, transferSyntax); err != nil {
+			c.Abort()
+			return nil, 0, err
+		}
+		matches = append(matches, match)
+
+		response, err = c.response(commandCFindResponse, c.assoc.messageID)
+	}
+}
+
+// Move requests the remote AE send the instances matching the keys at the
+// given level to the destination AE via C-MOVE, returning the number of
+// sub-operations in each state along with the status of the final response
+func (c *Client) Move(destination string, level dicom.QueryLevel, keys []*dicomutil.Element) (Suboperations, Status, error) {
+	contextID, _, identifier, err := c.identifier(level, keys, patientRootMove, studyRootMove)
+	if err != nil {
+		return Suboperations{}, 0, err
+	}
+
+	response, err := c.request(message{
+		contextID: contextID,
+		command: command{
+			field:               commandCMoveRequest,
+			affectedSOPClassUID: c.assoc.contexts[contextID].abstractSyntax,
+			priority:            priorityMedium,
+			moveDestination:     destination,
+		},
+		dataSet: identifier,
+	})
+
+	for {
+		if err != nil {
+			return Suboperations{}, 0, err
+		}
+		if !response.command.status.IsPending() {
+			return response.suboperations(), response.command.status, nil
+		}
+
+		response, err = c.response(commandCMoveResponse, c.assoc.messageID)
+	}
+}
+
+// Get requests the remote AE send the instances matching the keys at the
+// given level over this association via C-GET, returning the number of
+// sub-operations in each state along with the status of the final response.
+// Each instance received is passed to the store function, which returns the
+// status of its storage, and is closed once the store function returns. The
+// association must have been requested with the SCP role for the storage SOP
+// classes of the instances
+func (c *Client) Get(
+	level dicom.QueryLevel,
+	keys []*dicomutil.Element,
+	store func(file *dicom.File) Status,
+) (Suboperations, Status, error) {
+	contextID, _, identifier, err := c.identifier(level, keys, patientRootGet, studyRootGet)
+	if err != nil {
+		return Suboperations{}, 0, err
+	}
+
+	messageID := c.assoc.nextMessageID()
+	if err := c.assoc.writeMessage(message{
+		contextID: contextID,
+		command: command{
+			field:               commandCGetRequest,
+			messageID:           messageID,
+			affectedSOPClassUID: c.assoc.contexts[contextID].abstractSyntax,
+			priority:            priorityMedium,
+		},
+		dataSet: identifier,
+	}); err != nil {
+		return Suboperations{}, 0, err
+	}
+
+	for {
+		msg, err := c.assoc.readMessage()
+		if err != nil {
+			return Suboperations{}, 0, err
+		}
+
+		switch {
+		case msg.command.field == commandCStoreRequest:
+			file := msg.file
+			file.ID = msg.command.affectedSOPInstanceUID
+			status := store(file)
+			file.Close()
+
+			if err := c.assoc.writeMessage(message{
+				contextID: msg.contextID,
+				command: command{
+					field:                  commandCStoreResponse,
+					messageIDRespondedTo:   msg.command.messageID,
+					affectedSOPClassUID:    msg.command.affectedSOPClassUID,
+					affectedSOPInstanceUID: msg.command.affectedSOPInstanceUID,
+					status:                 status,
+				},
+			}); err != nil {
+				return Suboperations{}, 0, err
+			}
+		case msg.command.field == commandCGetResponse && msg.command.messageIDRespondedTo == messageID:
+			if !msg.command.status.IsPending() {
+				return msg.suboperations(), msg.command.status, nil
+			}
+		default:
+			c.Abort()
+			return Suboperations{}, 0, fmt.Errorf("%w: unexpected message 0x%04X", errUnexpectedPDU, msg.command.field)
+		}
+	}
+}
+
+// Store requests the remote AE store the file via C-STORE, returning the
+// status of the response
+func (c *Client) Store(file *dicom.File) (Status, error) {
+	return c.store(file, "", 0)
+}
+
+// store utility to request the remote AE store the file via C-STORE,
+// optionally as a sub-operation of the C-MOVE request with the given
+// originator AE title and message ID
+func (c *Client) store(file *dicom.File, moveOriginatorAETitle string, moveOriginatorMessageID uint16) (Status, error) {
+	meta, dataSet, err := readFile(file)
+	if err != nil {
+		return 0, err
+	}
+
+	contextID, ok := c.assoc.findContext(meta.sopClassUID, meta.transferSyntaxUID)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNoPresentationContext, meta.sopClassUID)
+	}
+
+	response, err := c.request(message{
+		contextID: contextID,
+		command: command{
+			field:                   commandCStoreRequest,
+			affectedSOPClassUID:     meta.sopClassUID,
+			affectedSOPInstanceUID:  meta.sopInstanceUID,
+			priority:                priorityMedium,
+			moveOriginatorAETitle:   moveOriginatorAETitle,
+			moveOriginatorMessageID: moveOriginatorMessageID,
+		},
+		dataSetReader: dataSet,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return response.command.status, nil
+}
+
+// Release releases the association
+func (c *Client) Release() error {
+	return c.assoc.release()
+}
+
+// Abort aborts the association
+func (c *Client) Abort() {
+	c.assoc.abort(abortSourceServiceUser, 0)
+}
+
+// request utility to send a request and wait for its response
+func (c *Client) request(msg message) (message, error) {
+	msg.command.messageID = c.assoc.nextMessageID()
+
+	if err := c.assoc.writeMessage(msg); err != nil {
+		return message{}, err
+	}
+
+	return c.response(msg.command.field|responseBit, msg.command.messageID)
+}
+
+// response utility to wait for the next response to the request with the
+// given message ID
+func (c *Client) response(field uint16, messageID uint16) (message, error) {
+	response, err := c.assoc.readMessage()
+	if err != nil {
+		return message{}, err
+	}
+
+	if response.command.field != field || response.command.messageIDRespondedTo != messageID {
+		c.Abort()
+		return message{}, fmt.Errorf("%w: unexpected response 0x%04X", errUnexpectedPDU, response.command.field)
+	}
+
+	return response, nil
+}
+
+// identifier utility to encode the identifier of a C-FIND, C-MOVE or C-GET
+// request at the given level, choosing a presentation context for either the
+// patient root or study root SOP class. The study root SOP class is preferred,
+// other than at the patient level
+func (c *Client) identifier(
+	level dicom.QueryLevel,
+	keys []*dicomutil.Element,
+	patientRoot string,
+	studyRoot string,
+) (byte, string, []byte, error) {
+	models := []string{studyRoot, patientRoot}
+	if level == dicom.QueryLevelPatient {
+		models = []string{patientRoot}
+	}
+
+	contextID, transferSyntax, ok := c.assoc.findAbstractSyntax(models...)
+	if !ok {
+		return 0, "", nil, fmt.Errorf("%w: %s", ErrNoPresentationContext, models[0])
+	}
+
+	levelElement, err := dicomutil.NewElement(tag.QueryRetrieveLevel, []string{string(level)})
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	identifier, err := encodeDataSet(append([]*dicomutil.Element{levelElement}, keys...), transferSyntax)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	return contextID, transferSyntax, identifier, nil
+}
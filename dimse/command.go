@@ -0,0 +1,297 @@
+package dimse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Command fields of DIMSE-C request and response messages. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part07/sect_E.1.html
+const (
+	commandCStoreRequest  uint16 = 0x0001
+	commandCStoreResponse uint16 = 0x8001
+	commandCGetRequest    uint16 = 0x0010
+	commandCGetResponse   uint16 = 0x8010
+	commandCFindRequest   uint16 = 0x0020
+	commandCFindResponse  uint16 = 0x8020
+	commandCMoveRequest   uint16 = 0x0021
+	commandCMoveResponse  uint16 = 0x8021
+	commandCEchoRequest   uint16 = 0x0030
+	commandCEchoResponse  uint16 = 0x8030
+	commandCCancelRequest uint16 = 0x0FFF
+)
+
+// responseBit the bit set in the command field of response messages
+const responseBit uint16 = 0x8000
+
+// commandDataSetTypeNone the Command Data Set Type (0000,0800) value
+// indicating no dataset follows the command
+const commandDataSetTypeNone uint16 = 0x0101
+
+// Priorities of DIMSE-C requests
+const priorityMedium uint16 = 0x0000
+
+// Tags of command elements, all within group 0000
+const (
+	commandGroupLength                    uint16 = 0x0000
+	commandAffectedSOPClassUID            uint16 = 0x0002
+	commandField                          uint16 = 0x0100
+	commandMessageID                      uint16 = 0x0110
+	commandMessageIDRespondedTo           uint16 = 0x0120
+	commandMoveDestination                uint16 = 0x0600
+	commandPriority                       uint16 = 0x0700
+	commandDataSetType                    uint16 = 0x0800
+	commandStatus                         uint16 = 0x0900
+	commandErrorComment                   uint16 = 0x0902
+	commandAffectedSOPInstanceUID         uint16 = 0x1000
+	commandNumberOfRemainingSuboperations uint16 = 0x1020
+	commandNumberOfCompletedSuboperations uint16 = 0x1021
+	commandNumberOfFailedSuboperations    uint16 = 0x1022
+	commandNumberOfWarningSuboperations   uint16 = 0x1023
+	commandMoveOriginatorAETitle          uint16 = 0x1030
+	commandMoveOriginatorMessageID        uint16 = 0x1031
+)
+
+var (
+	// errMalformedCommand error indicating a command set could not be decoded
+	errMalformedCommand = errors.New("malformed command set")
+)
+
+// Suboperations the number of C-STORE sub-operations of a C-MOVE or C-GET
+// request in each state
+type Suboperations struct {
+	Remaining int
+	Completed int
+	Failed    int
+	Warning   int
+}
+
+// command the command set of a DIMSE message
+type command struct {
+	field                  uint16
+	messageID              uint16
+	messageIDRespondedTo   uint16
+	affectedSOPClassUID    string
+	affectedSOPInstanceUID string
+	priority               uint16
+	hasDataSet             bool
+	status                 Status
+	errorComment           string
+
+	// moveDestination the AE title C-MOVE requests send instances to
+	moveDestination string
+
+	// moveOriginatorAETitle and moveOriginatorMessageID identify the C-MOVE
+	// request a C-STORE sub-operation is performed for
+	moveOriginatorAETitle   string
+	moveOriginatorMessageID uint16
+
+	// suboperations the progress of C-MOVE and C-GET requests, only present
+	// in their responses
+	suboperations *Suboperations
+}
+
+// isResponse determines whether the command is a response to a request
+func (c command) isResponse() bool {
+	return c.field&responseBit != 0
+}
+
+// encode encodes the command set in the implicit VR little endian transfer
+// syntax, as required of all command sets
+func (c command) encode() []byte {
+	elements := map[uint16][]byte{
+		commandField:       encodeUS(c.field),
+		commandDataSetType: encodeUS(commandDataSetTypeNone),
+	}
+
+	if c.hasDataSet {
+		elements[commandDataSetType] = encodeUS(0x0000)
+	}
+	if c.affectedSOPClassUID != "" {
+		elements[commandAffectedSOPClassUID] = encodeUID(c.affectedSOPClassUID)
+	}
+	if c.affectedSOPInstanceUID != "" {
+		elements[commandAffectedSOPInstanceUID] = encodeUID(c.affectedSOPInstanceUID)
+	}
+
+	switch {
+	case c.isResponse():
+		elements[commandMessageIDRespondedTo] = encodeUS(c.messageIDRespondedTo)
+		elements[commandStatus] = encodeUS(uint16(c.status))
+		if c.errorComment != "" {
+			elements[commandErrorComment] = encodeString(c.errorComment)
+		}
+		if c.suboperations != nil {
+			// the number of remaining sub-operations is only meaningful
+			// while the request is being processed
+			if c.status.IsPending() || c.status == StatusCancel {
+				elements[commandNumberOfRemainingSuboperations] = encodeCount(c.suboperations.Remaining)
+			}
+			elements[commandNumberOfCompletedSuboperations] = encodeCount(c.suboperations.Completed)
+			elements[commandNumberOfFailedSuboperations] = encodeCount(c.suboperations.Failed)
+			elements[commandNumberOfWarningSuboperations] = encodeCount(c.suboperations.Warning)
+		}
+	case c.field == commandCCancelRequest:
+		// cancel requests identify the request to cancel rather than
+		// themselves
+		elements[commandMessageIDRespondedTo] = encodeUS(c.messageIDRespondedTo)
+	default:
+		elements[commandMessageID] = encodeUS(c.messageID)
+		if c.field != commandCEchoRequest {
+			elements[commandPriority] = encodeUS(c.priority)
+		}
+		if c.moveDestination != "" {
+			elements[commandMoveDestination] = encodeString(c.moveDestination)
+		}
+		if c.moveOriginatorAETitle != "" {
+			elements[commandMoveOriginatorAETitle] = encodeString(c.moveOriginatorAETitle)
+			elements[commandMoveOriginatorMessageID] = encodeUS(c.moveOriginatorMessageID)
+		}
+	}
+
+	// elements are encoded in ascending tag order
+	var elementTags []uint16
+	for elementTag := range elements {
+		elementTags = append(elementTags, elementTag)
+	}
+	sort.Slice(elementTags, func(i, j int) bool {
+		return elementTags[i] < elementTags[j]
+	})
+
+	var body bytes.Buffer
+	for _, elementTag := range elementTags {
+		writeCommandElement(&body, elementTag, elements[elementTag])
+	}
+
+	groupLength := make([]byte, 4)
+	binary.LittleEndian.PutUint32(groupLength, uint32(body.Len()))
+
+	var buffer bytes.Buffer
+	writeCommandElement(&buffer, commandGroupLength, groupLength)
+	buffer.Write(body.Bytes())
+
+	return buffer.Bytes()
+}
+
+// decodeCommand utility to decode a command set encoded in the implicit VR
+// little endian transfer syntax
+func decodeCommand(data []byte) (command, error) {
+	elements := make(map[uint16][]byte)
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return command{}, errMalformedCommand
+		}
+
+		group := binary.LittleEndian.Uint16(data[0:2])
+		element := binary.LittleEndian.Uint16(data[2:4])
+		length := binary.LittleEndian.Uint32(data[4:8])
+		if group != 0x0000 || uint64(length) > uint64(len(data)-8) {
+			return command{}, errMalformedCommand
+		}
+
+		elements[element] = data[8 : 8+length]
+		data = data[8+length:]
+	}
+
+	field, ok := decodeUS(elements[commandField])
+	if !ok {
+		return command{}, fmt.Errorf("%w: missing command field", errMalformedCommand)
+	}
+
+	c := command{
+		field:                  field,
+		affectedSOPClassUID:    decodeString(elements[commandAffectedSOPClassUID]),
+		affectedSOPInstanceUID: decodeString(elements[commandAffectedSOPInstanceUID]),
+		errorComment:           decodeString(elements[commandErrorComment]),
+		moveDestination:        decodeString(elements[commandMoveDestination]),
+		moveOriginatorAETitle:  decodeString(elements[commandMoveOriginatorAETitle]),
+	}
+	c.messageID, _ = decodeUS(elements[commandMessageID])
+	c.messageIDRespondedTo, _ = decodeUS(elements[commandMessageIDRespondedTo])
+	c.priority, _ = decodeUS(elements[commandPriority])
+	c.moveOriginatorMessageID, _ = decodeUS(elements[commandMoveOriginatorMessageID])
+
+	if _, ok := elements[commandNumberOfCompletedSuboperations]; ok {
+		c.suboperations = &Suboperations{
+			Remaining: decodeCount(elements[commandNumberOfRemainingSuboperations]),
+			Completed: decodeCount(elements[commandNumberOfCompletedSuboperations]),
+			Failed:    decodeCount(elements[commandNumberOfFailedSuboperations]),
+			Warning:   decodeCount(elements[commandNumberOfWarningSuboperations]),
+		}
+	}
+
+	dataSetType, _ := decodeUS(elements[commandDataSetType])
+	c.hasDataSet = dataSetType != commandDataSetTypeNone
+
+	status, _ := decodeUS(elements[commandStatus])
+	c.status = Status(status)
+
+	return c, nil
+}
+
+// writeCommandElement utility to encode an element of group 0000 in the
+// implicit VR little endian transfer syntax
+func writeCommandElement(buffer *bytes.Buffer, element uint16, value []byte) {
+	binary.Write(buffer, binary.LittleEndian, uint16(0x0000))
+	binary.Write(buffer, binary.LittleEndian, element)
+	binary.Write(buffer, binary.LittleEndian, uint32(len(value)))
+	buffer.Write(value)
+}
+
+// encodeUS utility to encode an unsigned short value
+func encodeUS(value uint16) []byte {
+	data := make([]byte, 2)
+	binary.LittleEndian.PutUint16(data, value)
+	return data
+}
+
+// decodeUS utility to decode an unsigned short value
+func decodeUS(data []byte) (uint16, bool) {
+	if len(data) != 2 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint16(data), true
+}
+
+// encodeCount utility to encode a count as an unsigned short value, saturating
+// at its maximum
+func encodeCount(count int) []byte {
+	if count > math.MaxUint16 {
+		count = math.MaxUint16
+	}
+	return encodeUS(uint16(count))
+}
+
+// decodeCount utility to decode a count encoded as an unsigned short value,
+// or zero if absent
+func decodeCount(data []byte) int {
+	count, _ := decodeUS(data)
+	return int(count)
+}
+
+// encodeUID utility to encode a UID, padded to an even length with a null
+func encodeUID(uid string) []byte {
+	if len(uid)%2 != 0 {
+		return append([]byte(uid), 0x00)
+	}
+	return []byte(uid)
+}
+
+// encodeString utility to encode a string, padded to an even length with a
+// space
+func encodeString(value string) []byte {
+	if len(value)%2 != 0 {
+		return append([]byte(value), ' ')
+	}
+	return []byte(value)
+}
+
+// decodeString utility to decode a string or UID, removing any padding
+func decodeString(data []byte) string {
+	return strings.TrimRight(string(data), "\x00 ")
+}
@@ -0,0 +1,62 @@
+package dimse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_decodeCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command command
+		want    command
+	}{
+		{
+			name: "round trips requests with a dataset",
+			command: command{
+				field:                  commandCStoreRequest,
+				messageID:              7,
+				affectedSOPClassUID:    "1.2.840.10008.5.1.4.1.1.7",
+				affectedSOPInstanceUID: "1.2.3",
+				priority:               priorityMedium,
+				hasDataSet:             true,
+			},
+			want: command{
+				field:                  commandCStoreRequest,
+				messageID:              7,
+				affectedSOPClassUID:    "1.2.840.10008.5.1.4.1.1.7",
+				affectedSOPInstanceUID: "1.2.3",
+				priority:               priorityMedium,
+				hasDataSet:             true,
+			},
+		},
+		{
+			name: "round trips responses without a dataset",
+			command: command{
+				field:                commandCStoreResponse,
+				messageIDRespondedTo: 7,
+				affectedSOPClassUID:  "1.2.840.10008.5.1.4.1.1.7",
+				status:               StatusCannotUnderstand,
+				errorComment:         "bad",
+			},
+			want: command{
+				field:                commandCStoreResponse,
+				messageIDRespondedTo: 7,
+				affectedSOPClassUID:  "1.2.840.10008.5.1.4.1.1.7",
+				status:               StatusCannotUnderstand,
+				errorComment:         "bad",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCommand(tt.command.encode())
+			if err != nil {
+				t.Fatalf("decodeCommand() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeCommand() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
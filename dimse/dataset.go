@@ -0,0 +1,90 @@
+package dimse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	dicomutil "github.com/suyashkumar/dicom"
+)
+
+var (
+	// errUnsupportedTransferSyntax error indicating a dataset is encoded in a
+	// transfer syntax that cannot be decoded or encoded by this
+	// implementation
+	errUnsupportedTransferSyntax = errors.New("unsupported transfer syntax")
+)
+
+// encodeDataSet utility to encode the elements of a dataset, such as a query
+// identifier, in an uncompressed transfer syntax. Elements are encoded in
+// ascending tag order
+func encodeDataSet(elements []*dicomutil.Element, transferSyntax string) ([]byte, error) {
+	implicit, err := isImplicitVR(transferSyntax)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := append([]*dicomutil.Element{}, elements...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Tag.Compare(sorted[j].Tag) < 0
+	})
+
+	var buffer bytes.Buffer
+	writer := dicomutil.NewWriter(&buffer, dicomutil.SkipVRVerification())
+	writer.SetTransferSyntax(binary.LittleEndian, implicit)
+	for _, element := range sorted {
+		if err := writer.WriteElement(element); err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// decodeDataSet utility to decode a dataset encoded in an uncompressed
+// transfer syntax
+func decodeDataSet(data []byte, transferSyntax string) (dicomutil.Dataset, error) {
+	implicit, err := isImplicitVR(transferSyntax)
+	if err != nil {
+		return dicomutil.Dataset{}, err
+	}
+
+	parser, err := dicomutil.NewParser(
+		bytes.NewReader(data),
+		int64(len(data)),
+		nil,
+		dicomutil.SkipMetadataReadOnNewParserInit(),
+	)
+	if err != nil {
+		return dicomutil.Dataset{}, err
+	}
+	parser.SetTransferSyntax(binary.LittleEndian, implicit)
+
+	var dataSet dicomutil.Dataset
+	for {
+		element, err := parser.Next()
+		if errors.Is(err, dicomutil.ErrorEndOfDICOM) {
+			return dataSet, nil
+		}
+		if err != nil {
+			return dicomutil.Dataset{}, err
+		}
+
+		dataSet.Elements = append(dataSet.Elements, element)
+	}
+}
+
+// isImplicitVR utility to determine whether an uncompressed transfer syntax
+// encodes VRs implicitly
+func isImplicitVR(transferSyntax string) (bool, error) {
+	switch transferSyntax {
+	case implicitVRLittleEndian:
+		return true, nil
+	case explicitVRLittleEndian:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %s", errUnsupportedTransferSyntax, transferSyntax)
+	}
+}
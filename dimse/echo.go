@@ -0,0 +1,15 @@
+package dimse
+
+// handleEcho utility to handle a C-ECHO request, which remote AEs use to
+// verify connectivity with this server
+func (s *Server) handleEcho(assoc *association, msg message) error {
+	return assoc.writeMessage(message{
+		contextID: msg.contextID,
+		command: command{
+			field:                commandCEchoResponse,
+			messageIDRespondedTo: msg.command.messageID,
+			affectedSOPClassUID:  msg.command.affectedSOPClassUID,
+			status:               StatusSuccess,
+		},
+	})
+}
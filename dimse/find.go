@@ -0,0 +1,235 @@
+package dimse
+
+import (
+	"dicomviewer/dicom"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+var (
+	// errIdentifierMismatch error indicating a query identifier does not
+	// match the information model it was sent on
+	errIdentifierMismatch = errors.New("identifier does not match the information model")
+)
+
+// Query levels of the patient root and study root information models. The
+// study root models have no patient level
+var (
+	patientRootLevels = []dicom.QueryLevel{
+		dicom.QueryLevelPatient,
+		dicom.QueryLevelStudy,
+		dicom.QueryLevelSeries,
+		dicom.QueryLevelImage,
+	}
+	studyRootLevels = []dicom.QueryLevel{
+		dicom.QueryLevelStudy,
+		dicom.QueryLevelSeries,
+		dicom.QueryLevelImage,
+	}
+)
+
+// queryLevels the query levels supported by each query/retrieve SOP class
+var queryLevels = map[string][]dicom.QueryLevel{
+	patientRootFind: patientRootLevels,
+	patientRootMove: patientRootLevels,
+	patientRootGet:  patientRootLevels,
+	studyRootFind:   studyRootLevels,
+	studyRootMove:   studyRootLevels,
+	studyRootGet:    studyRootLevels,
+}
+
+// handleFind utility to handle a C-FIND request by searching the metadata
+// index, sending a pending response holding the identifier of each match
+// followed by a final response. Matching follows the attribute matching rules
+// of PS3.4
+func (s *Server) handleFind(assoc *association, msg message) error {
+	context := assoc.contexts[msg.contextID]
+	transferSyntax := context.transferSyntaxes[0]
+
+	respond := func(status Status, errorComment string, dataSet []byte) error {
+		return assoc.writeMessage(message{
+			contextID: msg.contextID,
+			command: command{
+				field:                commandCFindResponse,
+				messageIDRespondedTo: msg.command.messageID,
+				affectedSOPClassUID:  msg.command.affectedSOPClassUID,
+				status:               status,
+				errorComment:         truncate(errorComment, 64),
+			},
+			dataSet: dataSet,
+		})
+	}
+
+	identifier, err := decodeDataSet(msg.dataSet, transferSyntax)
+	if err != nil {
+		return respond(StatusCannotUnderstand, err.Error(), nil)
+	}
+
+	query, err := newFindQuery(context.abstractSyntax, identifier)
+	if err != nil {
+		return respond(StatusIdentifierMismatch, err.Error(), nil)
+	}
+
+	results, err := s.metadataIndex.Search(query)
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to search for %s from %s: %s", query.Level, assoc.remoteAETitle, err))
+		return respond(StatusOutOfResources, err.Error(), nil)
+	}
+
+	for _, result := range results {
+		cancelled, err := assoc.cancelled(msg.command.messageID)
+		if err != nil {
+			return err
+		}
+		if cancelled {
+			return respond(StatusCancel, "", nil)
+		}
+
+		dataSet, err := encodeDataSet(s.findResponse(identifier, result), transferSyntax)
+		if err != nil {
+			slog.Error(fmt.Sprintf("failed to encode match for %s: %s", assoc.remoteAETitle, err))
+			return respond(StatusProcessingFailure, err.Error(), nil)
+		}
+
+		if err := respond(StatusPending, "", dataSet); err != nil {
+			return err
+		}
+	}
+
+	return respond(StatusSuccess, "", nil)
+}
+
+// newFindQuery utility to build a search of the metadata index from a C-FIND,
+// C-MOVE or C-GET identifier. Every attribute of the identifier other than the
+// query level is a key, with sequence and binary attributes returned but not
+// matched
+func newFindQuery(model string, identifier dicomutil.Dataset) (dicom.SearchQuery, error) {
+	levelElement, err := identifier.FindElementByTag(tag.QueryRetrieveLevel)
+	if err != nil {
+		return dicom.SearchQuery{}, fmt.Errorf("%w: missing query/retrieve level", errIdentifierMismatch)
+	}
+
+	var level dicom.QueryLevel
+	if values, ok := levelElement.Value.GetValue().([]string); ok && len(values) > 0 {
+		level = dicom.QueryLevel(strings.TrimSpace(values[0]))
+	}
+
+	supported := false
+	for _, supportedLevel := range queryLevels[model] {
+		supported = supported || level == supportedLevel
+	}
+	if !supported {
+		return dicom.SearchQuery{}, fmt.Errorf("%w: unsupported query/retrieve level %q", errIdentifierMismatch, level)
+	}
+
+	query := dicom.SearchQuery{
+		Level: level,
+		Keys:  make(map[tag.Tag]string),
+	}
+
+	for _, element := range identifier.Elements {
+		switch element.Tag {
+		case tag.QueryRetrieveLevel, tag.SpecificCharacterSet, tag.RetrieveAETitle:
+			continue
+		}
+
+		switch values := element.Value.GetValue().(type) {
+		case []string:
+			query.Keys[element.Tag] = strings.Join(values, `\`)
+		case []int:
+			var key []string
+			for _, value := range values {
+				key = append(key, strconv.Itoa(value))
+			}
+			query.Keys[element.Tag] = strings.Join(key, `\`)
+		}
+	}
+
+	return query, nil
+}
+
+// findResponse utility to build the identifier of a C-FIND match, holding the
+// values of exactly the attributes requested. Attributes the match has no
+// value for are returned empty
+func (s *Server) findResponse(identifier dicomutil.Dataset, result dicom.JSONDataset) []*dicomutil.Element {
+	var elements []*dicomutil.Element
+	for _, requested := range identifier.Elements {
+		switch requested.Tag {
+		case tag.QueryRetrieveLevel:
+			elements = append(elements, requested)
+			continue
+		case tag.RetrieveAETitle:
+			if element, err := dicomutil.NewElement(tag.RetrieveAETitle, []string{s.aeTitle}); err == nil {
+				elements = append(elements, element)
+				continue
+			}
+		}
+
+		if element, ok := newResponseElement(requested.Tag, result[dicom.JSONTagKey(requested.Tag)]); ok {
+			elements = append(elements, element)
+			continue
+		}
+
+		if requested.Value.ValueType() == dicomutil.Sequences {
+			if element, err := dicomutil.NewElement(requested.Tag, [][]*dicomutil.Element{}); err == nil {
+				elements = append(elements, element)
+			}
+			continue
+		}
+
+		elements = append(elements, requested)
+	}
+
+	return elements
+}
+
+// newResponseElement utility to create an element holding the values of an
+// attribute of a match. Sequence and binary attributes are not supported
+func newResponseElement(t tag.Tag, attribute dicom.JSONAttribute) (*dicomutil.Element, bool) {
+	values := attribute.Strings()
+
+	var data interface{}
+	switch attribute.VR {
+	case "", "SQ", "AT", "OB", "OD", "OF", "OL", "OV", "OW", "UN":
+		return nil, false
+	case "US", "SS", "UL", "SL", "SV", "UV":
+		ints := make([]int, 0, len(values))
+		for _, value := range values {
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, false
+			}
+			ints = append(ints, i)
+		}
+		data = ints
+	case "FL", "FD":
+		floats := make([]float64, 0, len(values))
+		for _, value := range values {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, false
+			}
+			floats = append(floats, f)
+		}
+		data = floats
+	default:
+		if values == nil {
+			values = []string{}
+		}
+		data = values
+	}
+
+	element, err := dicomutil.NewElement(t, data)
+	if err != nil {
+		return nil, false
+	}
+	element.RawValueRepresentation = attribute.VR
+
+	return element, true
+}
@@ -0,0 +1,238 @@
+package dimse
+
+import (
+	"dicomviewer/dicom"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+func TestServer_Echo(t *testing.T) {
+	address, _ := startTestServer(t)
+
+	client, err := Dial(address, "TESTSCP", QueryContexts(), UseCallingAETitle("TESTSCU"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Release()
+
+	got, err := client.Echo()
+	if err != nil {
+		t.Fatalf("Echo() error = %v", err)
+	}
+	if got != StatusSuccess {
+		t.Errorf("Echo() = %v, want %v", got, StatusSuccess)
+	}
+}
+
+func TestServer_Find(t *testing.T) {
+	newKeys := func(keys map[tag.Tag]string) []*dicomutil.Element {
+		var elements []*dicomutil.Element
+		for keyTag, key := range keys {
+			element, err := dicomutil.NewElement(keyTag, []string{key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			elements = append(elements, element)
+		}
+		return elements
+	}
+
+	type args struct {
+		level dicom.QueryLevel
+		keys  map[tag.Tag]string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		want       []string
+		wantStatus Status
+	}{
+		{
+			name: "finds patients by name wildcard",
+			args: args{
+				level: dicom.QueryLevelPatient,
+				keys: map[tag.Tag]string{
+					tag.PatientName:                   "doe^1*",
+					tag.PatientID:                     "",
+					tag.NumberOfPatientRelatedStudies: "",
+					tag.NumberOfPatientRelatedSeries:  "",
+				},
+			},
+			want: []string{
+				`(0008,0052)=PATIENT (0010,0010)=DOE^1 (0010,0020)=PID1 (0020,1200)=1 (0020,1202)=2`,
+			},
+			wantStatus: StatusSuccess,
+		},
+		{
+			name: "finds studies by date range",
+			args: args{
+				level: dicom.QueryLevelStudy,
+				keys: map[tag.Tag]string{
+					tag.StudyDate:                     "20240302-20240331",
+					tag.StudyInstanceUID:              "",
+					tag.NumberOfStudyRelatedInstances: "",
+				},
+			},
+			want: []string{
+				`(0008,0020)=20240302 (0008,0052)=STUDY (0020,000d)=2 (0020,1208)=1`,
+			},
+			wantStatus: StatusSuccess,
+		},
+		{
+			name: "finds every series of a study",
+			args: args{
+				level: dicom.QueryLevelSeries,
+				keys: map[tag.Tag]string{
+					tag.StudyInstanceUID:  "1",
+					tag.SeriesInstanceUID: "",
+					tag.Modality:          "",
+					tag.SeriesDescription: "",
+				},
+			},
+			want: []string{
+				`(0008,0052)=SERIES (0008,0060)=OT (0008,103e)= (0020,000d)=1 (0020,000e)=1.1`,
+				`(0008,0052)=SERIES (0008,0060)=OT (0008,103e)= (0020,000d)=1 (0020,000e)=1.2`,
+			},
+			wantStatus: StatusSuccess,
+		},
+		{
+			name: "finds instances by list of UIDs",
+			args: args{
+				level: dicom.QueryLevelImage,
+				keys: map[tag.Tag]string{
+					tag.SOPInstanceUID: `1.2.1\2.1.1`,
+				},
+			},
+			want: []string{
+				`(0008,0018)=1.2.1 (0008,0052)=IMAGE`,
+				`(0008,0018)=2.1.1 (0008,0052)=IMAGE`,
+			},
+			wantStatus: StatusSuccess,
+		},
+		{
+			name: "finds nothing for unmatched keys",
+			args: args{
+				level: dicom.QueryLevelStudy,
+				keys: map[tag.Tag]string{
+					tag.PatientID: "PID3",
+				},
+			},
+			wantStatus: StatusSuccess,
+		},
+		{
+			name: "fails for unsupported query levels",
+			args: args{
+				level: "FRAME",
+			},
+			wantStatus: StatusIdentifierMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, index := startTestServer(t)
+			for _, file := range []*dicom.File{
+				newTestFile(t, "1", "1.1", "1.1.1", 16),
+				newTestFile(t, "1", "1.2", "1.2.1", 16),
+				newTestFile(t, "2", "2.1", "2.1.1", 16),
+			} {
+				metadata, err := dicom.NewInstanceMetadata(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				index.Add(metadata)
+			}
+
+			client, err := Dial(address, "TESTSCP", QueryContexts(), UseCallingAETitle("TESTSCU"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Release()
+
+			matches, status, err := client.Find(tt.args.level, newKeys(tt.args.keys))
+			if err != nil {
+				t.Fatalf("Find() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Find() status = %v, want %v", status, tt.wantStatus)
+			}
+
+			var got []string
+			for _, match := range matches {
+				var attributes []string
+				for _, element := range match.Elements {
+					attributes = append(attributes, element.Tag.String()+"="+elementValue(element))
+				}
+				got = append(got, strings.Join(attributes, " "))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Find() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// slowMetadataIndex a MetadataIndex taking the delay to search
+type slowMetadataIndex struct {
+	dicom.MetadataIndex
+	delay time.Duration
+}
+
+func (i slowMetadataIndex) Search(query dicom.SearchQuery) ([]dicom.JSONDataset, error) {
+	time.Sleep(i.delay)
+	return i.MetadataIndex.Search(query)
+}
+
+func TestServer_Find_slowSearch(t *testing.T) {
+	index := dicom.NewMemoryIndex()
+	address, _ := startTestServer(t,
+		UseTimeout(200*time.Millisecond),
+		UseMetadataIndex(slowMetadataIndex{MetadataIndex: index, delay: 400 * time.Millisecond}),
+	)
+
+	metadata, err := dicom.NewInstanceMetadata(newTestFile(t, "1", "1.1", "1.1.1", 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Add(metadata)
+
+	client, err := Dial(address, "TESTSCP", QueryContexts(), UseCallingAETitle("TESTSCU"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Release()
+
+	element, err := dicomutil.NewElement(tag.StudyInstanceUID, []string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, status, err := client.Find(dicom.QueryLevelStudy, []*dicomutil.Element{element})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if status != StatusSuccess || len(matches) != 1 {
+		t.Errorf("Find() = %v matches, %v, want 1 match, %v", len(matches), status, StatusSuccess)
+	}
+}
+
+// elementValue utility to format the value of an element for comparison
+func elementValue(element *dicomutil.Element) string {
+	switch values := element.Value.GetValue().(type) {
+	case []string:
+		return strings.Join(values, `\`)
+	case []int:
+		var formatted []string
+		for _, value := range values {
+			formatted = append(formatted, strconv.Itoa(value))
+		}
+		return strings.Join(formatted, `\`)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,542 @@
+package dimse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDU types of the DICOM upper layer protocol. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part08/sect_9.3.html
+const (
+	pduTypeAssociateRequest byte = 0x01
+	pduTypeAssociateAccept  byte = 0x02
+	pduTypeAssociateReject  byte = 0x03
+	pduTypeDataTransfer     byte = 0x04
+	pduTypeReleaseRequest   byte = 0x05
+	pduTypeReleaseResponse  byte = 0x06
+	pduTypeAbort            byte = 0x07
+)
+
+// Item types of A-ASSOCIATE-RQ and A-ASSOCIATE-AC PDUs
+const (
+	itemTypeApplicationContext         byte = 0x10
+	itemTypePresentationContextRequest byte = 0x20
+	itemTypePresentationContextAccept  byte = 0x21
+	itemTypeAbstractSyntax             byte = 0x30
+	itemTypeTransferSyntax             byte = 0x40
+	itemTypeUserInformation            byte = 0x50
+	itemTypeMaximumLength              byte = 0x51
+	itemTypeImplementationClassUID     byte = 0x52
+	itemTypeRoleSelection              byte = 0x54
+	itemTypeImplementationVersionName  byte = 0x55
+)
+
+const (
+	// protocolVersion the only version of the upper layer protocol
+	protocolVersion uint16 = 0x0001
+
+	// pduHeaderLength length of the type, reserved and length fields of a PDU
+	pduHeaderLength = 6
+
+	// associateHeaderLength length of the fixed fields of A-ASSOCIATE-RQ and
+	// A-ASSOCIATE-AC PDUs, preceding their variable items
+	associateHeaderLength = 68
+
+	// aeTitleLength the fixed length of AE titles within PDUs
+	aeTitleLength = 16
+
+	// pdvHeaderLength length of the length, presentation context ID and
+	// message control header fields of a presentation data value
+	pdvHeaderLength = 6
+
+	// maxPDULengthUnlimited a maximum PDU length indicating no limit
+	maxPDULengthUnlimited uint32 = 0
+
+	// defaultMaxPDULength the maximum length of PDUs received by this
+	// implementation
+	defaultMaxPDULength uint32 = 65536
+)
+
+// Bits of the message control header of presentation data values
+const (
+	messageControlCommand      byte = 0x01
+	messageControlLastFragment byte = 0x02
+)
+
+// Results of presentation context negotiation
+const (
+	presentationContextAccepted                  byte = 0
+	presentationContextAbstractSyntaxUnsupported byte = 3
+	presentationContextTransferSyntaxUnsupported byte = 4
+)
+
+// Result, source and reason of A-ASSOCIATE-RJ PDUs
+const (
+	rejectResultPermanent                     byte = 1
+	rejectSourceServiceUser                   byte = 1
+	rejectSourceServiceProviderACSE           byte = 2
+	rejectReasonApplicationContextUnsupported byte = 2
+	rejectReasonCalledAETitleUnrecognized     byte = 7
+	rejectReasonProtocolVersionUnsupported    byte = 2
+)
+
+// Source and reason of A-ABORT PDUs
+const (
+	abortSourceServiceUser     byte = 0
+	abortSourceServiceProvider byte = 2
+	abortReasonUnexpectedPDU   byte = 2
+)
+
+var (
+	// errPDUTooLarge error indicating a PDU exceeds the maximum length the
+	// receiver is willing to accept
+	errPDUTooLarge = errors.New("pdu exceeds maximum length")
+
+	// errMalformedPDU error indicating a PDU could not be decoded
+	errMalformedPDU = errors.New("malformed pdu")
+)
+
+// pdu a protocol data unit of the DICOM upper layer protocol
+type pdu interface {
+	pduType() byte
+	encode() []byte
+}
+
+// presentationContext a presentation context proposed in an A-ASSOCIATE-RQ or
+// negotiated in an A-ASSOCIATE-AC
+type presentationContext struct {
+	id               byte
+	abstractSyntax   string
+	transferSyntaxes []string
+
+	// result the result of negotiation, only meaningful when accepting
+	result byte
+}
+
+// roleSelection an SCP/SCU role selection sub-item, negotiating the roles
+// the association requestor may take for a SOP class. By default the
+// requestor is the SCU and the acceptor the SCP
+type roleSelection struct {
+	sopClassUID string
+	scu         bool
+	scp         bool
+}
+
+// userInformation the user information item of A-ASSOCIATE-RQ and
+// A-ASSOCIATE-AC PDUs
+type userInformation struct {
+	maxPDULength              uint32
+	implementationClassUID    string
+	implementationVersionName string
+	roleSelections            []roleSelection
+}
+
+// associate an A-ASSOCIATE-RQ or A-ASSOCIATE-AC PDU
+type associate struct {
+	accept bool
+
+	calledAETitle        string
+	callingAETitle       string
+	applicationContext   string
+	presentationContexts []presentationContext
+	userInformation      userInformation
+
+	protocolVersion uint16
+}
+
+func (a *associate) pduType() byte {
+	if a.accept {
+		return pduTypeAssociateAccept
+	}
+	return pduTypeAssociateRequest
+}
+
+func (a *associate) encode() []byte {
+	var buffer bytes.Buffer
+
+	binary.Write(&buffer, binary.BigEndian, protocolVersion)
+	buffer.Write([]byte{0, 0})
+	buffer.WriteString(padAETitle(a.calledAETitle))
+	buffer.WriteString(padAETitle(a.callingAETitle))
+	buffer.Write(make([]byte, 32))
+
+	writeItem(&buffer, itemTypeApplicationContext, []byte(a.applicationContext))
+
+	for _, pc := range a.presentationContexts {
+		var item bytes.Buffer
+		if a.accept {
+			item.Write([]byte{pc.id, 0, pc.result, 0})
+			transferSyntax := ""
+			if len(pc.transferSyntaxes) > 0 {
+				transferSyntax = pc.transferSyntaxes[0]
+			}
+			writeItem(&item, itemTypeTransferSyntax, []byte(transferSyntax))
+			writeItem(&buffer, itemTypePresentationContextAccept, item.Bytes())
+			continue
+		}
+
+		item.Write([]byte{pc.id, 0, 0, 0})
+		writeItem(&item, itemTypeAbstractSyntax, []byte(pc.abstractSyntax))
+		for _, transferSyntax := range pc.transferSyntaxes {
+			writeItem(&item, itemTypeTransferSyntax, []byte(transferSyntax))
+		}
+		writeItem(&buffer, itemTypePresentationContextRequest, item.Bytes())
+	}
+
+	var userInfo bytes.Buffer
+	maxLength := make([]byte, 4)
+	binary.BigEndian.PutUint32(maxLength, a.userInformation.maxPDULength)
+	writeItem(&userInfo, itemTypeMaximumLength, maxLength)
+	if a.userInformation.implementationClassUID != "" {
+		writeItem(&userInfo, itemTypeImplementationClassUID, []byte(a.userInformation.implementationClassUID))
+	}
+	for _, role := range a.userInformation.roleSelections {
+		var roleItem bytes.Buffer
+		binary.Write(&roleItem, binary.BigEndian, uint16(len(role.sopClassUID)))
+		roleItem.WriteString(role.sopClassUID)
+		roleItem.Write([]byte{boolByte(role.scu), boolByte(role.scp)})
+		writeItem(&userInfo, itemTypeRoleSelection, roleItem.Bytes())
+	}
+	if a.userInformation.implementationVersionName != "" {
+		writeItem(&userInfo, itemTypeImplementationVersionName, []byte(a.userInformation.implementationVersionName))
+	}
+	writeItem(&buffer, itemTypeUserInformation, userInfo.Bytes())
+
+	return buffer.Bytes()
+}
+
+// decodeAssociate utility to decode the body of an A-ASSOCIATE-RQ or
+// A-ASSOCIATE-AC PDU
+func decodeAssociate(data []byte, accept bool) (*associate, error) {
+	if len(data) < associateHeaderLength {
+		return nil, errMalformedPDU
+	}
+
+	a := &associate{
+		accept:          accept,
+		protocolVersion: binary.BigEndian.Uint16(data[0:2]),
+		calledAETitle:   strings.TrimSpace(string(data[4:20])),
+		callingAETitle:  strings.TrimSpace(string(data[20:36])),
+	}
+
+	items, err := decodeItems(data[associateHeaderLength:])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, it := range items {
+		switch it.itemType {
+		case itemTypeApplicationContext:
+			a.applicationContext = trimUID(it.data)
+		case itemTypePresentationContextRequest, itemTypePresentationContextAccept:
+			pc, err := decodePresentationContext(it.data)
+			if err != nil {
+				return nil, err
+			}
+			a.presentationContexts = append(a.presentationContexts, pc)
+		case itemTypeUserInformation:
+			subItems, err := decodeItems(it.data)
+			if err != nil {
+				return nil, err
+			}
+			for _, subItem := range subItems {
+				switch subItem.itemType {
+				case itemTypeMaximumLength:
+					if len(subItem.data) != 4 {
+						return nil, errMalformedPDU
+					}
+					a.userInformation.maxPDULength = binary.BigEndian.Uint32(subItem.data)
+				case itemTypeImplementationClassUID:
+					a.userInformation.implementationClassUID = trimUID(subItem.data)
+				case itemTypeImplementationVersionName:
+					a.userInformation.implementationVersionName = strings.TrimSpace(string(subItem.data))
+				case itemTypeRoleSelection:
+					role, err := decodeRoleSelection(subItem.data)
+					if err != nil {
+						return nil, err
+					}
+					a.userInformation.roleSelections = append(a.userInformation.roleSelections, role)
+				}
+			}
+		}
+	}
+
+	return a, nil
+}
+
+// decodePresentationContext utility to decode a presentation context item
+func decodePresentationContext(data []byte) (presentationContext, error) {
+	if len(data) < 4 {
+		return presentationContext{}, errMalformedPDU
+	}
+
+	pc := presentationContext{
+		id:     data[0],
+		result: data[2],
+	}
+
+	subItems, err := decodeItems(data[4:])
+	if err != nil {
+		return presentationContext{}, err
+	}
+
+	for _, subItem := range subItems {
+		switch subItem.itemType {
+		case itemTypeAbstractSyntax:
+			pc.abstractSyntax = trimUID(subItem.data)
+		case itemTypeTransferSyntax:
+			pc.transferSyntaxes = append(pc.transferSyntaxes, trimUID(subItem.data))
+		}
+	}
+
+	return pc, nil
+}
+
+// decodeRoleSelection utility to decode an SCP/SCU role selection sub-item
+func decodeRoleSelection(data []byte) (roleSelection, error) {
+	if len(data) < 2 {
+		return roleSelection{}, errMalformedPDU
+	}
+
+	length := int(binary.BigEndian.Uint16(data[0:2]))
+	if len(data) != length+4 {
+		return roleSelection{}, errMalformedPDU
+	}
+
+	return roleSelection{
+		sopClassUID: trimUID(data[2 : 2+length]),
+		scu:         data[2+length] == 1,
+		scp:         data[3+length] == 1,
+	}, nil
+}
+
+// associateReject an A-ASSOCIATE-RJ PDU
+type associateReject struct {
+	result byte
+	source byte
+	reason byte
+}
+
+func (r *associateReject) pduType() byte {
+	return pduTypeAssociateReject
+}
+
+func (r *associateReject) encode() []byte {
+	return []byte{0, r.result, r.source, r.reason}
+}
+
+// presentationDataValue a fragment of a command or dataset sent within a
+// P-DATA-TF PDU
+type presentationDataValue struct {
+	contextID byte
+	command   bool
+	last      bool
+	data      []byte
+}
+
+// dataTransfer a P-DATA-TF PDU
+type dataTransfer struct {
+	values []presentationDataValue
+}
+
+func (d *dataTransfer) pduType() byte {
+	return pduTypeDataTransfer
+}
+
+func (d *dataTransfer) encode() []byte {
+	var buffer bytes.Buffer
+	for _, pdv := range d.values {
+		var control byte
+		if pdv.command {
+			control |= messageControlCommand
+		}
+		if pdv.last {
+			control |= messageControlLastFragment
+		}
+
+		binary.Write(&buffer, binary.BigEndian, uint32(len(pdv.data)+2))
+		buffer.Write([]byte{pdv.contextID, control})
+		buffer.Write(pdv.data)
+	}
+
+	return buffer.Bytes()
+}
+
+// decodeDataTransfer utility to decode the body of a P-DATA-TF PDU
+func decodeDataTransfer(data []byte) (*dataTransfer, error) {
+	d := &dataTransfer{}
+	for len(data) > 0 {
+		if len(data) < pdvHeaderLength {
+			return nil, errMalformedPDU
+		}
+
+		length := binary.BigEndian.Uint32(data[0:4])
+		if length < 2 || uint64(length) > uint64(len(data)-4) {
+			return nil, errMalformedPDU
+		}
+
+		d.values = append(d.values, presentationDataValue{
+			contextID: data[4],
+			command:   data[5]&messageControlCommand != 0,
+			last:      data[5]&messageControlLastFragment != 0,
+			data:      data[pdvHeaderLength : 4+length],
+		})
+		data = data[4+length:]
+	}
+
+	return d, nil
+}
+
+// releaseRequest an A-RELEASE-RQ PDU
+type releaseRequest struct{}
+
+func (r *releaseRequest) pduType() byte {
+	return pduTypeReleaseRequest
+}
+
+func (r *releaseRequest) encode() []byte {
+	return make([]byte, 4)
+}
+
+// releaseResponse an A-RELEASE-RP PDU
+type releaseResponse struct{}
+
+func (r *releaseResponse) pduType() byte {
+	return pduTypeReleaseResponse
+}
+
+func (r *releaseResponse) encode() []byte {
+	return make([]byte, 4)
+}
+
+// abort an A-ABORT PDU
+type abort struct {
+	source byte
+	reason byte
+}
+
+func (a *abort) pduType() byte {
+	return pduTypeAbort
+}
+
+func (a *abort) encode() []byte {
+	return []byte{0, 0, a.source, a.reason}
+}
+
+// writePDU utility to encode and write a PDU
+func writePDU(w io.Writer, p pdu) error {
+	body := p.encode()
+
+	header := make([]byte, pduHeaderLength)
+	header[0] = p.pduType()
+	binary.BigEndian.PutUint32(header[2:], uint32(len(body)))
+
+	_, err := w.Write(append(header, body...))
+	return err
+}
+
+// readPDU utility to read and decode a PDU. PDUs longer than maxLength are
+// rejected, unless maxLength is zero
+func readPDU(r io.Reader, maxLength uint32) (pdu, error) {
+	header := make([]byte, pduHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[2:])
+	if maxLength != maxPDULengthUnlimited && length > maxLength {
+		return nil, fmt.Errorf("%w: %d bytes", errPDUTooLarge, length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	switch header[0] {
+	case pduTypeAssociateRequest:
+		return decodeAssociate(body, false)
+	case pduTypeAssociateAccept:
+		return decodeAssociate(body, true)
+	case pduTypeAssociateReject:
+		if len(body) < 4 {
+			return nil, errMalformedPDU
+		}
+		return &associateReject{result: body[1], source: body[2], reason: body[3]}, nil
+	case pduTypeDataTransfer:
+		return decodeDataTransfer(body)
+	case pduTypeReleaseRequest:
+		return &releaseRequest{}, nil
+	case pduTypeReleaseResponse:
+		return &releaseResponse{}, nil
+	case pduTypeAbort:
+		if len(body) < 4 {
+			return nil, errMalformedPDU
+		}
+		return &abort{source: body[2], reason: body[3]}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown pdu type 0x%02x", errMalformedPDU, header[0])
+	}
+}
+
+// item a variable item of an A-ASSOCIATE-RQ or A-ASSOCIATE-AC PDU
+type item struct {
+	itemType byte
+	data     []byte
+}
+
+// writeItem utility to encode an item
+func writeItem(buffer *bytes.Buffer, itemType byte, data []byte) {
+	buffer.Write([]byte{itemType, 0})
+	binary.Write(buffer, binary.BigEndian, uint16(len(data)))
+	buffer.Write(data)
+}
+
+// decodeItems utility to decode a series of items
+func decodeItems(data []byte) ([]item, error) {
+	var items []item
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errMalformedPDU
+		}
+
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if length > len(data)-4 {
+			return nil, errMalformedPDU
+		}
+
+		items = append(items, item{
+			itemType: data[0],
+			data:     data[4 : 4+length],
+		})
+		data = data[4+length:]
+	}
+
+	return items, nil
+}
+
+// padAETitle utility to pad an AE title with spaces to its fixed length
+func padAETitle(aeTitle string) string {
+	if len(aeTitle) > aeTitleLength {
+		return aeTitle[:aeTitleLength]
+	}
+
+	return aeTitle + strings.Repeat(" ", aeTitleLength-len(aeTitle))
+}
+
+// boolByte utility to encode a boolean as a byte
+func boolByte(value bool) byte {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// trimUID utility to trim the padding of a UID
+func trimUID(data []byte) string {
+	return strings.TrimRight(string(data), "\x00 ")
+}
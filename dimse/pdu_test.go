@@ -0,0 +1,150 @@
+package dimse
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func Test_readPDU(t *testing.T) {
+	type args struct {
+		pdu       pdu
+		maxLength uint32
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    pdu
+		wantErr bool
+	}{
+		{
+			name: "round trips associate requests",
+			args: args{
+				pdu: &associate{
+					calledAETitle:      "SCP",
+					callingAETitle:     "SCU",
+					applicationContext: applicationContextName,
+					presentationContexts: []presentationContext{
+						{
+							id:               1,
+							abstractSyntax:   "1.2.840.10008.1.1",
+							transferSyntaxes: []string{explicitVRLittleEndian, implicitVRLittleEndian},
+						},
+					},
+					userInformation: userInformation{
+						maxPDULength:           16384,
+						implementationClassUID: implementationClassUID,
+						roleSelections: []roleSelection{
+							{sopClassUID: testSOPClassUID, scp: true},
+						},
+					},
+				},
+			},
+			want: &associate{
+				calledAETitle:      "SCP",
+				callingAETitle:     "SCU",
+				applicationContext: applicationContextName,
+				presentationContexts: []presentationContext{
+					{
+						id:               1,
+						abstractSyntax:   "1.2.840.10008.1.1",
+						transferSyntaxes: []string{explicitVRLittleEndian, implicitVRLittleEndian},
+					},
+				},
+				userInformation: userInformation{
+					maxPDULength:           16384,
+					implementationClassUID: implementationClassUID,
+					roleSelections: []roleSelection{
+						{sopClassUID: testSOPClassUID, scp: true},
+					},
+				},
+				protocolVersion: protocolVersion,
+			},
+		},
+		{
+			name: "round trips associate accepts",
+			args: args{
+				pdu: &associate{
+					accept:             true,
+					calledAETitle:      "SCP",
+					callingAETitle:     "SCU",
+					applicationContext: applicationContextName,
+					presentationContexts: []presentationContext{
+						{
+							id:               1,
+							result:           presentationContextAccepted,
+							transferSyntaxes: []string{implicitVRLittleEndian},
+						},
+					},
+				},
+			},
+			want: &associate{
+				accept:             true,
+				calledAETitle:      "SCP",
+				callingAETitle:     "SCU",
+				applicationContext: applicationContextName,
+				presentationContexts: []presentationContext{
+					{
+						id:               1,
+						result:           presentationContextAccepted,
+						transferSyntaxes: []string{implicitVRLittleEndian},
+					},
+				},
+				protocolVersion: protocolVersion,
+			},
+		},
+		{
+			name: "round trips data transfers",
+			args: args{
+				pdu: &dataTransfer{
+					values: []presentationDataValue{
+						{contextID: 1, command: true, last: true, data: []byte{1, 2}},
+						{contextID: 1, last: false, data: []byte{3}},
+					},
+				},
+			},
+			want: &dataTransfer{
+				values: []presentationDataValue{
+					{contextID: 1, command: true, last: true, data: []byte{1, 2}},
+					{contextID: 1, last: false, data: []byte{3}},
+				},
+			},
+		},
+		{
+			name: "round trips aborts",
+			args: args{
+				pdu: &abort{source: abortSourceServiceProvider, reason: abortReasonUnexpectedPDU},
+			},
+			want: &abort{source: abortSourceServiceProvider, reason: abortReasonUnexpectedPDU},
+		},
+		{
+			name: "errors for PDUs exceeding the maximum length",
+			args: args{
+				pdu: &dataTransfer{
+					values: []presentationDataValue{
+						{contextID: 1, last: true, data: make([]byte, 32)},
+					},
+				},
+				maxLength: 16,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			if err := writePDU(&buffer, tt.args.pdu); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readPDU(&buffer, tt.args.maxLength)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readPDU() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readPDU() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package dimse
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrInvalidRemoteAE error indicating a remote AE could not be parsed
+	ErrInvalidRemoteAE = errors.New("remote AE must be in the form AETITLE@host:port")
+)
+
+// RemoteAE a known remote AE, which instances may be sent to via C-MOVE
+type RemoteAE struct {
+	AETitle string
+	Host    string
+	Port    string
+}
+
+// ParseRemoteAE parses a remote AE in the form AETITLE@host:port
+func ParseRemoteAE(value string) (RemoteAE, error) {
+	aeTitle, address, ok := strings.Cut(value, "@")
+	if !ok || aeTitle == "" || len(aeTitle) > aeTitleLength {
+		return RemoteAE{}, fmt.Errorf("%w: %s", ErrInvalidRemoteAE, value)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" || port == "" {
+		return RemoteAE{}, fmt.Errorf("%w: %s", ErrInvalidRemoteAE, value)
+	}
+
+	return RemoteAE{
+		AETitle: aeTitle,
+		Host:    host,
+		Port:    port,
+	}, nil
+}
+
+// Address returns the network address of the remote AE
+func (r RemoteAE) Address() string {
+	return net.JoinHostPort(r.Host, r.Port)
+}
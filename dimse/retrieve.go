@@ -0,0 +1,292 @@
+package dimse
+
+import (
+	"dicomviewer/dicom"
+	"fmt"
+	"log/slog"
+
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// handleMove utility to handle a C-MOVE request by sending the matching
+// instances to the move destination, over a sub-association requested of it
+// as a C-STORE SCU
+func (s *Server) handleMove(assoc *association, msg message) error {
+	destination, ok := s.remoteAEs[msg.command.moveDestination]
+	if !ok {
+		return s.respondRetrieve(assoc, msg, StatusMoveDestinationUnknown, Suboperations{}, nil,
+			fmt.Sprintf("unknown move destination %s", msg.command.moveDestination))
+	}
+
+	instances, status, err := s.resolveRetrieve(assoc, msg)
+	if err != nil {
+		return s.respondRetrieve(assoc, msg, status, Suboperations{}, nil, err.Error())
+	}
+	if len(instances) == 0 {
+		return s.respondRetrieve(assoc, msg, StatusSuccess, Suboperations{}, nil, "")
+	}
+
+	contexts, err := s.storageContexts(instances)
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to read instances to move to %s: %s", destination.AETitle, err))
+		return s.respondRetrieve(assoc, msg, StatusOutOfResourcesSuboperations, Suboperations{}, nil, err.Error())
+	}
+
+	client, err := Dial(
+		destination.Address(),
+		destination.AETitle,
+		contexts,
+		UseCallingAETitle(s.aeTitle),
+		UseClientTimeout(s.timeout),
+	)
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to associate with move destination %s: %s", destination.AETitle, err))
+		return s.respondRetrieve(assoc, msg, StatusOutOfResourcesSuboperations, Suboperations{}, nil, err.Error())
+	}
+	defer client.Release()
+
+	return s.retrieve(assoc, msg, instances, func(file *dicom.File) (Status, error) {
+		return client.store(file, assoc.remoteAETitle, msg.command.messageID)
+	})
+}
+
+// handleGet utility to handle a C-GET request by sending the matching
+// instances to the requestor over the same association. The requestor must
+// have accepted the SCP role for the SOP classes of the instances
+func (s *Server) handleGet(assoc *association, msg message) error {
+	instances, status, err := s.resolveRetrieve(assoc, msg)
+	if err != nil {
+		return s.respondRetrieve(assoc, msg, status, Suboperations{}, nil, err.Error())
+	}
+
+	return s.retrieve(assoc, msg, instances, func(file *dicom.File) (Status, error) {
+		meta, dataSet, err := readFile(file)
+		if err != nil {
+			slog.Error(fmt.Sprintf("failed to read instance %s to send to %s: %s", file.ID, assoc.remoteAETitle, err))
+			return StatusProcessingFailure, nil
+		}
+
+		contextID, ok := assoc.findContext(meta.sopClassUID, meta.transferSyntaxUID)
+		if !ok || !assoc.remoteSCPRoles[meta.sopClassUID] {
+			slog.Error(fmt.Sprintf("no presentation context to send instance %s to %s",
+				meta.sopInstanceUID, assoc.remoteAETitle))
+			return StatusSOPClassNotSupported, nil
+		}
+
+		messageID := assoc.nextMessageID()
+		if err := assoc.writeMessage(message{
+			contextID: contextID,
+			command: command{
+				field:                  commandCStoreRequest,
+				messageID:              messageID,
+				affectedSOPClassUID:    meta.sopClassUID,
+				affectedSOPInstanceUID: meta.sopInstanceUID,
+				priority:               priorityMedium,
+			},
+			dataSetReader: dataSet,
+		}); err != nil {
+			return 0, err
+		}
+
+		response, err := assoc.await(commandCStoreResponse, messageID)
+		if err != nil {
+			return 0, err
+		}
+
+		return response.command.status, nil
+	})
+}
+
+// resolveRetrieve utility to resolve the instances matching the identifier
+// of a C-MOVE or C-GET request, at any query level, from the index. Files are
+// only opened as each is sent. Returns the status to respond with on failure
+func (s *Server) resolveRetrieve(assoc *association, msg message) ([]dicom.InstanceMetadata, Status, error) {
+	context := assoc.contexts[msg.contextID]
+
+	identifier, err := decodeDataSet(msg.dataSet, context.transferSyntaxes[0])
+	if err != nil {
+		return nil, StatusCannotUnderstand, err
+	}
+
+	query, err := newFindQuery(context.abstractSyntax, identifier)
+	if err != nil {
+		return nil, StatusIdentifierMismatch, err
+	}
+	query.Level = dicom.QueryLevelImage
+
+	results, err := s.metadataIndex.Search(query)
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to search for instances to retrieve for %s: %s", assoc.remoteAETitle, err))
+		return nil, StatusOutOfResourcesMatches, err
+	}
+
+	var resolved []dicom.InstanceMetadata
+	seen := make(map[string]bool)
+	for _, result := range results {
+		instances, err := s.metadataIndex.Find(dicom.InstanceUIDs{
+			StudyInstanceUID:  dicom.FirstJSONString(result, tag.StudyInstanceUID),
+			SeriesInstanceUID: dicom.FirstJSONString(result, tag.SeriesInstanceUID),
+			SOPInstanceUID:    dicom.FirstJSONString(result, tag.SOPInstanceUID),
+		})
+		if err != nil {
+			return nil, StatusOutOfResourcesMatches, err
+		}
+
+		for _, instance := range instances {
+			if !seen[instance.FileID] {
+				seen[instance.FileID] = true
+				resolved = append(resolved, instance)
+			}
+		}
+	}
+
+	return resolved, StatusSuccess, nil
+}
+
+// storageContexts utility to determine the presentation contexts required to
+// send the instances, opening the file of each in turn to read its file meta
+// information
+func (s *Server) storageContexts(instances []dicom.InstanceMetadata) ([]PresentationContext, error) {
+	metas := make([]fileMeta, 0, len(instances))
+	for _, instance := range instances {
+		file, err := s.fileRepository.Get(instance.FileID)
+		if err != nil {
+			return nil, err
+		}
+
+		meta, _, err := readFile(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, meta)
+	}
+
+	return storageContexts(metas), nil
+}
+
+// retrieve utility to perform a C-STORE sub-operation for each instance of a
+// C-MOVE or C-GET request, sending a pending response with the progress of
+// the request after each and a final response once all are complete or the
+// request is cancelled. The file of each instance is open only for its
+// sub-operation. An error from a sub-operation fails it along with the
+// remaining sub-operations
+func (s *Server) retrieve(
+	assoc *association,
+	msg message,
+	instances []dicom.InstanceMetadata,
+	store func(file *dicom.File) (Status, error),
+) error {
+	var progress Suboperations
+	var failedUIDs []string
+
+	fail := func(instance dicom.InstanceMetadata) {
+		progress.Failed++
+		failedUIDs = append(failedUIDs, instance.SOPInstanceUID)
+	}
+
+	for idx, instance := range instances {
+		progress.Remaining = len(instances) - idx
+
+		cancelled, err := assoc.cancelled(msg.command.messageID)
+		if err != nil {
+			return err
+		}
+		if cancelled {
+			return s.respondRetrieve(assoc, msg, StatusCancel, progress, failedUIDs, "")
+		}
+
+		status, err := s.storeInstance(assoc, instance, store)
+		if err != nil {
+			slog.Error(fmt.Sprintf("failed to retrieve instances for %s: %s", assoc.remoteAETitle, err))
+			for _, remaining := range instances[idx:] {
+				fail(remaining)
+			}
+			progress.Remaining = 0
+			break
+		}
+
+		progress.Remaining--
+		switch {
+		case status.IsSuccess():
+			progress.Completed++
+		case status.IsWarning():
+			progress.Warning++
+		default:
+			fail(instance)
+		}
+
+		if progress.Remaining > 0 {
+			if err := s.respondRetrieve(assoc, msg, StatusPending, progress, nil, ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	status := StatusSuccess
+	if progress.Failed > 0 || progress.Warning > 0 {
+		status = StatusSuboperationsIncomplete
+	}
+
+	return s.respondRetrieve(assoc, msg, status, progress, failedUIDs, "")
+}
+
+// storeInstance utility to perform the C-STORE sub-operation of an instance
+// with its file, closing the file once done. Files that cannot be opened fail
+// only their own sub-operation
+func (s *Server) storeInstance(
+	assoc *association,
+	instance dicom.InstanceMetadata,
+	store func(file *dicom.File) (Status, error),
+) (Status, error) {
+	file, err := s.fileRepository.Get(instance.FileID)
+	if err != nil {
+		slog.Error(fmt.Sprintf("failed to get file %s to send to %s: %s", instance.FileID, assoc.remoteAETitle, err))
+		return StatusProcessingFailure, nil
+	}
+	defer file.Close()
+
+	return store(file)
+}
+
+// respondRetrieve utility to send a response to a C-MOVE or C-GET request.
+// The SOP instance UIDs of failed sub-operations are returned in the
+// identifier of the final response
+func (s *Server) respondRetrieve(
+	assoc *association,
+	msg message,
+	status Status,
+	progress Suboperations,
+	failedUIDs []string,
+	errorComment string,
+) error {
+	response := message{
+		contextID: msg.contextID,
+		command: command{
+			field:                msg.command.field | responseBit,
+			messageIDRespondedTo: msg.command.messageID,
+			affectedSOPClassUID:  msg.command.affectedSOPClassUID,
+			status:               status,
+			errorComment:         truncate(errorComment, 64),
+			suboperations:        &progress,
+		},
+	}
+
+	if len(failedUIDs) > 0 {
+		element, err := dicomutil.NewElement(tag.FailedSOPInstanceUIDList, failedUIDs)
+		if err != nil {
+			return err
+		}
+
+		response.dataSet, err = encodeDataSet(
+			[]*dicomutil.Element{element},
+			assoc.contexts[msg.contextID].transferSyntaxes[0],
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return assoc.writeMessage(response)
+}
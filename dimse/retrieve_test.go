@@ -0,0 +1,434 @@
+package dimse
+
+import (
+	"bytes"
+	"dicomviewer/dicom"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// storeTestFiles utility to store test files on the server at the address
+func storeTestFiles(t *testing.T, address string) {
+	t.Helper()
+
+	files := []*dicom.File{
+		newTestFile(t, "1", "1.1", "1.1.1", 16),
+		newTestFile(t, "1", "1.1", "1.1.2", 16),
+		newTestFile(t, "1", "1.2", "1.2.1", 16),
+		newTestFile(t, "2", "2.1", "2.1.1", 16),
+	}
+
+	contexts, err := StorageContexts(files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := Dial(address, "TESTSCP", contexts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Release()
+
+	for _, file := range files {
+		if status, err := client.Store(file); err != nil || status != StatusSuccess {
+			t.Fatalf("Store() = %v, %v", status, err)
+		}
+	}
+}
+
+// newTestKey utility to create a single valued key of an identifier
+func newTestKey(t *testing.T, keyTag tag.Tag, key string) *dicomutil.Element {
+	t.Helper()
+
+	element, err := dicomutil.NewElement(keyTag, []string{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return element
+}
+
+func TestServer_Move(t *testing.T) {
+	unreachable, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, unreachablePort, _ := net.SplitHostPort(unreachable.Addr().String())
+	unreachable.Close()
+
+	type args struct {
+		destination string
+		level       dicom.QueryLevel
+		keys        map[tag.Tag]string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		want       Suboperations
+		wantStatus Status
+		wantMoved  int
+	}{
+		{
+			name: "moves a study",
+			args: args{
+				destination: "DESTINATION",
+				level:       dicom.QueryLevelStudy,
+				keys: map[tag.Tag]string{
+					tag.StudyInstanceUID: "1",
+				},
+			},
+			want:       Suboperations{Completed: 3},
+			wantStatus: StatusSuccess,
+			wantMoved:  3,
+		},
+		{
+			name: "moves the studies of a patient",
+			args: args{
+				destination: "DESTINATION",
+				level:       dicom.QueryLevelPatient,
+				keys: map[tag.Tag]string{
+					tag.PatientID: "PID2",
+				},
+			},
+			want:       Suboperations{Completed: 1},
+			wantStatus: StatusSuccess,
+			wantMoved:  1,
+		},
+		{
+			name: "moves nothing for unmatched keys",
+			args: args{
+				destination: "DESTINATION",
+				level:       dicom.QueryLevelSeries,
+				keys: map[tag.Tag]string{
+					tag.SeriesInstanceUID: "3.1",
+				},
+			},
+			wantStatus: StatusSuccess,
+		},
+		{
+			name: "refuses unknown destinations",
+			args: args{
+				destination: "UNKNOWN",
+				level:       dicom.QueryLevelStudy,
+				keys: map[tag.Tag]string{
+					tag.StudyInstanceUID: "1",
+				},
+			},
+			wantStatus: StatusMoveDestinationUnknown,
+		},
+		{
+			name: "fails for unreachable destinations",
+			args: args{
+				destination: "UNREACHABLE",
+				level:       dicom.QueryLevelStudy,
+				keys: map[tag.Tag]string{
+					tag.StudyInstanceUID: "1",
+				},
+			},
+			wantStatus: StatusOutOfResourcesSuboperations,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destinationAddress, destinationIndex := startTestServer(t, UseAETitle("DESTINATION"))
+			host, port, _ := net.SplitHostPort(destinationAddress)
+
+			address, _ := startTestServer(t, UseRemoteAEs(
+				RemoteAE{AETitle: "DESTINATION", Host: host, Port: port},
+				RemoteAE{AETitle: "UNREACHABLE", Host: "127.0.0.1", Port: unreachablePort},
+			))
+			storeTestFiles(t, address)
+
+			client, err := Dial(address, "TESTSCP", RetrieveContexts())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Release()
+
+			var keys []*dicomutil.Element
+			for keyTag, key := range tt.args.keys {
+				keys = append(keys, newTestKey(t, keyTag, key))
+			}
+
+			got, status, err := client.Move(tt.args.destination, tt.args.level, keys)
+			if err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Move() status = %v, want %v", status, tt.wantStatus)
+			}
+			if got != tt.want {
+				t.Errorf("Move() = %+v, want %+v", got, tt.want)
+			}
+
+			moved, _ := destinationIndex.Find(dicom.InstanceUIDs{})
+			if len(moved) != tt.wantMoved {
+				t.Errorf("Move() moved = %v, want %v", len(moved), tt.wantMoved)
+			}
+		})
+	}
+}
+
+// slowFileRepository a FileRepository taking the delay to create each file,
+// as a destination slow to store instances
+type slowFileRepository struct {
+	dicom.FileRepository
+	delay time.Duration
+}
+
+func (r slowFileRepository) Create(file dicom.File) error {
+	time.Sleep(r.delay)
+	return r.FileRepository.Create(file)
+}
+
+func TestServer_Move_slowDestination(t *testing.T) {
+	// each instance is stored well within the timeout, but the move as a
+	// whole takes longer, during which the requestor sends nothing
+	destinationIndex := dicom.NewMemoryIndex()
+	destinationAddress, _ := startTestServer(t,
+		UseAETitle("DESTINATION"),
+		UseFileRepository(slowFileRepository{
+			FileRepository: dicom.NewIndexedFileRepository(
+				dicom.NewMemoryFileAdapter(),
+				destinationIndex,
+			),
+			delay: 200 * time.Millisecond,
+		}),
+		UseMetadataIndex(destinationIndex),
+	)
+	host, port, _ := net.SplitHostPort(destinationAddress)
+
+	address, _ := startTestServer(t,
+		UseTimeout(400*time.Millisecond),
+		UseRemoteAEs(RemoteAE{AETitle: "DESTINATION", Host: host, Port: port}),
+	)
+	storeTestFiles(t, address)
+
+	client, err := Dial(address, "TESTSCP", RetrieveContexts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Release()
+
+	got, status, err := client.Move("DESTINATION", dicom.QueryLevelStudy, []*dicomutil.Element{
+		newTestKey(t, tag.StudyInstanceUID, "1"),
+	})
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if status != StatusSuccess || got != (Suboperations{Completed: 3}) {
+		t.Errorf("Move() = %+v, %v, want %+v, %v", got, status, Suboperations{Completed: 3}, StatusSuccess)
+	}
+
+	// the association remains usable once the move is complete
+	got, status, err = client.Move("DESTINATION", dicom.QueryLevelStudy, []*dicomutil.Element{
+		newTestKey(t, tag.StudyInstanceUID, "2"),
+	})
+	if err != nil || status != StatusSuccess || got != (Suboperations{Completed: 1}) {
+		t.Errorf("Move() = %+v, %v, %v, want %+v, %v", got, status, err, Suboperations{Completed: 1}, StatusSuccess)
+	}
+}
+
+func TestServer_Get(t *testing.T) {
+	type args struct {
+		scpRole bool
+		level   dicom.QueryLevel
+		keys    map[tag.Tag]string
+	}
+	tests := []struct {
+		name       string
+		args       args
+		want       Suboperations
+		wantStatus Status
+		wantUIDs   []string
+	}{
+		{
+			name: "gets a series",
+			args: args{
+				scpRole: true,
+				level:   dicom.QueryLevelSeries,
+				keys: map[tag.Tag]string{
+					tag.SeriesInstanceUID: "1.1",
+				},
+			},
+			want:       Suboperations{Completed: 2},
+			wantStatus: StatusSuccess,
+			wantUIDs:   []string{"1.1.1", "1.1.2"},
+		},
+		{
+			name: "gets an instance",
+			args: args{
+				scpRole: true,
+				level:   dicom.QueryLevelImage,
+				keys: map[tag.Tag]string{
+					tag.SOPInstanceUID: "2.1.1",
+				},
+			},
+			want:       Suboperations{Completed: 1},
+			wantStatus: StatusSuccess,
+			wantUIDs:   []string{"2.1.1"},
+		},
+		{
+			name: "fails sub-operations without the SCP role",
+			args: args{
+				level: dicom.QueryLevelStudy,
+				keys: map[tag.Tag]string{
+					tag.StudyInstanceUID: "2",
+				},
+			},
+			want:       Suboperations{Failed: 1},
+			wantStatus: StatusSuboperationsIncomplete,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, _ := startTestServer(t)
+			storeTestFiles(t, address)
+
+			contexts := append(RetrieveContexts(), PresentationContext{
+				AbstractSyntax:   testSOPClassUID,
+				TransferSyntaxes: []string{explicitVRLittleEndian},
+				SCPRole:          tt.args.scpRole,
+			})
+
+			client, err := Dial(address, "TESTSCP", contexts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Release()
+
+			var keys []*dicomutil.Element
+			for keyTag, key := range tt.args.keys {
+				keys = append(keys, newTestKey(t, keyTag, key))
+			}
+
+			var gotUIDs []string
+			got, status, err := client.Get(tt.args.level, keys, func(file *dicom.File) Status {
+				uids, err := file.UIDs()
+				if err != nil {
+					return StatusCannotUnderstand
+				}
+				gotUIDs = append(gotUIDs, uids.SOPInstanceUID)
+				return StatusSuccess
+			})
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("Get() status = %v, want %v", status, tt.wantStatus)
+			}
+			if got != tt.want {
+				t.Errorf("Get() = %+v, want %+v", got, tt.want)
+			}
+
+			sort.Strings(gotUIDs)
+			if !reflect.DeepEqual(gotUIDs, tt.wantUIDs) {
+				t.Errorf("Get() received = %v, want %v", gotUIDs, tt.wantUIDs)
+			}
+		})
+	}
+}
+
+// openFileRepository a FileRepository tracking the number of files open at
+// once, as each file opened would hold a file descriptor
+type openFileRepository struct {
+	dicom.FileRepository
+
+	mu      sync.Mutex
+	open    int
+	maxOpen int
+}
+
+func (r *openFileRepository) Get(id string) (*dicom.File, error) {
+	file, err := r.FileRepository.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file.Raw())
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.open++
+	r.maxOpen = max(r.maxOpen, r.open)
+
+	opened := dicom.NewFile(id, int64(len(data)), &openFileContents{Reader: bytes.NewReader(data), repository: r})
+	return &opened, nil
+}
+
+// openFileContents the contents of a file opened from an openFileRepository
+type openFileContents struct {
+	*bytes.Reader
+	repository *openFileRepository
+}
+
+func (c *openFileContents) Close() error {
+	c.repository.mu.Lock()
+	defer c.repository.mu.Unlock()
+
+	c.repository.open--
+	return nil
+}
+
+func TestServer_retrieve_openFiles(t *testing.T) {
+	destinationAddress, _ := startTestServer(t, UseAETitle("DESTINATION"))
+	host, port, _ := net.SplitHostPort(destinationAddress)
+
+	index := dicom.NewMemoryIndex()
+	repository := &openFileRepository{
+		FileRepository: dicom.NewIndexedFileRepository(
+			dicom.NewMemoryFileAdapter(),
+			index,
+		),
+	}
+	address, _ := startTestServer(t,
+		UseFileRepository(repository),
+		UseMetadataIndex(index),
+		UseRemoteAEs(RemoteAE{AETitle: "DESTINATION", Host: host, Port: port}),
+	)
+	storeTestFiles(t, address)
+
+	contexts := append(RetrieveContexts(), PresentationContext{
+		AbstractSyntax:   testSOPClassUID,
+		TransferSyntaxes: []string{explicitVRLittleEndian},
+		SCPRole:          true,
+	})
+	client, err := Dial(address, "TESTSCP", contexts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Release()
+
+	keys := []*dicomutil.Element{newTestKey(t, tag.StudyInstanceUID, "1")}
+	if got, _, err := client.Move("DESTINATION", dicom.QueryLevelStudy, keys); err != nil || got.Completed != 3 {
+		t.Fatalf("Move() = %+v, %v", got, err)
+	}
+	if got, _, err := client.Get(dicom.QueryLevelStudy, keys, func(file *dicom.File) Status {
+		return StatusSuccess
+	}); err != nil || got.Completed != 3 {
+		t.Fatalf("Get() = %+v, %v", got, err)
+	}
+
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	// files are opened one at a time, as each is sent
+	if repository.maxOpen != 1 {
+		t.Errorf("retrieve() opened %v files at once, want 1", repository.maxOpen)
+	}
+	if repository.open != 0 {
+		t.Errorf("retrieve() left %v files open", repository.open)
+	}
+}
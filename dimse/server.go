@@ -0,0 +1,372 @@
+package dimse
+
+import (
+	"dicomviewer/dicom"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+const (
+	// DefaultPort the port registered for DICOM upper layer communication
+	DefaultPort = "11112"
+
+	// DefaultAETitle the default application entity title of the server
+	DefaultAETitle = "DICOMVIEWER"
+
+	// defaultTimeout the default maximum time to wait for each PDU from a
+	// remote AE
+	defaultTimeout = 60 * time.Second
+)
+
+// Server a DIMSE service class provider (SCP), accepting associations from
+// remote AEs over the DICOM upper layer protocol
+type Server struct {
+	fileRepository  dicom.FileRepository
+	metadataIndex   dicom.MetadataIndex
+	duplicatePolicy dicom.DuplicatePolicy
+
+	aeTitle string
+	port    string
+	timeout time.Duration
+
+	// remoteAEs the known remote AEs by AE title, which instances may be
+	// sent to via C-MOVE
+	remoteAEs map[string]RemoteAE
+}
+
+// ServerOptions options when instantiating a server
+type ServerOptions struct {
+	aeTitle         string
+	port            string
+	timeout         time.Duration
+	fileRepository  dicom.FileRepository
+	metadataIndex   dicom.MetadataIndex
+	duplicatePolicy dicom.DuplicatePolicy
+	remoteAEs       []RemoteAE
+}
+
+// UsePort option to specify a port for the server to listen on
+func UsePort(port string) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.port = port
+	}
+}
+
+// UseAETitle option to specify the AE title of the server. Associations
+// requested for other AE titles are rejected
+func UseAETitle(aeTitle string) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.aeTitle = aeTitle
+	}
+}
+
+// UseTimeout option to specify the maximum time to wait for each PDU from a
+// remote AE before closing the association
+func UseTimeout(timeout time.Duration) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// UseFileRepository option to specify the repository received instances are
+// stored in
+func UseFileRepository(fileRepository dicom.FileRepository) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.fileRepository = fileRepository
+	}
+}
+
+// UseMetadataIndex option to specify the index queried via C-FIND. The index
+// should be that of the file repository, so received instances can be found
+func UseMetadataIndex(metadataIndex dicom.MetadataIndex) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.metadataIndex = metadataIndex
+	}
+}
+
+// UseDuplicatePolicy option to specify the policy applied to received
+// instances duplicating a stored file. Defaults to keeping both files
+func UseDuplicatePolicy(policy dicom.DuplicatePolicy) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.duplicatePolicy = policy
+	}
+}
+
+// UseRemoteAEs option to specify the known remote AEs, which instances may be
+// sent to via C-MOVE. C-MOVE requests to any other destination are refused
+func UseRemoteAEs(remoteAEs ...RemoteAE) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.remoteAEs = append(opts.remoteAEs, remoteAEs...)
+	}
+}
+
+// NewServer constructs a new DIMSE server
+func NewServer(options ...func(opts *ServerOptions)) *Server {
+	var opts = ServerOptions{
+		aeTitle:         DefaultAETitle,
+		port:            DefaultPort,
+		timeout:         defaultTimeout,
+		duplicatePolicy: dicom.DuplicateKeepBoth,
+	}
+
+	for _, optFn := range options {
+		optFn(&opts)
+	}
+
+	if opts.metadataIndex == nil {
+		opts.metadataIndex = dicom.NewMemoryIndex()
+	}
+
+	if opts.fileRepository == nil {
+		localFileRepository := dicom.NewLocalFileAdapter()
+		if err := dicom.RebuildIndex(localFileRepository, opts.metadataIndex); err != nil {
+			slog.Error(fmt.Sprintf("failed to index existing files: %s", err))
+		}
+
+		opts.fileRepository = dicom.NewIndexedFileRepository(
+			localFileRepository,
+			opts.metadataIndex,
+		)
+	}
+
+	remoteAEs := make(map[string]RemoteAE, len(opts.remoteAEs))
+	for _, remoteAE := range opts.remoteAEs {
+		remoteAEs[remoteAE.AETitle] = remoteAE
+	}
+
+	return &Server{
+		fileRepository:  opts.fileRepository,
+		metadataIndex:   opts.metadataIndex,
+		duplicatePolicy: opts.duplicatePolicy,
+		aeTitle:         opts.aeTitle,
+		port:            opts.port,
+		timeout:         opts.timeout,
+		remoteAEs:       remoteAEs,
+	}
+}
+
+// ListenAndServe listens on the server's port and serves associations
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", s.port))
+	if err != nil {
+		return err
+	}
+
+	slog.Info(fmt.Sprintf("-- Starting DICOM Server %s on Port %s --", s.aeTitle, s.port))
+	return s.Serve(listener)
+}
+
+// Serve serves associations requested on connections accepted by the
+// listener, each in its own goroutine
+func (s *Server) Serve(listener net.Listener) error {
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn utility to negotiate an association on the connection and serve
+// the requests made over it until it is released or aborted
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	assoc, err := s.negotiate(conn)
+	if err != nil {
+		slog.Error(fmt.Sprintf("association from %s failed: %s", conn.RemoteAddr(), err))
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	assoc.incoming = make(chan received)
+	go assoc.receive(done)
+
+	for r := range assoc.incoming {
+		if r.err != nil {
+			if !errors.Is(r.err, errReleased) && !errors.Is(r.err, io.EOF) {
+				slog.Error(fmt.Sprintf("association with %s failed: %s", assoc.remoteAETitle, r.err))
+			}
+			return
+		}
+
+		// the remote AE may be silent for as long as the request takes, as for
+		// the sub-operations of C-MOVE, so it is not held to the timeout
+		assoc.serving(true)
+		err := s.handle(assoc, r.msg)
+		assoc.serving(false)
+		if err != nil {
+			slog.Error(fmt.Sprintf("association with %s failed: %s", assoc.remoteAETitle, err))
+			assoc.abort(abortSourceServiceProvider, abortReasonUnexpectedPDU)
+			return
+		}
+	}
+}
+
+// handle utility to dispatch a request to the service handling it
+func (s *Server) handle(assoc *association, msg message) error {
+	switch msg.command.field {
+	case commandCStoreRequest:
+		return s.handleStore(assoc, msg)
+	case commandCFindRequest:
+		return s.handleFind(assoc, msg)
+	case commandCMoveRequest:
+		return s.handleMove(assoc, msg)
+	case commandCGetRequest:
+		return s.handleGet(assoc, msg)
+	case commandCEchoRequest:
+		return s.handleEcho(assoc, msg)
+	case commandCCancelRequest:
+		// the request has already completed, so there is nothing to cancel
+		return nil
+	default:
+		if msg.command.isResponse() {
+			return fmt.Errorf("%w: unexpected response 0x%04X", errUnexpectedPDU, msg.command.field)
+		}
+
+		return assoc.writeMessage(message{
+			contextID: msg.contextID,
+			command: command{
+				field:                msg.command.field | responseBit,
+				messageIDRespondedTo: msg.command.messageID,
+				affectedSOPClassUID:  msg.command.affectedSOPClassUID,
+				status:               StatusUnrecognizedOperation,
+			},
+		})
+	}
+}
+
+// negotiate utility to negotiate an association requested on the connection.
+// Presentation contexts are accepted if this server supports their abstract
+// syntax and any of their transfer syntaxes
+func (s *Server) negotiate(conn net.Conn) (*association, error) {
+	assoc := &association{
+		conn:           conn,
+		localAETitle:   s.aeTitle,
+		timeout:        s.timeout,
+		contexts:       make(map[byte]presentationContext),
+		remoteSCPRoles: make(map[string]bool),
+	}
+
+	p, err := assoc.readPDU()
+	if err != nil {
+		return nil, err
+	}
+
+	request, ok := p.(*associate)
+	if !ok || request.accept {
+		assoc.abort(abortSourceServiceProvider, abortReasonUnexpectedPDU)
+		return nil, errUnexpectedPDU
+	}
+	assoc.remoteAETitle = request.callingAETitle
+	assoc.maxPDULength = request.userInformation.maxPDULength
+
+	reject := func(source byte, reason byte, err error) (*association, error) {
+		assoc.writePDU(&associateReject{
+			result: rejectResultPermanent,
+			source: source,
+			reason: reason,
+		})
+		return nil, err
+	}
+
+	switch {
+	case request.protocolVersion&protocolVersion == 0:
+		return reject(rejectSourceServiceProviderACSE, rejectReasonProtocolVersionUnsupported,
+			fmt.Errorf("unsupported protocol version %d", request.protocolVersion))
+	case request.applicationContext != applicationContextName:
+		return reject(rejectSourceServiceUser, rejectReasonApplicationContextUnsupported,
+			fmt.Errorf("unsupported application context %s", request.applicationContext))
+	case request.calledAETitle != s.aeTitle:
+		return reject(rejectSourceServiceUser, rejectReasonCalledAETitleUnrecognized,
+			fmt.Errorf("unrecognized called AE title %s", request.calledAETitle))
+	}
+
+	accept := &associate{
+		accept:             true,
+		calledAETitle:      request.calledAETitle,
+		callingAETitle:     request.callingAETitle,
+		applicationContext: applicationContextName,
+		userInformation: userInformation{
+			maxPDULength:              defaultMaxPDULength,
+			implementationClassUID:    implementationClassUID,
+			implementationVersionName: implementationVersionName,
+		},
+	}
+
+	for _, proposed := range request.presentationContexts {
+		pc := presentationContext{
+			id:             proposed.id,
+			abstractSyntax: proposed.abstractSyntax,
+			result:         presentationContextAbstractSyntaxUnsupported,
+		}
+
+		if supported := s.transferSyntaxes(proposed.abstractSyntax); supported != nil {
+			pc.result = presentationContextTransferSyntaxUnsupported
+			if transferSyntax, ok := negotiateTransferSyntax(proposed.transferSyntaxes, supported); ok {
+				pc.result = presentationContextAccepted
+				pc.transferSyntaxes = []string{transferSyntax}
+				assoc.contexts[pc.id] = pc
+			}
+		}
+
+		accept.presentationContexts = append(accept.presentationContexts, pc)
+	}
+
+	// the remote AE may take the SCP role for storage SOP classes, so that
+	// instances may be sent to it via C-GET
+	for _, role := range request.userInformation.roleSelections {
+		if !isStorageSOPClass(role.sopClassUID) {
+			continue
+		}
+
+		assoc.remoteSCPRoles[role.sopClassUID] = role.scp
+		accept.userInformation.roleSelections = append(accept.userInformation.roleSelections, role)
+	}
+
+	if err := assoc.writePDU(accept); err != nil {
+		return nil, err
+	}
+
+	return assoc, nil
+}
+
+// transferSyntaxes utility to determine the transfer syntaxes supported for
+// an abstract syntax, or nil if the abstract syntax is not supported
+func (s *Server) transferSyntaxes(abstractSyntax string) []string {
+	switch {
+	case isStorageSOPClass(abstractSyntax):
+		return storageTransferSyntaxes
+	case abstractSyntax == verificationSOPClass:
+		return uncompressedTransferSyntaxes
+	case queryLevels[abstractSyntax] != nil:
+		return uncompressedTransferSyntaxes
+	default:
+		return nil
+	}
+}
+
+// negotiateTransferSyntax utility to choose a transfer syntax for a
+// presentation context. Supported transfer syntaxes are preferred in the
+// order proposed
+func negotiateTransferSyntax(proposed []string, supported []string) (string, bool) {
+	for _, transferSyntax := range proposed {
+		for _, supportedTransferSyntax := range supported {
+			if transferSyntax == supportedTransferSyntax {
+				return transferSyntax, true
+			}
+		}
+	}
+
+	return "", false
+}
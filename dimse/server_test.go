@@ -0,0 +1,238 @@
+package dimse
+
+import (
+	"bytes"
+	"dicomviewer/dicom"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+const testSOPClassUID = "1.2.840.10008.5.1.4.1.1.7"
+
+// newTestFile utility to encode a DICOM file for testing, with a bulk data
+// element of the given size
+func newTestFile(t *testing.T, studyUID, seriesUID, sopUID string, bulkSize int) *dicom.File {
+	t.Helper()
+
+	newElement := func(elementTag tag.Tag, data interface{}) *dicomutil.Element {
+		element, err := dicomutil.NewElement(elementTag, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return element
+	}
+
+	var buffer bytes.Buffer
+	err := dicomutil.Write(&buffer, dicomutil.Dataset{
+		Elements: []*dicomutil.Element{
+			newElement(tag.MediaStorageSOPClassUID, []string{testSOPClassUID}),
+			newElement(tag.MediaStorageSOPInstanceUID, []string{sopUID}),
+			newElement(tag.TransferSyntaxUID, []string{explicitVRLittleEndian}),
+			newElement(tag.SOPClassUID, []string{testSOPClassUID}),
+			newElement(tag.SOPInstanceUID, []string{sopUID}),
+			newElement(tag.Modality, []string{"OT"}),
+			newElement(tag.PatientName, []string{"DOE^" + studyUID}),
+			newElement(tag.PatientID, []string{"PID" + studyUID}),
+			newElement(tag.StudyDate, []string{"2024030" + studyUID}),
+			newElement(tag.StudyInstanceUID, []string{studyUID}),
+			newElement(tag.SeriesInstanceUID, []string{seriesUID}),
+			newElement(tag.EncapsulatedDocument, make([]byte, bulkSize)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := dicom.NewFile(sopUID, int64(buffer.Len()), bytes.NewReader(buffer.Bytes()))
+	return &file
+}
+
+func Test_readFile(t *testing.T) {
+	file := newTestFile(t, "1", "1.1", "1.1.1", 16)
+
+	meta, dataSet, err := readFile(file)
+	if err != nil {
+		t.Fatalf("readFile() error = %v", err)
+	}
+
+	want := fileMeta{
+		sopClassUID:       testSOPClassUID,
+		sopInstanceUID:    "1.1.1",
+		transferSyntaxUID: explicitVRLittleEndian,
+	}
+	if meta != want {
+		t.Errorf("readFile() meta = %+v, want %+v", meta, want)
+	}
+
+	// the dataset read follows the file meta information, so a file encoded
+	// with it is equivalent to the original
+	data, err := io.ReadAll(dataSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := append(encodePart10Header(meta, ""), data...)
+	decoded := dicom.NewFile("decoded", int64(len(encoded)), bytes.NewReader(encoded))
+	uids, err := decoded.UIDs()
+	if err != nil {
+		t.Fatalf("File.UIDs() of re-encoded file error = %v", err)
+	}
+	if uids.SOPInstanceUID != "1.1.1" || uids.SeriesInstanceUID != "1.1" {
+		t.Errorf("File.UIDs() of re-encoded file = %+v", uids)
+	}
+
+	malformed := dicom.NewFile("malformed", 4, bytes.NewReader([]byte("DICM")))
+	if _, _, err := readFile(&malformed); !errors.Is(err, errMalformedFile) {
+		t.Errorf("readFile() error = %v, want %v", err, errMalformedFile)
+	}
+}
+
+// startTestServer utility to start a server listening on loopback, returning
+// its address and the index of the files it stores
+func startTestServer(t *testing.T, options ...func(opts *ServerOptions)) (string, dicom.MetadataIndex) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	index := dicom.NewMemoryIndex()
+	server := NewServer(append([]func(opts *ServerOptions){
+		UseAETitle("TESTSCP"),
+		UseFileRepository(dicom.NewIndexedFileRepository(
+			dicom.NewMemoryFileAdapter(),
+			index,
+		)),
+		UseMetadataIndex(index),
+	}, options...)...)
+	go server.Serve(listener)
+
+	return listener.Addr().String(), index
+}
+
+func TestServer_Store(t *testing.T) {
+	malformedFile := func() *dicom.File {
+		data := append(encodePart10Header(fileMeta{
+			sopClassUID:       testSOPClassUID,
+			sopInstanceUID:    "1.1.2",
+			transferSyntaxUID: explicitVRLittleEndian,
+		}, ""), []byte("not a dataset")...)
+		file := dicom.NewFile("malformed", int64(len(data)), bytes.NewReader(data))
+		return &file
+	}
+
+	type args struct {
+		calledAETitle string
+		files         []*dicom.File
+		options       []func(opts *ServerOptions)
+	}
+	tests := []struct {
+		name        string
+		args        args
+		want        []Status
+		wantIndexed int
+		wantErr     error
+	}{
+		{
+			name: "stores instances",
+			args: args{
+				calledAETitle: "TESTSCP",
+				files: []*dicom.File{
+					newTestFile(t, "1", "1.1", "1.1.1", 16),
+					newTestFile(t, "1", "1.2", "1.2.1", 16),
+				},
+			},
+			want:        []Status{StatusSuccess, StatusSuccess},
+			wantIndexed: 2,
+		},
+		{
+			name: "stores instances spanning many PDUs",
+			args: args{
+				calledAETitle: "TESTSCP",
+				files: []*dicom.File{
+					newTestFile(t, "1", "1.1", "1.1.1", 300000),
+				},
+			},
+			want:        []Status{StatusSuccess},
+			wantIndexed: 1,
+		},
+		{
+			name: "rejects duplicate instances",
+			args: args{
+				calledAETitle: "TESTSCP",
+				files: []*dicom.File{
+					newTestFile(t, "1", "1.1", "1.1.1", 16),
+					newTestFile(t, "1", "1.1", "1.1.1", 16),
+				},
+				options: []func(opts *ServerOptions){
+					UseDuplicatePolicy(dicom.DuplicateReject),
+				},
+			},
+			want:        []Status{StatusSuccess, StatusDuplicateSOPInstance},
+			wantIndexed: 1,
+		},
+		{
+			name: "fails to store malformed instances",
+			args: args{
+				calledAETitle: "TESTSCP",
+				files: []*dicom.File{
+					malformedFile(),
+				},
+			},
+			want: []Status{StatusCannotUnderstand},
+		},
+		{
+			name: "rejects associations for other AE titles",
+			args: args{
+				calledAETitle: "OTHERSCP",
+				files: []*dicom.File{
+					newTestFile(t, "1", "1.1", "1.1.1", 16),
+				},
+			},
+			wantErr: ErrAssociationRejected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, index := startTestServer(t, tt.args.options...)
+
+			contexts, err := StorageContexts(tt.args.files...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client, err := Dial(address, tt.args.calledAETitle, contexts, UseCallingAETitle("TESTSCU"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Dial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			for idx, file := range tt.args.files {
+				got, err := client.Store(file)
+				if err != nil {
+					t.Fatalf("Store() error = %v", err)
+				}
+				if got != tt.want[idx] {
+					t.Errorf("Store() = %v, want %v", got, tt.want[idx])
+				}
+			}
+
+			if err := client.Release(); err != nil {
+				t.Errorf("Release() error = %v", err)
+			}
+
+			indexed, _ := index.Find(dicom.InstanceUIDs{})
+			if len(indexed) != tt.wantIndexed {
+				t.Errorf("Store() indexed = %v, want %v", len(indexed), tt.wantIndexed)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package dimse
+
+import "fmt"
+
+// Status the status of a DIMSE response. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part07/chapter_C.html
+type Status uint16
+
+const (
+	StatusSuccess                     Status = 0x0000
+	StatusPending                     Status = 0xFF00
+	StatusCancel                      Status = 0xFE00
+	StatusProcessingFailure           Status = 0x0110
+	StatusDuplicateSOPInstance        Status = 0x0111
+	StatusSOPClassNotSupported        Status = 0x0122
+	StatusUnrecognizedOperation       Status = 0x0211
+	StatusOutOfResources              Status = 0xA700
+	StatusOutOfResourcesMatches       Status = 0xA701
+	StatusOutOfResourcesSuboperations Status = 0xA702
+	StatusMoveDestinationUnknown      Status = 0xA801
+	StatusIdentifierMismatch          Status = 0xA900
+	StatusSuboperationsIncomplete     Status = 0xB000
+	StatusCannotUnderstand            Status = 0xC000
+)
+
+// IsSuccess determines whether the status indicates success
+func (s Status) IsSuccess() bool {
+	return s == StatusSuccess
+}
+
+// IsPending determines whether the status indicates further responses will
+// follow
+func (s Status) IsPending() bool {
+	return s == StatusPending || s == 0xFF01
+}
+
+// IsWarning determines whether the status indicates success with warnings
+func (s Status) IsWarning() bool {
+	return s == 0x0001 || s == 0x0107 || s == 0x0116 || s&0xF000 == 0xB000
+}
+
+// IsFailure determines whether the status indicates failure
+func (s Status) IsFailure() bool {
+	return !s.IsSuccess() && !s.IsPending() && !s.IsWarning() && s != StatusCancel
+}
+
+func (s Status) String() string {
+	return fmt.Sprintf("0x%04X", uint16(s))
+}
@@ -0,0 +1,216 @@
+package dimse
+
+import (
+	"bytes"
+	"dicomviewer/dicom"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	// part10PreambleLength length of the preamble of a DICOM file, preceding
+	// the DICM prefix
+	part10PreambleLength = 128
+
+	// part10Prefix the prefix identifying a DICOM file
+	part10Prefix = "DICM"
+
+	// maxMetaValueLength the maximum length of the UID values read from file
+	// meta information
+	maxMetaValueLength = 64
+)
+
+// Tags of file meta information elements, all within group 0002
+const (
+	metaGroupLength                uint16 = 0x0000
+	metaFileMetaInformationVersion uint16 = 0x0001
+	metaMediaStorageSOPClassUID    uint16 = 0x0002
+	metaMediaStorageSOPInstanceUID uint16 = 0x0003
+	metaTransferSyntaxUID          uint16 = 0x0010
+	metaImplementationClassUID     uint16 = 0x0012
+	metaImplementationVersionName  uint16 = 0x0013
+	metaSourceApplicationEntity    uint16 = 0x0016
+)
+
+var (
+	// errMalformedFile error indicating a DICOM file's preamble or file meta
+	// information could not be read
+	errMalformedFile = errors.New("malformed DICOM file meta information")
+)
+
+// fileMeta the file meta information of a DICOM file identifying the instance
+// it holds and the transfer syntax of its dataset
+type fileMeta struct {
+	sopClassUID       string
+	sopInstanceUID    string
+	transferSyntaxUID string
+}
+
+// handleStore utility to handle a C-STORE request by storing the received
+// instance in the file repository, applying the duplicate policy of the server
+// to instances duplicating a stored file
+func (s *Server) handleStore(assoc *association, msg message) error {
+	response := command{
+		field:                  commandCStoreResponse,
+		messageIDRespondedTo:   msg.command.messageID,
+		affectedSOPClassUID:    msg.command.affectedSOPClassUID,
+		affectedSOPInstanceUID: msg.command.affectedSOPInstanceUID,
+		status:                 StatusSuccess,
+	}
+
+	file := msg.file
+	defer file.Close()
+
+	if _, err := dicom.IngestFile(s.fileRepository, s.metadataIndex, *file, s.duplicatePolicy); err != nil {
+		slog.Error(fmt.Sprintf("failed to store instance %s from %s: %s",
+			msg.command.affectedSOPInstanceUID, assoc.remoteAETitle, err))
+
+		switch {
+		case errors.Is(err, dicom.ErrDuplicateFile):
+			response.status = StatusDuplicateSOPInstance
+		case errors.Is(err, dicom.ErrInvalidFile):
+			response.status = StatusCannotUnderstand
+		default:
+			response.status = StatusOutOfResources
+		}
+		response.errorComment = truncate(err.Error(), 64)
+	}
+
+	return assoc.writeMessage(message{
+		contextID: msg.contextID,
+		command:   response,
+	})
+}
+
+// encodePart10Header utility to encode the preamble and file meta information
+// of a DICOM file holding a dataset received over the network
+func encodePart10Header(meta fileMeta, sourceAETitle string) []byte {
+	var elements bytes.Buffer
+	writeMetaElement(&elements, metaFileMetaInformationVersion, "OB", []byte{0x00, 0x01})
+	writeMetaElement(&elements, metaMediaStorageSOPClassUID, "UI", encodeUID(meta.sopClassUID))
+	writeMetaElement(&elements, metaMediaStorageSOPInstanceUID, "UI", encodeUID(meta.sopInstanceUID))
+	writeMetaElement(&elements, metaTransferSyntaxUID, "UI", encodeUID(meta.transferSyntaxUID))
+	writeMetaElement(&elements, metaImplementationClassUID, "UI", encodeUID(implementationClassUID))
+	writeMetaElement(&elements, metaImplementationVersionName, "SH", encodeString(implementationVersionName))
+	if sourceAETitle != "" {
+		writeMetaElement(&elements, metaSourceApplicationEntity, "AE", encodeString(sourceAETitle))
+	}
+
+	groupLength := make([]byte, 4)
+	binary.LittleEndian.PutUint32(groupLength, uint32(elements.Len()))
+
+	var buffer bytes.Buffer
+	buffer.Write(make([]byte, part10PreambleLength))
+	buffer.WriteString(part10Prefix)
+	writeMetaElement(&buffer, metaGroupLength, "UL", groupLength)
+	buffer.Write(elements.Bytes())
+
+	return buffer.Bytes()
+}
+
+// decodePart10 utility to read the file meta information of a DICOM file,
+// returning a reader of the dataset following it. Only the file meta
+// information is read, so the dataset may be streamed
+func decodePart10(raw io.ReadSeeker) (fileMeta, io.Reader, error) {
+	prefix := make([]byte, part10PreambleLength+len(part10Prefix))
+	if _, err := io.ReadFull(raw, prefix); err != nil ||
+		string(prefix[part10PreambleLength:]) != part10Prefix {
+		return fileMeta{}, nil, errMalformedFile
+	}
+	offset := int64(len(prefix))
+
+	var meta fileMeta
+	header := make([]byte, 12)
+	for {
+		// the dataset starts at the first element outside of group 0002
+		if _, err := io.ReadFull(raw, header[:8]); err != nil ||
+			binary.LittleEndian.Uint16(header[0:2]) != 0x0002 {
+			break
+		}
+		element := binary.LittleEndian.Uint16(header[2:4])
+		vr := string(header[4:6])
+
+		// file meta information is always explicit VR little endian
+		var length uint32
+		headerLength := int64(8)
+		switch vr {
+		case "OB", "OD", "OF", "OL", "OW", "SQ", "UC", "UN", "UR", "UT":
+			if _, err := io.ReadFull(raw, header[8:12]); err != nil {
+				return fileMeta{}, nil, errMalformedFile
+			}
+			length = binary.LittleEndian.Uint32(header[8:12])
+			headerLength = 12
+		default:
+			length = uint32(binary.LittleEndian.Uint16(header[6:8]))
+		}
+
+		var target *string
+		switch element {
+		case metaMediaStorageSOPClassUID:
+			target = &meta.sopClassUID
+		case metaMediaStorageSOPInstanceUID:
+			target = &meta.sopInstanceUID
+		case metaTransferSyntaxUID:
+			target = &meta.transferSyntaxUID
+		}
+
+		if target != nil {
+			if length > maxMetaValueLength {
+				return fileMeta{}, nil, errMalformedFile
+			}
+			value := make([]byte, length)
+			if _, err := io.ReadFull(raw, value); err != nil {
+				return fileMeta{}, nil, errMalformedFile
+			}
+			*target = decodeString(value)
+		} else if _, err := raw.Seek(int64(length), io.SeekCurrent); err != nil {
+			return fileMeta{}, nil, errMalformedFile
+		}
+
+		offset += headerLength + int64(length)
+	}
+
+	if meta.sopClassUID == "" || meta.sopInstanceUID == "" || meta.transferSyntaxUID == "" {
+		return fileMeta{}, nil, errMalformedFile
+	}
+
+	if _, err := raw.Seek(offset, io.SeekStart); err != nil {
+		return fileMeta{}, nil, err
+	}
+
+	return meta, raw, nil
+}
+
+// writeMetaElement utility to encode an element of group 0002 in the explicit
+// VR little endian transfer syntax
+func writeMetaElement(buffer *bytes.Buffer, element uint16, vr string, value []byte) {
+	binary.Write(buffer, binary.LittleEndian, uint16(0x0002))
+	binary.Write(buffer, binary.LittleEndian, element)
+	buffer.WriteString(vr)
+	if vr == "OB" {
+		buffer.Write([]byte{0, 0})
+		binary.Write(buffer, binary.LittleEndian, uint32(len(value)))
+	} else {
+		binary.Write(buffer, binary.LittleEndian, uint16(len(value)))
+	}
+	buffer.Write(value)
+}
+
+// readFile utility to read the file meta information of a file in the
+// repository, returning a reader streaming its dataset
+func readFile(file *dicom.File) (fileMeta, io.Reader, error) {
+	return decodePart10(file.Raw())
+}
+
+// truncate utility to truncate a string to a maximum length
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+
+	return strings.TrimSpace(value[:length])
+}
@@ -0,0 +1,78 @@
+package dimse
+
+import "strings"
+
+const (
+	// applicationContextName the DICOM application context, the only
+	// application context defined by the standard
+	applicationContextName = "1.2.840.10008.3.1.1.1"
+
+	// implementationClassUID identifies this implementation to remote AEs
+	// during association negotiation and in the file meta information of
+	// received instances
+	implementationClassUID = "2.25.333017699060706774526265402978941174326"
+
+	// implementationVersionName the version of this implementation
+	implementationVersionName = "DICOMVIEWER"
+
+	// storageSOPClassPrefix the prefix shared by the UIDs of storage SOP
+	// classes
+	storageSOPClassPrefix = "1.2.840.10008.5.1.4.1.1."
+)
+
+// SOP classes of the verification and query/retrieve services. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part04/sect_B.5.html
+const (
+	verificationSOPClass = "1.2.840.10008.1.1"
+	patientRootFind      = "1.2.840.10008.5.1.4.1.2.1.1"
+	patientRootMove      = "1.2.840.10008.5.1.4.1.2.1.2"
+	patientRootGet       = "1.2.840.10008.5.1.4.1.2.1.3"
+	studyRootFind        = "1.2.840.10008.5.1.4.1.2.2.1"
+	studyRootMove        = "1.2.840.10008.5.1.4.1.2.2.2"
+	studyRootGet         = "1.2.840.10008.5.1.4.1.2.2.3"
+)
+
+// Transfer syntaxes. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part06/chapter_A.html
+const (
+	implicitVRLittleEndian = "1.2.840.10008.1.2"
+	explicitVRLittleEndian = "1.2.840.10008.1.2.1"
+	jpegBaseline           = "1.2.840.10008.1.2.4.50"
+	jpegExtended           = "1.2.840.10008.1.2.4.51"
+	jpegLossless           = "1.2.840.10008.1.2.4.57"
+	jpegLosslessFirstOrder = "1.2.840.10008.1.2.4.70"
+	jpegLSLossless         = "1.2.840.10008.1.2.4.80"
+	jpegLSNearLossless     = "1.2.840.10008.1.2.4.81"
+	jpeg2000Lossless       = "1.2.840.10008.1.2.4.90"
+	jpeg2000               = "1.2.840.10008.1.2.4.91"
+	rleLossless            = "1.2.840.10008.1.2.5"
+)
+
+// uncompressedTransferSyntaxes transfer syntaxes of uncompressed datasets, in
+// order of preference
+var uncompressedTransferSyntaxes = []string{
+	explicitVRLittleEndian,
+	implicitVRLittleEndian,
+}
+
+// storageTransferSyntaxes transfer syntaxes accepted for storage. Received
+// instances are stored as is, so compressed transfer syntaxes are accepted
+// alongside uncompressed ones
+var storageTransferSyntaxes = append(
+	append([]string{}, uncompressedTransferSyntaxes...),
+	jpegBaseline,
+	jpegExtended,
+	jpegLossless,
+	jpegLosslessFirstOrder,
+	jpegLSLossless,
+	jpegLSNearLossless,
+	jpeg2000Lossless,
+	jpeg2000,
+	rleLossless,
+)
+
+// isStorageSOPClass utility to determine whether a SOP class is a storage SOP
+// class, i.e. identifies instances that may be stored via C-STORE
+func isStorageSOPClass(sopClassUID string) bool {
+	return strings.HasPrefix(sopClassUID, storageSOPClassPrefix)
+}
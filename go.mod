@@ -5,6 +5,7 @@ go 1.22.2
 require (
 	github.com/go-chi/chi/v5 v5.0.12
 	github.com/google/uuid v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/suyashkumar/dicom v1.0.7
 )
 
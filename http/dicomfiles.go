@@ -1,47 +1,85 @@
 package http
 
 import (
+	"context"
 	"dicomviewer/dicom"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"image/png"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
 	dicomutil "github.com/suyashkumar/dicom"
-	"github.com/suyashkumar/dicom/pkg/tag"
 )
 
 const tagQueryParamKey = "tag"
 
+// headerTotalCount the header holding the total number of results, where the
+// response body has no room for it
+const headerTotalCount = "X-Total-Count"
+
+// Page sizes when listing DICOM files
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
 // dicomRecords contains a set of http handlers for managing DICOM files
 type dicomFiles struct {
-	fileRepository dicom.FileRepository
+	fileRepository  dicom.FileRepository
+	metadataIndex   dicom.MetadataIndex
+	pseudonymizer   *dicom.Pseudonymizer
+	redactTemplates []dicom.RedactTemplate
+	duplicatePolicy dicom.DuplicatePolicy
 }
 
-// Get an http handler to retrieve a raw DICOM file
+// GetAll an http handler to list DICOM files a page at a time, sorted and
+// filtered by their indexed attributes
 func (f *dicomFiles) GetAll(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	fileIDs, err := f.fileRepository.GetAll()
+	query, err := f.parseListQuery(r.URL.Query())
 	if err != nil {
 		slog.ErrorContext(ctx, err.Error())
 		writeJSONError(w, http.StatusBadRequest, err)
 		return
 	}
 
+	result, err := f.metadataIndex.List(query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, dicom.ErrInvalidCursor) {
+			status = http.StatusBadRequest
+		}
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, status, err)
+		return
+	}
+
 	type Response struct {
-		FileIDs []string `json:"fileIds"`
+		FileIDs    []string `json:"fileIds"`
+		NextCursor string   `json:"nextCursor,omitempty"`
+		Total      int      `json:"total"`
 	}
 
-	writeJSONResponse(w, Response{
-		FileIDs: fileIDs,
-	})
+	response := Response{
+		FileIDs: make([]string, 0, len(result.Instances)),
+		Total:   result.Total,
+	}
+	for _, instance := range result.Instances {
+		response.FileIDs = append(response.FileIDs, instance.FileID)
+	}
+	if result.NextCursor != nil {
+		response.NextCursor = result.NextCursor.String()
+	}
+
+	writeJSONResponse(w, response)
 }
 
 // Get an http handler to retrieve a raw DICOM file
@@ -61,6 +99,7 @@ func (f *dicomFiles) GetByID(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, httpStatus, err)
 		return
 	}
+	defer file.Close()
 
 	http.ServeContent(w, r, file.ID, time.Now(), file.Raw())
 }
@@ -76,11 +115,11 @@ func (f *dicomFiles) GetAsPNG(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shouldRemap, err := strconv.ParseBool(
-		r.URL.Query().Get("remap"),
-	)
+	pngOptions, err := f.parsePNGQuery(r.URL.Query())
 	if err != nil {
-		shouldRemap = true
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
 	}
 
 	file, httpStatus, err := f.getFile(fileID)
@@ -89,8 +128,9 @@ func (f *dicomFiles) GetAsPNG(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, httpStatus, err)
 		return
 	}
+	defer file.Close()
 
-	image, err := file.PNG(dicom.PNGRemapPixels(shouldRemap))
+	image, err := file.PNG(pngOptions...)
 	if err != nil {
 		slog.ErrorContext(ctx, err.Error())
 		writeJSONError(w, http.StatusInternalServerError, err)
@@ -105,8 +145,168 @@ func (f *dicomFiles) GetAsPNG(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetFrames an http handler to retrieve the frame count and per-frame
+// metadata of a DICOM file
+func (f *dicomFiles) GetFrames(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fileID, err := parseURLParam(r, "id")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	file, httpStatus, err := f.getFile(fileID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, httpStatus, err)
+		return
+	}
+	defer file.Close()
+
+	frameCount, err := file.FrameCount()
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	frames, err := file.Frames()
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type Response struct {
+		FrameCount int               `json:"frameCount"`
+		Frames     []dicom.FrameInfo `json:"frames"`
+	}
+
+	writeJSONResponse(w, Response{
+		FrameCount: frameCount,
+		Frames:     frames,
+	})
+}
+
+// GetFrameAsPNG an http handler to retrieve a single frame of a DICOM file as
+// a grayscale PNG
+func (f *dicomFiles) GetFrameAsPNG(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fileID, err := parseURLParam(r, "id")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	frameIndex, err := parseIntURLParam(r, "n")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	pngOptions, err := f.parsePNGQuery(r.URL.Query())
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	file, httpStatus, err := f.getFile(fileID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, httpStatus, err)
+		return
+	}
+	defer file.Close()
+
+	image, err := file.Frame(frameIndex, pngOptions...)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, dicom.ErrFrameNotFound) {
+			status = http.StatusNotFound
+		}
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, status, err)
+		return
+	}
+
+	err = png.Encode(w, image)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+}
+
+// GetPixelValue an http handler to retrieve the stored and modality values
+// of a single pixel of a frame of a DICOM file
+func (f *dicomFiles) GetPixelValue(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fileID, err := parseURLParam(r, "id")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	frameIndex, err := parseIntURLParam(r, "n")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	x, err := strconv.Atoi(r.URL.Query().Get("x"))
+	if err != nil {
+		err = errors.New("query param x must be an integer")
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	y, err := strconv.Atoi(r.URL.Query().Get("y"))
+	if err != nil {
+		err = errors.New("query param y must be an integer")
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	file, httpStatus, err := f.getFile(fileID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, httpStatus, err)
+		return
+	}
+	defer file.Close()
+
+	pixelValue, err := file.PixelValue(frameIndex, x, y)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, dicom.ErrFrameNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, dicom.ErrPixelOutOfBounds):
+			status = http.StatusBadRequest
+		}
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, status, err)
+		return
+	}
+
+	writeJSONResponse(w, pixelValue)
+}
+
 // SearchAttributes an http handler to search the attributes/elements of a
-// DICOM file
+// DICOM file, either by tag or a page at a time filtered by group and keyword.
+// Elements are returned in the DICOM JSON Model if application/dicom+json is
+// requested, or the Native DICOM Model if application/dicom+xml is requested
 func (f *dicomFiles) SearchAttributes(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -127,14 +327,23 @@ func (f *dicomFiles) SearchAttributes(
 		return
 	}
 
+	elementQuery, err := f.parseElementQuery(r.URL.Query())
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
 	file, httpStatus, err := f.getFile(fileID)
 	if err != nil {
 		slog.ErrorContext(ctx, err.Error())
 		writeJSONError(w, httpStatus, err)
 		return
 	}
+	defer file.Close()
 
-	var elementsByTag map[string]*dicomutil.Element
+	var elementsByTag dicom.DICOMElementsLookup
+	var total int
 	if len(dicomTags) > 0 {
 		elementsByTag, err = file.FindElements(dicomTags...)
 		if err != nil {
@@ -142,8 +351,9 @@ func (f *dicomFiles) SearchAttributes(
 			writeJSONError(w, http.StatusInternalServerError, err)
 			return
 		}
+		total = len(elementsByTag)
 	} else {
-		elementsByTag, err = file.AllElements()
+		elementsByTag, total, err = file.SearchElements(elementQuery)
 		if err != nil {
 			slog.ErrorContext(ctx, err.Error())
 			writeJSONError(w, http.StatusInternalServerError, err)
@@ -151,22 +361,105 @@ func (f *dicomFiles) SearchAttributes(
 		}
 	}
 
+	// the DICOM JSON and XML models hold the elements as a single dataset, so
+	// the total is returned in a header
+	if requestsMediaType(r, mediaTypeDICOMJSON, mediaTypeDICOMXML) {
+		dataset, err := elementsByTag.JSONDataset()
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error())
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set(headerTotalCount, strconv.Itoa(total))
+		if requestsMediaType(r, mediaTypeDICOMJSON) {
+			writeDICOMJSONResponse(w, http.StatusOK, dataset)
+			return
+		}
+		if err := writeDICOMXMLResponse(w, http.StatusOK, dataset.XMLDataset()); err != nil {
+			slog.ErrorContext(ctx, err.Error())
+		}
+		return
+	}
+
 	type Response struct {
 		ElementsByTag map[string]*dicomutil.Element `json:"elementsByTag"`
+		Total         int                           `json:"total"`
 	}
 
 	writeJSONResponse(
 		w,
 		Response{
 			ElementsByTag: elementsByTag,
+			Total:         total,
 		},
 	)
 }
 
-// Create an http handler to create a DICOM file
+// Create an http handler to create a DICOM file. Files duplicating a stored
+// file are handled by the duplicate policy of the request, or otherwise the
+// server
 func (f *dicomFiles) Create(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	policy, err := f.parseDuplicatePolicy(r.URL.Query())
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	newFile := dicom.NewFile(
+		uuid.NewString(),
+		header.Size,
+		file,
+	)
+
+	result, err := dicom.IngestFile(
+		f.fileRepository,
+		f.metadataIndex,
+		newFile,
+		policy,
+	)
+	f.writeIngestResult(ctx, w, result, err)
+}
+
+// Update an http handler to replace the contents of a DICOM file. Files
+// duplicating another stored file are rejected if the duplicate policy of the
+// request, or otherwise the server, rejects duplicates
+func (f *dicomFiles) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fileID, err := parseURLParam(r, "id")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	policy, err := f.parseDuplicatePolicy(r.URL.Query())
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	existing, httpStatus, err := f.getFile(fileID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, httpStatus, err)
+		return
+	}
+	existing.Close()
+
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		slog.ErrorContext(ctx, err.Error())
@@ -175,18 +468,111 @@ func (f *dicomFiles) Create(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	fileID := uuid.NewString()
 	newFile := dicom.NewFile(
 		fileID,
 		header.Size,
 		file,
 	)
 
-	if err := f.fileRepository.Create(
+	result, err := dicom.UpdateFile(
+		f.fileRepository,
+		f.metadataIndex,
 		newFile,
-	); err != nil {
+		policy,
+	)
+	f.writeIngestResult(ctx, w, result, err)
+}
+
+// writeIngestResult utility to respond with the outcome of ingesting a file.
+// Files rejected as duplicates are a conflict, described with the file they
+// duplicate
+func (f *dicomFiles) writeIngestResult(
+	ctx context.Context,
+	w http.ResponseWriter,
+	result dicom.IngestResult,
+	err error,
+) {
+	type Response struct {
+		FileID    string           `json:"fileId"`
+		Stored    bool             `json:"stored"`
+		Duplicate *dicom.Duplicate `json:"duplicate,omitempty"`
+		Error     string           `json:"error,omitempty"`
+	}
+
+	if errors.Is(err, dicom.ErrDuplicateFile) {
 		slog.ErrorContext(ctx, err.Error())
-		writeJSONError(w, http.StatusInternalServerError, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(Response{
+			FileID:    result.FileID,
+			Duplicate: result.Duplicate,
+			Error:     err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, dicom.ErrInvalidFile) {
+			status = http.StatusBadRequest
+		}
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, status, err)
+		return
+	}
+
+	writeJSONResponse(
+		w,
+		Response{
+			FileID:    result.FileID,
+			Stored:    result.Stored,
+			Duplicate: result.Duplicate,
+		},
+	)
+}
+
+// Delete an http handler to delete a DICOM file, moving it to the trash from
+// which it can be restored
+func (f *dicomFiles) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fileID, err := parseURLParam(r, "id")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := f.fileRepository.Delete(fileID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, dicom.ErrFileNotFound) {
+			status = http.StatusNotFound
+		}
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, status, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Restore an http handler to restore a deleted DICOM file from the trash
+func (f *dicomFiles) Restore(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fileID, err := parseURLParam(r, "id")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := f.fileRepository.Restore(fileID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, dicom.ErrFileNotFound) {
+			status = http.StatusNotFound
+		}
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, status, err)
 		return
 	}
 
@@ -202,6 +588,119 @@ func (f *dicomFiles) Create(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// Anonymize an http handler to de-identify a DICOM file with the PS3.15 Basic
+// Application Level Confidentiality Profile, creating a new file
+func (f *dicomFiles) Anonymize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fileID, err := parseURLParam(r, "id")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	anonymizeOptions, err := f.parseAnonymizeQuery(r.URL.Query())
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	file, httpStatus, err := f.getFile(fileID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, httpStatus, err)
+		return
+	}
+	defer file.Close()
+
+	anonymized, err := file.Anonymize(uuid.NewString(), anonymizeOptions...)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	defer anonymized.Close()
+
+	if err := f.fileRepository.Create(anonymized); err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type Response struct {
+		FileID string `json:"fileId"`
+	}
+
+	writeJSONResponse(
+		w,
+		Response{
+			FileID: anonymized.ID,
+		},
+	)
+}
+
+// Redact an http handler to black out burned in annotations from the pixel
+// data of a DICOM file, given as regions and/or by the templates matching its
+// manufacturer and model, creating a new file
+func (f *dicomFiles) Redact(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	fileID, err := parseURLParam(r, "id")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	redactOptions, err := f.parseRedactQuery(r.URL.Query())
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	file, httpStatus, err := f.getFile(fileID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, httpStatus, err)
+		return
+	}
+	defer file.Close()
+
+	redacted, err := file.Redact(uuid.NewString(), redactOptions...)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, dicom.ErrNoRedactRegions) || errors.Is(err, dicom.ErrUnsupportedPixelData) {
+			status = http.StatusUnprocessableEntity
+		}
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, status, err)
+		return
+	}
+
+	defer redacted.Close()
+
+	if err := f.fileRepository.Create(redacted); err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type Response struct {
+		FileID string `json:"fileId"`
+	}
+
+	writeJSONResponse(
+		w,
+		Response{
+			FileID: redacted.ID,
+		},
+	)
+}
+
 func (f *dicomFiles) getFile(id string) (*dicom.File, int, error) { // http status, err
 	file, err := f.fileRepository.Get(id)
 	if err != nil {
@@ -215,36 +714,258 @@ func (f *dicomFiles) getFile(id string) (*dicom.File, int, error) { // http stat
 	return file, http.StatusFound, nil
 }
 
-// parseTagQuery utility to parse url tag queries into tag objects
-func (f dicomFiles) parseTagQuery(query url.Values) ([]tag.Tag, error) {
+// parseTagQuery utility to parse url tag queries into paths to elements. Tags
+// may be given as keywords, hex or paths into sequences
+func (f dicomFiles) parseTagQuery(query url.Values) ([]dicom.ElementPath, error) {
 
 	queryStrings := query[tagQueryParamKey]
 
-	var tags []tag.Tag
+	var paths []dicom.ElementPath
 	for _, queryString := range queryStrings {
-		tag, err := parseTag(queryString)
+		path, err := dicom.ParseElementPath(queryString)
 		if err != nil {
 			return nil, err
 		}
-		tags = append(tags, tag)
+		paths = append(paths, path)
 	}
 
-	return tags, nil
+	return paths, nil
 }
 
-// parseTag adapted from helper in github.com/suyashkumar/dicom
-func parseTag(tagString string) (tag.Tag, error) {
-	parts := strings.Split(strings.Trim(tagString, "()"), ",")
-	if len(parts) < 2 {
-		return tag.Tag{}, errors.New("malformed tag")
+// parseElementQuery utility to parse url attribute search queries into a
+// query of the elements of a DICOM file
+func (f dicomFiles) parseElementQuery(query url.Values) (dicom.ElementQuery, error) {
+	elementQuery := dicom.ElementQuery{
+		Keyword: query.Get("keyword"),
 	}
-	group, err := strconv.ParseInt(parts[0], 16, 0)
-	if err != nil {
-		return tag.Tag{}, err
+
+	for key, value := range map[string]*int{
+		"limit":  &elementQuery.Limit,
+		"offset": &elementQuery.Offset,
+		"depth":  &elementQuery.Depth,
+	} {
+		param := query.Get(key)
+		if param == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 0 {
+			return dicom.ElementQuery{}, fmt.Errorf("query param %s must be a non-negative integer", key)
+		}
+		*value = parsed
+	}
+
+	if group := query.Get("group"); group != "" {
+		parsed, err := strconv.ParseUint(group, 16, 16)
+		if err != nil || len(group) != 4 {
+			return dicom.ElementQuery{}, fmt.Errorf("malformed group %s, must be 4 hex digits", group)
+		}
+		parsedGroup := uint16(parsed)
+		elementQuery.Group = &parsedGroup
+	}
+
+	if bulkData := query.Get("bulkData"); bulkData != "" {
+		includeBulkData, err := strconv.ParseBool(bulkData)
+		if err != nil {
+			return dicom.ElementQuery{}, fmt.Errorf("malformed bulkData %s, must be true or false", bulkData)
+		}
+		elementQuery.IncludeBulkData = includeBulkData
+	}
+
+	return elementQuery, nil
+}
+
+// parseAnonymizeQuery utility to parse url anonymize queries into the options
+// of the profile to apply
+func (f dicomFiles) parseAnonymizeQuery(
+	query url.Values,
+) ([]func(opts *dicom.AnonymizeOptions), error) {
+	options := []func(opts *dicom.AnonymizeOptions){
+		dicom.AnonymizePseudonymizer(f.pseudonymizer),
+	}
+
+	for key, option := range map[string]func(bool) func(opts *dicom.AnonymizeOptions){
+		"retainLongitudinalDates": dicom.AnonymizeRetainLongitudinalDates,
+		"retainDeviceIdentity":    dicom.AnonymizeRetainDeviceIdentity,
+		"cleanDescriptors":        dicom.AnonymizeCleanDescriptors,
+	} {
+		param := query.Get(key)
+		if param == "" {
+			continue
+		}
+
+		value, err := strconv.ParseBool(param)
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s %s, must be true or false", key, param)
+		}
+		options = append(options, option(value))
+	}
+
+	return options, nil
+}
+
+// parseRedactQuery utility to parse url redact queries into the regions to
+// redact, and whether to apply the templates matching the file
+func (f dicomFiles) parseRedactQuery(
+	query url.Values,
+) ([]func(opts *dicom.RedactOptions), error) {
+	var options []func(opts *dicom.RedactOptions)
+
+	for _, value := range query["region"] {
+		region, err := dicom.ParseRedactRegion(value)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, dicom.RedactRegions(region))
 	}
-	elem, err := strconv.ParseInt(parts[1], 16, 0)
+
+	if param := query.Get("templates"); param != "" {
+		value, err := strconv.ParseBool(param)
+		if err != nil {
+			return nil, fmt.Errorf("malformed templates %s, must be true or false", param)
+		}
+		if value {
+			options = append(options, dicom.RedactTemplates(f.redactTemplates...))
+		}
+	}
+
+	if len(options) == 0 {
+		return nil, errors.New("regions or templates to redact are required")
+	}
+
+	return options, nil
+}
+
+// parseDuplicatePolicy utility to parse the duplicate policy of a request,
+// defaulting to that of the server
+func (f dicomFiles) parseDuplicatePolicy(query url.Values) (dicom.DuplicatePolicy, error) {
+	param := query.Get("duplicatePolicy")
+	if param == "" {
+		return f.duplicatePolicy, nil
+	}
+
+	return dicom.ParseDuplicatePolicy(param)
+}
+
+// parseListQuery utility to parse url list queries into a query of the
+// metadata index. The sort order defaults to that of the cursor, if any
+func (f dicomFiles) parseListQuery(query url.Values) (dicom.ListQuery, error) {
+	listQuery := dicom.ListQuery{
+		Modality:      query.Get("modality"),
+		PatientID:     query.Get("patientId"),
+		StudyDateFrom: query.Get("studyDateFrom"),
+		StudyDateTo:   query.Get("studyDateTo"),
+		Limit:         defaultListLimit,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxListLimit {
+			return dicom.ListQuery{}, fmt.Errorf("limit must be an integer between 1 and %d", maxListLimit)
+		}
+		listQuery.Limit = value
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return dicom.ListQuery{}, errors.New("offset must be a non-negative integer")
+		}
+		listQuery.Offset = value
+	}
+
+	for _, date := range []string{listQuery.StudyDateFrom, listQuery.StudyDateTo} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("20060102", date); err != nil {
+			return dicom.ListQuery{}, fmt.Errorf("malformed study date %s, must be YYYYMMDD", date)
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		listCursor, err := dicom.ParseListCursor(cursor)
+		if err != nil {
+			return dicom.ListQuery{}, err
+		}
+		listQuery.Cursor = &listCursor
+		listQuery.Sort = listCursor.Sort
+		listQuery.Descending = listCursor.Descending
+	}
+
+	switch sort := dicom.ListSort(query.Get("sort")); sort {
+	case "":
+	case dicom.ListSortCreated, dicom.ListSortStudyDate, dicom.ListSortSize:
+		listQuery.Sort = sort
+	default:
+		return dicom.ListQuery{}, fmt.Errorf("unsupported sort %s", sort)
+	}
+
+	switch order := query.Get("order"); order {
+	case "":
+	case "asc":
+		listQuery.Descending = false
+	case "desc":
+		listQuery.Descending = true
+	default:
+		return dicom.ListQuery{}, fmt.Errorf("unsupported order %s, must be asc or desc", order)
+	}
+
+	return listQuery, nil
+}
+
+// parsePNGQuery utility to parse url PNG rendering queries into PNG generate
+// options. An explicit window center/width takes precedence over a named
+// window preset
+func (f dicomFiles) parsePNGQuery(
+	query url.Values,
+) ([]func(opts *dicom.PNGGenerateOptions), error) {
+	shouldRemap, err := strconv.ParseBool(
+		query.Get("remap"),
+	)
 	if err != nil {
-		return tag.Tag{}, err
+		shouldRemap = true
+	}
+
+	options := []func(opts *dicom.PNGGenerateOptions){
+		dicom.PNGRemapPixels(shouldRemap),
+	}
+
+	windowCenter := query.Get("wc")
+	windowWidth := query.Get("ww")
+	preset := query.Get("preset")
+
+	switch {
+	case windowCenter != "" || windowWidth != "":
+		if windowCenter == "" || windowWidth == "" {
+			return nil, errors.New("both wc and ww must be specified")
+		}
+
+		center, err := strconv.ParseFloat(windowCenter, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed wc: %w", err)
+		}
+		width, err := strconv.ParseFloat(windowWidth, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed ww: %w", err)
+		}
+		if width <= 0 {
+			return nil, errors.New("ww must be greater than 0")
+		}
+
+		options = append(options, dicom.PNGWindow(dicom.Window{
+			Center: center,
+			Width:  width,
+		}))
+	case preset != "":
+		window, err := dicom.WindowPreset(preset)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, preset)
+		}
+
+		options = append(options, dicom.PNGWindow(window))
 	}
-	return tag.Tag{Group: uint16(group), Element: uint16(elem)}, nil
+
+	return options, nil
 }
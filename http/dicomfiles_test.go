@@ -1,10 +1,21 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"dicomviewer/dicom"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strconv"
 	"testing"
 
+	"github.com/go-chi/chi/v5"
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/frame"
 	"github.com/suyashkumar/dicom/pkg/tag"
 )
 
@@ -15,7 +26,7 @@ func Test_dicomFiles_parseTagQuery(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    []tag.Tag
+		want    []dicom.ElementPath
 		wantErr bool
 	}{
 		{
@@ -87,8 +98,8 @@ func Test_dicomFiles_parseTagQuery(t *testing.T) {
 				},
 			},
 			wantErr: false,
-			want: []tag.Tag{
-				{Group: 0000, Element: 0001},
+			want: []dicom.ElementPath{
+				{Tag: tag.Tag{Group: 0000, Element: 0001}},
 			},
 		},
 		{
@@ -99,8 +110,8 @@ func Test_dicomFiles_parseTagQuery(t *testing.T) {
 				},
 			},
 			wantErr: false,
-			want: []tag.Tag{
-				{Group: 0000, Element: 0001},
+			want: []dicom.ElementPath{
+				{Tag: tag.Tag{Group: 0000, Element: 0001}},
 			},
 		},
 		{
@@ -111,9 +122,9 @@ func Test_dicomFiles_parseTagQuery(t *testing.T) {
 				},
 			},
 			wantErr: false,
-			want: []tag.Tag{
-				{Group: 0000, Element: 0001},
-				{Group: 0005, Element: 0002},
+			want: []dicom.ElementPath{
+				{Tag: tag.Tag{Group: 0000, Element: 0001}},
+				{Tag: tag.Tag{Group: 0005, Element: 0002}},
 			},
 		},
 		{
@@ -124,11 +135,67 @@ func Test_dicomFiles_parseTagQuery(t *testing.T) {
 				},
 			},
 			wantErr: false,
-			want: []tag.Tag{
-				{Group: 0000, Element: 0001},
-				{Group: 0005, Element: 0002},
+			want: []dicom.ElementPath{
+				{Tag: tag.Tag{Group: 0000, Element: 0001}},
+				{Tag: tag.Tag{Group: 0005, Element: 0002}},
 			},
 		},
+		{
+			name: "returns correct tag for keywords and 8 hex digit tags",
+			args: args{
+				query: url.Values{
+					"tag": {"PatientName", "0020000D"},
+				},
+			},
+			want: []dicom.ElementPath{
+				{Tag: tag.PatientName},
+				{Tag: tag.StudyInstanceUID},
+			},
+		},
+		{
+			name: "returns correct path for sequence paths",
+			args: args{
+				query: url.Values{
+					"tag": {"ReferencedSeriesSequence[0].(0008,114a)[2].ReferencedSOPInstanceUID"},
+				},
+			},
+			want: []dicom.ElementPath{
+				{
+					Items: []dicom.SequenceItem{
+						{Tag: tag.ReferencedSeriesSequence, Index: 0},
+						{Tag: tag.ReferencedInstanceSequence, Index: 2},
+					},
+					Tag: tag.ReferencedSOPInstanceUID,
+				},
+			},
+		},
+		{
+			name: "errors for unknown keyword",
+			args: args{
+				query: url.Values{
+					"tag": {"PatientFavouriteColour"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for sequence path without item index",
+			args: args{
+				query: url.Values{
+					"tag": {"ReferencedSeriesSequence.SeriesInstanceUID"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for sequence path with malformed item index",
+			args: args{
+				query: url.Values{
+					"tag": {"ReferencedSeriesSequence[-1].SeriesInstanceUID"},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -144,3 +211,663 @@ func Test_dicomFiles_parseTagQuery(t *testing.T) {
 		})
 	}
 }
+
+func Test_dicomFiles_parsePNGQuery(t *testing.T) {
+	type args struct {
+		query url.Values
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantOptions int
+		wantErr     bool
+	}{
+		{
+			name: "returns remap option for empty query params",
+			args: args{
+				query: url.Values{},
+			},
+			wantOptions: 1,
+		},
+		{
+			name: "returns window option for window center and width",
+			args: args{
+				query: url.Values{
+					"wc": {"40"},
+					"ww": {"400"},
+				},
+			},
+			wantOptions: 2,
+		},
+		{
+			name: "returns window option for known preset",
+			args: args{
+				query: url.Values{
+					"preset": {"lung"},
+				},
+			},
+			wantOptions: 2,
+		},
+		{
+			name: "errors for window center without width",
+			args: args{
+				query: url.Values{
+					"wc": {"40"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for malformed window width",
+			args: args{
+				query: url.Values{
+					"wc": {"40"},
+					"ww": {"wide"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for non-positive window width",
+			args: args{
+				query: url.Values{
+					"wc": {"40"},
+					"ww": {"0"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for unknown preset",
+			args: args{
+				query: url.Values{
+					"preset": {"spleen"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dicomFiles{}
+			got, err := d.parsePNGQuery(tt.args.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("dicomFiles.parsePNGQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.wantOptions {
+				t.Errorf("dicomFiles.parsePNGQuery() returned %d options, want %d", len(got), tt.wantOptions)
+			}
+		})
+	}
+}
+
+func Test_dicomFiles_parseListQuery(t *testing.T) {
+	cursor := dicom.ListCursor{Sort: dicom.ListSortSize, Descending: true, Key: "100", FileID: "a"}
+
+	type args struct {
+		query url.Values
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    dicom.ListQuery
+		wantErr bool
+	}{
+		{
+			name: "returns the default limit for empty query params",
+			args: args{
+				query: url.Values{},
+			},
+			want: dicom.ListQuery{
+				Limit: defaultListLimit,
+			},
+		},
+		{
+			name: "parses filters, sort and limit",
+			args: args{
+				query: url.Values{
+					"modality":      {"CT"},
+					"patientId":     {"P1"},
+					"studyDateFrom": {"20240101"},
+					"studyDateTo":   {"20240331"},
+					"sort":          {"studyDate"},
+					"order":         {"desc"},
+					"limit":         {"10"},
+					"offset":        {"20"},
+				},
+			},
+			want: dicom.ListQuery{
+				Modality:      "CT",
+				PatientID:     "P1",
+				StudyDateFrom: "20240101",
+				StudyDateTo:   "20240331",
+				Sort:          dicom.ListSortStudyDate,
+				Descending:    true,
+				Limit:         10,
+				Offset:        20,
+			},
+		},
+		{
+			name: "sorts by the order of the cursor",
+			args: args{
+				query: url.Values{
+					"cursor": {cursor.String()},
+				},
+			},
+			want: dicom.ListQuery{
+				Sort:       dicom.ListSortSize,
+				Descending: true,
+				Cursor:     &cursor,
+				Limit:      defaultListLimit,
+			},
+		},
+		{
+			name: "errors for malformed cursor",
+			args: args{
+				query: url.Values{
+					"cursor": {"page2"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for limit above the maximum",
+			args: args{
+				query: url.Values{
+					"limit": {"1001"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for negative offset",
+			args: args{
+				query: url.Values{
+					"offset": {"-1"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for malformed study date",
+			args: args{
+				query: url.Values{
+					"studyDateFrom": {"2024-01-01"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for unknown sort",
+			args: args{
+				query: url.Values{
+					"sort": {"name"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dicomFiles{}
+			got, err := d.parseListQuery(tt.args.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("dicomFiles.parseListQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dicomFiles.parseListQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dicomFiles_parseElementQuery(t *testing.T) {
+	group := uint16(0x0010)
+
+	type args struct {
+		query url.Values
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    dicom.ElementQuery
+		wantErr bool
+	}{
+		{
+			name: "returns empty query for empty query params",
+			args: args{
+				query: url.Values{},
+			},
+			want: dicom.ElementQuery{},
+		},
+		{
+			name: "parses filters, depth and pagination",
+			args: args{
+				query: url.Values{
+					"group":    {"0010"},
+					"keyword":  {"Patient*"},
+					"bulkData": {"true"},
+					"depth":    {"2"},
+					"limit":    {"10"},
+					"offset":   {"20"},
+				},
+			},
+			want: dicom.ElementQuery{
+				Group:           &group,
+				Keyword:         "Patient*",
+				IncludeBulkData: true,
+				Depth:           2,
+				Limit:           10,
+				Offset:          20,
+			},
+		},
+		{
+			name: "errors for malformed group",
+			args: args{
+				query: url.Values{
+					"group": {"10"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for negative depth",
+			args: args{
+				query: url.Values{
+					"depth": {"-1"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for malformed bulkData",
+			args: args{
+				query: url.Values{
+					"bulkData": {"sometimes"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dicomFiles{}
+			got, err := d.parseElementQuery(tt.args.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("dicomFiles.parseElementQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dicomFiles.parseElementQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dicomFiles_parseAnonymizeQuery(t *testing.T) {
+	type args struct {
+		query url.Values
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantOptions int
+		wantErr     bool
+	}{
+		{
+			name: "returns pseudonymizer option for empty query params",
+			args: args{
+				query: url.Values{},
+			},
+			wantOptions: 1,
+		},
+		{
+			name: "returns profile options",
+			args: args{
+				query: url.Values{
+					"retainLongitudinalDates": {"true"},
+					"retainDeviceIdentity":    {"false"},
+					"cleanDescriptors":        {"1"},
+				},
+			},
+			wantOptions: 4,
+		},
+		{
+			name: "errors for malformed profile option",
+			args: args{
+				query: url.Values{
+					"cleanDescriptors": {"sometimes"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dicomFiles{}
+			got, err := d.parseAnonymizeQuery(tt.args.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("dicomFiles.parseAnonymizeQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.wantOptions {
+				t.Errorf("dicomFiles.parseAnonymizeQuery() returned %d options, want %d", len(got), tt.wantOptions)
+			}
+		})
+	}
+}
+
+func Test_dicomFiles_parseRedactQuery(t *testing.T) {
+	type args struct {
+		query url.Values
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantOptions int
+		wantErr     bool
+	}{
+		{
+			name: "errors for empty query params",
+			args: args{
+				query: url.Values{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "returns region and template options",
+			args: args{
+				query: url.Values{
+					"region":    {"0,0,100,20", "0,480,640,32"},
+					"templates": {"true"},
+				},
+			},
+			wantOptions: 3,
+		},
+		{
+			name: "errors without templates or regions",
+			args: args{
+				query: url.Values{
+					"templates": {"false"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for malformed region",
+			args: args{
+				query: url.Values{
+					"region": {"0,0,100"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dicomFiles{}
+			got, err := d.parseRedactQuery(tt.args.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("dicomFiles.parseRedactQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.wantOptions {
+				t.Errorf("dicomFiles.parseRedactQuery() returned %d options, want %d", len(got), tt.wantOptions)
+			}
+		})
+	}
+}
+
+func Test_dicomFiles_Delete(t *testing.T) {
+	index := dicom.NewMemoryIndex()
+	f := &dicomFiles{
+		fileRepository: dicom.NewIndexedFileRepository(
+			dicom.NewMemoryFileAdapter(),
+			index,
+		),
+		metadataIndex: index,
+	}
+
+	data := newTestDICOM(t, "1", "1.1", "1.1.1")
+	if err := f.fileRepository.Create(dicom.NewFile("file", int64(len(data)), bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	// serve test helper to call a handler for the file with the ID
+	serve := func(handler http.HandlerFunc, method string, fileID string) int {
+		r := httptest.NewRequest(method, "/api/v1/files/"+fileID, nil)
+		routeContext := chi.NewRouteContext()
+		routeContext.URLParams.Add("id", fileID)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		method      string
+		fileID      string
+		wantStatus  int
+		wantIndexed int
+	}{
+		{
+			name:        "deletes the file",
+			handler:     f.Delete,
+			method:      http.MethodDelete,
+			fileID:      "file",
+			wantStatus:  http.StatusNoContent,
+			wantIndexed: 0,
+		},
+		{
+			name:        "fails to delete a deleted file",
+			handler:     f.Delete,
+			method:      http.MethodDelete,
+			fileID:      "file",
+			wantStatus:  http.StatusNotFound,
+			wantIndexed: 0,
+		},
+		{
+			name:        "restores the deleted file",
+			handler:     f.Restore,
+			method:      http.MethodPost,
+			fileID:      "file",
+			wantStatus:  http.StatusOK,
+			wantIndexed: 1,
+		},
+		{
+			name:        "fails to restore an unknown file",
+			handler:     f.Restore,
+			method:      http.MethodPost,
+			fileID:      "unknown",
+			wantStatus:  http.StatusNotFound,
+			wantIndexed: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(tt.handler, tt.method, tt.fileID); got != tt.wantStatus {
+				t.Errorf("status = %v, want %v", got, tt.wantStatus)
+			}
+
+			indexed, _ := index.Find(dicom.InstanceUIDs{})
+			if len(indexed) != tt.wantIndexed {
+				t.Errorf("indexed = %v, want %v", len(indexed), tt.wantIndexed)
+			}
+		})
+	}
+}
+
+// newTestFramesDICOM test helper to encode a greyscale DICOM file of 2x2
+// frames, one frame every 40ms
+func newTestFramesDICOM(t *testing.T, frameCount int) []byte {
+	t.Helper()
+
+	frames := make([]*frame.Frame, frameCount)
+	for idx := range frames {
+		frames[idx] = &frame.Frame{
+			NativeData: frame.NativeFrame{
+				Data:          [][]int{{idx}, {idx}, {idx}, {idx}},
+				Rows:          2,
+				Cols:          2,
+				BitsPerSample: 8,
+			},
+		}
+	}
+
+	pixelData, err := dicomutil.NewValue(dicomutil.PixelDataInfo{Frames: frames})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestDICOM(t, "1", "1.1", "1.1.1",
+		newTestElement(t, tag.FrameTime, []string{"40"}),
+		newTestElement(t, tag.SamplesPerPixel, []int{1}),
+		newTestElement(t, tag.PhotometricInterpretation, []string{"MONOCHROME2"}),
+		newTestElement(t, tag.NumberOfFrames, []string{strconv.Itoa(frameCount)}),
+		newTestElement(t, tag.Rows, []int{2}),
+		newTestElement(t, tag.Columns, []int{2}),
+		newTestElement(t, tag.BitsAllocated, []int{8}),
+		newTestElement(t, tag.BitsStored, []int{8}),
+		newTestElement(t, tag.HighBit, []int{7}),
+		newTestElement(t, tag.PixelRepresentation, []int{0}),
+		&dicomutil.Element{
+			Tag:                    tag.PixelData,
+			RawValueRepresentation: "OW",
+			Value:                  pixelData,
+		},
+	)
+}
+
+func Test_dicomFiles_GetFrames(t *testing.T) {
+	f := &dicomFiles{
+		fileRepository: newTestFileRepository(t, map[string][]byte{
+			"file": newTestFramesDICOM(t, 3),
+		}),
+	}
+
+	tests := []struct {
+		name        string
+		fileID      string
+		wantStatus  int
+		wantOffsets []float64
+	}{
+		{
+			name:        "describes each frame of the file",
+			fileID:      "file",
+			wantStatus:  http.StatusOK,
+			wantOffsets: []float64{0, 40, 80},
+		},
+		{
+			name:       "fails for an unknown file",
+			fileID:     "unknown",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/files/"+tt.fileID+"/frames", nil)
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", tt.fileID)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+
+			w := httptest.NewRecorder()
+			f.GetFrames(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				FrameCount int               `json:"frameCount"`
+				Frames     []dicom.FrameInfo `json:"frames"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+
+			if response.FrameCount != len(tt.wantOffsets) || len(response.Frames) != len(tt.wantOffsets) {
+				t.Fatalf("frames = %d of %d, want %d", len(response.Frames), response.FrameCount, len(tt.wantOffsets))
+			}
+			for idx, frameInfo := range response.Frames {
+				if frameInfo.TimeOffset == nil || *frameInfo.TimeOffset != tt.wantOffsets[idx] {
+					t.Errorf("frames[%d] time offset = %v, want %v", idx, frameInfo.TimeOffset, tt.wantOffsets[idx])
+				}
+			}
+		})
+	}
+}
+
+func Test_dicomFiles_GetFrameAsPNG(t *testing.T) {
+	f := &dicomFiles{
+		fileRepository: newTestFileRepository(t, map[string][]byte{
+			"file": newTestFramesDICOM(t, 3),
+		}),
+	}
+
+	tests := []struct {
+		name       string
+		fileID     string
+		n          string
+		wantStatus int
+		wantPixel  uint32
+	}{
+		{
+			name:       "renders the frame",
+			fileID:     "file",
+			n:          "2",
+			wantStatus: http.StatusOK,
+			wantPixel:  2,
+		},
+		{
+			name:       "fails for a frame past the last",
+			fileID:     "file",
+			n:          "3",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "fails for a malformed frame",
+			fileID:     "file",
+			n:          "first",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "fails for an unknown file",
+			fileID:     "unknown",
+			n:          "0",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/files/"+tt.fileID+"/frames/"+tt.n+"/png?remap=false", nil)
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", tt.fileID)
+			routeContext.URLParams.Add("n", tt.n)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+
+			w := httptest.NewRecorder()
+			f.GetFrameAsPNG(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			image, err := png.Decode(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value, _, _, _ := image.At(1, 1).RGBA(); value>>8 != tt.wantPixel {
+				t.Errorf("pixel = %v, want %v", value>>8, tt.wantPixel)
+			}
+		})
+	}
+}
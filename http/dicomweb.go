@@ -0,0 +1,501 @@
+package http
+
+import (
+	"dicomviewer/dicom"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+const (
+	mediaTypeDICOM     = "application/dicom"
+	mediaTypeDICOMJSON = "application/dicom+json"
+	mediaTypeDICOMXML  = "application/dicom+xml"
+	mediaTypeMultipart = "multipart/related"
+)
+
+// Failure Reason (0008,1197) values of instances that could not be stored.
+// See https://dicom.nema.org/medical/dicom/current/output/chtml/part18/sect_I.2.2.html
+const (
+	failureReasonProcessingFailure = 0x0110
+	failureReasonDuplicate         = 0x0111
+	failureReasonCannotUnderstand  = 0xC000
+)
+
+// tagRetrieveURL the Retrieve URL (0008,1190) attribute, which is missing
+// from the dictionary of the underlying DICOM library
+var tagRetrieveURL = tag.Tag{Group: 0x0008, Element: 0x1190}
+
+var (
+	// errNoInstancesFound error indicating no instances match the requested
+	// study, series or instance UIDs
+	errNoInstancesFound = errors.New("no instances were found")
+
+	// errUnsupportedMediaType error indicating the request body is not
+	// multipart/related application/dicom
+	errUnsupportedMediaType = errors.New("request must be multipart/related with type application/dicom")
+
+	// errStudyMismatch error indicating an instance does not belong to the
+	// study it was stored to
+	errStudyMismatch = errors.New("instance does not belong to the study")
+
+	// errNotAcceptable error indicating the requested media type cannot be
+	// provided
+	errNotAcceptable = errors.New("requested media type is not supported")
+)
+
+// dicomWeb contains a set of http handlers implementing the DICOMweb
+// RESTful services. See
+// https://dicom.nema.org/medical/dicom/current/output/chtml/part18/PS3.18.html
+type dicomWeb struct {
+	fileRepository  dicom.FileRepository
+	metadataIndex   dicom.MetadataIndex
+	duplicatePolicy dicom.DuplicatePolicy
+}
+
+// Retrieve an http handler implementing WADO-RS retrieval of the instances of
+// a study, series or single instance as multipart/related application/dicom
+func (d *dicomWeb) Retrieve(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !acceptsMediaType(r, mediaTypeMultipart, mediaTypeDICOM) {
+		slog.ErrorContext(ctx, errNotAcceptable.Error())
+		writeJSONError(w, http.StatusNotAcceptable, errNotAcceptable)
+		return
+	}
+
+	instances, httpStatus, err := d.findInstances(r)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, httpStatus, err)
+		return
+	}
+
+	multipartWriter := multipart.NewWriter(w)
+	w.Header().Set(
+		"Content-Type",
+		mime.FormatMediaType(mediaTypeMultipart, map[string]string{
+			"type":     mediaTypeDICOM,
+			"boundary": multipartWriter.Boundary(),
+		}),
+	)
+
+	// files are streamed one at a time, so the response may already be
+	// partially written when a file fails. Once it is, the connection is
+	// aborted, rather than the response ended, so that the failure is not
+	// mistaken for a complete response
+	written := false
+	for _, instance := range instances {
+		err := d.withFile(instance.FileID, func(file *dicom.File) error {
+			written = true
+			part, err := multipartWriter.CreatePart(textproto.MIMEHeader{
+				"Content-Type": {mediaTypeDICOM},
+			})
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(part, file.Raw())
+			return err
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error())
+			if !written {
+				writeJSONError(w, http.StatusInternalServerError, err)
+				return
+			}
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	if err := multipartWriter.Close(); err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// RetrieveMetadata an http handler implementing WADO-RS retrieval of the
+// metadata of the instances of a study, series or single instance as DICOM
+// JSON. Pixel data is excluded
+func (d *dicomWeb) RetrieveMetadata(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !acceptsMediaType(r, mediaTypeDICOMJSON, "application/json") {
+		slog.ErrorContext(ctx, errNotAcceptable.Error())
+		writeJSONError(w, http.StatusNotAcceptable, errNotAcceptable)
+		return
+	}
+
+	instances, httpStatus, err := d.findInstances(r)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, httpStatus, err)
+		return
+	}
+
+	datasets := make([]dicom.JSONDataset, 0, len(instances))
+	for _, instance := range instances {
+		err := d.withFile(instance.FileID, func(file *dicom.File) error {
+			dataSet, err := file.Header()
+			if err != nil {
+				return err
+			}
+
+			datasets = append(datasets, dicom.NewJSONDataset(dataSet.Elements))
+			return nil
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error())
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	writeDICOMJSONResponse(w, http.StatusOK, datasets)
+}
+
+// Store an http handler implementing STOW-RS storage of the application/dicom
+// instances of a multipart/related request. Each instance is stored
+// separately, and the outcome for each reported in the response
+func (d *dicomWeb) Store(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !acceptsMediaType(r, mediaTypeDICOMJSON, "application/json") {
+		slog.ErrorContext(ctx, errNotAcceptable.Error())
+		writeJSONError(w, http.StatusNotAcceptable, errNotAcceptable)
+		return
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != mediaTypeMultipart ||
+		(params["type"] != "" && params["type"] != mediaTypeDICOM) {
+		slog.ErrorContext(ctx, errUnsupportedMediaType.Error())
+		writeJSONError(w, http.StatusUnsupportedMediaType, errUnsupportedMediaType)
+		return
+	}
+
+	// instances may only be stored to the study in the url, if any
+	studyUID := chi.URLParam(r, "study")
+
+	var referenced, failed []interface{}
+
+	multipartReader := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := multipartReader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error())
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		result, err := d.storeInstance(r, part, studyUID)
+		part.Close()
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error())
+			failed = append(failed, result)
+			continue
+		}
+
+		referenced = append(referenced, result)
+	}
+
+	response := dicom.JSONDataset{}
+	if studyUID != "" {
+		response[dicom.JSONTagKey(tagRetrieveURL)] = dicom.JSONAttribute{
+			VR:    "UR",
+			Value: []interface{}{d.retrieveURL(r, studyUID, "", "")},
+		}
+	}
+	if len(referenced) > 0 {
+		response[dicom.JSONTagKey(tag.ReferencedSOPSequence)] = dicom.JSONAttribute{
+			VR:    "SQ",
+			Value: referenced,
+		}
+	}
+	if len(failed) > 0 {
+		response[dicom.JSONTagKey(tag.FailedSOPSequence)] = dicom.JSONAttribute{
+			VR:    "SQ",
+			Value: failed,
+		}
+	}
+
+	// every instance stored, some instances stored or no instances stored
+	status := http.StatusOK
+	switch {
+	case len(failed) > 0 && len(referenced) > 0:
+		status = http.StatusAccepted
+	case len(failed) > 0 || len(referenced) == 0:
+		status = http.StatusConflict
+	}
+
+	writeDICOMJSONResponse(w, status, response)
+}
+
+// storeInstance utility to store a single instance of a STOW-RS request,
+// returning the item of the Referenced SOP Sequence (0008,1199) describing the
+// stored instance or, on error, the item of the Failed SOP Sequence (0008,1198)
+// describing the failure
+func (d *dicomWeb) storeInstance(
+	r *http.Request,
+	part *multipart.Part,
+	studyUID string,
+) (dicom.JSONDataset, error) {
+	item := dicom.JSONDataset{}
+	fail := func(reason int, err error) (dicom.JSONDataset, error) {
+		item[dicom.JSONTagKey(tag.FailureReason)] = dicom.JSONAttribute{
+			VR:    "US",
+			Value: []interface{}{reason},
+		}
+		return item, err
+	}
+
+	if contentType := part.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != mediaTypeDICOM {
+			return fail(failureReasonCannotUnderstand, errUnsupportedMediaType)
+		}
+	}
+
+	// instances are spooled to disk, rather than read into memory
+	file, err := dicom.SpoolFile(uuid.NewString(), part)
+	if err != nil {
+		return fail(failureReasonProcessingFailure, err)
+	}
+	defer file.Close()
+
+	dataSet, err := file.Header()
+	if err != nil {
+		return fail(failureReasonCannotUnderstand, err)
+	}
+	uids, err := file.UIDs()
+	if err != nil {
+		return fail(failureReasonCannotUnderstand, err)
+	}
+
+	// identify the instance in the response, whether stored or not
+	for attributeTag, value := range map[tag.Tag]string{
+		tag.ReferencedSOPClassUID:    elementString(dataSet, tag.SOPClassUID),
+		tag.ReferencedSOPInstanceUID: uids.SOPInstanceUID,
+	} {
+		if value != "" {
+			item[dicom.JSONTagKey(attributeTag)] = dicom.JSONAttribute{
+				VR:    "UI",
+				Value: []interface{}{value},
+			}
+		}
+	}
+
+	if studyUID != "" && uids.StudyInstanceUID != studyUID {
+		return fail(failureReasonProcessingFailure, errStudyMismatch)
+	}
+
+	if _, err := dicom.IngestFile(d.fileRepository, d.metadataIndex, file, d.duplicatePolicy); err != nil {
+		switch {
+		case errors.Is(err, dicom.ErrDuplicateFile):
+			return fail(failureReasonDuplicate, err)
+		case errors.Is(err, dicom.ErrInvalidFile):
+			return fail(failureReasonCannotUnderstand, err)
+		}
+		return fail(failureReasonProcessingFailure, err)
+	}
+
+	item[dicom.JSONTagKey(tagRetrieveURL)] = dicom.JSONAttribute{
+		VR: "UR",
+		Value: []interface{}{d.retrieveURL(
+			r,
+			uids.StudyInstanceUID,
+			uids.SeriesInstanceUID,
+			uids.SOPInstanceUID,
+		)},
+	}
+
+	return item, nil
+}
+
+// retrieveURL utility to build the WADO-RS url of a study, series or instance
+func (d *dicomWeb) retrieveURL(r *http.Request, studyUID, seriesUID, sopUID string) string {
+	retrieveURL := fmt.Sprintf("%s/studies/%s", requestBaseURL(r), url.PathEscape(studyUID))
+	if seriesUID != "" {
+		retrieveURL += fmt.Sprintf("/series/%s", url.PathEscape(seriesUID))
+	}
+	if sopUID != "" {
+		retrieveURL += fmt.Sprintf("/instances/%s", url.PathEscape(sopUID))
+	}
+
+	return retrieveURL
+}
+
+// SearchStudies an http handler implementing QIDO-RS search for studies
+func (d *dicomWeb) SearchStudies(w http.ResponseWriter, r *http.Request) {
+	d.search(w, r, dicom.QueryLevelStudy)
+}
+
+// SearchSeries an http handler implementing QIDO-RS search for the series of
+// a study
+func (d *dicomWeb) SearchSeries(w http.ResponseWriter, r *http.Request) {
+	d.search(w, r, dicom.QueryLevelSeries)
+}
+
+// SearchInstances an http handler implementing QIDO-RS search for the
+// instances of a series
+func (d *dicomWeb) SearchInstances(w http.ResponseWriter, r *http.Request) {
+	d.search(w, r, dicom.QueryLevelImage)
+}
+
+// search utility to search the metadata index at the given query level and
+// write matches as DICOM JSON. Responds with no content if nothing matches
+func (d *dicomWeb) search(w http.ResponseWriter, r *http.Request, level dicom.QueryLevel) {
+	ctx := r.Context()
+
+	if !acceptsMediaType(r, mediaTypeDICOMJSON, "application/json") {
+		slog.ErrorContext(ctx, errNotAcceptable.Error())
+		writeJSONError(w, http.StatusNotAcceptable, errNotAcceptable)
+		return
+	}
+
+	query, err := parseSearchQuery(level, r.URL.Query())
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// studies and series in the url scope the search
+	if studyUID := chi.URLParam(r, "study"); studyUID != "" {
+		query.Keys[tag.StudyInstanceUID] = studyUID
+	}
+	if seriesUID := chi.URLParam(r, "series"); seriesUID != "" {
+		query.Keys[tag.SeriesInstanceUID] = seriesUID
+	}
+
+	results, err := d.metadataIndex.Search(query)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if len(results) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeDICOMJSONResponse(w, http.StatusOK, results)
+}
+
+// findInstances utility to find the instances belonging to the study, series
+// or instance identified by the request's url params
+func (d *dicomWeb) findInstances(r *http.Request) ([]dicom.InstanceMetadata, int, error) { // http status, err
+	studyUID, err := parseURLParam(r, "study")
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	// series and instance are optional depending on the route
+	instances, err := d.metadataIndex.Find(dicom.InstanceUIDs{
+		StudyInstanceUID:  studyUID,
+		SeriesInstanceUID: chi.URLParam(r, "series"),
+		SOPInstanceUID:    chi.URLParam(r, "sop"),
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if len(instances) == 0 {
+		return nil, http.StatusNotFound, errNoInstancesFound
+	}
+
+	return instances, http.StatusOK, nil
+}
+
+// withFile utility to read a file from the repository, closing it once read,
+// so that only a single file of a study is open at a time
+func (d *dicomWeb) withFile(id string, read func(file *dicom.File) error) error {
+	file, err := d.fileRepository.Get(id)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return read(file)
+}
+
+// parseSearchQuery utility to parse QIDO-RS query params into a search query.
+// Attributes may be identified by keyword or by tag in the form GGGGEEEE
+func parseSearchQuery(level dicom.QueryLevel, query url.Values) (dicom.SearchQuery, error) {
+	searchQuery := dicom.SearchQuery{
+		Level: level,
+		Keys:  make(map[tag.Tag]string),
+	}
+
+	for key, values := range query {
+		switch key {
+		case "limit", "offset":
+			value, err := strconv.Atoi(query.Get(key))
+			if err != nil || value < 0 {
+				return dicom.SearchQuery{}, fmt.Errorf("%s must be a non-negative integer", key)
+			}
+			if key == "limit" {
+				searchQuery.Limit = value
+			} else {
+				searchQuery.Offset = value
+			}
+		case "includefield":
+			for _, value := range values {
+				for _, field := range strings.Split(value, ",") {
+					if field == "all" {
+						searchQuery.IncludeAll = true
+						continue
+					}
+
+					fieldTag, err := dicom.ParseTag(field)
+					if err != nil {
+						return dicom.SearchQuery{}, err
+					}
+					searchQuery.IncludeFields = append(searchQuery.IncludeFields, fieldTag)
+				}
+			}
+		case "fuzzymatching":
+			// fuzzy matching is not supported, so is ignored as permitted
+		default:
+			keyTag, err := dicom.ParseTag(key)
+			if err != nil {
+				return dicom.SearchQuery{}, err
+			}
+			searchQuery.Keys[keyTag] = query.Get(key)
+		}
+	}
+
+	return searchQuery, nil
+}
+
+// elementString utility to read the first string value of an element of a
+// dataset, or an empty string if there is none
+func elementString(dataSet *dicomutil.Dataset, t tag.Tag) string {
+	element, err := dataSet.FindElementByTag(t)
+	if err != nil {
+		return ""
+	}
+
+	values, ok := element.Value.GetValue().([]string)
+	if !ok || len(values) == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(values[0])
+}
@@ -0,0 +1,407 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"dicomviewer/dicom"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	dicomutil "github.com/suyashkumar/dicom"
+	"github.com/suyashkumar/dicom/pkg/tag"
+)
+
+// newTestElement utility to construct a DICOM element for testing
+func newTestElement(t *testing.T, elementTag tag.Tag, data interface{}) *dicomutil.Element {
+	t.Helper()
+
+	element, err := dicomutil.NewElement(elementTag, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return element
+}
+
+// newTestDICOM utility to encode a minimal DICOM file for testing, with any
+// further elements given
+func newTestDICOM(t *testing.T, studyUID, seriesUID, sopUID string, elements ...*dicomutil.Element) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	err := dicomutil.Write(&buffer, dicomutil.Dataset{
+		Elements: append([]*dicomutil.Element{
+			newTestElement(t, tag.MediaStorageSOPClassUID, []string{"1.2.840.10008.5.1.4.1.1.7"}),
+			newTestElement(t, tag.MediaStorageSOPInstanceUID, []string{sopUID}),
+			newTestElement(t, tag.TransferSyntaxUID, []string{"1.2.840.10008.1.2.1"}),
+			newTestElement(t, tag.SOPClassUID, []string{"1.2.840.10008.5.1.4.1.1.7"}),
+			newTestElement(t, tag.SOPInstanceUID, []string{sopUID}),
+			newTestElement(t, tag.Modality, []string{"OT"}),
+			newTestElement(t, tag.StudyInstanceUID, []string{studyUID}),
+			newTestElement(t, tag.SeriesInstanceUID, []string{seriesUID}),
+		}, elements...),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+// newTestFileRepository utility to construct an in-memory file repository
+// holding the files for testing
+func newTestFileRepository(t *testing.T, files map[string][]byte) dicom.FileRepository {
+	t.Helper()
+
+	repository := dicom.NewMemoryFileAdapter()
+	for id, data := range files {
+		if err := repository.Create(dicom.NewFile(id, int64(len(data)), bytes.NewReader(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repository
+}
+
+func Test_dicomWeb_Retrieve(t *testing.T) {
+	tests := []struct {
+		name       string
+		missing    string
+		wantStatus int
+		wantParts  int
+		wantErr    bool
+	}{
+		{
+			name:       "retrieves every instance of a study",
+			wantStatus: http.StatusOK,
+			wantParts:  2,
+		},
+		{
+			name:       "aborts the response when an instance cannot be read",
+			missing:    "1.1.2",
+			wantStatus: http.StatusOK,
+			wantParts:  1,
+			wantErr:    true,
+		},
+		{
+			name:       "responds with an error when the first instance cannot be read",
+			missing:    "1.1.1",
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := dicom.NewMemoryIndex()
+			files := dicom.NewMemoryFileAdapter()
+			repository := dicom.NewIndexedFileRepository(files, index)
+			for _, sopUID := range []string{"1.1.1", "1.1.2"} {
+				data := newTestDICOM(t, "1", "1.1", sopUID)
+				if err := repository.Create(dicom.NewFile(sopUID, int64(len(data)), bytes.NewReader(data))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.missing != "" {
+				if err := files.Delete(tt.missing); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			d := &dicomWeb{fileRepository: repository, metadataIndex: index}
+			router := chi.NewRouter()
+			router.Get("/studies/{study}", d.Retrieve)
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			// small responses are still buffered when the handler aborts, in
+			// which case the client sees no response at all
+			resp, err := http.Get(server.URL + "/studies/1")
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatal(err)
+				}
+				return
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Retrieve() status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parts := 0
+			reader := multipart.NewReader(resp.Body, params["boundary"])
+			for {
+				part, err := reader.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err == nil {
+					_, err = io.Copy(io.Discard, part)
+				}
+				if err != nil {
+					if !tt.wantErr {
+						t.Fatalf("Retrieve() error reading part = %v", err)
+					}
+					break
+				}
+				parts++
+			}
+
+			if err == nil && tt.wantErr {
+				t.Errorf("Retrieve() completed the response, want it aborted")
+			}
+			if parts != tt.wantParts {
+				t.Errorf("Retrieve() parts = %v, want %v", parts, tt.wantParts)
+			}
+		})
+	}
+}
+
+func Test_parseSearchQuery(t *testing.T) {
+	type args struct {
+		level dicom.QueryLevel
+		query url.Values
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    dicom.SearchQuery
+		wantErr bool
+	}{
+		{
+			name: "parses empty query",
+			args: args{
+				level: dicom.QueryLevelStudy,
+				query: url.Values{},
+			},
+			want: dicom.SearchQuery{
+				Level: dicom.QueryLevelStudy,
+				Keys:  map[tag.Tag]string{},
+			},
+		},
+		{
+			name: "parses matching keys by keyword and tag",
+			args: args{
+				level: dicom.QueryLevelStudy,
+				query: url.Values{
+					"PatientName": {"DOE*"},
+					"00080020":    {"20240101-"},
+				},
+			},
+			want: dicom.SearchQuery{
+				Level: dicom.QueryLevelStudy,
+				Keys: map[tag.Tag]string{
+					tag.PatientName: "DOE*",
+					tag.StudyDate:   "20240101-",
+				},
+			},
+		},
+		{
+			name: "parses include fields, limit and offset",
+			args: args{
+				level: dicom.QueryLevelSeries,
+				query: url.Values{
+					"includefield":  {"StudyDescription,00081030", "all"},
+					"limit":         {"10"},
+					"offset":        {"20"},
+					"fuzzymatching": {"true"},
+				},
+			},
+			want: dicom.SearchQuery{
+				Level:         dicom.QueryLevelSeries,
+				Keys:          map[tag.Tag]string{},
+				IncludeFields: []tag.Tag{tag.StudyDescription, tag.StudyDescription},
+				IncludeAll:    true,
+				Limit:         10,
+				Offset:        20,
+			},
+		},
+		{
+			name: "errors for unknown attribute",
+			args: args{
+				level: dicom.QueryLevelStudy,
+				query: url.Values{
+					"NotAnAttribute": {"1"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "errors for negative limit",
+			args: args{
+				level: dicom.QueryLevelStudy,
+				query: url.Values{
+					"limit": {"-1"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSearchQuery(tt.args.level, tt.args.query)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseSearchQuery() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSearchQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_dicomWeb_Store(t *testing.T) {
+	type args struct {
+		studyUID        string
+		parts           [][]byte
+		duplicatePolicy dicom.DuplicatePolicy
+	}
+	tests := []struct {
+		name           string
+		args           args
+		wantStatus     int
+		wantReferenced int
+		wantFailed     int
+		wantIndexed    int
+	}{
+		{
+			name: "stores every instance",
+			args: args{
+				parts: [][]byte{
+					newTestDICOM(t, "1", "1.1", "1.1.1"),
+					newTestDICOM(t, "2", "2.1", "2.1.1"),
+				},
+			},
+			wantStatus:     http.StatusOK,
+			wantReferenced: 2,
+			wantIndexed:    2,
+		},
+		{
+			name: "reports instances that are not DICOM",
+			args: args{
+				parts: [][]byte{
+					newTestDICOM(t, "1", "1.1", "1.1.1"),
+					[]byte("not a DICOM file"),
+				},
+			},
+			wantStatus:     http.StatusAccepted,
+			wantReferenced: 1,
+			wantFailed:     1,
+			wantIndexed:    1,
+		},
+		{
+			name: "rejects instances of other studies",
+			args: args{
+				studyUID: "1",
+				parts: [][]byte{
+					newTestDICOM(t, "2", "2.1", "2.1.1"),
+				},
+			},
+			wantStatus: http.StatusConflict,
+			wantFailed: 1,
+		},
+		{
+			name: "keeps duplicate instances",
+			args: args{
+				parts: [][]byte{
+					newTestDICOM(t, "1", "1.1", "1.1.1"),
+					newTestDICOM(t, "1", "1.1", "1.1.1"),
+				},
+				duplicatePolicy: dicom.DuplicateKeepBoth,
+			},
+			wantStatus:     http.StatusOK,
+			wantReferenced: 2,
+			wantIndexed:    2,
+		},
+		{
+			name: "rejects duplicate instances",
+			args: args{
+				parts: [][]byte{
+					newTestDICOM(t, "1", "1.1", "1.1.1"),
+					newTestDICOM(t, "1", "1.1", "1.1.1"),
+				},
+				duplicatePolicy: dicom.DuplicateReject,
+			},
+			wantStatus:     http.StatusAccepted,
+			wantReferenced: 1,
+			wantFailed:     1,
+			wantIndexed:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := dicom.NewMemoryIndex()
+			d := &dicomWeb{
+				fileRepository: dicom.NewIndexedFileRepository(
+					dicom.NewMemoryFileAdapter(),
+					index,
+				),
+				metadataIndex:   index,
+				duplicatePolicy: dicom.DuplicateKeepBoth,
+			}
+			if tt.args.duplicatePolicy != "" {
+				d.duplicatePolicy = tt.args.duplicatePolicy
+			}
+
+			var body bytes.Buffer
+			multipartWriter := multipart.NewWriter(&body)
+			for _, part := range tt.args.parts {
+				partWriter, _ := multipartWriter.CreatePart(textproto.MIMEHeader{
+					"Content-Type": {mediaTypeDICOM},
+				})
+				partWriter.Write(part)
+			}
+			multipartWriter.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "/studies", &body)
+			r.Header.Set(
+				"Content-Type",
+				`multipart/related; type="application/dicom"; boundary=`+multipartWriter.Boundary(),
+			)
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("study", tt.args.studyUID)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+
+			w := httptest.NewRecorder()
+			d.Store(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Store() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+
+			var response dicom.JSONDataset
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(response[dicom.JSONTagKey(tag.ReferencedSOPSequence)].Value); got != tt.wantReferenced {
+				t.Errorf("Store() referenced = %v, want %v", got, tt.wantReferenced)
+			}
+			if got := len(response[dicom.JSONTagKey(tag.FailedSOPSequence)].Value); got != tt.wantFailed {
+				t.Errorf("Store() failed = %v, want %v", got, tt.wantFailed)
+			}
+
+			indexed, _ := index.Find(dicom.InstanceUIDs{})
+			if len(indexed) != tt.wantIndexed {
+				t.Errorf("Store() indexed = %v, want %v", len(indexed), tt.wantIndexed)
+			}
+		})
+	}
+}
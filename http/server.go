@@ -14,6 +14,8 @@ const DefaultPort = "3000"
 
 type Server struct {
 	dicomFiles *dicomFiles
+	dicomWeb   *dicomWeb
+	studies    *studies
 	router     chi.Router
 
 	port string
@@ -21,7 +23,12 @@ type Server struct {
 
 // ServerOptions options when instantiating a server
 type ServerOptions struct {
-	port string
+	port            string
+	fileRepository  dicom.FileRepository
+	metadataIndex   dicom.MetadataIndex
+	pseudonymizer   *dicom.Pseudonymizer
+	redactTemplates []dicom.RedactTemplate
+	duplicatePolicy dicom.DuplicatePolicy
 }
 
 // UsePort option to specify a port for the server to listen on
@@ -31,20 +38,108 @@ func UsePort(port string) func(opts *ServerOptions) {
 	}
 }
 
+// UseFileRepository option to specify the repository DICOM files are stored
+// in. The repository should add created files to the metadata index specified
+// with UseMetadataIndex. Repositories which do not list files by study are
+// indexed by the server
+func UseFileRepository(fileRepository dicom.FileRepository) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.fileRepository = fileRepository
+	}
+}
+
+// UseMetadataIndex option to specify the index searched for DICOM files
+func UseMetadataIndex(metadataIndex dicom.MetadataIndex) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.metadataIndex = metadataIndex
+	}
+}
+
+// UsePseudonymizer option to specify the pseudonymizer remapping UIDs and
+// identifiers when anonymizing files, so that they remain consistent across
+// restarts. Defaults to a pseudonymizer with a random key
+func UsePseudonymizer(pseudonymizer *dicom.Pseudonymizer) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.pseudonymizer = pseudonymizer
+	}
+}
+
+// UseRedactTemplates option to specify the templates of burned in annotation
+// regions applied when redacting files from a matching manufacturer and model
+func UseRedactTemplates(templates ...dicom.RedactTemplate) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.redactTemplates = templates
+	}
+}
+
+// UseDuplicatePolicy option to specify the policy applied to uploaded files
+// duplicating a stored file. Defaults to keeping both files
+func UseDuplicatePolicy(policy dicom.DuplicatePolicy) func(opts *ServerOptions) {
+	return func(opts *ServerOptions) {
+		opts.duplicatePolicy = policy
+	}
+}
+
 // NewServer constructs a new application server
-func NewServer(options ...func(opts *ServerOptions)) *Server {
+func NewServer(options ...func(opts *ServerOptions)) (*Server, error) {
 
 	var opts = ServerOptions{
-		port: DefaultPort,
+		port:            DefaultPort,
+		duplicatePolicy: dicom.DuplicateKeepBoth,
 	}
 
 	for _, optFn := range options {
 		optFn(&opts)
 	}
 
+	if opts.metadataIndex == nil {
+		opts.metadataIndex = dicom.NewMemoryIndex()
+	}
+
+	if opts.fileRepository == nil {
+		localFileRepository := dicom.NewLocalFileAdapter()
+		if err := dicom.RebuildIndex(localFileRepository, opts.metadataIndex); err != nil {
+			slog.Error(fmt.Sprintf("failed to index existing files: %s", err))
+		}
+
+		opts.fileRepository = dicom.NewIndexedFileRepository(
+			localFileRepository,
+			opts.metadataIndex,
+		)
+	}
+
+	if opts.pseudonymizer == nil {
+		pseudonymizer, err := dicom.NewRandomPseudonymizer()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate pseudonymizer key: %w", err)
+		}
+		opts.pseudonymizer = pseudonymizer
+	}
+
+	studyRepository, ok := opts.fileRepository.(dicom.StudyRepository)
+	if !ok {
+		studyRepository = dicom.NewIndexedFileRepository(
+			opts.fileRepository,
+			opts.metadataIndex,
+		)
+		opts.fileRepository = studyRepository
+	}
+
 	service := &Server{
 		dicomFiles: &dicomFiles{
-			fileRepository: dicom.NewLocalFileAdapter(),
+			fileRepository:  opts.fileRepository,
+			metadataIndex:   opts.metadataIndex,
+			pseudonymizer:   opts.pseudonymizer,
+			redactTemplates: opts.redactTemplates,
+			duplicatePolicy: opts.duplicatePolicy,
+		},
+		dicomWeb: &dicomWeb{
+			fileRepository:  opts.fileRepository,
+			metadataIndex:   opts.metadataIndex,
+			duplicatePolicy: opts.duplicatePolicy,
+		},
+		studies: &studies{
+			studyRepository: studyRepository,
 		},
 		router: chi.NewRouter(),
 		port:   opts.port,
@@ -52,7 +147,7 @@ func NewServer(options ...func(opts *ServerOptions)) *Server {
 
 	service.registerRoutes()
 
-	return service
+	return service, nil
 }
 
 func (s *Server) registerRoutes() {
@@ -73,14 +168,103 @@ func (s *Server) registerRoutes() {
 					// GET /api/v1/files/{id}
 					filesByID.Get("/", s.dicomFiles.GetByID)
 
+					// PUT /api/v1/files/{id}
+					filesByID.Put("/", s.dicomFiles.Update)
+
+					// DELETE /api/v1/files/{id}
+					filesByID.Delete("/", s.dicomFiles.Delete)
+
+					// POST /api/v1/files/{id}/restore
+					filesByID.Post("/restore", s.dicomFiles.Restore)
+
 					// GET /api/v1/files/{id}/png
 					filesByID.Get("/png", s.dicomFiles.GetAsPNG)
 
+					filesByID.Route("/frames", func(frames chi.Router) {
+
+						// GET /api/v1/files/{id}/frames
+						frames.Get("/", s.dicomFiles.GetFrames)
+
+						// GET /api/v1/files/{id}/frames/{n}/png
+						frames.Get("/{n}/png", s.dicomFiles.GetFrameAsPNG)
+
+						// GET /api/v1/files/{id}/frames/{n}/values
+						frames.Get("/{n}/values", s.dicomFiles.GetPixelValue)
+					})
+
 					// GET /api/v1/files/{id}/attributes
 					filesByID.Get("/attributes", s.dicomFiles.SearchAttributes)
+
+					// POST /api/v1/files/{id}/anonymize
+					filesByID.Post("/anonymize", s.dicomFiles.Anonymize)
+
+					// POST /api/v1/files/{id}/redact
+					filesByID.Post("/redact", s.dicomFiles.Redact)
 				})
 
 			})
+
+			apiV1.Route("/studies", func(studies chi.Router) {
+
+				// GET /api/v1/studies
+				studies.Get("/", s.studies.GetAll)
+
+				// DELETE /api/v1/studies/{study}
+				studies.Delete("/{study}", s.studies.DeleteStudy)
+
+				// GET /api/v1/studies/{study}/series
+				studies.Get("/{study}/series", s.studies.GetSeries)
+
+				// DELETE /api/v1/studies/{study}/series/{series}
+				studies.Delete("/{study}/series/{series}", s.studies.DeleteSeries)
+
+				// GET /api/v1/studies/{study}/series/{series}/instances
+				studies.Get("/{study}/series/{series}/instances", s.studies.GetInstances)
+			})
+		})
+	})
+
+	// DICOMweb WADO-RS and QIDO-RS
+
+	// GET /studies
+	s.router.Get("/studies", s.dicomWeb.SearchStudies)
+
+	// POST /studies
+	s.router.Post("/studies", s.dicomWeb.Store)
+
+	s.router.Route("/studies/{study}", func(study chi.Router) {
+
+		// GET /studies/{study}
+		study.Get("/", s.dicomWeb.Retrieve)
+
+		// POST /studies/{study}
+		study.Post("/", s.dicomWeb.Store)
+
+		// GET /studies/{study}/metadata
+		study.Get("/metadata", s.dicomWeb.RetrieveMetadata)
+
+		// GET /studies/{study}/series
+		study.Get("/series", s.dicomWeb.SearchSeries)
+
+		study.Route("/series/{series}", func(series chi.Router) {
+
+			// GET /studies/{study}/series/{series}
+			series.Get("/", s.dicomWeb.Retrieve)
+
+			// GET /studies/{study}/series/{series}/metadata
+			series.Get("/metadata", s.dicomWeb.RetrieveMetadata)
+
+			// GET /studies/{study}/series/{series}/instances
+			series.Get("/instances", s.dicomWeb.SearchInstances)
+
+			series.Route("/instances/{sop}", func(instance chi.Router) {
+
+				// GET /studies/{study}/series/{series}/instances/{sop}
+				instance.Get("/", s.dicomWeb.Retrieve)
+
+				// GET /studies/{study}/series/{series}/instances/{sop}/metadata
+				instance.Get("/metadata", s.dicomWeb.RetrieveMetadata)
+			})
 		})
 	})
 }
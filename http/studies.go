@@ -0,0 +1,173 @@
+package http
+
+import (
+	"dicomviewer/dicom"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// studies contains a set of http handlers for navigating DICOM files by the
+// study and series they belong to
+type studies struct {
+	studyRepository dicom.StudyRepository
+}
+
+// GetAll an http handler to list every study
+func (s *studies) GetAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	studies, err := s.studyRepository.ListStudies()
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	type Response struct {
+		Studies []dicom.Study `json:"studies"`
+	}
+
+	if studies == nil {
+		studies = []dicom.Study{}
+	}
+
+	writeJSONResponse(w, Response{
+		Studies: studies,
+	})
+}
+
+// GetSeries an http handler to list the series of a study
+func (s *studies) GetSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	studyUID, err := parseURLParam(r, "study")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	series, err := s.studyRepository.ListSeries(studyUID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, hierarchyErrorStatus(err), err)
+		return
+	}
+
+	type Response struct {
+		Series []dicom.Series `json:"series"`
+	}
+
+	writeJSONResponse(w, Response{
+		Series: series,
+	})
+}
+
+// GetInstances an http handler to list the instances of a series of a study.
+// The file ID of each instance can be used with the /api/v1/files routes
+func (s *studies) GetInstances(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	studyUID, err := parseURLParam(r, "study")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	seriesUID, err := parseURLParam(r, "series")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	instances, err := s.studyRepository.ListInstances(studyUID, seriesUID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, hierarchyErrorStatus(err), err)
+		return
+	}
+
+	type Response struct {
+		Instances []dicom.Instance `json:"instances"`
+	}
+
+	writeJSONResponse(w, Response{
+		Instances: instances,
+	})
+}
+
+// DeleteStudy an http handler to delete every file of a study, moving them to
+// the trash from which they can be restored
+func (s *studies) DeleteStudy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	studyUID, err := parseURLParam(r, "study")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fileIDs, err := s.studyRepository.DeleteStudy(studyUID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, hierarchyErrorStatus(err), err)
+		return
+	}
+
+	type Response struct {
+		FileIDs []string `json:"fileIds"`
+	}
+
+	writeJSONResponse(w, Response{
+		FileIDs: fileIDs,
+	})
+}
+
+// DeleteSeries an http handler to delete every file of a series of a study,
+// moving them to the trash from which they can be restored
+func (s *studies) DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	studyUID, err := parseURLParam(r, "study")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	seriesUID, err := parseURLParam(r, "series")
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fileIDs, err := s.studyRepository.DeleteSeries(studyUID, seriesUID)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error())
+		writeJSONError(w, hierarchyErrorStatus(err), err)
+		return
+	}
+
+	type Response struct {
+		FileIDs []string `json:"fileIds"`
+	}
+
+	writeJSONResponse(w, Response{
+		FileIDs: fileIDs,
+	})
+}
+
+// hierarchyErrorStatus utility to determine the http status of an error
+// listing the studies, series or instances of a repository
+func hierarchyErrorStatus(err error) int {
+	if errors.Is(err, dicom.ErrStudyNotFound) || errors.Is(err, dicom.ErrSeriesNotFound) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
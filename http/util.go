@@ -1,9 +1,15 @@
 package http
 
 import (
+	"dicomviewer/dicom"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -17,6 +23,20 @@ func parseURLParam(r *http.Request, key string) (string, error) {
 	return value, nil
 }
 
+func parseIntURLParam(r *http.Request, key string) (int, error) {
+	value, err := parseURLParam(r, key)
+	if err != nil {
+		return 0, err
+	}
+
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("url param %s is not an integer", key)
+	}
+
+	return intValue, nil
+}
+
 func writeJSONResponse(w http.ResponseWriter, i interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(i)
@@ -34,3 +54,88 @@ func writeJSONError(w http.ResponseWriter, httpStatusCode int, err error) error
 
 	return json.NewEncoder(w).Encode(errorResp)
 }
+
+// acceptsMediaType utility to determine whether the request's Accept header
+// allows any of the given media types. Requests without an Accept header
+// accept any media type
+func acceptsMediaType(r *http.Request, mediaTypes ...string) bool {
+	if len(r.Header.Values("Accept")) == 0 {
+		return true
+	}
+
+	for _, acceptedMediaType := range acceptedMediaTypes(r) {
+		if acceptedMediaType == "*/*" {
+			return true
+		}
+		for _, mediaType := range mediaTypes {
+			if acceptedMediaType == mediaType {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// requestsMediaType utility to determine whether the request's Accept header
+// explicitly names any of the given media types, rather than allowing them
+// by wildcard or by omission
+func requestsMediaType(r *http.Request, mediaTypes ...string) bool {
+	for _, acceptedMediaType := range acceptedMediaTypes(r) {
+		for _, mediaType := range mediaTypes {
+			if acceptedMediaType == mediaType {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// acceptedMediaTypes utility to parse the media types listed by the request's
+// Accept headers, ignoring any parameters
+func acceptedMediaTypes(r *http.Request) []string {
+	var mediaTypes []string
+	for _, header := range r.Header.Values("Accept") {
+		for _, acceptedType := range strings.Split(header, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(acceptedType))
+			if err != nil {
+				continue
+			}
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+
+	return mediaTypes
+}
+
+// writeDICOMJSONResponse utility to write a DICOM JSON response of one or more
+// datasets
+func writeDICOMJSONResponse(w http.ResponseWriter, httpStatusCode int, i interface{}) error {
+	w.Header().Set("Content-Type", mediaTypeDICOMJSON)
+	w.WriteHeader(httpStatusCode)
+	return json.NewEncoder(w).Encode(i)
+}
+
+// writeDICOMXMLResponse utility to write a Native DICOM Model XML response of
+// a dataset
+func writeDICOMXMLResponse(w http.ResponseWriter, httpStatusCode int, dataset dicom.XMLDataset) error {
+	w.Header().Set("Content-Type", mediaTypeDICOMXML)
+	w.WriteHeader(httpStatusCode)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(dataset)
+}
+
+// requestBaseURL utility to determine the scheme and host the request was
+// made to, for building absolute URLs in responses
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_acceptsMediaType(t *testing.T) {
+	type args struct {
+		accept     []string
+		mediaTypes []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "accepts any media type without accept header",
+			args: args{
+				mediaTypes: []string{"application/dicom"},
+			},
+			want: true,
+		},
+		{
+			name: "accepts wildcard media type",
+			args: args{
+				accept:     []string{"*/*"},
+				mediaTypes: []string{"application/dicom"},
+			},
+			want: true,
+		},
+		{
+			name: "accepts matching media type with parameters",
+			args: args{
+				accept:     []string{`multipart/related; type="application/dicom"`},
+				mediaTypes: []string{"multipart/related"},
+			},
+			want: true,
+		},
+		{
+			name: "accepts matching media type from list",
+			args: args{
+				accept:     []string{"image/png, application/dicom+json;q=0.9"},
+				mediaTypes: []string{"application/dicom+json"},
+			},
+			want: true,
+		},
+		{
+			name: "rejects non-matching media type",
+			args: args{
+				accept:     []string{"image/png"},
+				mediaTypes: []string{"application/dicom+json"},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/", nil)
+			for _, accept := range tt.args.accept {
+				r.Header.Add("Accept", accept)
+			}
+			if got := acceptsMediaType(r, tt.args.mediaTypes...); got != tt.want {
+				t.Errorf("acceptsMediaType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_requestsMediaType(t *testing.T) {
+	type args struct {
+		accept     []string
+		mediaTypes []string
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{
+			name: "does not request media types without accept header",
+			args: args{
+				mediaTypes: []string{"application/dicom+json"},
+			},
+			want: false,
+		},
+		{
+			name: "does not request media types by wildcard",
+			args: args{
+				accept:     []string{"*/*"},
+				mediaTypes: []string{"application/dicom+json"},
+			},
+			want: false,
+		},
+		{
+			name: "requests matching media type from list",
+			args: args{
+				accept:     []string{"application/json, application/dicom+json;q=0.9"},
+				mediaTypes: []string{"application/dicom+json"},
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/", nil)
+			for _, accept := range tt.args.accept {
+				r.Header.Add("Accept", accept)
+			}
+			if got := requestsMediaType(r, tt.args.mediaTypes...); got != tt.want {
+				t.Errorf("requestsMediaType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}